@@ -4,7 +4,9 @@
 package auth
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"time"
 
 	redis "gopkg.in/redis.v5"
@@ -110,3 +112,11 @@ func (r *Redis) GetToken(gatewayID string) (string, error) {
 func (r *Redis) SetExchanger(e Exchanger) {
 	r.Exchanger = e
 }
+
+// Validate checks that Redis can be reached
+func (r *Redis) Validate(ctx context.Context) error {
+	if err := r.client.Ping().Err(); err != nil {
+		return fmt.Errorf("auth: could not reach Redis: %w", err)
+	}
+	return nil
+}
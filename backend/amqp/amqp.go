@@ -4,18 +4,22 @@
 package amqp
 
 import (
+	"context"
 	"crypto/tls"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
 	"os"
 	"os/user"
 	"sync"
 	"time"
 
-	"github.com/TheThingsNetwork/api/gateway"
-	"github.com/TheThingsNetwork/api/router"
 	"github.com/TheThingsNetwork/api/trace"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/backend"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/events"
 	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
+	"github.com/TheThingsNetwork/go-utils/backoff"
 	"github.com/apex/log"
 	"github.com/gogo/protobuf/proto"
 	"github.com/streadway/amqp"
@@ -43,6 +47,18 @@ func New(config Config, ctx log.Interface) (*AMQP, error) {
 		}
 	}
 
+	if config.PrefetchCount <= 0 {
+		config.PrefetchCount = 1
+	}
+
+	if config.Consumers <= 0 {
+		config.Consumers = 1
+	}
+
+	if config.PayloadTransformer == nil {
+		config.PayloadTransformer = backend.RawPayload
+	}
+
 	amqp.ctx = ctx.WithField("Connector", "AMQP")
 	amqp.config = config
 	amqp.publish.ch = make(chan publishMessage, BufferSize)
@@ -55,13 +71,16 @@ func New(config Config, ctx log.Interface) (*AMQP, error) {
 // BufferSize indicates the maximum number of AMQP messages that should be buffered
 var BufferSize = 10
 
-// Routing Key formats for connect, disconnect, uplink, downlink and status messages
+// Routing Key formats for connect, connect response, disconnect, uplink, downlink, downlink acknowledgement and
+// status messages
 var (
-	ConnectRoutingKeyFormat    = "connect"
-	DisconnectRoutingKeyFormat = "disconnect"
-	UplinkRoutingKeyFormat     = "%s.up"
-	DownlinkRoutingKeyFormat   = "%s.down"
-	StatusRoutingKeyFormat     = "%s.status"
+	ConnectRoutingKeyFormat         = "connect"
+	ConnectResponseRoutingKeyFormat = "%s.connect.response"
+	DisconnectRoutingKeyFormat      = "disconnect"
+	UplinkRoutingKeyFormat          = "%s.up"
+	DownlinkRoutingKeyFormat        = "%s.down"
+	DownlinkAckRoutingKeyFormat     = "%s.down.ack"
+	StatusRoutingKeyFormat          = "%s.status"
 )
 
 // Config contains configuration for AMQP
@@ -74,6 +93,47 @@ type Config struct {
 	QueuePrefix    string
 	ConsumerPrefix string
 	TLSConfig      *tls.Config
+
+	// PrefetchCount is the number of unacknowledged deliveries the broker sends per subscription (default 1).
+	// Higher values increase throughput, but also the number of messages that are held in memory.
+	PrefetchCount int
+
+	// Consumers is the number of goroutines that handle deliveries per subscription (default 1).
+	// With more than one consumer, messages of a subscription may be handled out of order.
+	// It is not useful to set this higher than PrefetchCount.
+	Consumers int
+
+	// DeadLetterExchange is the exchange that messages that can not be handled are dead-lettered to by the broker.
+	// If set, the queues of the bridge are declared with this dead-letter exchange (and DeadLetterRoutingKey if set).
+	// Note that queues that already exist without these arguments must be deleted before this can be used.
+	DeadLetterExchange   string
+	DeadLetterRoutingKey string
+
+	// MaxRedeliveries is the number of times a message that can not be handled is requeued before it is dead-lettered.
+	MaxRedeliveries int
+
+	// PayloadTransformer transforms the LoRaWAN payload of published downlink messages, and reverses this for
+	// received uplink messages. Defaults to backend.RawPayload.
+	PayloadTransformer backend.PayloadTransformer
+
+	// ConnectTimeout is the total time during which the initial connection is retried, waiting between attempts
+	// according to ConnectBackoff. If zero, the connection is retried ConnectRetries times in the background.
+	ConnectTimeout time.Duration
+	ConnectBackoff backoff.Config
+
+	// PublishTimeout is the time that a publish waits for room in the publish buffer before it returns
+	// backend.ErrPublishTimeout. The message is then not published. Messages that are still in the buffer after the
+	// timeout (for example while the publish channel is recreated) are dropped as well. If zero, messages are
+	// dropped immediately if the buffer is full, and messages in the buffer do not expire.
+	PublishTimeout time.Duration
+
+	// DownlinkAcks enables publishing the acknowledgements of downlink messages that the bridge receives from
+	// gateways (see PublishDownlinkAck).
+	DownlinkAcks bool
+
+	// Events receives BackendDisconnected and BackendReconnected events when the connection to the broker is lost
+	// and restored. It may be nil.
+	Events *events.Notifier
 }
 
 func (c Config) url() (url string) {
@@ -99,11 +159,21 @@ func (c Config) url() (url string) {
 type publishMessage struct {
 	routingKey string
 	message    []byte
+	headers    amqp.Table
+	deadline   time.Time // after which the message is not published, zero if it does not expire
 }
 
 type subscribeMessage struct {
 	routingKey string
 	message    []byte
+	result     chan<- error
+}
+
+// done reports the result of handling the message
+func (m subscribeMessage) done(err error) {
+	if m.result != nil {
+		m.result <- err
+	}
 }
 
 type subscription struct {
@@ -129,7 +199,8 @@ type AMQP struct {
 		*amqp.Connection
 		sync.RWMutex
 		sync.WaitGroup
-		once sync.Once
+		once    sync.Once
+		stopped error // why the connection is not restored anymore
 	}
 	publish struct {
 		ch      chan publishMessage
@@ -139,6 +210,7 @@ type AMQP struct {
 	}
 	subscriptions    map[string]*subscription
 	subscriptionLock sync.RWMutex
+	redeliveries     redeliveries
 }
 
 var (
@@ -197,17 +269,27 @@ func (c *AMQP) setup() (err error) {
 	return nil
 }
 
-// Connect to AMQP
+// Connect to AMQP. If a ConnectTimeout is configured, Connect blocks until the initial connection is established
+// and returns an error if that did not succeed within the timeout. Otherwise it connects in the background.
 func (c *AMQP) Connect() error {
-	go c.autoReconnect()
+	if c.config.ConnectTimeout > 0 {
+		if err := backend.RetryConnect(c.ctx, c.config.ConnectTimeout, c.config.ConnectBackoff, c.connect); err != nil {
+			c.stop(err)
+			return fmt.Errorf("Could not connect to AMQP (%s)", err)
+		}
+		go c.autoReconnect(true)
+		return nil
+	}
+	go c.autoReconnect(false)
 	return nil
 }
 
-// AutoReconnect connects to AMQP and automatically reconnects when the connection is lost
-func (c *AMQP) autoReconnect() (err error) {
+// AutoReconnect connects to AMQP (unless already connected) and automatically reconnects when the connection is lost
+func (c *AMQP) autoReconnect(connected bool) (err error) {
+	var lost bool
 	for {
 		retries := ConnectRetries
-		for {
+		for !connected {
 			err = c.connect()
 			if err == nil {
 				break // Connected, break without err
@@ -222,8 +304,13 @@ func (c *AMQP) autoReconnect() (err error) {
 		if err != nil {
 			break // Unable to connect, stop trying
 		}
+		connected = false
 
 		c.ctx.Info("Connected")
+		if lost {
+			c.config.Events.Emit(events.Event{Kind: events.BackendReconnected, Source: "amqp", Message: "Reconnected to AMQP"})
+			lost = false
+		}
 
 		// Monitor the connection and reconnect on error
 		ch := make(chan *amqp.Error)
@@ -234,22 +321,75 @@ func (c *AMQP) autoReconnect() (err error) {
 			break
 		}
 		c.ctx.WithError(err).Warn("Connection closed")
+		c.config.Events.Emit(events.Event{Kind: events.BackendDisconnected, Source: "amqp", Message: err.Error()})
+		lost = true
 		time.Sleep(ConnectRetryDelay)
 	}
 	if err != nil {
 		c.ctx.WithError(err).Error("Could not connect")
+		c.stop(err)
 	} else {
 		c.ctx.Info("Connection closed")
+		c.stop(errConnectionClosed)
 	}
 	return
 }
 
+var errConnectionClosed = errors.New("connection closed")
+
+// stop records that the connection is not restored anymore
+func (c *AMQP) stop(err error) {
+	c.connection.Lock()
+	defer c.connection.Unlock()
+	c.connection.stopped = err
+}
+
 // Disconnect from AMQP
 func (c *AMQP) Disconnect() error {
 	c.connection.Wait()
 	return c.connection.Close()
 }
 
+// Validate checks that the AMQP broker can be reached. It does not connect the client.
+func (c *AMQP) Validate(ctx context.Context) error {
+	address := c.config.Address
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		port := "5672"
+		if c.config.TLSConfig != nil {
+			port = "5671"
+		}
+		address = net.JoinHostPort(address, port)
+	}
+	if err := backend.Dial(ctx, address); err != nil {
+		return fmt.Errorf("amqp: could not reach broker: %w", err)
+	}
+	return nil
+}
+
+// HealthCheck returns an error if the client is not connected to the broker, or if it can not open a channel
+func (c *AMQP) HealthCheck(ctx context.Context) error {
+	c.connection.RLock()
+	conn, stopped := c.connection.Connection, c.connection.stopped
+	c.connection.RUnlock()
+	switch {
+	case stopped != nil:
+		return fmt.Errorf("%w: amqp: %w", backend.ErrFatal, stopped)
+	case conn == nil:
+		return fmt.Errorf("%w: amqp: not connected yet", backend.ErrTransient)
+	}
+	err := backend.CheckWithContext(ctx, func() error {
+		channel, err := conn.Channel()
+		if err != nil {
+			return err
+		}
+		return channel.Close()
+	})
+	if err != nil {
+		return fmt.Errorf("%w: amqp: could not open channel: %w", backend.ErrTransient, err)
+	}
+	return nil
+}
+
 func (c *AMQP) autoRecreatePublishChannel() (err error) {
 	var channel *amqp.Channel
 	for {
@@ -291,10 +431,16 @@ func (c *AMQP) autoRecreatePublishChannel() (err error) {
 					break handle
 				}
 				ctx := c.ctx.WithField("RoutingKey", msg.routingKey)
+				if !msg.deadline.IsZero() && time.Now().After(msg.deadline) {
+					backend.PublishTimedOut("amqp")
+					ctx.Warn("Not publishing message [publish timeout]")
+					continue
+				}
 				err := c.publish.channel.Publish(c.config.ExchangeName, msg.routingKey, false, false, amqp.Publishing{
 					DeliveryMode: amqp.Persistent,
 					Timestamp:    time.Now(),
 					ContentType:  "application/octet-stream",
+					Headers:      msg.headers,
 					Body:         msg.message,
 				})
 				if err != nil {
@@ -318,17 +464,44 @@ func (c *AMQP) autoRecreatePublishChannel() (err error) {
 	return
 }
 
-// Publish a message to a routing key
+// Publish a message to a routing key. Messages are published to the broker in the background.
 func (c *AMQP) Publish(routingKey string, message []byte) error {
+	return c.enqueue(publishMessage{routingKey: routingKey, message: message})
+}
+
+// attributeHeaders returns the attributes of a message as AMQP message headers, or nil if there are none
+func attributeHeaders(attributes map[string]string) amqp.Table {
+	if len(attributes) == 0 {
+		return nil
+	}
+	headers := make(amqp.Table, len(attributes))
+	for key, value := range attributes {
+		headers[key] = value
+	}
+	return headers
+}
+
+func (c *AMQP) enqueue(msg publishMessage) error {
 	c.publish.once.Do(func() {
 		go c.autoRecreatePublishChannel()
 	})
+	if c.config.PublishTimeout <= 0 {
+		select {
+		case c.publish.ch <- msg:
+		default:
+			c.ctx.Warn("Not publishing message [buffer full]")
+		}
+		return nil
+	}
+	ctx, cancel := backend.PublishContext(c.config.PublishTimeout)
+	defer cancel()
+	msg.deadline, _ = ctx.Deadline()
 	select {
-	case c.publish.ch <- publishMessage{routingKey: routingKey, message: message}:
-	default:
-		c.ctx.Warn("Not publishing message [buffer full]")
+	case c.publish.ch <- msg:
+		return nil
+	case <-ctx.Done():
+		return backend.PublishTimedOut("amqp")
 	}
-	return nil
 }
 
 func (c *AMQP) subscribe(routingKey string) (chan subscribeMessage, error) {
@@ -339,7 +512,7 @@ func (c *AMQP) subscribe(routingKey string) (chan subscribeMessage, error) {
 	}
 	defer channel.Close()
 	queueName := fmt.Sprintf("%s.%s", c.config.QueuePrefix, routingKey)
-	if _, err := channel.QueueDeclare(queueName, true, false, false, false, nil); err != nil {
+	if _, err := channel.QueueDeclare(queueName, true, false, false, false, c.queueArgs()); err != nil {
 		return nil, err
 	}
 	if err := channel.QueueBind(queueName, routingKey, c.config.ExchangeName, false, nil); err != nil {
@@ -388,7 +561,7 @@ func (c *AMQP) subscribe(routingKey string) (chan subscribeMessage, error) {
 			ch := make(chan *amqp.Error)
 			channel.NotifyClose(ch)
 
-			err = channel.Qos(1, 0, false)
+			err = channel.Qos(c.config.PrefetchCount, 0, false)
 			if err != nil {
 				break
 			}
@@ -399,23 +572,34 @@ func (c *AMQP) subscribe(routingKey string) (chan subscribeMessage, error) {
 				break
 			}
 
-		handle:
-			for {
-				select {
-				case amqpErr, hasErr := <-ch:
-					if hasErr {
-						err = errors.New(amqpErr.Error())
-						break handle
-					}
-					break handle
-				case msg, ok := <-subscribe:
-					if !ok {
-						break handle
+			var consumers sync.WaitGroup
+			for i := 0; i < c.config.Consumers; i++ {
+				consumers.Add(1)
+				go func() {
+					defer consumers.Done()
+					for msg := range subscribe {
+						inFlightDeliveries.Inc()
+						ctx.Debug("Receiving message")
+						result := make(chan error, 1)
+						subscribeMessages <- subscribeMessage{routingKey: msg.RoutingKey, message: msg.Body, result: result}
+						c.settle(ctx, msg, <-result)
+						inFlightDeliveries.Dec()
 					}
-					ctx.Debug("Receiving message")
-					subscribeMessages <- subscribeMessage{routingKey: msg.RoutingKey, message: msg.Body}
-					msg.Ack(false)
+				}()
+			}
+			consumersDone := make(chan struct{})
+			go func() {
+				consumers.Wait()
+				close(consumersDone)
+			}()
+
+			select {
+			case amqpErr, hasErr := <-ch:
+				if hasErr {
+					err = errors.New(amqpErr.Error())
 				}
+				<-consumersDone
+			case <-consumersDone:
 			}
 			if err == nil {
 				break
@@ -467,18 +651,20 @@ func (c *AMQP) SubscribeConnect() (<-chan *types.ConnectMessage, error) {
 	}
 	go func() {
 		for msg := range connect {
-			var connect types.ConnectMessage
-			if err := proto.Unmarshal(msg.message, &connect); err != nil {
+			connect, err := types.ParseConnect(msg.message)
+			if err != nil {
 				c.ctx.WithError(err).Warn("Could not unmarshal connect message")
+				msg.done(err)
 				continue
 			}
 			ctx := c.ctx.WithField("GatewayID", connect.GatewayID)
 			select {
-			case messages <- &connect:
+			case messages <- connect:
 				ctx.WithField("ProtoSize", len(msg.message)).Debug("Received connect message")
 			default:
 				ctx.Warn("Could not handle connect message: buffer full")
 			}
+			msg.done(nil)
 		}
 		close(messages)
 	}()
@@ -499,18 +685,20 @@ func (c *AMQP) SubscribeDisconnect() (<-chan *types.DisconnectMessage, error) {
 	}
 	go func() {
 		for msg := range disconnect {
-			var disconnect types.DisconnectMessage
-			if err := proto.Unmarshal(msg.message, &disconnect); err != nil {
+			disconnect, err := types.ParseDisconnect(msg.message)
+			if err != nil {
 				c.ctx.WithError(err).Warn("Could not unmarshal disconnect message")
+				msg.done(err)
 				continue
 			}
 			ctx := c.ctx.WithField("GatewayID", disconnect.GatewayID)
 			select {
-			case messages <- &disconnect:
+			case messages <- disconnect:
 				ctx.WithField("ProtoSize", len(msg.message)).Debug("Received disconnect message")
 			default:
 				ctx.Warn("Could not handle disconnect message: buffer full")
 			}
+			msg.done(nil)
 		}
 		close(messages)
 	}()
@@ -532,21 +720,33 @@ func (c *AMQP) SubscribeUplink(gatewayID string) (<-chan *types.UplinkMessage, e
 	}
 	go func() {
 		for msg := range uplink {
+			message, err := types.ParseUplink(msg.message)
+			if err != nil {
+				ctx.WithError(err).Warn("Could not unmarshal uplink message")
+				msg.done(err)
+				continue
+			}
 			uplink := types.UplinkMessage{
 				GatewayID: gatewayID,
-				Message:   new(router.UplinkMessage),
+				Message:   message,
 			}
-			if err := proto.Unmarshal(msg.message, uplink.Message); err != nil {
-				ctx.WithError(err).Warn("Could not unmarshal uplink message")
+			payload, err := c.config.PayloadTransformer.Decode(uplink.Message.Payload)
+			if err != nil {
+				ctx.WithError(err).Warn("Could not decode uplink payload")
+				msg.done(err)
 				continue
 			}
-			uplink.Message.Trace = uplink.Message.Trace.WithEvent(trace.ReceiveEvent, "backend", "amqp")
+			uplink.Message.Payload = payload
+			if types.Tracing(types.TraceBasic) {
+				uplink.Message.Trace = uplink.Message.Trace.WithEvent(trace.ReceiveEvent, "backend", "amqp")
+			}
 			select {
 			case messages <- &uplink:
 				ctx.WithField("ProtoSize", len(msg.message)).Debug("Received uplink message")
 			default:
 				ctx.Warn("Could not handle uplink message: buffer full")
 			}
+			msg.done(nil)
 		}
 		close(messages)
 	}()
@@ -568,14 +768,16 @@ func (c *AMQP) SubscribeStatus(gatewayID string) (<-chan *types.StatusMessage, e
 	}
 	go func() {
 		for msg := range status {
+			message, err := types.ParseStatus(msg.message)
+			if err != nil {
+				ctx.WithError(err).Warn("Could not unmarshal status message")
+				msg.done(err)
+				continue
+			}
 			status := types.StatusMessage{
 				Backend:   "AMQP",
 				GatewayID: gatewayID,
-				Message:   new(gateway.Status),
-			}
-			if err := proto.Unmarshal(msg.message, status.Message); err != nil {
-				ctx.WithError(err).Warn("Could not unmarshal uplink message")
-				continue
+				Message:   message,
 			}
 			select {
 			case messages <- &status:
@@ -583,6 +785,7 @@ func (c *AMQP) SubscribeStatus(gatewayID string) (<-chan *types.StatusMessage, e
 			default:
 				ctx.Warn("Could not handle status message: buffer full")
 			}
+			msg.done(nil)
 		}
 		close(messages)
 	}()
@@ -599,14 +802,52 @@ func (c *AMQP) PublishDownlink(message *types.DownlinkMessage) error {
 	ctx := c.ctx.WithField("GatewayID", message.GatewayID)
 	downlink := *message.Message
 	downlink.Trace = nil
+	payload, err := c.config.PayloadTransformer.Encode(downlink.Payload)
+	if err != nil {
+		return err
+	}
+	downlink.Payload = payload
 	msg, err := proto.Marshal(&downlink)
 	if err != nil {
 		return err
 	}
-	err = c.Publish(fmt.Sprintf(DownlinkRoutingKeyFormat, message.GatewayID), msg)
+	err = c.enqueue(publishMessage{
+		routingKey: fmt.Sprintf(DownlinkRoutingKeyFormat, message.GatewayID),
+		message:    msg,
+		headers:    attributeHeaders(message.Attributes),
+	})
 	if err != nil {
 		return err
 	}
 	ctx.WithField("ProtoSize", len(msg)).Debug("Published downlink message")
 	return nil
 }
+
+// RespondConnect publishes the response to the connect message of a gateway as JSON
+func (c *AMQP) RespondConnect(message *types.ConnectResponseMessage) error {
+	msg, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	if err := c.Publish(fmt.Sprintf(ConnectResponseRoutingKeyFormat, message.GatewayID), msg); err != nil {
+		return err
+	}
+	c.ctx.WithField("GatewayID", message.GatewayID).Debug("Published connect response")
+	return nil
+}
+
+// PublishDownlinkAck publishes a downlink acknowledgement as JSON, if DownlinkAcks is enabled in the Config
+func (c *AMQP) PublishDownlinkAck(message *types.DownlinkAckMessage) error {
+	if !c.config.DownlinkAcks {
+		return errors.New("amqp: downlink acks are not enabled")
+	}
+	msg, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	if err := c.Publish(fmt.Sprintf(DownlinkAckRoutingKeyFormat, message.GatewayID), msg); err != nil {
+		return err
+	}
+	c.ctx.WithField("GatewayID", message.GatewayID).Debug("Published downlink ack")
+	return nil
+}
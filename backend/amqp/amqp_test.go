@@ -17,6 +17,7 @@ import (
 	"github.com/apex/log/handlers/text"
 	"github.com/gogo/protobuf/proto"
 	. "github.com/smartystreets/goconvey/convey"
+	"github.com/streadway/amqp"
 )
 
 var host string
@@ -95,6 +96,7 @@ func TestAMQP(t *testing.T) {
 							case msg, ok := <-msg:
 								So(ok, ShouldBeTrue)
 								So(msg, ShouldNotBeNil)
+								msg.done(nil)
 							}
 						})
 					})
@@ -263,3 +265,61 @@ func TestAMQP(t *testing.T) {
 		})
 	})
 }
+
+func TestAMQPConfig(t *testing.T) {
+	Convey("When creating a new AMQP without prefetch and consumer configuration", t, func(c C) {
+		amqp, err := New(Config{Address: host}, log.Log)
+		So(err, ShouldBeNil)
+		Convey("The defaults should be used", func() {
+			So(amqp.config.PrefetchCount, ShouldEqual, 1)
+			So(amqp.config.Consumers, ShouldEqual, 1)
+		})
+	})
+}
+
+func TestAMQPDeadLetter(t *testing.T) {
+	Convey("Given a new AMQP with a dead-letter exchange", t, func(c C) {
+		a, _ := New(Config{
+			Address:              host,
+			DeadLetterExchange:   "bridge.dlx",
+			DeadLetterRoutingKey: "dead",
+		}, log.Log)
+
+		Convey("The queues should be declared with dead-letter arguments", func() {
+			args := a.queueArgs()
+			So(args["x-dead-letter-exchange"], ShouldEqual, "bridge.dlx")
+			So(args["x-dead-letter-routing-key"], ShouldEqual, "dead")
+		})
+
+		Convey("When a delivery fails repeatedly", func() {
+			delivery := amqp.Delivery{RoutingKey: "dev.up", Body: []byte("garbage")}
+			Convey("The failures should be counted", func() {
+				So(a.redeliveries.failed(delivery), ShouldEqual, 0)
+				So(a.redeliveries.failed(delivery), ShouldEqual, 1)
+				So(a.redeliveries.failed(amqp.Delivery{RoutingKey: "dev.up", Body: []byte("other")}), ShouldEqual, 0)
+			})
+			Convey("The count should be reset when forgotten", func() {
+				a.redeliveries.failed(delivery)
+				a.redeliveries.forget(delivery)
+				So(a.redeliveries.failed(delivery), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When the broker sets the delivery count", func() {
+			delivery := amqp.Delivery{Headers: amqp.Table{"x-delivery-count": int64(4)}}
+			So(a.redeliveries.failed(delivery), ShouldEqual, 4)
+		})
+	})
+
+	Convey("Given a new AMQP without a dead-letter exchange", t, func(c C) {
+		a, _ := New(Config{Address: host}, log.Log)
+		So(a.queueArgs(), ShouldBeNil)
+	})
+}
+
+func TestAttributeHeaders(t *testing.T) {
+	Convey("Attributes should be sent as message headers", t, func(c C) {
+		So(attributeHeaders(nil), ShouldBeNil)
+		So(attributeHeaders(map[string]string{"region": "eu"}), ShouldResemble, amqp.Table{"region": "eu"})
+	})
+}
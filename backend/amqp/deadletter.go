@@ -0,0 +1,88 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package amqp
+
+import (
+	"crypto/sha1"
+	"sync"
+
+	"github.com/apex/log"
+	"github.com/streadway/amqp"
+)
+
+// maxTrackedRedeliveries is the maximum number of failed messages for which redeliveries are counted
+const maxTrackedRedeliveries = 1024
+
+// redeliveries counts how often messages that could not be handled were redelivered.
+// Brokers that set the x-delivery-count header (such as quorum queues in RabbitMQ)
+// are trusted, for other brokers the messages are identified by their contents.
+type redeliveries struct {
+	mu     sync.Mutex
+	counts map[[sha1.Size]byte]int
+}
+
+func (r *redeliveries) key(delivery amqp.Delivery) [sha1.Size]byte {
+	return sha1.Sum(append([]byte(delivery.RoutingKey+"\x00"), delivery.Body...))
+}
+
+// failed registers a failed delivery and returns how often it failed before
+func (r *redeliveries) failed(delivery amqp.Delivery) int {
+	if count, ok := delivery.Headers["x-delivery-count"].(int64); ok {
+		return int(count)
+	}
+	key := r.key(delivery)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.counts == nil || len(r.counts) >= maxTrackedRedeliveries {
+		r.counts = make(map[[sha1.Size]byte]int)
+	}
+	count := r.counts[key]
+	r.counts[key] = count + 1
+	return count
+}
+
+// forget stops counting the redeliveries of a delivery
+func (r *redeliveries) forget(delivery amqp.Delivery) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.counts) == 0 {
+		return
+	}
+	delete(r.counts, r.key(delivery))
+}
+
+func (c *AMQP) queueArgs() amqp.Table {
+	if c.config.DeadLetterExchange == "" {
+		return nil
+	}
+	args := amqp.Table{"x-dead-letter-exchange": c.config.DeadLetterExchange}
+	if c.config.DeadLetterRoutingKey != "" {
+		args["x-dead-letter-routing-key"] = c.config.DeadLetterRoutingKey
+	}
+	return args
+}
+
+// settle acknowledges a delivery that was handled. If a dead-letter exchange is
+// configured, deliveries that could not be handled are requeued up to
+// MaxRedeliveries times, after which they are rejected and dead-lettered by the broker.
+func (c *AMQP) settle(ctx log.Interface, delivery amqp.Delivery, err error) {
+	if c.config.DeadLetterExchange == "" {
+		delivery.Ack(false)
+		return
+	}
+	if err == nil {
+		c.redeliveries.forget(delivery)
+		delivery.Ack(false)
+		return
+	}
+	if c.redeliveries.failed(delivery) < c.config.MaxRedeliveries {
+		ctx.WithError(err).Debug("Could not handle message, requeueing")
+		delivery.Nack(false, true)
+		return
+	}
+	c.redeliveries.forget(delivery)
+	ctx.WithError(err).Warn("Could not handle message, dead-lettering")
+	deadLetteredCounter.Inc()
+	delivery.Nack(false, false)
+}
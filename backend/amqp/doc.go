@@ -14,16 +14,41 @@
 // routing key when it disconnects, in order to help the bridge clean up
 // connections.
 //
+// If the bridge is configured to respond to connect messages, it publishes
+// the resolved gateway information (types.ConnectResponseMessage) as JSON on
+// the "[gateway-id].connect.response" routing key.
+//
 // Uplink messages are sent as protocol buffers on the "[gateway-id].up" routing
 // key. The bridge should call `SubscribeUplink("gateway-id")` to subscribe to
 // these. It is also possible to subscribe to a wildcard gateway by passing "*".
 //
 // Downlink messages are sent as protocol buffers on the "[gateway-id].down"
 // routing key. The bridge should call `PublishDownlink(*types.DownlinkMessage)`
-// in order to send the downlink to the gateway.
+// in order to send the downlink to the gateway. The attributes of the downlink
+// message are sent as message headers, with the attribute key as header key.
 //
 // Gateway status messages are sent as protocol buffers on the
 // "[gateway-id].status" routing key. The bridge should call
 // `SubscribeStatus("gateway-id")` to subscribe to these. It is also possible to
 // subscribe to a wildcard gateway by passing "*".
+//
+// If Config.DownlinkAcks is set, the acknowledgements of downlink messages
+// that the bridge receives from gateways (such as Semtech packet forwarders)
+// are published as JSON on the "[gateway-id].down.ack" routing key.
+//
+// The number of deliveries that the broker sends before they are acknowledged
+// can be tuned with Config.PrefetchCount, and the number of goroutines that
+// handle them with Config.Consumers. A prefetch count of a few times the number
+// of consumers usually keeps the consumers busy without holding a large backlog
+// in memory. The ttn_bridge_amqp_in_flight_deliveries metric shows how many
+// deliveries are being handled.
+//
+// Messages that can not be handled are acknowledged and dropped, unless
+// Config.DeadLetterExchange is set. In that case they are requeued up to
+// Config.MaxRedeliveries times, after which they are rejected so that the
+// broker dead-letters them.
+//
+// By default, the LoRaWAN payload in the protocol buffers is sent as raw bytes.
+// Config.PayloadTransformer can be used to encode it differently (for example
+// as base64 or hex) for consumers that expect this.
 package amqp
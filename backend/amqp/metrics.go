@@ -0,0 +1,29 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package amqp
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var inFlightDeliveries = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Namespace: "ttn",
+		Subsystem: "bridge",
+		Name:      "amqp_in_flight_deliveries",
+		Help:      "Number of AMQP deliveries that have been received but not yet acknowledged.",
+	},
+)
+
+var deadLetteredCounter = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Namespace: "ttn",
+		Subsystem: "bridge",
+		Name:      "amqp_dead_lettered_total",
+		Help:      "Total number of AMQP messages that were rejected to the dead-letter exchange.",
+	},
+)
+
+func init() {
+	prometheus.MustRegister(inFlightDeliveries)
+	prometheus.MustRegister(deadLetteredCounter)
+}
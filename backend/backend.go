@@ -30,3 +30,27 @@ type Southbound interface {
 	UnsubscribeStatus(gatewayID string) error
 	PublishDownlink(message *types.DownlinkMessage) error
 }
+
+// ConnectResponder is implemented by southbound backends that can send a response to the connect message of a
+// gateway
+type ConnectResponder interface {
+	RespondConnect(message *types.ConnectResponseMessage) error
+}
+
+// GatewayDisconnecter is implemented by southbound backends that can disconnect a gateway on their side, for
+// example by disconnecting its client from the broker
+type GatewayDisconnecter interface {
+	DisconnectGateway(gatewayID string) error
+}
+
+// DownlinkAcker is implemented by southbound backends that receive acknowledgements of downlink messages from
+// gateways
+type DownlinkAcker interface {
+	SubscribeDownlinkAck() (<-chan *types.DownlinkAckMessage, error)
+	UnsubscribeDownlinkAck() error
+}
+
+// DownlinkAckPublisher is implemented by backends that publish acknowledgements of downlink messages
+type DownlinkAckPublisher interface {
+	PublishDownlinkAck(message *types.DownlinkAckMessage) error
+}
@@ -22,11 +22,12 @@ type dummyGateway struct {
 
 // Dummy backend
 type Dummy struct {
-	mu         sync.Mutex
-	ctx        log.Interface
-	connect    chan *types.ConnectMessage
-	disconnect chan *types.DisconnectMessage
-	gateways   map[string]*dummyGateway
+	mu          sync.Mutex
+	ctx         log.Interface
+	connect     chan *types.ConnectMessage
+	disconnect  chan *types.DisconnectMessage
+	downlinkAck chan *types.DownlinkAckMessage
+	gateways    map[string]*dummyGateway
 }
 
 // New returns a new Dummy backend
@@ -109,6 +110,36 @@ func (d *Dummy) UnsubscribeDisconnect() error {
 	return nil
 }
 
+// PublishDownlinkAck publishes downlink acknowledgements to the dummy backend
+func (d *Dummy) PublishDownlinkAck(message *types.DownlinkAckMessage) error {
+	select {
+	case d.downlinkAck <- message:
+		d.ctx.WithField("GatewayID", message.GatewayID).Debug("Published downlink ack")
+	default:
+		d.ctx.WithField("GatewayID", message.GatewayID).Debug("Did not publish downlink ack [buffer full]")
+	}
+	return nil
+}
+
+// SubscribeDownlinkAck implements backend interfaces
+func (d *Dummy) SubscribeDownlinkAck() (<-chan *types.DownlinkAckMessage, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.downlinkAck = make(chan *types.DownlinkAckMessage, BufferSize)
+	d.ctx.Debug("Subscribed to downlink ack")
+	return d.downlinkAck, nil
+}
+
+// UnsubscribeDownlinkAck implements backend interfaces
+func (d *Dummy) UnsubscribeDownlinkAck() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	close(d.downlinkAck)
+	d.downlinkAck = nil
+	d.ctx.Debug("Unsubscribed from downlink ack")
+	return nil
+}
+
 func (d *Dummy) getGateway(gatewayID string) *dummyGateway {
 	d.mu.Lock()
 	defer d.mu.Unlock()
@@ -4,6 +4,7 @@
 package dummy
 
 import (
+	"net/http"
 	"time"
 
 	"github.com/TheThingsNetwork/api/trace"
@@ -45,6 +46,11 @@ func (d *Dummy) WithHTTPServer(addr string) *WithServer {
 	}
 }
 
+// Handle registers an additional handler for the given pattern on the HTTP server
+func (d *WithServer) Handle(pattern string, handler http.Handler) {
+	d.server.Handle(pattern, handler)
+}
+
 // PublishUplink implements backend interfaces
 func (d *WithServer) PublishUplink(message *types.UplinkMessage) error {
 	uplink := *message.Message
@@ -26,6 +26,7 @@ const (
 type Server struct {
 	ctx        log.Interface
 	addr       string
+	mux        *http.ServeMux
 	server     *socketio.Server
 	connect    chan string
 	disconnect chan string
@@ -48,6 +49,7 @@ func NewServer(ctx log.Interface, addr string) (*Server, error) {
 		ctx:               ctx.WithField("Connector", "Dummy-HTTP"),
 		server:            server,
 		addr:              addr,
+		mux:               http.NewServeMux(),
 		connect:           make(chan string, BufferSize),
 		disconnect:        make(chan string, BufferSize),
 		uplink:            make(chan *types.UplinkMessage, BufferSize),
@@ -57,6 +59,11 @@ func NewServer(ctx log.Interface, addr string) (*Server, error) {
 	}, nil
 }
 
+// Handle registers an additional handler for the given pattern on the server
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
 // Listen opens the server and starts listening for http requests
 func (s *Server) Listen() {
 	s.server.On("connection", func(so socketio.Socket) {
@@ -65,16 +72,15 @@ func (s *Server) Listen() {
 
 	go s.handleEvents()
 
-	mux := http.NewServeMux()
-	mux.Handle("/socket.io/", s.server)
-	mux.Handle("/", http.FileServer(http.Dir("./assets")))
-	mux.HandleFunc("/gateways", func(res http.ResponseWriter, _ *http.Request) {
+	s.mux.Handle("/socket.io/", s.server)
+	s.mux.Handle("/", http.FileServer(http.Dir("./assets")))
+	s.mux.HandleFunc("/gateways", func(res http.ResponseWriter, _ *http.Request) {
 		res.Header().Add("content-type", "application/json; charset=utf-8")
 		enc := json.NewEncoder(res)
 		enc.Encode(s.ConnectedGateways())
 	})
 	s.ctx.Infof("HTTP server listening on %s", s.addr)
-	err := http.ListenAndServe(s.addr, mux)
+	err := http.ListenAndServe(s.addr, s.mux)
 	if err != nil {
 		s.ctx.WithError(err).Fatal("Could not serve HTTP")
 	}
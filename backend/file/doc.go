@@ -0,0 +1,23 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+// Package file writes the messages that the bridge routes northbound to a local
+// file or to stdout, so that the bridge can be run without a broker during
+// development and in integration tests.
+//
+// Uplink messages, status messages and downlink acknowledgements are written as
+// JSON lines with the time at which they were written, the type of the message
+// ("uplink", "status" or "downlink_ack"), the gateway ID and the attributes of
+// uplink and status messages (omitted if there are none):
+//
+//	{"time":"...","type":"uplink","gateway_id":"dev","attributes":{...},"message":{...}}
+//
+// Payloads are base64-encoded, as usual for bytes in JSON.
+//
+// When Config.MaxSize is set, the file is rotated before it would grow larger
+// than MaxSize bytes: the file is renamed to "[path].1", and older files are
+// renamed to "[path].2" and so on, keeping at most Config.MaxBackups files.
+//
+// The backend does not receive downlink messages. SubscribeDownlink returns a
+// channel that is closed when the gateway is unsubscribed.
+package file
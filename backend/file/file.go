@@ -0,0 +1,217 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package file
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/TheThingsNetwork/api/trace"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
+	"github.com/apex/log"
+)
+
+// Stdout is the path that writes to stdout instead of a file
+const Stdout = "-"
+
+// ErrNotConnected is returned when messages are published before Connect or after Disconnect
+var ErrNotConnected = errors.New("file: not connected")
+
+// DefaultMaxBackups is the default number of rotated files that are kept
+const DefaultMaxBackups = 3
+
+// Config contains configuration for the file backend
+type Config struct {
+	// Path is the file that the messages are appended to, or Stdout
+	Path string
+
+	// MaxSize is the size in bytes above which the file is rotated. If zero, the file is not rotated. Stdout is
+	// never rotated.
+	MaxSize int64
+
+	// MaxBackups is the number of rotated files that are kept; defaults to DefaultMaxBackups
+	MaxBackups int
+}
+
+// New returns a new file backend
+func New(config Config, ctx log.Interface) (*File, error) {
+	if config.Path == "" {
+		config.Path = Stdout
+	}
+	if config.MaxBackups <= 0 {
+		config.MaxBackups = DefaultMaxBackups
+	}
+	return &File{
+		config:    config,
+		ctx:       ctx.WithField("Connector", "File").WithField("Path", config.Path),
+		downlinks: make(map[string]chan *types.DownlinkMessage),
+	}, nil
+}
+
+// File writes messages to a file or stdout
+type File struct {
+	config Config
+	ctx    log.Interface
+
+	mu   sync.Mutex
+	w    io.Writer
+	file *os.File // nil when writing to stdout
+	size int64
+
+	downlinksMu sync.Mutex
+	downlinks   map[string]chan *types.DownlinkMessage
+}
+
+// record is the JSON representation of a written message
+type record struct {
+	Time       time.Time         `json:"time"`
+	Type       string            `json:"type"`
+	GatewayID  string            `json:"gateway_id"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Message    interface{}       `json:"message"`
+}
+
+// Connect opens the file
+func (f *File) Connect() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.config.Path == Stdout {
+		f.w = os.Stdout
+		f.ctx.Info("Writing messages to stdout")
+		return nil
+	}
+	if err := f.open(); err != nil {
+		return fmt.Errorf("Could not open file (%s)", err)
+	}
+	f.ctx.Info("Writing messages to file")
+	return nil
+}
+
+func (f *File) open() error {
+	file, err := os.OpenFile(f.config.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.w, f.file, f.size = file, file, info.Size()
+	return nil
+}
+
+// Disconnect closes the file
+func (f *File) Disconnect() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.w = nil
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
+
+// rotate renames the file to [path].1 (shifting older files) and opens a new file
+func (f *File) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.file, f.w = nil, nil
+	for i := f.config.MaxBackups - 1; i > 0; i-- {
+		from, to := fmt.Sprintf("%s.%d", f.config.Path, i), fmt.Sprintf("%s.%d", f.config.Path, i+1)
+		if err := os.Rename(from, to); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(f.config.Path, f.config.Path+".1"); err != nil {
+		return err
+	}
+	f.ctx.Debug("Rotated file")
+	return f.open()
+}
+
+func (f *File) write(kind, gatewayID string, attributes map[string]string, message interface{}) error {
+	line, err := json.Marshal(record{Time: time.Now().UTC(), Type: kind, GatewayID: gatewayID, Attributes: attributes, Message: message})
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.w == nil {
+		return ErrNotConnected
+	}
+	if f.file != nil && f.config.MaxSize > 0 && f.size > 0 && f.size+int64(len(line)) > f.config.MaxSize {
+		if err := f.rotate(); err != nil {
+			return fmt.Errorf("file: could not rotate: %w", err)
+		}
+	}
+	n, err := f.w.Write(line)
+	f.size += int64(n)
+	return err
+}
+
+// CleanupGateway does nothing
+func (f *File) CleanupGateway(gatewayID string) {}
+
+// PublishUplink writes the uplink message
+func (f *File) PublishUplink(message *types.UplinkMessage) error {
+	if types.Tracing(types.TraceBasic) {
+		message.Message.Trace = message.Message.Trace.WithEvent(trace.ForwardEvent, "backend", "file")
+	}
+	if err := f.write("uplink", message.GatewayID, message.Attributes, message.Message); err != nil {
+		return err
+	}
+	f.ctx.WithField("GatewayID", message.GatewayID).Debug("Wrote uplink message")
+	return nil
+}
+
+// PublishStatus writes the status message
+func (f *File) PublishStatus(message *types.StatusMessage) error {
+	if err := f.write("status", message.GatewayID, message.Attributes, message.Message); err != nil {
+		return err
+	}
+	f.ctx.WithField("GatewayID", message.GatewayID).Debug("Wrote status message")
+	return nil
+}
+
+// PublishDownlinkAck writes the downlink acknowledgement
+func (f *File) PublishDownlinkAck(message *types.DownlinkAckMessage) error {
+	if err := f.write("downlink_ack", message.GatewayID, nil, message); err != nil {
+		return err
+	}
+	f.ctx.WithField("GatewayID", message.GatewayID).Debug("Wrote downlink ack")
+	return nil
+}
+
+// SubscribeDownlink returns a channel that does not receive downlink messages
+func (f *File) SubscribeDownlink(gatewayID string) (<-chan *types.DownlinkMessage, error) {
+	f.downlinksMu.Lock()
+	defer f.downlinksMu.Unlock()
+	if downlinks, ok := f.downlinks[gatewayID]; ok {
+		return downlinks, nil
+	}
+	downlinks := make(chan *types.DownlinkMessage)
+	f.downlinks[gatewayID] = downlinks
+	return downlinks, nil
+}
+
+// UnsubscribeDownlink closes the downlink channel of the gateway
+func (f *File) UnsubscribeDownlink(gatewayID string) error {
+	f.downlinksMu.Lock()
+	defer f.downlinksMu.Unlock()
+	if downlinks, ok := f.downlinks[gatewayID]; ok {
+		close(downlinks)
+		delete(f.downlinks, gatewayID)
+	}
+	return nil
+}
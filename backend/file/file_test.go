@@ -0,0 +1,104 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package file
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/TheThingsNetwork/api/gateway"
+	"github.com/TheThingsNetwork/api/router"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
+	"github.com/apex/log"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func readRecords(path string) (records []map[string]interface{}) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err == nil {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+func TestFile(t *testing.T) {
+	Convey("Given a file backend", t, func(c C) {
+		dir, err := ioutil.TempDir("", "bridge-file")
+		So(err, ShouldBeNil)
+		Reset(func() { os.RemoveAll(dir) })
+		path := filepath.Join(dir, "messages.json")
+
+		f, err := New(Config{Path: path}, log.Log)
+		So(err, ShouldBeNil)
+
+		Convey("Publishing before connecting should fail", func() {
+			So(f.PublishStatus(&types.StatusMessage{GatewayID: "dev", Message: &gateway.Status{}}), ShouldEqual, ErrNotConnected)
+		})
+
+		Convey("When connected", func() {
+			So(f.Connect(), ShouldBeNil)
+			Reset(func() { f.Disconnect() })
+
+			Convey("When publishing an uplink and a status message", func() {
+				So(f.PublishUplink(&types.UplinkMessage{GatewayID: "dev", Message: &router.UplinkMessage{Payload: []byte{1, 2, 3}}}), ShouldBeNil)
+				So(f.PublishStatus(&types.StatusMessage{GatewayID: "dev", Message: &gateway.Status{FrequencyPlan: "EU_863_870"}, Attributes: map[string]string{"region": "eu"}}), ShouldBeNil)
+
+				Convey("They should be written as JSON lines", func() {
+					records := readRecords(path)
+					So(records, ShouldHaveLength, 2)
+					So(records[0]["type"], ShouldEqual, "uplink")
+					So(records[0]["gateway_id"], ShouldEqual, "dev")
+					So(records[0]["time"], ShouldNotBeEmpty)
+					So(records[0]["message"].(map[string]interface{})["payload"], ShouldEqual, "AQID")
+					So(records[1]["type"], ShouldEqual, "status")
+					So(records[1]["message"].(map[string]interface{})["frequency_plan"], ShouldEqual, "EU_863_870")
+					So(records[0], ShouldNotContainKey, "attributes")
+					So(records[1]["attributes"], ShouldResemble, map[string]interface{}{"region": "eu"})
+				})
+			})
+
+			Convey("Downlink subscriptions should be closed when unsubscribing", func() {
+				downlinks, err := f.SubscribeDownlink("dev")
+				So(err, ShouldBeNil)
+				So(f.UnsubscribeDownlink("dev"), ShouldBeNil)
+				_, ok := <-downlinks
+				So(ok, ShouldBeFalse)
+			})
+		})
+
+		Convey("When the file is rotated by size", func() {
+			f, _ := New(Config{Path: path, MaxSize: 200, MaxBackups: 2}, log.Log)
+			So(f.Connect(), ShouldBeNil)
+			Reset(func() { f.Disconnect() })
+			for i := 0; i < 20; i++ {
+				So(f.PublishStatus(&types.StatusMessage{GatewayID: "dev", Message: &gateway.Status{FrequencyPlan: "EU_863_870"}}), ShouldBeNil)
+			}
+
+			Convey("The files should not be larger than the maximum size", func() {
+				for _, name := range []string{path, path + ".1", path + ".2"} {
+					info, err := os.Stat(name)
+					So(err, ShouldBeNil)
+					So(info.Size(), ShouldBeLessThanOrEqualTo, 200)
+					So(readRecords(name), ShouldNotBeEmpty)
+				}
+			})
+			Convey("At most the maximum number of backups should be kept", func() {
+				_, err := os.Stat(path + ".3")
+				So(os.IsNotExist(err), ShouldBeTrue)
+			})
+		})
+	})
+}
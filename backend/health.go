@@ -0,0 +1,39 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package backend
+
+import (
+	"context"
+	"errors"
+)
+
+// HealthChecker is implemented by backends that can report whether they can currently publish. HealthCheck is called
+// periodically, so it should be cheap, and it should return when ctx is done. The returned errors wrap ErrTransient
+// if the backend is expected to recover by itself (for example while it reconnects), or ErrFatal if it is not.
+type HealthChecker interface {
+	HealthCheck(ctx context.Context) error
+}
+
+var (
+	// ErrTransient is wrapped by health check errors from which the backend is expected to recover by itself
+	ErrTransient = errors.New("backend: temporarily unhealthy")
+
+	// ErrFatal is wrapped by health check errors from which the backend does not recover by itself
+	ErrFatal = errors.New("backend: unhealthy")
+)
+
+// CheckWithContext calls check and returns the error of ctx if it does not return before ctx is done. The check is
+// abandoned, not stopped.
+func CheckWithContext(ctx context.Context, check func() error) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- check()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,36 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package backend
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCheckWithContext(t *testing.T) {
+	Convey("Given a context with a timeout", t, func(c C) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		Reset(cancel)
+
+		Convey("The error of a check that returns in time should be returned", func() {
+			checkErr := errors.New("check failed")
+			So(CheckWithContext(ctx, func() error { return checkErr }), ShouldEqual, checkErr)
+			So(CheckWithContext(ctx, func() error { return nil }), ShouldBeNil)
+		})
+
+		Convey("A check that blocks should be abandoned when the context is done", func() {
+			unblock := make(chan struct{})
+			Reset(func() { close(unblock) })
+			err := CheckWithContext(ctx, func() error {
+				<-unblock
+				return nil
+			})
+			So(err, ShouldEqual, context.DeadlineExceeded)
+		})
+	})
+}
@@ -0,0 +1,19 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package backend
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var publishTimeouts = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "ttn",
+		Subsystem: "bridge",
+		Name:      "publish_timeouts_total",
+		Help:      "Total number of publishes to a backend that timed out.",
+	}, []string{"backend"},
+)
+
+func init() {
+	prometheus.MustRegister(publishTimeouts)
+}
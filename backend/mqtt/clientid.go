@@ -0,0 +1,59 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package mqtt
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/TheThingsNetwork/ttn/utils/random"
+)
+
+// DefaultClientID is the client ID template that is used if none is configured
+const DefaultClientID = "bridge-{random}"
+
+var clientIDPlaceholder = regexp.MustCompile(`\{[^}]*\}`)
+
+// FormatClientID resolves a client ID template. The template can contain the
+// placeholders {hostname}, {pid} and {random} (a random string of 16
+// characters). The returned bool indicates if the client ID is expected to be
+// unique between bridge instances, which is the case if it contains {random}
+// or both {hostname} and {pid}.
+func FormatClientID(template string) (clientID string, unique bool, err error) {
+	if template == "" {
+		template = DefaultClientID
+	}
+	var hasHostname, hasPID, hasRandom bool
+	clientID = clientIDPlaceholder.ReplaceAllStringFunc(template, func(placeholder string) string {
+		switch placeholder {
+		case "{hostname}":
+			hasHostname = true
+			hostname, hostErr := os.Hostname()
+			if hostErr != nil {
+				err = fmt.Errorf("mqtt: could not get hostname for client ID: %s", hostErr)
+			}
+			return hostname
+		case "{pid}":
+			hasPID = true
+			return strconv.Itoa(os.Getpid())
+		case "{random}":
+			hasRandom = true
+			return random.String(16)
+		default:
+			err = fmt.Errorf("mqtt: unknown placeholder %s in client ID", placeholder)
+			return placeholder
+		}
+	})
+	if err != nil {
+		return "", false, err
+	}
+	if strings.TrimSpace(clientID) == "" {
+		return "", false, errors.New("mqtt: empty client ID")
+	}
+	return clientID, hasRandom || (hasHostname && hasPID), nil
+}
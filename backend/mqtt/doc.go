@@ -14,16 +14,38 @@
 // types.DisconnectMessage containing the gateway's ID on the "disconnect"
 // topic.
 //
+// If the bridge is configured to respond to connect messages, it publishes
+// the resolved gateway information (types.ConnectResponseMessage) as JSON on
+// the "[gateway-id]/connect/response" topic.
+//
 // Uplink messages are sent as protocol buffers on the "[gateway-id]/up" topic.
 // The bridge should call `SubscribeUplink("gateway-id")` to subscribe to this
 // topic. It is also possible to subscribe to a wildcard gateway by passing "+".
 //
 // Downlink messages are sent as protocol buffers on the "[gateway-id]/down"
 // topic. The bridge should call `PublishDownlink(*types.DownlinkMessage)` in
-// order to send the downlink to the gateway.
+// order to send the downlink to the gateway. MQTT 3.1.1 messages have no
+// headers, and gateways expect the protocol buffer as is, so the attributes of
+// the downlink message are not sent.
 //
 // Gateway status messages are sent as protocol buffers on the
 // "[gateway-id]/status" topic. The bridge should call
 // `SubscribeStatus("gateway-id")` to subscribe to this topic. It is also
 // possible to subscribe to a wildcard gateway by passing "+".
+//
+// If Config.DownlinkAcks is set, the acknowledgements of downlink messages
+// that the bridge receives from gateways (such as Semtech packet forwarders)
+// are published as JSON on the "[gateway-id]/down/ack" topic.
+//
+// If a will topic is configured, the bridge sets a last will with the broker,
+// which is published when the bridge disconnects uncleanly. When the bridge
+// disconnects cleanly, it publishes a "stopped" message to the same topic.
+//
+// By default, the LoRaWAN payload in the protocol buffers is sent as raw bytes.
+// Config.PayloadTransformer can be used to encode it differently (for example
+// as base64 or hex) for consumers that expect this.
+//
+// The bridge pings the broker every Config.KeepAlive, and considers the
+// connection lost if no response is received within Config.PingTimeout.
+// Shorter values detect broker failures faster.
 package mqtt
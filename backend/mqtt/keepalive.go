@@ -0,0 +1,48 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package mqtt
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Default keep-alive interval and ping timeout
+var (
+	DefaultKeepAlive   = 30 * time.Second
+	DefaultPingTimeout = 10 * time.Second
+)
+
+// Bounds of the keep-alive interval. The MQTT protocol allows at most 65535 seconds.
+const (
+	MinKeepAlive = time.Second
+	MaxKeepAlive = 65535 * time.Second
+)
+
+// keepAlive returns the keep-alive interval and ping timeout of the config, or an error if they are out of bounds
+func keepAlive(config Config) (keepAlive, pingTimeout time.Duration, err error) {
+	keepAlive, pingTimeout = config.KeepAlive, config.PingTimeout
+	if keepAlive == 0 {
+		keepAlive = DefaultKeepAlive
+	}
+	if pingTimeout == 0 {
+		pingTimeout = DefaultPingTimeout
+	}
+	if keepAlive < MinKeepAlive || keepAlive > MaxKeepAlive {
+		return 0, 0, fmt.Errorf("mqtt: keep-alive %s should be between %s and %s", keepAlive, MinKeepAlive, MaxKeepAlive)
+	}
+	if keepAlive%time.Second != 0 {
+		return 0, 0, fmt.Errorf("mqtt: keep-alive %s should be a whole number of seconds", keepAlive)
+	}
+	if pingTimeout < 0 || pingTimeout >= keepAlive {
+		return 0, 0, fmt.Errorf("mqtt: ping timeout %s should be positive and shorter than the keep-alive %s", pingTimeout, keepAlive)
+	}
+	return keepAlive, pingTimeout, nil
+}
+
+// isPingTimeout returns whether the connection was lost because the broker did not respond to a ping
+func isPingTimeout(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "pingresp not received")
+}
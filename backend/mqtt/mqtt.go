@@ -4,16 +4,22 @@
 package mqtt
 
 import (
+	"context"
 	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
+	"net/url"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/TheThingsNetwork/api/gateway"
-	"github.com/TheThingsNetwork/api/router"
 	"github.com/TheThingsNetwork/api/trace"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/backend"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/events"
 	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
-	"github.com/TheThingsNetwork/ttn/utils/random"
+	"github.com/TheThingsNetwork/go-utils/backoff"
 	"github.com/apex/log"
 	paho "github.com/eclipse/paho.mqtt.golang"
 	"github.com/gogo/protobuf/proto"
@@ -28,34 +34,78 @@ func New(config Config, ctx log.Interface) (*MQTT, error) {
 
 	mqtt.ctx = ctx.WithField("Connector", "MQTT")
 
+	clientID, unique, err := FormatClientID(config.ClientID)
+	if err != nil {
+		return nil, err
+	}
+	if !unique {
+		mqtt.ctx.WithField("ClientID", clientID).Warn("MQTT client ID may not be unique, bridges with the same client ID will disconnect each other")
+	}
+
 	mqttOpts := paho.NewClientOptions()
 	for _, broker := range config.Brokers {
 		mqttOpts.AddBroker(broker)
 	}
+	mqtt.brokers = config.Brokers
 	if config.TLSConfig != nil {
 		mqttOpts.SetTLSConfig(config.TLSConfig)
 	}
-	mqttOpts.SetClientID(fmt.Sprintf("bridge-%s", random.String(16)))
+	mqttOpts.SetClientID(clientID)
 	mqttOpts.SetUsername(config.Username)
 	mqttOpts.SetPassword(config.Password)
-	mqttOpts.SetKeepAlive(30 * time.Second)
-	mqttOpts.SetPingTimeout(10 * time.Second)
+	keepAlive, pingTimeout, err := keepAlive(config)
+	if err != nil {
+		return nil, err
+	}
+	mqttOpts.SetKeepAlive(keepAlive)
+	mqttOpts.SetPingTimeout(pingTimeout)
+	mqttOpts.SetWriteTimeout(config.PublishTimeout)
 	mqttOpts.SetCleanSession(true)
+	if config.WillTopic != "" {
+		if config.WillPayload == "" {
+			config.WillPayload = DefaultWillPayload
+		}
+		if config.StoppedPayload == "" {
+			config.StoppedPayload = DefaultStoppedPayload
+		}
+		mqttOpts.SetWill(config.WillTopic, config.WillPayload, PublishQoS, false)
+		mqtt.willTopic = config.WillTopic
+		mqtt.stoppedPayload = config.StoppedPayload
+	}
 	mqttOpts.SetDefaultPublishHandler(func(_ paho.Client, msg paho.Message) {
 		mqtt.ctx.Warnf("Received unhandled message on MQTT: %v", msg)
 	})
 
+	mqtt.payloadTransformer = config.PayloadTransformer
+	if mqtt.payloadTransformer == nil {
+		mqtt.payloadTransformer = backend.RawPayload
+	}
+
+	mqtt.healthTopic = config.HealthTopic
+	mqtt.downlinkAcks = config.DownlinkAcks
+
+	mqtt.connectTimeout = config.ConnectTimeout
+	mqtt.connectBackoff = config.ConnectBackoff
+	mqtt.publishTimeout = config.PublishTimeout
+
 	mqtt.subscriptions = make(map[string]subscription)
 	var reconnecting bool
 	mqttOpts.SetConnectionLostHandler(func(_ paho.Client, err error) {
+		if isPingTimeout(err) {
+			mqtt.ctx.WithField("PingTimeout", pingTimeout).Warn("Ping timed out")
+		}
 		mqtt.ctx.Warnf("Disconnected (%s). Reconnecting...", err.Error())
+		config.Events.Emit(events.Event{Kind: events.BackendDisconnected, Source: "mqtt", Message: err.Error()})
 		reconnecting = true
+		atomic.StoreInt32(&mqtt.state, stateReconnecting)
 	})
 	mqttOpts.SetOnConnectHandler(func(_ paho.Client) {
-		mqtt.ctx.Info("Connected")
+		mqtt.ctx.WithField("ClientID", clientID).Info("Connected")
+		atomic.StoreInt32(&mqtt.state, stateConnected)
 		if reconnecting {
 			mqtt.resubscribe()
 			reconnecting = false
+			config.Events.Emit(events.Event{Kind: events.BackendReconnected, Source: "mqtt", Message: "Reconnected to MQTT"})
 		}
 	})
 
@@ -76,13 +126,16 @@ var (
 // BufferSize indicates the maximum number of MQTT messages that should be buffered
 var BufferSize = 10
 
-// Topic formats for connect, disconnect, uplink, downlink and status messages
+// Topic formats for connect, connect response, disconnect, uplink, downlink, downlink acknowledgement and status
+// messages
 var (
-	ConnectTopicFormat    = "connect"
-	DisconnectTopicFormat = "disconnect"
-	UplinkTopicFormat     = "%s/up"
-	DownlinkTopicFormat   = "%s/down"
-	StatusTopicFormat     = "%s/status"
+	ConnectTopicFormat         = "connect"
+	ConnectResponseTopicFormat = "%s/connect/response"
+	DisconnectTopicFormat      = "disconnect"
+	UplinkTopicFormat          = "%s/up"
+	DownlinkTopicFormat        = "%s/down"
+	DownlinkAckTopicFormat     = "%s/down/ack"
+	StatusTopicFormat          = "%s/status"
 )
 
 // Config contains configuration for MQTT
@@ -91,8 +144,55 @@ type Config struct {
 	Username  string
 	Password  string
 	TLSConfig *tls.Config
+
+	// ClientID is the template for the MQTT client ID (see FormatClientID); defaults to DefaultClientID
+	ClientID string
+
+	// WillTopic is the topic of the last will that the broker publishes when the bridge disconnects uncleanly.
+	// On a clean disconnect, StoppedPayload is published to the same topic.
+	WillTopic      string
+	WillPayload    string
+	StoppedPayload string
+
+	// PayloadTransformer transforms the LoRaWAN payload of published downlink messages, and reverses this for
+	// received uplink messages. Defaults to backend.RawPayload.
+	PayloadTransformer backend.PayloadTransformer
+
+	// ConnectTimeout is the total time during which the initial connection is retried, waiting between attempts
+	// according to ConnectBackoff. Connect does not wait for an attempt beyond it. If zero, the connection is
+	// retried ConnectRetries times.
+	ConnectTimeout time.Duration
+	ConnectBackoff backoff.Config
+
+	// KeepAlive is the interval at which the broker is pinged, and PingTimeout the time to wait for a response
+	// before the connection is considered lost. Defaults to DefaultKeepAlive and DefaultPingTimeout.
+	KeepAlive   time.Duration
+	PingTimeout time.Duration
+
+	// PublishTimeout is the time that a publish waits for the client to send the message before it returns
+	// backend.ErrPublishTimeout. It is also used as write timeout of the client, which bounds the time that the
+	// client waits for room in its outgoing queue. If zero, publishes do not time out.
+	PublishTimeout time.Duration
+
+	// HealthTopic is the topic to which HealthCheck publishes the current time, to check that the broker accepts
+	// publishes. If empty, HealthCheck only checks that the client is connected.
+	HealthTopic string
+
+	// DownlinkAcks enables publishing the acknowledgements of downlink messages that the bridge receives from
+	// gateways (see PublishDownlinkAck). Brokers that restrict the topics of the bridge may reject these.
+	DownlinkAcks bool
+
+	// Events receives BackendDisconnected and BackendReconnected events when the connection to the broker is lost
+	// and restored. It may be nil.
+	Events *events.Notifier
 }
 
+// Default payloads for the last will and the stopped message
+const (
+	DefaultWillPayload    = "lost"
+	DefaultStoppedPayload = "stopped"
+)
+
 type subscription struct {
 	handler paho.MessageHandler
 	cancel  func()
@@ -102,10 +202,32 @@ type subscription struct {
 type MQTT struct {
 	ctx           log.Interface
 	client        paho.Client
+	brokers       []string
 	subscriptions map[string]subscription
 	mu            sync.Mutex
+
+	willTopic      string
+	stoppedPayload string
+	healthTopic    string
+	downlinkAcks   bool
+
+	state int32 // connection state, accessed atomically
+
+	connectTimeout time.Duration
+	connectBackoff backoff.Config
+	publishTimeout time.Duration
+
+	payloadTransformer backend.PayloadTransformer
 }
 
+// Connection states of the client, for HealthCheck
+const (
+	stateConnecting int32 = iota
+	stateConnected
+	stateReconnecting
+	stateStopped // disconnected, or the initial connection failed
+)
+
 var (
 	// ConnectRetries says how many times the client should retry a failed connection
 	ConnectRetries = 10
@@ -113,17 +235,41 @@ var (
 	ConnectRetryDelay = time.Second
 )
 
+func (c *MQTT) connect() error {
+	token := c.client.Connect()
+	finished := token.WaitTimeout(1 * time.Second)
+	if !finished {
+		c.ctx.Warn("MQTT connection took longer than expected...")
+		token.Wait()
+	}
+	return token.Error()
+}
+
+var errConnectTimeout = errors.New("mqtt: connect timed out")
+
+// connectWithin is like connect, but stops waiting for the attempt when the timeout elapses
+func (c *MQTT) connectWithin(timeout time.Duration) error {
+	token := c.client.Connect()
+	if !token.WaitTimeout(timeout) {
+		return errConnectTimeout
+	}
+	return token.Error()
+}
+
 // Connect to MQTT
 func (c *MQTT) Connect() error {
+	if c.connectTimeout > 0 {
+		deadline := time.Now().Add(c.connectTimeout)
+		connect := func() error { return c.connectWithin(time.Until(deadline)) }
+		if err := backend.RetryConnect(c.ctx, c.connectTimeout, c.connectBackoff, connect); err != nil {
+			atomic.StoreInt32(&c.state, stateStopped)
+			return fmt.Errorf("Could not connect to MQTT (%s)", err)
+		}
+		return nil
+	}
 	var err error
 	for retries := 0; retries < ConnectRetries; retries++ {
-		token := c.client.Connect()
-		finished := token.WaitTimeout(1 * time.Second)
-		if !finished {
-			c.ctx.Warn("MQTT connection took longer than expected...")
-			token.Wait()
-		}
-		err = token.Error()
+		err = c.connect()
 		if err == nil {
 			break
 		}
@@ -131,6 +277,7 @@ func (c *MQTT) Connect() error {
 		<-time.After(ConnectRetryDelay)
 	}
 	if err != nil {
+		atomic.StoreInt32(&c.state, stateStopped)
 		return fmt.Errorf("Could not connect to MQTT (%s)", err)
 	}
 	return err
@@ -138,12 +285,87 @@ func (c *MQTT) Connect() error {
 
 // Disconnect from MQTT
 func (c *MQTT) Disconnect() error {
+	if c.willTopic != "" && c.client.IsConnected() {
+		token, err := c.publish(c.willTopic, []byte(c.stoppedPayload))
+		if err != nil {
+			c.ctx.WithError(err).Warn("Could not publish stopped message")
+		} else if !token.WaitTimeout(time.Second) {
+			c.ctx.Warn("Could not publish stopped message: timeout")
+		} else if err := token.Error(); err != nil {
+			c.ctx.WithError(err).Warn("Could not publish stopped message")
+		}
+	}
+	atomic.StoreInt32(&c.state, stateStopped)
 	c.client.Disconnect(100)
 	return nil
 }
 
-func (c *MQTT) publish(topic string, msg []byte) paho.Token {
-	return c.client.Publish(topic, PublishQoS, false, msg)
+// HealthTimeout is the timeout of the publish of HealthCheck if its context has no deadline
+var HealthTimeout = 5 * time.Second
+
+// HealthCheck returns an error if the client is not connected to the broker. If a health topic is configured, it
+// also publishes to that topic, and returns an error if the publish does not complete.
+func (c *MQTT) HealthCheck(ctx context.Context) error {
+	switch atomic.LoadInt32(&c.state) {
+	case stateConnecting:
+		return fmt.Errorf("%w: mqtt: not connected yet", backend.ErrTransient)
+	case stateReconnecting:
+		return fmt.Errorf("%w: mqtt: reconnecting", backend.ErrTransient)
+	case stateStopped:
+		return fmt.Errorf("%w: mqtt: not connected", backend.ErrFatal)
+	}
+	if c.healthTopic == "" {
+		return nil
+	}
+	timeout := HealthTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+	token, err := c.publish(c.healthTopic, []byte(time.Now().UTC().Format(time.RFC3339)))
+	if err == nil && !token.WaitTimeout(timeout) {
+		err = backend.ErrPublishTimeout
+	}
+	if err == nil {
+		err = token.Error()
+	}
+	if err != nil {
+		return fmt.Errorf("%w: mqtt: could not publish to health topic: %w", backend.ErrTransient, err)
+	}
+	return nil
+}
+
+// Validate checks that at least one of the MQTT brokers can be reached. It does not connect the client.
+func (c *MQTT) Validate(ctx context.Context) error {
+	addresses := make([]string, 0, len(c.brokers))
+	for _, broker := range c.brokers {
+		u, err := url.Parse(broker)
+		if err != nil {
+			return fmt.Errorf("mqtt: invalid broker %q: %w", broker, err)
+		}
+		address := u.Host
+		if u.Port() == "" {
+			port := "1883"
+			if u.Scheme == "ssl" || u.Scheme == "tls" {
+				port = "8883"
+			}
+			address = net.JoinHostPort(u.Hostname(), port)
+		}
+		addresses = append(addresses, address)
+	}
+	if err := backend.Dial(ctx, addresses...); err != nil {
+		return fmt.Errorf("mqtt: could not reach broker: %w", err)
+	}
+	return nil
+}
+
+// publish publishes the message, returning backend.ErrPublishTimeout if the client did not send it within the
+// publish timeout (for example because it is reconnecting)
+func (c *MQTT) publish(topic string, msg []byte) (paho.Token, error) {
+	token := c.client.Publish(topic, PublishQoS, false, msg)
+	if c.publishTimeout > 0 && !token.WaitTimeout(c.publishTimeout) {
+		return nil, backend.PublishTimedOut("mqtt")
+	}
+	return token, nil
 }
 
 func (c *MQTT) subscribe(topic string, handler paho.MessageHandler, cancel func()) paho.Token {
@@ -182,14 +404,14 @@ func (c *MQTT) unsubscribe(topic string) paho.Token {
 func (c *MQTT) SubscribeConnect() (<-chan *types.ConnectMessage, error) {
 	messages := make(chan *types.ConnectMessage, BufferSize)
 	token := c.subscribe(ConnectTopicFormat, func(_ paho.Client, msg paho.Message) {
-		var connect types.ConnectMessage
-		if err := proto.Unmarshal(msg.Payload(), &connect); err != nil {
+		connect, err := types.ParseConnect(msg.Payload())
+		if err != nil {
 			c.ctx.WithError(err).Warn("Could not unmarshal connect message")
 			return
 		}
 		ctx := c.ctx.WithField("GatewayID", connect.GatewayID)
 		select {
-		case messages <- &connect:
+		case messages <- connect:
 			ctx.WithField("ProtoSize", len(msg.Payload())).Debug("Received connect message")
 		default:
 			ctx.Warn("Could not handle connect message: buffer full")
@@ -212,14 +434,14 @@ func (c *MQTT) UnsubscribeConnect() error {
 func (c *MQTT) SubscribeDisconnect() (<-chan *types.DisconnectMessage, error) {
 	messages := make(chan *types.DisconnectMessage, BufferSize)
 	token := c.subscribe(DisconnectTopicFormat, func(_ paho.Client, msg paho.Message) {
-		var disconnect types.DisconnectMessage
-		if err := proto.Unmarshal(msg.Payload(), &disconnect); err != nil {
+		disconnect, err := types.ParseDisconnect(msg.Payload())
+		if err != nil {
 			c.ctx.WithError(err).Warn("Could not unmarshal disconnect message")
 			return
 		}
 		ctx := c.ctx.WithField("GatewayID", disconnect.GatewayID)
 		select {
-		case messages <- &disconnect:
+		case messages <- disconnect:
 			ctx.WithField("ProtoSize", len(msg.Payload())).Debug("Received disconnect message")
 		default:
 			ctx.Warn("Could not handle disconnect message: buffer full")
@@ -243,15 +465,24 @@ func (c *MQTT) SubscribeUplink(gatewayID string) (<-chan *types.UplinkMessage, e
 	ctx := c.ctx.WithField("GatewayID", gatewayID)
 	messages := make(chan *types.UplinkMessage, BufferSize)
 	token := c.subscribe(fmt.Sprintf(UplinkTopicFormat, gatewayID), func(_ paho.Client, msg paho.Message) {
+		message, err := types.ParseUplink(msg.Payload())
+		if err != nil {
+			ctx.WithError(err).Warn("Could not unmarshal uplink message")
+			return
+		}
 		uplink := types.UplinkMessage{
 			GatewayID: gatewayID,
-			Message:   new(router.UplinkMessage),
+			Message:   message,
 		}
-		if err := proto.Unmarshal(msg.Payload(), uplink.Message); err != nil {
-			ctx.WithError(err).Warn("Could not unmarshal uplink message")
+		payload, err := c.payloadTransformer.Decode(uplink.Message.Payload)
+		if err != nil {
+			ctx.WithError(err).Warn("Could not decode uplink payload")
 			return
 		}
-		uplink.Message.Trace = uplink.Message.Trace.WithEvent(trace.ReceiveEvent, "backend", "mqtt")
+		uplink.Message.Payload = payload
+		if types.Tracing(types.TraceBasic) {
+			uplink.Message.Trace = uplink.Message.Trace.WithEvent(trace.ReceiveEvent, "backend", "mqtt")
+		}
 		select {
 		case messages <- &uplink:
 			ctx.WithField("ProtoSize", len(msg.Payload())).Debug("Received uplink message")
@@ -277,14 +508,15 @@ func (c *MQTT) SubscribeStatus(gatewayID string) (<-chan *types.StatusMessage, e
 	ctx := c.ctx.WithField("GatewayID", gatewayID)
 	messages := make(chan *types.StatusMessage, BufferSize)
 	token := c.subscribe(fmt.Sprintf(StatusTopicFormat, gatewayID), func(_ paho.Client, msg paho.Message) {
+		message, err := types.ParseStatus(msg.Payload())
+		if err != nil {
+			ctx.WithError(err).Warn("Could not unmarshal status message")
+			return
+		}
 		status := types.StatusMessage{
 			Backend:   "MQTT",
 			GatewayID: gatewayID,
-			Message:   new(gateway.Status),
-		}
-		if err := proto.Unmarshal(msg.Payload(), status.Message); err != nil {
-			ctx.WithError(err).Warn("Could not unmarshal status message")
-			return
+			Message:   message,
 		}
 		select {
 		case messages <- &status:
@@ -311,11 +543,19 @@ func (c *MQTT) PublishDownlink(message *types.DownlinkMessage) error {
 	ctx := c.ctx.WithField("GatewayID", message.GatewayID)
 	downlink := *message.Message
 	downlink.Trace = nil
+	payload, err := c.payloadTransformer.Encode(downlink.Payload)
+	if err != nil {
+		return err
+	}
+	downlink.Payload = payload
 	msg, err := proto.Marshal(&downlink)
 	if err != nil {
 		return err
 	}
-	token := c.publish(fmt.Sprintf(DownlinkTopicFormat, message.GatewayID), msg)
+	token, err := c.publish(fmt.Sprintf(DownlinkTopicFormat, message.GatewayID), msg)
+	if err != nil {
+		return err
+	}
 	go func() {
 		token.Wait()
 		if err := token.Error(); err != nil {
@@ -326,3 +566,50 @@ func (c *MQTT) PublishDownlink(message *types.DownlinkMessage) error {
 	}()
 	return nil
 }
+
+// RespondConnect publishes the response to the connect message of a gateway as JSON
+func (c *MQTT) RespondConnect(message *types.ConnectResponseMessage) error {
+	ctx := c.ctx.WithField("GatewayID", message.GatewayID)
+	msg, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	token, err := c.publish(fmt.Sprintf(ConnectResponseTopicFormat, message.GatewayID), msg)
+	if err != nil {
+		return err
+	}
+	go func() {
+		token.Wait()
+		if err := token.Error(); err != nil {
+			ctx.WithError(err).Warn("Could not publish connect response")
+			return
+		}
+		ctx.Debug("Published connect response")
+	}()
+	return nil
+}
+
+// PublishDownlinkAck publishes a downlink acknowledgement as JSON, if DownlinkAcks is enabled in the Config
+func (c *MQTT) PublishDownlinkAck(message *types.DownlinkAckMessage) error {
+	if !c.downlinkAcks {
+		return errors.New("mqtt: downlink acks are not enabled")
+	}
+	ctx := c.ctx.WithField("GatewayID", message.GatewayID)
+	msg, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	token, err := c.publish(fmt.Sprintf(DownlinkAckTopicFormat, message.GatewayID), msg)
+	if err != nil {
+		return err
+	}
+	go func() {
+		token.Wait()
+		if err := token.Error(); err != nil {
+			ctx.WithError(err).Warn("Could not publish downlink ack")
+			return
+		}
+		ctx.Debug("Published downlink ack")
+	}()
+	return nil
+}
@@ -6,6 +6,7 @@ package mqtt
 import (
 	"bytes"
 	"fmt"
+	"net"
 	"os"
 	"testing"
 	"time"
@@ -163,7 +164,8 @@ func TestMQTT(t *testing.T) {
 						statusMessage := new(gateway.Status)
 						statusMessage.Description = "Awesome Description"
 						bin, _ := proto.Marshal(statusMessage)
-						mqtt.publish(fmt.Sprintf(StatusTopicFormat, "dev"), bin).Wait()
+						token, _ := mqtt.publish(fmt.Sprintf(StatusTopicFormat, "dev"), bin)
+						token.Wait()
 						Convey("There should be a corresponding StatusMessage in the channel", func() {
 							select {
 							case <-time.After(time.Second):
@@ -217,3 +219,124 @@ func TestMQTT(t *testing.T) {
 
 	})
 }
+
+func TestFormatClientID(t *testing.T) {
+	Convey("Given client ID templates", t, func(c C) {
+		Convey("The default template should be unique", func() {
+			clientID, unique, err := FormatClientID("")
+			So(err, ShouldBeNil)
+			So(clientID, ShouldStartWith, "bridge-")
+			So(clientID, ShouldHaveLength, 23)
+			So(unique, ShouldBeTrue)
+		})
+		Convey("Hostname and PID should be unique", func() {
+			hostname, _ := os.Hostname()
+			clientID, unique, err := FormatClientID("bridge-{hostname}-{pid}")
+			So(err, ShouldBeNil)
+			So(clientID, ShouldEqual, fmt.Sprintf("bridge-%s-%d", hostname, os.Getpid()))
+			So(unique, ShouldBeTrue)
+		})
+		Convey("A static client ID should not be unique", func() {
+			clientID, unique, err := FormatClientID("my-bridge")
+			So(err, ShouldBeNil)
+			So(clientID, ShouldEqual, "my-bridge")
+			So(unique, ShouldBeFalse)
+		})
+		Convey("An unknown placeholder should return an error", func() {
+			_, _, err := FormatClientID("bridge-{foo}")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestKeepAlive(t *testing.T) {
+	Convey("Given an MQTT config", t, func(c C) {
+		Convey("Without keep-alive, the defaults should be used", func() {
+			keepAlive, pingTimeout, err := keepAlive(Config{})
+			So(err, ShouldBeNil)
+			So(keepAlive, ShouldEqual, DefaultKeepAlive)
+			So(pingTimeout, ShouldEqual, DefaultPingTimeout)
+		})
+		Convey("With a valid keep-alive, it should be used", func() {
+			keepAlive, pingTimeout, err := keepAlive(Config{KeepAlive: 5 * time.Second, PingTimeout: 2 * time.Second})
+			So(err, ShouldBeNil)
+			So(keepAlive, ShouldEqual, 5*time.Second)
+			So(pingTimeout, ShouldEqual, 2*time.Second)
+		})
+		Convey("With an invalid keep-alive, New should return an error", func() {
+			_, err := New(Config{KeepAlive: 500 * time.Millisecond}, log.Log)
+			So(err, ShouldNotBeNil)
+			_, err = New(Config{KeepAlive: 5 * time.Second, PingTimeout: 5 * time.Second}, log.Log)
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestConnectTimeout(t *testing.T) {
+	Convey("Given a broker that does not respond", t, func(c C) {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		So(err, ShouldBeNil)
+		Reset(func() { lis.Close() })
+		go func() {
+			for {
+				conn, err := lis.Accept()
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+			}
+		}()
+
+		Convey("When connecting with a connect timeout", func() {
+			mqtt, err := New(Config{
+				Brokers:        []string{fmt.Sprintf("tcp://%s", lis.Addr())},
+				ConnectTimeout: 200 * time.Millisecond,
+			}, log.Log)
+			So(err, ShouldBeNil)
+			start := time.Now()
+			err = mqtt.Connect()
+			Convey("Connect should return when the timeout elapses", func() {
+				So(err, ShouldNotBeNil)
+				So(time.Since(start), ShouldBeLessThan, time.Second)
+			})
+		})
+	})
+}
+
+func TestMQTTWill(t *testing.T) {
+	Convey("Given a new MQTT with a will topic", t, func(c C) {
+		ctx := log.Log
+		mqtt, err := New(Config{
+			Brokers:   []string{fmt.Sprintf("tcp://%s", host)},
+			WillTopic: "bridge/test-will",
+		}, ctx)
+		So(err, ShouldBeNil)
+		listener, _ := New(Config{
+			Brokers: []string{fmt.Sprintf("tcp://%s", host)},
+		}, ctx)
+
+		Convey("When both are connected", func() {
+			So(mqtt.Connect(), ShouldBeNil)
+			So(listener.Connect(), ShouldBeNil)
+			Reset(func() { listener.Disconnect() })
+
+			payloads := make(chan string, 1)
+			token := listener.subscribe("bridge/test-will", func(_ paho.Client, msg paho.Message) {
+				payloads <- string(msg.Payload())
+			}, nil)
+			token.Wait()
+
+			Convey("When disconnecting cleanly", func() {
+				mqtt.Disconnect()
+				Convey("A stopped message should be published", func() {
+					select {
+					case <-time.After(time.Second):
+						So("Timeout Exceeded", ShouldBeFalse)
+					case payload := <-payloads:
+						So(payload, ShouldEqual, DefaultStoppedPayload)
+					}
+				})
+			})
+		})
+	})
+}
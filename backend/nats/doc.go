@@ -0,0 +1,36 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+// Package nats connects to a NATS server with JetStream in order to communicate
+// with servers up the chain.
+//
+// Uplink messages are published as protocol buffers on the
+// "bridge.[gateway-id].up" subject, and gateway status messages on the
+// "bridge.[gateway-id].status" subject. Messages are published to a JetStream
+// stream (Config.Stream, created if it does not exist), and a publish only
+// succeeds once the server acknowledged that the message is stored. The
+// attributes of the messages (such as the tags and flags that middleware
+// injects) are sent as message headers, with the attribute key as header key.
+//
+// Downlink messages are received as protocol buffers on the
+// "bridge.[gateway-id].down" subject. The bridge should call
+// `SubscribeDownlink("gateway-id")`, which creates (or resumes) a durable
+// consumer for the gateway. Downlinks are acknowledged once they are handed to
+// the bridge. Downlinks that were not acknowledged within Config.AckWait (for
+// example because the bridge unsubscribed or lost its connection) are
+// redelivered up to Config.MaxDeliver times. Downlinks that can not be parsed
+// are terminated, so that they are not redelivered. Consumers of gateways that
+// do not subscribe again are removed by the server after
+// Config.ConsumerInactiveThreshold.
+//
+// Acknowledgements of downlink messages by gateways are published as JSON on
+// the "bridge.[gateway-id].down.ack" subject. They are not stored in the
+// stream, and are only received by clients that are subscribed at the time.
+//
+// The client reconnects automatically when the connection to the server is
+// lost, and resumes the consumers of the subscribed gateways.
+//
+// By default, the LoRaWAN payload in the protocol buffers is sent as raw bytes.
+// Config.PayloadTransformer can be used to encode it differently (for example
+// as base64 or hex) for consumers that expect this.
+package nats
@@ -0,0 +1,482 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package nats
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TheThingsNetwork/api/trace"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/backend"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/events"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
+	"github.com/TheThingsNetwork/go-utils/backoff"
+	"github.com/apex/log"
+	"github.com/gogo/protobuf/proto"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// New returns a new NATS JetStream backend
+func New(config Config, ctx log.Interface) (*NATS, error) {
+	if config.URL == "" {
+		config.URL = nats.DefaultURL
+	}
+	if config.Stream == "" {
+		config.Stream = "BRIDGE"
+	}
+	if config.ConsumerPrefix == "" {
+		config.ConsumerPrefix = "bridge"
+	}
+	if config.AckWait <= 0 {
+		config.AckWait = 30 * time.Second
+	}
+	if config.MaxDeliver <= 0 {
+		config.MaxDeliver = 5
+	}
+	if config.ConsumerInactiveThreshold <= 0 {
+		config.ConsumerInactiveThreshold = time.Hour
+	}
+	if config.PayloadTransformer == nil {
+		config.PayloadTransformer = backend.RawPayload
+	}
+	return &NATS{
+		config:        config,
+		ctx:           ctx.WithField("Connector", "NATS"),
+		connected:     make(chan struct{}),
+		subscriptions: make(map[string]*subscription),
+	}, nil
+}
+
+// Subject formats for uplink, status and downlink messages, and the subjects of the stream
+var (
+	UplinkSubjectFormat   = "bridge.%s.up"
+	StatusSubjectFormat   = "bridge.%s.status"
+	DownlinkSubjectFormat = "bridge.%s.down"
+	StreamSubjects        = []string{"bridge.*.up", "bridge.*.status", "bridge.*.down"}
+)
+
+// DownlinkAckSubjectFormat is the subject format for downlink acknowledgements, which are not stored in the stream
+var DownlinkAckSubjectFormat = "bridge.%s.down.ack"
+
+var (
+	// ConnectRetries says how many times the client should retry a failed initial connection
+	ConnectRetries = 10
+	// ConnectRetryDelay says how long the client should wait between retries, also when reconnecting
+	ConnectRetryDelay = time.Second
+	// SetupTimeout is the timeout of requests to the JetStream API, such as creating streams and consumers
+	SetupTimeout = 10 * time.Second
+)
+
+// Config contains configuration for NATS
+type Config struct {
+	// URL is the comma-separated list of servers, optionally with user:pass@ for authentication
+	URL       string
+	TLSConfig *tls.Config
+
+	// Stream is the name of the JetStream stream that stores the messages (default BRIDGE). It is created with
+	// StreamSubjects if it does not exist.
+	Stream string
+
+	// ConsumerPrefix is the prefix of the names of the durable downlink consumers (default bridge)
+	ConsumerPrefix string
+
+	// AckWait is the time after which downlinks that were not acknowledged are redelivered (default 30s), up to
+	// MaxDeliver times (default 5)
+	AckWait    time.Duration
+	MaxDeliver int
+
+	// ConsumerInactiveThreshold is the time after which the server removes the consumer of a gateway that is no
+	// longer subscribed (default 1h)
+	ConsumerInactiveThreshold time.Duration
+
+	// PayloadTransformer transforms the LoRaWAN payload of published uplink messages, and reverses this for
+	// received downlink messages. Defaults to backend.RawPayload.
+	PayloadTransformer backend.PayloadTransformer
+
+	// ConnectTimeout is the total time during which the initial connection is retried, waiting between attempts
+	// according to ConnectBackoff. If zero, the connection is retried ConnectRetries times in the background.
+	ConnectTimeout time.Duration
+	ConnectBackoff backoff.Config
+
+	// PublishTimeout is the time that a publish waits for the acknowledgement of the server before it returns
+	// backend.ErrPublishTimeout. If zero, the default timeout of the JetStream client is used.
+	PublishTimeout time.Duration
+
+	// Events receives BackendDisconnected and BackendReconnected events when the connection to the server is lost
+	// and restored. It may be nil.
+	Events *events.Notifier
+}
+
+type subscription struct {
+	downlink chan *types.DownlinkMessage
+	consume  jetstream.ConsumeContext
+	done     chan struct{}
+	mu       sync.RWMutex // held for writing when the downlink channel is closed
+	closed   bool
+}
+
+// NATS side of the bridge
+type NATS struct {
+	config Config
+	ctx    log.Interface
+
+	mu          sync.RWMutex
+	conn        *nats.Conn
+	js          jetstream.JetStream
+	connected   chan struct{} // closed when the initial connection is established
+	connectOnce sync.Once
+	connectErr  error // set when the initial connection failed
+
+	subscriptions    map[string]*subscription
+	subscriptionLock sync.Mutex
+}
+
+func (n *NATS) connect() error {
+	opts := []nats.Option{
+		nats.Name("gateway-connector-bridge"),
+		nats.MaxReconnects(-1),
+		nats.ReconnectWait(ConnectRetryDelay),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err == nil {
+				return // Closed by Disconnect
+			}
+			n.ctx.WithError(err).Warn("Connection lost")
+			n.config.Events.Emit(events.Event{Kind: events.BackendDisconnected, Source: "nats", Message: err.Error()})
+		}),
+		nats.ReconnectHandler(func(*nats.Conn) {
+			n.ctx.Info("Reconnected")
+			n.config.Events.Emit(events.Event{Kind: events.BackendReconnected, Source: "nats", Message: "Reconnected to NATS"})
+		}),
+	}
+	if n.config.TLSConfig != nil {
+		opts = append(opts, nats.Secure(n.config.TLSConfig))
+	}
+	conn, err := nats.Connect(n.config.URL, opts...)
+	if err != nil {
+		return err
+	}
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), SetupTimeout)
+	defer cancel()
+	if _, err := js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:     n.config.Stream,
+		Subjects: StreamSubjects,
+		Storage:  jetstream.FileStorage,
+	}); err != nil {
+		conn.Close()
+		return fmt.Errorf("could not set up stream %s (%s)", n.config.Stream, err)
+	}
+	n.mu.Lock()
+	n.conn, n.js = conn, js
+	n.mu.Unlock()
+	n.connectOnce.Do(func() { close(n.connected) })
+	n.ctx.Info("Connected")
+	return nil
+}
+
+// Connect to NATS. If a ConnectTimeout is configured, Connect blocks until the initial connection is established
+// and returns an error if that did not succeed within the timeout. Otherwise it connects in the background. Once
+// connected, the client reconnects automatically.
+func (n *NATS) Connect() error {
+	if n.config.ConnectTimeout > 0 {
+		if err := backend.RetryConnect(n.ctx, n.config.ConnectTimeout, n.config.ConnectBackoff, n.connect); err != nil {
+			n.mu.Lock()
+			n.connectErr = err
+			n.mu.Unlock()
+			return fmt.Errorf("Could not connect to NATS (%s)", err)
+		}
+		return nil
+	}
+	go func() {
+		for retries := ConnectRetries; ; {
+			err := n.connect()
+			if err == nil {
+				return
+			}
+			n.ctx.WithError(err).Warn("Error trying to connect")
+			retries--
+			if retries <= 0 {
+				n.ctx.WithError(err).Error("Could not connect")
+				n.mu.Lock()
+				n.connectErr = err
+				n.mu.Unlock()
+				return
+			}
+			time.Sleep(ConnectRetryDelay)
+		}
+	}()
+	return nil
+}
+
+// Disconnect from NATS. The durable consumers are kept, so that downlinks are redelivered when the gateways
+// subscribe again.
+func (n *NATS) Disconnect() error {
+	n.subscriptionLock.Lock()
+	for gatewayID, sub := range n.subscriptions {
+		sub.stop()
+		delete(n.subscriptions, gatewayID)
+	}
+	n.subscriptionLock.Unlock()
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	if n.conn != nil {
+		n.conn.Close()
+	}
+	return nil
+}
+
+// Validate checks that at least one of the NATS servers can be reached. It does not connect the client.
+func (n *NATS) Validate(ctx context.Context) error {
+	var addresses []string
+	for _, server := range strings.Split(n.config.URL, ",") {
+		u, err := url.Parse(strings.TrimSpace(server))
+		if err != nil {
+			return fmt.Errorf("nats: invalid server %q: %w", server, err)
+		}
+		address := u.Host
+		if u.Port() == "" {
+			address = net.JoinHostPort(u.Hostname(), "4222")
+		}
+		addresses = append(addresses, address)
+	}
+	if err := backend.Dial(ctx, addresses...); err != nil {
+		return fmt.Errorf("nats: could not reach server: %w", err)
+	}
+	return nil
+}
+
+// HealthCheck returns an error if the client is not connected to NATS, or if the stream can not be looked up
+func (n *NATS) HealthCheck(ctx context.Context) error {
+	n.mu.RLock()
+	conn, js, connectErr := n.conn, n.js, n.connectErr
+	n.mu.RUnlock()
+	switch {
+	case connectErr != nil:
+		return fmt.Errorf("%w: nats: could not connect: %w", backend.ErrFatal, connectErr)
+	case conn == nil:
+		return fmt.Errorf("%w: nats: not connected yet", backend.ErrTransient)
+	}
+	switch status := conn.Status(); status {
+	case nats.CONNECTED:
+	case nats.CLOSED:
+		return fmt.Errorf("%w: nats: connection closed", backend.ErrFatal)
+	default:
+		return fmt.Errorf("%w: nats: %s", backend.ErrTransient, status)
+	}
+	if _, err := js.Stream(ctx, n.config.Stream); err != nil {
+		return fmt.Errorf("%w: nats: could not look up stream %s: %w", backend.ErrTransient, n.config.Stream, err)
+	}
+	return nil
+}
+
+// jetStream waits until the client is connected, or until ctx is done
+func (n *NATS) jetStream(ctx context.Context) (jetstream.JetStream, error) {
+	select {
+	case <-n.connected:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.js, nil
+}
+
+// attributeHeader returns the attributes of a message as NATS message headers, or nil if there are none
+func attributeHeader(attributes map[string]string) nats.Header {
+	if len(attributes) == 0 {
+		return nil
+	}
+	header := make(nats.Header, len(attributes))
+	for key, value := range attributes {
+		header[key] = []string{value}
+	}
+	return header
+}
+
+func (n *NATS) publish(subject string, data []byte, attributes map[string]string) error {
+	ctx := context.Background()
+	if n.config.PublishTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, n.config.PublishTimeout)
+		defer cancel()
+	}
+	js, err := n.jetStream(ctx)
+	if err == nil {
+		_, err = js.PublishMsg(ctx, &nats.Msg{Subject: subject, Data: data, Header: attributeHeader(attributes)})
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return backend.PublishTimedOut("nats")
+	}
+	return err
+}
+
+// CleanupGateway does nothing, as subscriptions are cleaned up by UnsubscribeDownlink
+func (n *NATS) CleanupGateway(gatewayID string) {}
+
+// PublishUplink publishes uplink messages to NATS
+func (n *NATS) PublishUplink(message *types.UplinkMessage) error {
+	ctx := n.ctx.WithField("GatewayID", message.GatewayID)
+	if types.Tracing(types.TraceBasic) {
+		message.Message.Trace = message.Message.Trace.WithEvent(trace.ForwardEvent, "backend", "nats")
+	}
+	uplink := *message.Message
+	payload, err := n.config.PayloadTransformer.Encode(uplink.Payload)
+	if err != nil {
+		return err
+	}
+	uplink.Payload = payload
+	msg, err := proto.Marshal(&uplink)
+	if err != nil {
+		return err
+	}
+	if err := n.publish(fmt.Sprintf(UplinkSubjectFormat, message.GatewayID), msg, message.Attributes); err != nil {
+		return err
+	}
+	ctx.WithField("ProtoSize", len(msg)).Debug("Published uplink message")
+	return nil
+}
+
+// PublishStatus publishes status messages to NATS
+func (n *NATS) PublishStatus(message *types.StatusMessage) error {
+	ctx := n.ctx.WithField("GatewayID", message.GatewayID)
+	msg, err := proto.Marshal(message.Message)
+	if err != nil {
+		return err
+	}
+	if err := n.publish(fmt.Sprintf(StatusSubjectFormat, message.GatewayID), msg, message.Attributes); err != nil {
+		return err
+	}
+	ctx.WithField("ProtoSize", len(msg)).Debug("Published status message")
+	return nil
+}
+
+// PublishDownlinkAck publishes downlink acknowledgements to NATS. Acknowledgements are published as JSON without
+// JetStream, so they are only received by subscribers that are connected at the time.
+func (n *NATS) PublishDownlinkAck(message *types.DownlinkAckMessage) error {
+	n.mu.RLock()
+	conn := n.conn
+	n.mu.RUnlock()
+	if conn == nil {
+		return errors.New("nats: not connected yet")
+	}
+	msg, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	if err := conn.Publish(fmt.Sprintf(DownlinkAckSubjectFormat, message.GatewayID), msg); err != nil {
+		return err
+	}
+	n.ctx.WithField("GatewayID", message.GatewayID).Debug("Published downlink ack")
+	return nil
+}
+
+// consumerName returns the name of the durable consumer of a gateway. Consumer names can not contain the
+// characters that NATS uses in subjects.
+func (n *NATS) consumerName(gatewayID string) string {
+	return n.config.ConsumerPrefix + "-" + strings.NewReplacer(".", "_", "*", "_", ">", "_", " ", "_").Replace(gatewayID)
+}
+
+// SubscribeDownlink handles downlink messages for the given gateway ID
+func (n *NATS) SubscribeDownlink(gatewayID string) (<-chan *types.DownlinkMessage, error) {
+	ctx := n.ctx.WithField("GatewayID", gatewayID)
+
+	setupCtx, cancel := context.WithTimeout(context.Background(), SetupTimeout)
+	defer cancel()
+	js, err := n.jetStream(setupCtx)
+	if err != nil {
+		return nil, err
+	}
+	consumer, err := js.CreateOrUpdateConsumer(setupCtx, n.config.Stream, jetstream.ConsumerConfig{
+		Durable:           n.consumerName(gatewayID),
+		FilterSubject:     fmt.Sprintf(DownlinkSubjectFormat, gatewayID),
+		DeliverPolicy:     jetstream.DeliverNewPolicy,
+		AckPolicy:         jetstream.AckExplicitPolicy,
+		AckWait:           n.config.AckWait,
+		MaxDeliver:        n.config.MaxDeliver,
+		InactiveThreshold: n.config.ConsumerInactiveThreshold,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sub := &subscription{
+		downlink: make(chan *types.DownlinkMessage),
+		done:     make(chan struct{}),
+	}
+	sub.consume, err = consumer.Consume(func(msg jetstream.Msg) {
+		sub.mu.RLock()
+		defer sub.mu.RUnlock()
+		if sub.closed {
+			msg.Nak()
+			return
+		}
+		in, err := types.ParseDownlink(msg.Data())
+		if err == nil {
+			in.Payload, err = n.config.PayloadTransformer.Decode(in.Payload)
+		}
+		if err != nil {
+			ctx.WithError(err).Warn("Could not handle downlink message")
+			msg.Term()
+			return
+		}
+		ctx.Debug("Downlink message received")
+		if types.Tracing(types.TraceBasic) {
+			in.Trace = in.Trace.WithEvent(trace.ReceiveEvent, "backend", "nats")
+		}
+		select {
+		case sub.downlink <- &types.DownlinkMessage{GatewayID: gatewayID, Message: in}:
+			msg.Ack()
+		case <-sub.done:
+			msg.Nak()
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	n.subscriptionLock.Lock()
+	if prev, ok := n.subscriptions[gatewayID]; ok {
+		prev.stop()
+	}
+	n.subscriptions[gatewayID] = sub
+	n.subscriptionLock.Unlock()
+
+	return sub.downlink, nil
+}
+
+// stop stops consuming and closes the downlink channel. Downlinks that are being handled are not acknowledged, so
+// that they are redelivered.
+func (s *subscription) stop() {
+	close(s.done)
+	s.consume.Stop()
+	s.mu.Lock()
+	s.closed = true
+	close(s.downlink)
+	s.mu.Unlock()
+}
+
+// UnsubscribeDownlink unsubscribes from downlink messages for the given gateway ID. The durable consumer is kept
+// until ConsumerInactiveThreshold, so that downlinks are not lost if the gateway subscribes again.
+func (n *NATS) UnsubscribeDownlink(gatewayID string) error {
+	n.subscriptionLock.Lock()
+	defer n.subscriptionLock.Unlock()
+	if sub, ok := n.subscriptions[gatewayID]; ok {
+		sub.stop()
+		delete(n.subscriptions, gatewayID)
+	}
+	return nil
+}
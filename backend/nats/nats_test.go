@@ -0,0 +1,188 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package nats
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/TheThingsNetwork/api/gateway"
+	"github.com/TheThingsNetwork/api/router"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/backend"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
+	"github.com/apex/log"
+	"github.com/apex/log/handlers/text"
+	"github.com/gogo/protobuf/proto"
+	"github.com/nats-io/nats.go"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+var natsURL string
+
+func init() {
+	natsURL = os.Getenv("NATS_ADDRESS")
+	if natsURL == "" {
+		natsURL = "nats://localhost:4222"
+	}
+}
+
+func TestConsumerName(t *testing.T) {
+	Convey("Consumer names should not contain subject characters", t, func(c C) {
+		n, _ := New(Config{}, log.Log)
+		So(n.consumerName("dev"), ShouldEqual, "bridge-dev")
+		So(n.consumerName("eui.*>"), ShouldEqual, "bridge-eui___")
+	})
+}
+
+func TestAttributeHeader(t *testing.T) {
+	Convey("Attributes should be sent as message headers", t, func(c C) {
+		So(attributeHeader(nil), ShouldBeNil)
+		So(attributeHeader(map[string]string{"auto_update": "true"}), ShouldResemble, nats.Header{"auto_update": []string{"true"}})
+	})
+}
+
+func TestNATS(t *testing.T) {
+	Convey("Given a new Context", t, func(c C) {
+
+		var logs bytes.Buffer
+		ctx := &log.Logger{
+			Handler: text.New(&logs),
+			Level:   log.DebugLevel,
+		}
+		defer func() {
+			if logs.Len() > 0 {
+				c.Printf("\n%s", logs.String())
+			}
+		}()
+
+		Convey("Before connecting it should be temporarily unhealthy", func() {
+			n, err := New(Config{URL: natsURL}, ctx)
+			So(err, ShouldBeNil)
+			So(errors.Is(n.HealthCheck(context.Background()), backend.ErrTransient), ShouldBeTrue)
+		})
+
+		Convey("When connecting to NATS", func() {
+			stream := fmt.Sprintf("TEST_%d", time.Now().UnixNano())
+			n, err := New(Config{
+				URL:            natsURL,
+				Stream:         stream,
+				AckWait:        time.Second,
+				ConnectTimeout: time.Second,
+			}, ctx)
+			So(err, ShouldBeNil)
+			So(n.Connect(), ShouldBeNil)
+			Reset(func() {
+				if n.js != nil {
+					n.js.DeleteStream(context.Background(), stream)
+				}
+				n.Disconnect()
+			})
+
+			Convey("It should be healthy", func() {
+				So(n.HealthCheck(context.Background()), ShouldBeNil)
+			})
+
+			Convey("When disconnecting it should be unhealthy", func() {
+				n.js.DeleteStream(context.Background(), stream)
+				n.Disconnect()
+				So(errors.Is(n.HealthCheck(context.Background()), backend.ErrFatal), ShouldBeTrue)
+			})
+
+			Convey("When publishing an uplink message", func() {
+				err := n.PublishUplink(&types.UplinkMessage{
+					GatewayID:  "dev",
+					Message:    &router.UplinkMessage{Payload: []byte{1, 2, 3, 4}},
+					Attributes: map[string]string{"site": "rooftop"},
+				})
+				Convey("There should be no error", func() {
+					So(err, ShouldBeNil)
+				})
+				Convey("It should be stored in the stream", func() {
+					s, err := n.js.Stream(context.Background(), stream)
+					So(err, ShouldBeNil)
+					msg, err := s.GetLastMsgForSubject(context.Background(), "bridge.dev.up")
+					So(err, ShouldBeNil)
+					uplink, err := types.ParseUplink(msg.Data)
+					So(err, ShouldBeNil)
+					So(uplink.Payload, ShouldResemble, []byte{1, 2, 3, 4})
+					So(msg.Header["site"], ShouldResemble, []string{"rooftop"})
+				})
+			})
+
+			Convey("When publishing a status message", func() {
+				err := n.PublishStatus(&types.StatusMessage{
+					GatewayID: "dev",
+					Message:   &gateway.Status{Description: "Awesome Description"},
+				})
+				Convey("There should be no error", func() {
+					So(err, ShouldBeNil)
+				})
+			})
+
+			Convey("When subscribing to downlink messages", func() {
+				downlink, err := n.SubscribeDownlink("dev")
+				So(err, ShouldBeNil)
+				Reset(func() { n.UnsubscribeDownlink("dev") })
+
+				Convey("When a downlink message is published", func() {
+					data, _ := proto.Marshal(&router.DownlinkMessage{Payload: []byte{1, 2, 3, 4}})
+					_, err := n.js.Publish(context.Background(), "bridge.dev.down", data)
+					So(err, ShouldBeNil)
+
+					Convey("It should be received and acknowledged", func() {
+						select {
+						case msg := <-downlink:
+							So(msg.GatewayID, ShouldEqual, "dev")
+							So(msg.Message.Payload, ShouldResemble, []byte{1, 2, 3, 4})
+						case <-time.After(5 * time.Second):
+							So("Timeout Exceeded", ShouldBeFalse)
+						}
+						time.Sleep(100 * time.Millisecond)
+						consumer, err := n.js.Consumer(context.Background(), stream, n.consumerName("dev"))
+						So(err, ShouldBeNil)
+						info, err := consumer.Info(context.Background())
+						So(err, ShouldBeNil)
+						So(info.NumAckPending, ShouldEqual, 0)
+					})
+				})
+
+				Convey("When a malformed downlink message is published", func() {
+					_, err := n.js.Publish(context.Background(), "bridge.dev.down", []byte{0xff, 0xff, 0xff})
+					So(err, ShouldBeNil)
+
+					Convey("It should not be delivered", func() {
+						select {
+						case <-downlink:
+							So("Received malformed downlink", ShouldBeFalse)
+						case <-time.After(100 * time.Millisecond):
+						}
+					})
+				})
+
+				Convey("When unsubscribing and publishing a downlink message", func() {
+					n.UnsubscribeDownlink("dev")
+					data, _ := proto.Marshal(&router.DownlinkMessage{Payload: []byte{5, 6, 7, 8}})
+					_, err := n.js.Publish(context.Background(), "bridge.dev.down", data)
+					So(err, ShouldBeNil)
+
+					Convey("It should be delivered when subscribing again", func() {
+						downlink, err := n.SubscribeDownlink("dev")
+						So(err, ShouldBeNil)
+						select {
+						case msg := <-downlink:
+							So(msg.Message.Payload, ShouldResemble, []byte{5, 6, 7, 8})
+						case <-time.After(5 * time.Second):
+							So("Timeout Exceeded", ShouldBeFalse)
+						}
+					})
+				})
+			})
+		})
+	})
+}
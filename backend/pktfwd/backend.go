@@ -79,6 +79,54 @@ func (c *gateways) set(mac lorawan.EUI64, gw gateway) error {
 	return nil
 }
 
+// txAckTimeout is how long the token of a PULL_RESP is kept to match the TX_ACK of the gateway to the downlink
+const txAckTimeout = time.Minute
+
+type sentDownlink struct {
+	mac   lorawan.EUI64
+	token uint16
+}
+
+type sentDownlinkInfo struct {
+	id   string
+	sent time.Time
+}
+
+// sentDownlinks keeps the IDs of the downlink messages that were sent to the gateways by the random token of their
+// PULL_RESP packet. The gateway echoes this token in its TX_ACK packet.
+type sentDownlinks struct {
+	sync.Mutex
+	downlinks map[sentDownlink]sentDownlinkInfo
+}
+
+func (s *sentDownlinks) add(mac lorawan.EUI64, token uint16, id string) {
+	defer s.Unlock()
+	s.Lock()
+	s.downlinks[sentDownlink{mac, token}] = sentDownlinkInfo{id: id, sent: time.Now()}
+}
+
+// take returns the ID of the downlink message that was sent to the gateway with the token, and forgets the token
+func (s *sentDownlinks) take(mac lorawan.EUI64, token uint16) (id string, ok bool) {
+	defer s.Unlock()
+	s.Lock()
+	downlink, ok := s.downlinks[sentDownlink{mac, token}]
+	if !ok || time.Since(downlink.sent) > txAckTimeout {
+		return "", false
+	}
+	delete(s.downlinks, sentDownlink{mac, token})
+	return downlink.id, true
+}
+
+func (s *sentDownlinks) cleanup() {
+	defer s.Unlock()
+	s.Lock()
+	for key, downlink := range s.downlinks {
+		if time.Since(downlink.sent) > txAckTimeout {
+			delete(s.downlinks, key)
+		}
+	}
+}
+
 func (c *gateways) cleanup() error {
 	defer c.Unlock()
 	c.Lock()
@@ -101,9 +149,11 @@ type Backend struct {
 	conn         *net.UDPConn
 	rxChan       chan *types.UplinkMessage
 	statsChan    chan *types.StatusMessage
+	txAckChan    chan *types.DownlinkAckMessage
 	udpSendChan  chan udpPacket
 	closed       bool
 	gateways     gateways
+	downlinks    sentDownlinks
 	wg           sync.WaitGroup
 	skipCRCCheck bool
 
@@ -130,6 +180,7 @@ func NewBackend(config Config, onNew func(lorawan.EUI64) error, onDelete func(lo
 		conn:         conn,
 		rxChan:       make(chan *types.UplinkMessage),
 		statsChan:    make(chan *types.StatusMessage),
+		txAckChan:    make(chan *types.DownlinkAckMessage),
 		udpSendChan:  make(chan udpPacket),
 		gateways: gateways{
 			session:  config.Session,
@@ -137,6 +188,9 @@ func NewBackend(config Config, onNew func(lorawan.EUI64) error, onDelete func(lo
 			onNew:    onNew,
 			onDelete: onDelete,
 		},
+		downlinks: sentDownlinks{
+			downlinks: make(map[sentDownlink]sentDownlinkInfo),
+		},
 	}
 
 	if config.LockIP {
@@ -150,6 +204,7 @@ func NewBackend(config Config, onNew func(lorawan.EUI64) error, onDelete func(lo
 			if err := b.gateways.cleanup(); err != nil {
 				b.log.Errorf("Gateways cleanup failed: %s", err)
 			}
+			b.downlinks.cleanup()
 			time.Sleep(time.Minute)
 		}
 	}()
@@ -198,9 +253,16 @@ func (b *Backend) StatsChan() chan *types.StatusMessage {
 	return b.statsChan
 }
 
-// Send sends the given packet to the gateway.
+// TXAckChan returns the channel containing the received TX acknowledgements.
+func (b *Backend) TXAckChan() chan *types.DownlinkAckMessage {
+	return b.txAckChan
+}
+
+// Send sends the given packet to the gateway. The random token of the PULL_RESP packet is kept, so that the TX_ACK
+// of the gateway can be matched to the downlink message.
 func (b *Backend) Send(txPacket *types.DownlinkMessage) error {
-	gw, err := b.gateways.get(getMac(txPacket.GatewayID))
+	mac := getMac(txPacket.GatewayID)
+	gw, err := b.gateways.get(mac)
 	if err != nil {
 		return err
 	}
@@ -208,9 +270,11 @@ func (b *Backend) Send(txPacket *types.DownlinkMessage) error {
 	if err != nil {
 		return err
 	}
+	token := uint16(pseudorandom.Intn(1 << 16))
+	b.downlinks.add(mac, token, txPacket.ID())
 	pullResp := PullRespPacket{
 		ProtocolVersion: gw.protocolVersion,
-		RandomToken:     uint16(pseudorandom.Intn(1 << 16)),
+		RandomToken:     token,
 		Payload: PullRespPayload{
 			TXPK: txpk,
 		},
@@ -394,7 +458,9 @@ func (b *Backend) handleRXPacket(addr *net.UDPAddr, mac lorawan.EUI64, rxpk RXPK
 		return err
 	}
 	rxPacket.GatewayAddr = addr
-	rxPacket.Message.Trace = rxPacket.Message.Trace.WithEvent(trace.ReceiveEvent, "backend", "packet-forwarder")
+	if types.Tracing(types.TraceBasic) {
+		rxPacket.Message.Trace = rxPacket.Message.Trace.WithEvent(trace.ReceiveEvent, "backend", "packet-forwarder")
+	}
 	b.rxChan <- rxPacket
 	return nil
 }
@@ -410,14 +476,21 @@ func (b *Backend) handleTXACK(addr *net.UDPAddr, data []byte) error {
 		}
 	}
 	var errBool bool
+	ack := &types.DownlinkAckMessage{GatewayID: getID(p.GatewayMAC)}
 
 	logFields := log.Fields{
-		"addr": addr,
-		"mac":  p.GatewayMAC,
+		"addr":  addr,
+		"mac":   p.GatewayMAC,
+		"token": p.RandomToken,
+	}
+	if id, ok := b.downlinks.take(p.GatewayMAC, p.RandomToken); ok {
+		ack.DownlinkID = id
+		logFields["downlink_id"] = id
 	}
 	if p.Payload != nil {
-		if p.Payload.TXPKACK.Error != "NONE" {
+		if p.Payload.TXPKACK.Error != "NONE" && p.Payload.TXPKACK.Error != "" {
 			errBool = true
+			ack.Error = p.Payload.TXPKACK.Error
 		}
 		logFields["error"] = p.Payload.TXPKACK.Error
 	}
@@ -428,6 +501,7 @@ func (b *Backend) handleTXACK(addr *net.UDPAddr, data []byte) error {
 		b.log.WithFields(logFields).Debug("tx ack received")
 	}
 
+	b.txAckChan <- ack
 	return nil
 }
 
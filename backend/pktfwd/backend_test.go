@@ -10,6 +10,7 @@ import (
 	pb_protocol "github.com/TheThingsNetwork/api/protocol"
 	pb_lorawan "github.com/TheThingsNetwork/api/protocol/lorawan"
 	pb_router "github.com/TheThingsNetwork/api/router"
+	"github.com/TheThingsNetwork/api/trace"
 	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
 	"github.com/brocaar/lorawan"
 	. "github.com/smartystreets/goconvey/convey"
@@ -320,6 +321,7 @@ func TestBackend(t *testing.T) {
 							PolarizationInversion: true,
 						},
 						Payload: []byte{1, 2, 3, 4},
+						Trace:   &trace.Trace{ID: "downlink"},
 					},
 				}
 
@@ -384,6 +386,36 @@ func TestBackend(t *testing.T) {
 							},
 						})
 					})
+
+					Convey("Then the TX_ACK of the gateway is matched to the downlink", func() {
+						i, _, err := gwConn.ReadFromUDP(buf)
+						So(err, ShouldBeNil)
+						var pullResp PullRespPacket
+						So(pullResp.UnmarshalBinary(buf[:i]), ShouldBeNil)
+
+						for _, token := range []uint16{pullResp.RandomToken, pullResp.RandomToken} {
+							txAck := TXACKPacket{
+								ProtocolVersion: ProtocolVersion2,
+								RandomToken:     token,
+								GatewayMAC:      p.GatewayMAC,
+							}
+							b, err := txAck.MarshalBinary()
+							So(err, ShouldBeNil)
+							_, err = gwConn.WriteToUDP(b, backendAddr)
+							So(err, ShouldBeNil)
+						}
+
+						// Only one of the TX_ACK packets with the same token is matched
+						var downlinkIDs []string
+						for i := 0; i < 2; i++ {
+							ack := <-backend.TXAckChan()
+							So(ack.GatewayID, ShouldEqual, "eui-0102030405060708")
+							So(ack.Error, ShouldBeEmpty)
+							downlinkIDs = append(downlinkIDs, ack.DownlinkID)
+						}
+						So(downlinkIDs, ShouldContain, "downlink")
+						So(downlinkIDs, ShouldContain, "")
+					})
 				})
 			})
 		})
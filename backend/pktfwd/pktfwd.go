@@ -44,6 +44,7 @@ type PacketForwarder struct {
 	disconnect chan *types.DisconnectMessage
 	uplink     map[string]chan *types.UplinkMessage
 	status     map[string]chan *types.StatusMessage
+	ack        chan *types.DownlinkAckMessage
 }
 
 // Connect implements the Southbound interface
@@ -83,6 +84,18 @@ func (f *PacketForwarder) Connect() (err error) {
 		}
 	}()
 
+	go func() {
+		for ack := range f.backend.TXAckChan() {
+			f.mu.RLock()
+			if f.ack != nil {
+				f.ack <- ack
+			} else {
+				f.ctx.WithField("GatewayID", ack.GatewayID).Debug("Dropping downlink ack")
+			}
+			f.mu.RUnlock()
+		}
+	}()
+
 	return
 }
 
@@ -123,6 +136,25 @@ func (f *PacketForwarder) UnsubscribeDisconnect() error {
 	return nil
 }
 
+// SubscribeDownlinkAck implements the backend.DownlinkAcker interface
+func (f *PacketForwarder) SubscribeDownlinkAck() (<-chan *types.DownlinkAckMessage, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.ack = make(chan *types.DownlinkAckMessage)
+	return f.ack, nil
+}
+
+// UnsubscribeDownlinkAck implements the backend.DownlinkAcker interface
+func (f *PacketForwarder) UnsubscribeDownlinkAck() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.ack != nil {
+		close(f.ack)
+		f.ack = nil
+	}
+	return nil
+}
+
 // SubscribeUplink implements the Southbound interface
 func (f *PacketForwarder) SubscribeUplink(gatewayID string) (<-chan *types.UplinkMessage, error) {
 	f.mu.Lock()
@@ -0,0 +1,39 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package backend
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/TheThingsNetwork/go-utils/backoff"
+	"github.com/apex/log"
+)
+
+// RetryConnect calls connect until it succeeds or until the timeout elapses. Between attempts, it waits
+// according to the backoff configuration (or backoff.DefaultConfig if it is empty).
+func RetryConnect(ctx log.Interface, timeout time.Duration, config backoff.Config, connect func() error) (err error) {
+	if config.BaseDelay == 0 {
+		config = backoff.DefaultConfig
+	}
+	deadline := time.Now().Add(timeout)
+	for attempt := 1; ; attempt++ {
+		ctx := ctx.WithField("Attempt", attempt)
+		ctx.Debug("Connecting...")
+		if err = connect(); err == nil {
+			return nil
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			break
+		}
+		delay := config.Backoff(attempt - 1)
+		if delay > remaining {
+			delay = remaining
+		}
+		ctx.WithError(err).WithField("Delay", delay).Warn("Could not connect. Retrying...")
+		time.Sleep(delay)
+	}
+	return fmt.Errorf("could not connect within %s (%s)", timeout, err)
+}
@@ -0,0 +1,51 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package backend
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/TheThingsNetwork/go-utils/backoff"
+	"github.com/apex/log"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRetryConnect(t *testing.T) {
+	Convey("Given a backoff configuration", t, func(c C) {
+		config := backoff.Config{BaseDelay: 5 * time.Millisecond, MaxDelay: 20 * time.Millisecond, Factor: 2}
+
+		Convey("When connecting succeeds after some attempts", func() {
+			var attempts int
+			err := RetryConnect(log.Log, time.Second, config, func() error {
+				attempts++
+				if attempts < 3 {
+					return errors.New("connection refused")
+				}
+				return nil
+			})
+			Convey("There should be no error", func() {
+				So(err, ShouldBeNil)
+			})
+			Convey("It should have retried", func() {
+				So(attempts, ShouldEqual, 3)
+			})
+		})
+
+		Convey("When connecting keeps failing", func() {
+			start := time.Now()
+			err := RetryConnect(log.Log, 50*time.Millisecond, config, func() error {
+				return errors.New("connection refused")
+			})
+			Convey("There should be an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+			Convey("It should only give up after the timeout", func() {
+				So(time.Since(start), ShouldBeGreaterThanOrEqualTo, 50*time.Millisecond)
+				So(time.Since(start), ShouldBeLessThan, 500*time.Millisecond)
+			})
+		})
+	})
+}
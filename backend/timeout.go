@@ -0,0 +1,29 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package backend
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrPublishTimeout is returned by backends if a publish did not complete within the publish timeout
+var ErrPublishTimeout = errors.New("backend: publish timed out")
+
+// PublishContext returns the context of a publish that is done after the timeout. Backends pass it to the client
+// calls of the publish, so that a blocked publish returns instead of being abandoned. If the timeout is zero, the
+// context is only done when it is canceled.
+func PublishContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+// PublishTimedOut counts a publish to the named backend that timed out, and returns ErrPublishTimeout
+func PublishTimedOut(name string) error {
+	publishTimeouts.WithLabelValues(name).Inc()
+	return ErrPublishTimeout
+}
@@ -0,0 +1,48 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package backend
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPublishContext(t *testing.T) {
+	Convey("Given a publish timeout", t, func(c C) {
+		timeout := 10 * time.Millisecond
+
+		Convey("When creating a publish context", func() {
+			ctx, cancel := PublishContext(timeout)
+			Reset(cancel)
+			Convey("It should be done after the timeout", func() {
+				select {
+				case <-ctx.Done():
+				case <-time.After(100 * time.Millisecond):
+				}
+				So(ctx.Err(), ShouldNotBeNil)
+			})
+		})
+
+		Convey("When the timeout is zero", func() {
+			ctx, cancel := PublishContext(0)
+			Convey("It should not have a deadline", func() {
+				_, ok := ctx.Deadline()
+				So(ok, ShouldBeFalse)
+			})
+			Convey("It should be done when it is canceled", func() {
+				cancel()
+				So(ctx.Err(), ShouldNotBeNil)
+			})
+		})
+	})
+
+	Convey("When a publish timed out", t, func(c C) {
+		err := PublishTimedOut("test")
+		Convey("The error should be ErrPublishTimeout", func() {
+			So(err, ShouldEqual, ErrPublishTimeout)
+		})
+	})
+}
@@ -0,0 +1,81 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package backend
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+// PayloadTransformer transforms the LoRaWAN payload of messages for a backend. Encode is applied to payloads that are
+// published to the backend, Decode to payloads that are received from the backend.
+type PayloadTransformer interface {
+	Encode(payload []byte) ([]byte, error)
+	Decode(payload []byte) ([]byte, error)
+}
+
+type transformFunc struct {
+	encode, decode func([]byte) ([]byte, error)
+}
+
+func (t transformFunc) Encode(payload []byte) ([]byte, error) { return t.encode(payload) }
+func (t transformFunc) Decode(payload []byte) ([]byte, error) { return t.decode(payload) }
+
+// TransformFunc returns a PayloadTransformer that uses the given functions
+func TransformFunc(encode, decode func([]byte) ([]byte, error)) PayloadTransformer {
+	return &transformFunc{encode: encode, decode: decode}
+}
+
+// RawPayload does not transform payloads
+var RawPayload = TransformFunc(
+	func(payload []byte) ([]byte, error) { return payload, nil },
+	func(payload []byte) ([]byte, error) { return payload, nil },
+)
+
+// Base64Payload transforms payloads to and from standard base64
+var Base64Payload = TransformFunc(
+	func(payload []byte) ([]byte, error) {
+		encoded := make([]byte, base64.StdEncoding.EncodedLen(len(payload)))
+		base64.StdEncoding.Encode(encoded, payload)
+		return encoded, nil
+	},
+	func(payload []byte) ([]byte, error) {
+		decoded := make([]byte, base64.StdEncoding.DecodedLen(len(payload)))
+		n, err := base64.StdEncoding.Decode(decoded, payload)
+		return decoded[:n], err
+	},
+)
+
+// HexPayload transforms payloads to and from hex
+var HexPayload = TransformFunc(
+	func(payload []byte) ([]byte, error) {
+		encoded := make([]byte, hex.EncodedLen(len(payload)))
+		hex.Encode(encoded, payload)
+		return encoded, nil
+	},
+	func(payload []byte) ([]byte, error) {
+		decoded := make([]byte, hex.DecodedLen(len(payload)))
+		n, err := hex.Decode(decoded, payload)
+		return decoded[:n], err
+	},
+)
+
+// PayloadTransformers contains the built-in payload transformers by name
+var PayloadTransformers = map[string]PayloadTransformer{
+	"raw":    RawPayload,
+	"base64": Base64Payload,
+	"hex":    HexPayload,
+}
+
+// GetPayloadTransformer returns the built-in payload transformer with the given name ("" is raw)
+func GetPayloadTransformer(name string) (PayloadTransformer, error) {
+	if name == "" {
+		return RawPayload, nil
+	}
+	if transformer, ok := PayloadTransformers[name]; ok {
+		return transformer, nil
+	}
+	return nil, fmt.Errorf("backend: unknown payload transformer %q", name)
+}
@@ -0,0 +1,67 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package backend
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestPayloadTransformers(t *testing.T) {
+	Convey("Given a payload", t, func(c C) {
+		payload := []byte{0x40, 0x01, 0x02, 0x03, 0x04, 0xff}
+
+		Convey("The raw transformer should not change it", func() {
+			encoded, err := RawPayload.Encode(payload)
+			So(err, ShouldBeNil)
+			So(encoded, ShouldResemble, payload)
+		})
+
+		Convey("The base64 transformer should encode it", func() {
+			encoded, err := Base64Payload.Encode(payload)
+			So(err, ShouldBeNil)
+			So(string(encoded), ShouldEqual, "QAECAwT/")
+			decoded, err := Base64Payload.Decode(encoded)
+			So(err, ShouldBeNil)
+			So(decoded, ShouldResemble, payload)
+		})
+
+		Convey("The hex transformer should encode it", func() {
+			encoded, err := HexPayload.Encode(payload)
+			So(err, ShouldBeNil)
+			So(string(encoded), ShouldEqual, "4001020304ff")
+			decoded, err := HexPayload.Decode(encoded)
+			So(err, ShouldBeNil)
+			So(decoded, ShouldResemble, payload)
+		})
+
+		Convey("A custom transformer should use the functions", func() {
+			reverse := TransformFunc(
+				func(payload []byte) ([]byte, error) { return bytes.ToUpper(payload), nil },
+				func(payload []byte) ([]byte, error) { return bytes.ToLower(payload), nil },
+			)
+			encoded, err := reverse.Encode([]byte("abc"))
+			So(err, ShouldBeNil)
+			So(string(encoded), ShouldEqual, "ABC")
+		})
+
+		Convey("Invalid payloads should not be decoded", func() {
+			_, err := HexPayload.Decode([]byte("xyz"))
+			So(err, ShouldNotBeNil)
+		})
+	})
+
+	Convey("When getting a payload transformer by name", t, func(c C) {
+		transformer, err := GetPayloadTransformer("hex")
+		So(err, ShouldBeNil)
+		So(transformer, ShouldEqual, HexPayload)
+		transformer, err = GetPayloadTransformer("")
+		So(err, ShouldBeNil)
+		So(transformer, ShouldEqual, RawPayload)
+		_, err = GetPayloadTransformer("rot13")
+		So(err, ShouldNotBeNil)
+	})
+}
@@ -5,6 +5,7 @@ package ttn
 
 import (
 	"context"
+	"fmt"
 	"sync"
 	"time"
 
@@ -12,12 +13,14 @@ import (
 	"github.com/TheThingsNetwork/api/discovery/discoveryclient"
 	"github.com/TheThingsNetwork/api/router/routerclient"
 	"github.com/TheThingsNetwork/api/trace"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/backend"
 	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
 	"github.com/TheThingsNetwork/go-utils/grpc/auth"
 	"github.com/TheThingsNetwork/ttn/api"
 	"github.com/TheThingsNetwork/ttn/api/pool"
 	"github.com/apex/log"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
 )
 
 func init() {
@@ -29,6 +32,11 @@ func init() {
 type RouterConfig struct {
 	DiscoveryServer string
 	RouterID        string
+
+	// PublishTimeout is the time that a publish waits for the Router to be connected before it returns
+	// backend.ErrPublishTimeout. The streams to the Router drop messages if their buffer is full, so publishes do
+	// not block once the Router is connected. If zero, publishes wait until the Router is connected.
+	PublishTimeout time.Duration
 }
 
 // Router side of the bridge
@@ -40,6 +48,9 @@ type Router struct {
 
 	pool *pool.Pool
 
+	connected     chan struct{} // closed when the Router is connected
+	connectedOnce sync.Once
+
 	mu       sync.Mutex
 	gateways map[string]*gatewayConn
 }
@@ -47,18 +58,18 @@ type Router struct {
 // New sets up a new TTN Router
 func New(config RouterConfig, ctx log.Interface, tokenFunc func(string) string) (*Router, error) {
 	router := &Router{
-		config:   config,
-		Ctx:      ctx.WithField("Connector", "TTN Router"),
-		pool:     pool.NewPool(context.Background(), append(pool.DefaultDialOptions, auth.WithTokenFunc("id", tokenFunc).DialOption())...),
-		gateways: make(map[string]*gatewayConn),
+		config:    config,
+		Ctx:       ctx.WithField("Connector", "TTN Router"),
+		pool:      pool.NewPool(context.Background(), append(pool.DefaultDialOptions, auth.WithTokenFunc("id", tokenFunc).DialOption())...),
+		connected: make(chan struct{}),
+		gateways:  make(map[string]*gatewayConn),
 	}
 	return router, nil
 }
 
-// Connect to the TTN Router
+// Connect to the TTN Router. The lock is only held to set the connection, so that publishes that wait for the
+// connection can time out.
 func (r *Router) Connect() error {
-	r.mu.Lock()
-	defer r.mu.Unlock()
 	r.Ctx.WithFields(log.Fields{
 		"Discovery": r.config.DiscoveryServer,
 		"RouterID":  r.config.RouterID,
@@ -77,16 +88,21 @@ func (r *Router) Connect() error {
 		"RouterID": r.config.RouterID,
 		"Address":  announcement.NetAddress,
 	}).Info("Connecting with Router")
+	var conn *grpc.ClientConn
 	if announcement.GetCertificate() == "" {
-		r.conn, err = announcement.Dial(nil)
+		conn, err = announcement.Dial(nil)
 	} else {
-		r.conn, err = announcement.Dial(r.pool)
+		conn, err = announcement.Dial(r.pool)
 	}
 	if err != nil {
 		return err
 	}
-	r.client = routerclient.NewClient(routerclient.DefaultClientConfig)
-	r.client.AddServer(r.config.RouterID, r.conn)
+	client := routerclient.NewClient(routerclient.DefaultClientConfig)
+	client.AddServer(r.config.RouterID, conn)
+	r.mu.Lock()
+	r.conn, r.client = conn, client
+	r.mu.Unlock()
+	r.connectedOnce.Do(func() { close(r.connected) })
 	return nil
 }
 
@@ -99,6 +115,24 @@ func (r *Router) Disconnect() error {
 	return nil
 }
 
+// HealthCheck returns an error if the connection with the Router is not ready
+func (r *Router) HealthCheck(ctx context.Context) error {
+	r.mu.Lock()
+	conn := r.conn
+	r.mu.Unlock()
+	if conn == nil {
+		return fmt.Errorf("%w: ttn: not connected yet", backend.ErrTransient)
+	}
+	switch state := conn.GetState(); state {
+	case connectivity.Ready, connectivity.Idle:
+		return nil
+	case connectivity.Shutdown:
+		return fmt.Errorf("%w: ttn: connection shut down", backend.ErrFatal)
+	default:
+		return fmt.Errorf("%w: ttn: connection %s", backend.ErrTransient, state)
+	}
+}
+
 type gatewayConn struct {
 	stream     routerclient.GenericStream
 	lastActive time.Time
@@ -130,17 +164,38 @@ func (r *Router) CleanupGateway(gatewayID string) {
 
 // PublishUplink publishes uplink messages to the TTN Router
 func (r *Router) PublishUplink(message *types.UplinkMessage) error {
-	message.Message.Trace = message.Message.Trace.WithEvent(trace.ForwardEvent, "backend", "ttn")
+	if types.Tracing(types.TraceBasic) {
+		message.Message.Trace = message.Message.Trace.WithEvent(trace.ForwardEvent, "backend", "ttn")
+	}
+	if err := r.waitConnected(); err != nil {
+		return err
+	}
 	r.getGateway(message.GatewayID, false).stream.Uplink(message.Message)
 	return nil
 }
 
 // PublishStatus publishes status messages to the TTN Router
 func (r *Router) PublishStatus(message *types.StatusMessage) error {
+	if err := r.waitConnected(); err != nil {
+		return err
+	}
 	r.getGateway(message.GatewayID, false).stream.Status(message.Message)
 	return nil
 }
 
+// waitConnected waits until the Router is connected, and returns backend.ErrPublishTimeout if it is not connected
+// within the publish timeout
+func (r *Router) waitConnected() error {
+	ctx, cancel := backend.PublishContext(r.config.PublishTimeout)
+	defer cancel()
+	select {
+	case <-r.connected:
+		return nil
+	case <-ctx.Done():
+		return backend.PublishTimedOut("ttn")
+	}
+}
+
 // SubscribeDownlink handles downlink messages for the given gateway ID
 func (r *Router) SubscribeDownlink(gatewayID string) (<-chan *types.DownlinkMessage, error) {
 	downlink := make(chan *types.DownlinkMessage)
@@ -165,7 +220,9 @@ func (r *Router) SubscribeDownlink(gatewayID string) (<-chan *types.DownlinkMess
 	go func() {
 		for in := range ch {
 			ctx.Debug("Downlink message received")
-			in.Trace = in.Trace.WithEvent(trace.ReceiveEvent, "backend", "ttn")
+			if types.Tracing(types.TraceBasic) {
+				in.Trace = in.Trace.WithEvent(trace.ReceiveEvent, "backend", "ttn")
+			}
 			downlink <- &types.DownlinkMessage{GatewayID: gatewayID, Message: in}
 		}
 		close(downlink)
@@ -5,11 +5,13 @@ package ttn
 
 import (
 	"bytes"
+	"io/ioutil"
 	"testing"
 	"time"
 
 	pb_gateway "github.com/TheThingsNetwork/api/gateway"
 	pb_router "github.com/TheThingsNetwork/api/router"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/backend"
 	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
 	ttnlog "github.com/TheThingsNetwork/go-utils/log"
 	"github.com/TheThingsNetwork/go-utils/log/apex"
@@ -96,3 +98,20 @@ func TestTTNRouter(t *testing.T) {
 		})
 	})
 }
+
+func TestPublishBeforeConnect(t *testing.T) {
+	Convey("Given a TTN Router that is not connected yet", t, func(c C) {
+		ctx := &log.Logger{Handler: text.New(ioutil.Discard), Level: log.ErrorLevel}
+		router, _ := New(RouterConfig{PublishTimeout: 10 * time.Millisecond}, ctx, func(string) string { return "token" })
+		Reset(func() { router.Disconnect() })
+
+		Convey("When publishing an uplink message", func() {
+			start := time.Now()
+			err := router.PublishUplink(&types.UplinkMessage{GatewayID: "dev", Message: &pb_router.UplinkMessage{}})
+			Convey("It should return a timeout error after the publish timeout", func() {
+				So(err, ShouldEqual, backend.ErrPublishTimeout)
+				So(time.Since(start), ShouldBeLessThan, 100*time.Millisecond)
+			})
+		})
+	})
+}
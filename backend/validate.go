@@ -0,0 +1,34 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package backend
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+)
+
+// DialTimeout is the timeout of Dial if the context has no deadline
+var DialTimeout = 5 * time.Second
+
+// Dial checks that a TCP connection can be made to at least one of the addresses (host:port), so that backends can
+// check the connectivity to their servers before the bridge is started. If none of the addresses can be reached,
+// the errors of all addresses are returned.
+func Dial(ctx context.Context, addresses ...string) error {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DialTimeout)
+		defer cancel()
+	}
+	var errs []error
+	for _, address := range addresses {
+		conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", address)
+		if err == nil {
+			return conn.Close()
+		}
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
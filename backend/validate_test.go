@@ -0,0 +1,36 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package backend
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDial(t *testing.T) {
+	Convey("Given a listening server and a closed port", t, func(c C) {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		So(err, ShouldBeNil)
+		Reset(func() { lis.Close() })
+		closed, err := net.Listen("tcp", "127.0.0.1:0")
+		So(err, ShouldBeNil)
+		closedAddr := closed.Addr().String()
+		closed.Close()
+
+		Convey("Dialing the server should succeed", func() {
+			So(Dial(context.Background(), lis.Addr().String()), ShouldBeNil)
+		})
+
+		Convey("Dialing should succeed if one of the addresses can be reached", func() {
+			So(Dial(context.Background(), closedAddr, lis.Addr().String()), ShouldBeNil)
+		})
+
+		Convey("Dialing only the closed port should fail", func() {
+			So(Dial(context.Background(), closedAddr), ShouldNotBeNil)
+		})
+	})
+}
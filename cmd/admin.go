@@ -0,0 +1,78 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/TheThingsNetwork/gateway-connector-bridge/exchange"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/middleware/ratelimit"
+	"github.com/apex/log"
+)
+
+// authorized checks that the request has the given bearer token
+func authorized(r *http.Request, token string) bool {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(token)) == 1
+}
+
+// disconnectHandler returns a handler that force-disconnects the gateway in the gateway_id form value
+func disconnectHandler(ctx log.Interface, bridge *exchange.Exchange, token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !authorized(r, token) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		gatewayID := r.FormValue("gateway_id")
+		if gatewayID == "" {
+			http.Error(w, "missing gateway_id", http.StatusBadRequest)
+			return
+		}
+		ctx := ctx.WithFields(log.Fields{"GatewayID": gatewayID, "RemoteAddr": r.RemoteAddr})
+		switch err := bridge.ForceDisconnect(gatewayID); err {
+		case nil:
+			ctx.Info("Forced disconnect requested")
+			fmt.Fprintln(w, "ok")
+		case exchange.ErrNotConnected:
+			http.Error(w, err.Error(), http.StatusNotFound)
+		default:
+			ctx.WithError(err).Warn("Could not force disconnect")
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// rateLimitHandler returns a handler that writes the rate limit state of the gateway in the gateway_id form value
+func rateLimitHandler(rateLimit *ratelimit.RateLimit) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gatewayID := r.FormValue("gateway_id")
+		if gatewayID == "" {
+			http.Error(w, "missing gateway_id", http.StatusBadRequest)
+			return
+		}
+		state, err := rateLimit.State(gatewayID)
+		switch err {
+		case nil:
+		case ratelimit.ErrUnknownGateway:
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Add("content-type", "application/json; charset=utf-8")
+		json.NewEncoder(w).Encode(state)
+	})
+}
@@ -0,0 +1,93 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/TheThingsNetwork/api/gateway"
+	"github.com/TheThingsNetwork/api/router"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/middleware"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/middleware/gatewayinfo"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+type gatewayInfoOutput struct {
+	GatewayID      string                    `json:"gateway_id"`
+	Error          string                    `json:"error,omitempty"`
+	Status         *gateway.Status           `json:"status,omitempty"`
+	Attributes     map[string]string         `json:"attributes,omitempty"`
+	UplinkLocation *gateway.LocationMetadata `json:"uplink_location,omitempty"`
+}
+
+// GatewayInfoCmd prints the gateway information that the bridge would inject for a gateway
+var GatewayInfoCmd = &cobra.Command{
+	Use:   "gatewayinfo [gateway-id]",
+	Short: "Print the gateway information that would be injected for a gateway",
+	Long:  `gatewayinfo fetches the public information of a gateway from the account server and prints what the bridge would inject into its status and uplink messages as JSON`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		viper.BindPFlags(cmd.Flags())
+		gatewayID := args[0]
+
+		gatewayInfo, err := gatewayinfo.NewPublic(viper.GetString("account-server"))
+		if err != nil {
+			ctx.WithError(err).Fatal("Invalid account server")
+		}
+		defer gatewayInfo.Close()
+		httpClient, err := gatewayinfo.NewHTTPClient(gatewayinfo.HTTPClientConfig{
+			Proxy:               viper.GetString("account-server-proxy"),
+			Timeout:             viper.GetDuration("account-server-timeout"),
+			MaxIdleConnsPerHost: viper.GetInt("account-server-max-idle-conns"),
+		})
+		if err != nil {
+			ctx.WithError(err).Fatal("Invalid account server proxy")
+		}
+		gatewayInfo = gatewayInfo.WithHTTPClient(httpClient)
+		if caFile, certFile := viper.GetString("account-server-ca-file"), viper.GetString("account-server-cert-file"); caFile != "" || certFile != "" {
+			tlsConfig, err := gatewayinfo.LoadTLSConfig(caFile, certFile, viper.GetString("account-server-key-file"))
+			if err != nil {
+				ctx.WithError(err).Fatal("Could not load TLS configuration for the account server")
+			}
+			gatewayInfo = gatewayInfo.WithTLSConfig(tlsConfig)
+		}
+		gatewayInfo = gatewayInfo.WithInjectFlags(viper.GetBool("info-inject-flags"))
+
+		output := gatewayInfoOutput{GatewayID: gatewayID}
+		if err := gatewayInfo.Refresh(gatewayID); err != nil {
+			output.Error = err.Error()
+		} else {
+			status := &types.StatusMessage{GatewayID: gatewayID, Message: new(gateway.Status)}
+			gatewayInfo.HandleStatus(middleware.NewContext(), status)
+			output.Status, output.Attributes = status.Message, status.Attributes
+
+			uplink := &types.UplinkMessage{GatewayID: gatewayID, Message: new(router.UplinkMessage)}
+			gatewayInfo.HandleUplink(middleware.NewContext(), uplink)
+			output.UplinkLocation = uplink.Message.GatewayMetadata.Location
+		}
+
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(output)
+		if output.Error != "" {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	BridgeCmd.AddCommand(GatewayInfoCmd)
+
+	GatewayInfoCmd.Flags().String("account-server", "https://account.thethingsnetwork.org", "Account server to fetch gateway information from")
+	GatewayInfoCmd.Flags().String("account-server-proxy", "", "Proxy for requests to the account server (from the HTTPS_PROXY environment variable if empty)")
+	GatewayInfoCmd.Flags().Duration("account-server-timeout", gatewayinfo.DefaultHTTPTimeout, "Timeout of requests to the account server")
+	GatewayInfoCmd.Flags().Int("account-server-max-idle-conns", gatewayinfo.DefaultMaxIdleConnsPerHost, "Maximum number of idle connections to the account server")
+	GatewayInfoCmd.Flags().String("account-server-ca-file", "", "Location of the file containing Root CA certificates for the account server")
+	GatewayInfoCmd.Flags().String("account-server-cert-file", "", "Location of the client certificate for the account server")
+	GatewayInfoCmd.Flags().String("account-server-key-file", "", "Location of the key of the client certificate for the account server")
+	GatewayInfoCmd.Flags().Bool("info-inject-flags", false, "Inject gateway flags (auto_update) as status attributes")
+}
@@ -0,0 +1,76 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/TheThingsNetwork/gateway-connector-bridge/backend"
+	"github.com/apex/log"
+)
+
+// backendHealth probes a backend periodically and keeps the result for the HTTP status server. Fatal errors are
+// reported immediately, transient errors only after threshold consecutive failed probes.
+type backendHealth struct {
+	ctx       log.Interface
+	checker   backend.HealthChecker
+	timeout   time.Duration
+	threshold int
+
+	mu       sync.Mutex
+	failures int
+	err      error
+}
+
+func newBackendHealth(ctx log.Interface, checker backend.HealthChecker, timeout time.Duration, threshold int) *backendHealth {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &backendHealth{ctx: ctx, checker: checker, timeout: timeout, threshold: threshold}
+}
+
+// probe runs the health check of the backend once and logs when the backend becomes unhealthy or recovers
+func (h *backendHealth) probe() {
+	ctx := context.Background()
+	if h.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.timeout)
+		defer cancel()
+	}
+	err := h.checker.HealthCheck(ctx)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err == nil {
+		if h.err != nil {
+			h.ctx.Info("Backend is healthy again")
+		}
+		h.failures, h.err = 0, nil
+		return
+	}
+	h.failures++
+	if errors.Is(err, backend.ErrFatal) || h.failures >= h.threshold {
+		if h.err == nil {
+			h.ctx.WithError(err).Warn("Backend is unhealthy")
+		}
+		h.err = err
+	}
+}
+
+// run probes the backend at the given interval
+func (h *backendHealth) run(interval time.Duration) {
+	for range time.Tick(interval) {
+		h.probe()
+	}
+}
+
+// Err returns the error of the backend if it is unhealthy
+func (h *backendHealth) Err() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.err
+}
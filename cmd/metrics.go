@@ -0,0 +1,33 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package cmd
+
+import (
+	"runtime"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// registerBuildInfo registers a gauge that is always 1, with the version and build information of the bridge as
+// labels. The build information is set in the configuration by main, from the variables that are injected with
+// ldflags at build time.
+func registerBuildInfo() {
+	buildInfo := prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: "ttn",
+			Subsystem: "bridge",
+			Name:      "build_info",
+			Help:      "Version and build information of the bridge.",
+			ConstLabels: prometheus.Labels{
+				"version":    config.GetString("version"),
+				"git_commit": config.GetString("gitCommit"),
+				"git_branch": config.GetString("gitBranch"),
+				"build_date": config.GetString("buildDate"),
+				"go_version": runtime.Version(),
+			},
+		},
+	)
+	buildInfo.Set(1)
+	prometheus.MustRegister(buildInfo)
+}
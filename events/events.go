@@ -0,0 +1,129 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+// Package events emits structured events when the bridge detects abnormal conditions, so that operators can be
+// notified (for example by wiring a Handler to a chat or paging service).
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Kind is the kind of an event
+type Kind string
+
+// Event kinds
+const (
+	// AccountServerDown is emitted when the account server is considered unhealthy
+	AccountServerDown Kind = "account_server_down"
+	// AccountServerUp is emitted when the account server is healthy again after being down
+	AccountServerUp Kind = "account_server_up"
+	// ConnectStorm is emitted when more gateways connect within a time window than a threshold
+	ConnectStorm Kind = "connect_storm"
+	// BackendDisconnected is emitted when a backend loses its connection
+	BackendDisconnected Kind = "backend_disconnected"
+	// BackendReconnected is emitted when a backend is connected again after losing its connection
+	BackendReconnected Kind = "backend_reconnected"
+)
+
+// Event is a structured event
+type Event struct {
+	Kind    Kind                   `json:"kind"`
+	Time    time.Time              `json:"time"`
+	Source  string                 `json:"source,omitempty"` // for example the name of the backend
+	Message string                 `json:"message"`
+	Fields  map[string]interface{} `json:"fields,omitempty"`
+
+	// Suppressed is the number of events of the same kind and source that were not emitted since the previous
+	// event because of the rate limit
+	Suppressed int `json:"suppressed,omitempty"`
+}
+
+// Handler handles events. Handlers are called in the goroutine of the emitter, so they should not block.
+type Handler func(Event)
+
+// DefaultMinInterval is the default minimum interval between events of the same kind and source
+var DefaultMinInterval = 5 * time.Minute
+
+type key struct {
+	kind   Kind
+	source string
+}
+
+type limit struct {
+	last       time.Time
+	suppressed int
+}
+
+// Notifier sends events to its handlers. Events of the same kind and source are rate limited. A nil *Notifier
+// discards all events, so that components can emit events without checking whether a Notifier is configured.
+type Notifier struct {
+	mu          sync.Mutex
+	minInterval time.Duration
+	handlers    []Handler
+	limits      map[key]*limit
+}
+
+// New returns a new Notifier that emits at most one event of the same kind and source per minInterval (or
+// DefaultMinInterval if it is 0)
+func New(minInterval time.Duration) *Notifier {
+	if minInterval == 0 {
+		minInterval = DefaultMinInterval
+	}
+	return &Notifier{
+		minInterval: minInterval,
+		limits:      make(map[key]*limit),
+	}
+}
+
+// Handle adds a handler
+func (n *Notifier) Handle(handler Handler) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.handlers = append(n.handlers, handler)
+}
+
+// Emit sends the event to the handlers, unless an event of the same kind and source was emitted less than the
+// minimum interval ago. If the time of the event is not set, it is set to the current time.
+func (n *Notifier) Emit(event Event) {
+	if n == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	n.mu.Lock()
+	k := key{event.Kind, event.Source}
+	l, ok := n.limits[k]
+	if !ok {
+		l = new(limit)
+		n.limits[k] = l
+	}
+	if !l.last.IsZero() && event.Time.Sub(l.last) < n.minInterval {
+		l.suppressed++
+		n.mu.Unlock()
+		suppressedCounter.WithLabelValues(string(event.Kind)).Inc()
+		return
+	}
+	event.Suppressed, l.suppressed = l.suppressed, 0
+	l.last = event.Time
+	handlers := n.handlers
+	n.mu.Unlock()
+	emittedCounter.WithLabelValues(string(event.Kind)).Inc()
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
+
+// Channel returns a channel that receives the events, and a Handler to add to the Notifier. Events are dropped if
+// the buffer of the channel is full.
+func Channel(buffer int) (<-chan Event, Handler) {
+	ch := make(chan Event, buffer)
+	return ch, func(event Event) {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
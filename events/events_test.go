@@ -0,0 +1,61 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package events
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNotifier(t *testing.T) {
+	Convey("Given a Notifier with a handler", t, func(c C) {
+		n := New(time.Hour)
+		var received []Event
+		n.Handle(func(event Event) { received = append(received, event) })
+
+		Convey("When emitting an event", func() {
+			n.Emit(Event{Kind: ConnectStorm, Message: "storm"})
+			Convey("The handler should receive it", func() {
+				So(received, ShouldHaveLength, 1)
+				So(received[0].Kind, ShouldEqual, ConnectStorm)
+				So(received[0].Time.IsZero(), ShouldBeFalse)
+			})
+		})
+
+		Convey("When emitting events of the same kind and source within the interval", func() {
+			start := time.Now()
+			n.Emit(Event{Kind: BackendDisconnected, Source: "mqtt", Time: start})
+			n.Emit(Event{Kind: BackendDisconnected, Source: "mqtt", Time: start.Add(time.Minute)})
+			n.Emit(Event{Kind: BackendDisconnected, Source: "amqp", Time: start.Add(time.Minute)})
+			Convey("Only events of other sources should be emitted", func() {
+				So(received, ShouldHaveLength, 2)
+				So(received[1].Source, ShouldEqual, "amqp")
+			})
+			Convey("The next event after the interval should report the suppressed events", func() {
+				n.Emit(Event{Kind: BackendDisconnected, Source: "mqtt", Time: start.Add(2 * time.Hour)})
+				So(received, ShouldHaveLength, 3)
+				So(received[2].Suppressed, ShouldEqual, 1)
+			})
+		})
+
+		Convey("A nil Notifier should discard events", func() {
+			var n *Notifier
+			So(func() { n.Emit(Event{Kind: ConnectStorm}) }, ShouldNotPanic)
+		})
+	})
+
+	Convey("Given a Notifier with a channel", t, func(c C) {
+		n := New(0)
+		ch, handler := Channel(1)
+		n.Handle(handler)
+		n.Emit(Event{Kind: AccountServerDown})
+		n.Emit(Event{Kind: AccountServerUp})
+		Convey("Events should be dropped when the channel is full", func() {
+			So((<-ch).Kind, ShouldEqual, AccountServerDown)
+			So(ch, ShouldBeEmpty)
+		})
+	})
+}
@@ -0,0 +1,29 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package events
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var emittedCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "ttn",
+		Subsystem: "bridge",
+		Name:      "events_emitted_total",
+		Help:      "Total number of events that were emitted.",
+	}, []string{"kind"},
+)
+
+var suppressedCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "ttn",
+		Subsystem: "bridge",
+		Name:      "events_suppressed_total",
+		Help:      "Total number of events that were suppressed by the rate limit.",
+	}, []string{"kind"},
+)
+
+func init() {
+	prometheus.MustRegister(emittedCounter)
+	prometheus.MustRegister(suppressedCounter)
+}
@@ -0,0 +1,43 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/apex/log"
+)
+
+// WebhookTimeout is the timeout of a webhook request
+var WebhookTimeout = 10 * time.Second
+
+// Webhook returns a Handler that POSTs events as JSON to the given URL. Requests are sent in the background, and
+// failed requests are logged.
+func Webhook(ctx log.Interface, url string) Handler {
+	client := &http.Client{Timeout: WebhookTimeout}
+	ctx = ctx.WithField("URL", url)
+	return func(event Event) {
+		body, err := json.Marshal(event)
+		if err != nil {
+			ctx.WithError(err).Warn("Could not marshal event")
+			return
+		}
+		go func() {
+			res, err := client.Post(url, "application/json", bytes.NewReader(body))
+			if err == nil {
+				res.Body.Close()
+				if res.StatusCode >= 300 {
+					err = fmt.Errorf("webhook returned %s", res.Status)
+				}
+			}
+			if err != nil {
+				ctx.WithError(err).WithField("Kind", event.Kind).Warn("Could not send event to webhook")
+			}
+		}()
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package exchange
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/TheThingsNetwork/gateway-connector-bridge/backend"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
+	"github.com/apex/log"
+)
+
+// Results of downlink acknowledgements
+const (
+	ackAccepted = "accepted"
+	ackRejected = "rejected"
+)
+
+// subscribeDownlinkAck subscribes to the downlink acknowledgements of the southbound backend. It returns nil if the
+// backend does not emit them.
+func (b *Exchange) subscribeDownlinkAck(southbound backend.Southbound) <-chan *types.DownlinkAckMessage {
+	acker, ok := southbound.(backend.DownlinkAcker)
+	if !ok {
+		return nil
+	}
+	downlinkAck, err := acker.SubscribeDownlinkAck()
+	if err != nil {
+		b.ctx.WithError(err).Errorf("Could not subscribe to downlink ack from backend %v", southbound)
+	}
+	return downlinkAck
+}
+
+func (b *Exchange) unsubscribeDownlinkAck(southbound backend.Southbound) {
+	acker, ok := southbound.(backend.DownlinkAcker)
+	if !ok {
+		return
+	}
+	if err := acker.UnsubscribeDownlinkAck(); err != nil {
+		b.ctx.WithError(err).Errorf("Could not unsubscribe from downlink ack on backend %v", southbound)
+	}
+}
+
+// ackPublishers returns the northbound backends and the southbound backends that publish downlink acknowledgements.
+// Southbound backends that emit acknowledgements themselves are skipped, so that acknowledgements are not routed back
+// to where they came from.
+func (b *Exchange) ackPublishers() (publishers []backend.DownlinkAckPublisher) {
+	added := make(map[backend.DownlinkAckPublisher]bool)
+	add := func(publisher backend.DownlinkAckPublisher) {
+		if !added[publisher] {
+			added[publisher] = true
+			publishers = append(publishers, publisher)
+		}
+	}
+	for _, northbound := range b.northboundBackends {
+		if publisher, ok := northbound.(backend.DownlinkAckPublisher); ok {
+			add(publisher)
+		}
+	}
+	for _, southbound := range b.southboundBackends {
+		if _, ok := southbound.(backend.DownlinkAcker); ok {
+			continue
+		}
+		if publisher, ok := southbound.(backend.DownlinkAckPublisher); ok {
+			add(publisher)
+		}
+	}
+	return publishers
+}
+
+// handleDownlinkAck publishes the downlink acknowledgement to the northbound and southbound backends that publish
+// acknowledgements. Acknowledgements of gateways that are not connected are dropped.
+func (b *Exchange) handleDownlinkAck(ctx *log.Entry, downlinkAckMessage *types.DownlinkAckMessage) {
+	result := ackAccepted
+	if downlinkAckMessage.Error != "" {
+		result = ackRejected
+		ctx = ctx.WithField("Error", downlinkAckMessage.Error)
+	}
+	if downlinkAckMessage.DownlinkID != "" {
+		ctx = ctx.WithField("DownlinkID", downlinkAckMessage.DownlinkID)
+	}
+	downlinkAcks.WithLabelValues(result).Inc()
+	if !b.gateways.Contains(strings.ToLower(downlinkAckMessage.GatewayID)) {
+		ctx.Debug("Got downlink ack from not-connected gateway")
+		b.stats.drop(downlinkAckKind)
+		return
+	}
+	published := 0
+	for _, publisher := range b.ackPublishers() {
+		ctx := ctx.WithField("Backend", fmt.Sprintf("%T", publisher))
+		if err := publisher.PublishDownlinkAck(downlinkAckMessage); err != nil {
+			ctx.WithError(err).Debug("Did not publish downlink ack")
+			continue
+		}
+		ctx.Debug("Published downlink ack")
+		published++
+	}
+	if published == 0 {
+		ctx.Debug("Downlink ack not published by any backend")
+		b.stats.drop(downlinkAckKind)
+		return
+	}
+	b.stats.handle(downlinkAckKind)
+}
@@ -0,0 +1,132 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package exchange
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
+	"github.com/apex/log"
+)
+
+// Reasons for dropping deferred downlinks
+const (
+	deferRejected     = "rejected"
+	deferLimit        = "limit"
+	deferExpired      = "expired"
+	deferDisconnected = "disconnected"
+)
+
+// heldDownlink is a downlink message that is held until its gateway is known to be connected
+type heldDownlink struct {
+	message *types.DownlinkMessage
+	held    time.Time
+}
+
+// deferral holds the downlinks of gateways that are connected in the state of the Exchange, but that did not send a
+// message since the bridge started (such as gateways that were reconnected from the Redis state, or gateways that
+// are routed as unknown gateway)
+type deferral struct {
+	mu      sync.Mutex
+	enabled bool
+	limit   int
+	maxAge  time.Duration
+	known   map[string]struct{}
+	held    map[string][]heldDownlink
+}
+
+// SetDeferDownlinksUntilConnected holds downlink messages of gateways until they are known to be connected, which is
+// when they sent a connect, uplink or status message. At most limit downlinks are held per gateway, after which the
+// oldest is dropped; if limit is 0, the downlinks are dropped right away. Held downlinks are sent when the gateway
+// connects, unless they were held for longer than maxAge (if not 0). Downlinks of gateways that disconnect are dropped.
+func (b *Exchange) SetDeferDownlinksUntilConnected(limit int, maxAge time.Duration) {
+	b.deferral.mu.Lock()
+	defer b.deferral.mu.Unlock()
+	b.deferral.enabled = true
+	b.deferral.limit = limit
+	b.deferral.maxAge = maxAge
+	if b.deferral.known == nil {
+		b.deferral.known = make(map[string]struct{})
+		b.deferral.held = make(map[string][]heldDownlink)
+	}
+}
+
+// deferDownlink holds the downlink message if its gateway is not known to be connected, and returns whether it did
+func (b *Exchange) deferDownlink(ctx log.Interface, message *types.DownlinkMessage) bool {
+	b.deferral.mu.Lock()
+	defer b.deferral.mu.Unlock()
+	if !b.deferral.enabled {
+		return false
+	}
+	gatewayID := strings.ToLower(message.GatewayID)
+	if _, ok := b.deferral.known[gatewayID]; ok {
+		return false
+	}
+	if b.deferral.limit <= 0 {
+		ctx.Debug("Dropped downlink for gateway that is not known to be connected")
+		droppedDownlinks.WithLabelValues(deferRejected).Inc()
+		b.stats.drop(downlinkKind)
+		return true
+	}
+	held := b.deferral.held[gatewayID]
+	if len(held) >= b.deferral.limit {
+		ctx.Debug("Dropped oldest deferred downlink")
+		droppedDownlinks.WithLabelValues(deferLimit).Inc()
+		b.stats.drop(downlinkKind)
+		held = held[1:]
+	}
+	b.deferral.held[gatewayID] = append(held, heldDownlink{message: message, held: time.Now()})
+	ctx.Debug("Deferred downlink until gateway is connected")
+	deferredDownlinks.Inc()
+	return true
+}
+
+// markConnected marks the gateway as known to be connected, and returns the downlinks that were held for it
+func (b *Exchange) markConnected(ctx log.Interface, gatewayID string) []*types.DownlinkMessage {
+	b.deferral.mu.Lock()
+	defer b.deferral.mu.Unlock()
+	if !b.deferral.enabled {
+		return nil
+	}
+	gatewayID = strings.ToLower(gatewayID)
+	if _, ok := b.deferral.known[gatewayID]; ok {
+		return nil
+	}
+	b.deferral.known[gatewayID] = struct{}{}
+	held := b.deferral.held[gatewayID]
+	delete(b.deferral.held, gatewayID)
+	messages := make([]*types.DownlinkMessage, 0, len(held))
+	for _, downlink := range held {
+		if b.deferral.maxAge > 0 && time.Since(downlink.held) > b.deferral.maxAge {
+			droppedDownlinks.WithLabelValues(deferExpired).Inc()
+			b.stats.drop(downlinkKind)
+			continue
+		}
+		messages = append(messages, downlink.message)
+	}
+	if len(held) > 0 {
+		ctx.WithField("Downlinks", len(messages)).Debug("Sending deferred downlinks")
+	}
+	return messages
+}
+
+// markDisconnected forgets that the gateway is connected and drops the downlinks that were held for it
+func (b *Exchange) markDisconnected(gatewayID string) {
+	b.deferral.mu.Lock()
+	defer b.deferral.mu.Unlock()
+	if !b.deferral.enabled {
+		return
+	}
+	gatewayID = strings.ToLower(gatewayID)
+	delete(b.deferral.known, gatewayID)
+	if held := b.deferral.held[gatewayID]; len(held) > 0 {
+		droppedDownlinks.WithLabelValues(deferDisconnected).Add(float64(len(held)))
+		for range held {
+			b.stats.drop(downlinkKind)
+		}
+		delete(b.deferral.held, gatewayID)
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package exchange
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/TheThingsNetwork/gateway-connector-bridge/backend"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/middleware"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
+	"github.com/apex/log"
+)
+
+// ErrNotConnected is returned by ForceDisconnect if the gateway is not connected
+var ErrNotConnected = errors.New("exchange: gateway not connected")
+
+// ForceDisconnect disconnects a gateway as if it sent a disconnect message, without validating its key. The
+// disconnect is handled by the worker of the gateway, after the messages that it is already handling. Southbound backends that implement
+// backend.GatewayDisconnecter are also asked to disconnect the gateway.
+func (b *Exchange) ForceDisconnect(gatewayID string) error {
+	gatewayID = strings.ToLower(gatewayID)
+	if !b.gateways.Contains(gatewayID) {
+		return ErrNotConnected
+	}
+	select {
+	case b.queue(gatewayID).forceDisconnect <- gatewayID:
+		return nil
+	case <-b.done:
+		return errors.New("exchange: stopped")
+	}
+}
+
+func (b *Exchange) forceDisconnect(ctx log.Interface, gatewayID string) {
+	if !b.gateways.Contains(gatewayID) {
+		ctx.Debug("Gateway already disconnected")
+		return
+	}
+	if err := b.middleware.Execute(middleware.NewContext(), &types.DisconnectMessage{GatewayID: gatewayID}); err != nil {
+		ctx.WithError(err).Warn("Error in middleware")
+	}
+	b.deactivateNorthbound(gatewayID)
+	b.deactivateSouthbound(gatewayID)
+	for _, southbound := range b.southboundBackends {
+		if disconnecter, ok := southbound.(backend.GatewayDisconnecter); ok {
+			if err := disconnecter.DisconnectGateway(gatewayID); err != nil {
+				ctx.WithField("Backend", fmt.Sprintf("%T", southbound)).WithError(err).Warn("Could not disconnect gateway from backend")
+			}
+		}
+	}
+	b.gateways.Remove(gatewayID)
+	b.markDisconnected(gatewayID)
+	connectedGateways.Dec()
+	forcedDisconnects.Inc()
+	b.stats.handle(disconnectKind)
+	ctx.Warn("Forced disconnect")
+}
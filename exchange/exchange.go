@@ -16,6 +16,7 @@ import (
 	"github.com/TheThingsNetwork/api/trace"
 	"github.com/TheThingsNetwork/gateway-connector-bridge/auth"
 	"github.com/TheThingsNetwork/gateway-connector-bridge/backend"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/events"
 	"github.com/TheThingsNetwork/gateway-connector-bridge/middleware"
 	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
 	"github.com/apex/log"
@@ -30,6 +31,7 @@ import (
 // - Uplink messages are routed from the southbound backends to the northbound backends
 // - Downlink messages are routed from the northbound backends to the southbound backends
 // - Status messages are routed from the southbound backends to the northbound backends
+// - Downlink acknowledgements are routed from the southbound backends to the backends that publish them
 // until a disconnection message is received on the southbound backend
 type Exchange struct {
 	ctx  log.Interface
@@ -41,6 +43,9 @@ type Exchange struct {
 
 	middleware middleware.Chain
 
+	events *events.Notifier
+	storm  storm
+
 	northboundBackends []backend.Northbound
 	southboundBackends []backend.Southbound
 	backendInit        sync.WaitGroup
@@ -49,16 +54,21 @@ type Exchange struct {
 	southboundDone map[string][]chan struct{}
 	doneLock       sync.Mutex
 
-	connect    chan *types.ConnectMessage
-	disconnect chan *types.DisconnectMessage
-	uplink     chan *types.UplinkMessage
-	status     chan *types.StatusMessage
-	downlink   chan *types.DownlinkMessage
+	queues   []*queue
+	queuesMu sync.RWMutex
 
 	killWhenIdleFor time.Duration
 	idleWatchdog    *time.Timer
 
+	exemplars bool
+
 	gateways gatewayState
+	deferral deferral
+
+	started       time.Time
+	stats         stats
+	summaryFields map[string]func() interface{}
+	summaryMu     sync.Mutex
 }
 
 // New initializes a new Exchange
@@ -68,13 +78,11 @@ func New(ctx log.Interface, killWhenIdleFor time.Duration) *Exchange {
 		done:            make(chan struct{}),
 		northboundDone:  make(map[string][]chan struct{}),
 		southboundDone:  make(map[string][]chan struct{}),
-		connect:         make(chan *types.ConnectMessage),
-		disconnect:      make(chan *types.DisconnectMessage),
-		uplink:          make(chan *types.UplinkMessage),
-		status:          make(chan *types.StatusMessage),
-		downlink:        make(chan *types.DownlinkMessage),
+		queues:          []*queue{newQueue()},
 		gateways:        mapset.NewSet(),
 		killWhenIdleFor: killWhenIdleFor,
+		started:         time.Now(),
+		stats:           newStats(),
 	}
 	info.WithLabelValues(viper.GetString("buildDate"), viper.GetString("gitCommit"), viper.GetString("id"), viper.GetString("version")).Set(1)
 	if killWhenIdleFor > 0 {
@@ -93,6 +101,13 @@ func (b *Exchange) SetID(id string) {
 	trace.SetComponent("bridge", id)
 }
 
+// SetExemplars sets whether the trace IDs of uplink and downlink messages are attached as exemplars to the
+// processing duration histogram. Exemplars are only attached when tracing is enabled, and are only exposed in the
+// OpenMetrics format.
+func (b *Exchange) SetExemplars(enabled bool) {
+	b.exemplars = enabled
+}
+
 // SetMiddleware sets the middleware to be executed
 func (b *Exchange) SetMiddleware(chain middleware.Chain) {
 	b.middleware = chain
@@ -144,6 +159,7 @@ func (b *Exchange) subscribeSouthbound(backend backend.Southbound) {
 	if err != nil {
 		b.ctx.WithError(err).Errorf("Could not subscribe to disconnect from backend %v", backend)
 	}
+	downlinkAck := b.subscribeDownlinkAck(backend)
 	b.backendInit.Done()
 loop:
 	for {
@@ -151,9 +167,16 @@ loop:
 		case <-b.done:
 			break loop
 		case connectMessage := <-connect:
-			b.connect <- connectMessage
+			b.observeConnect()
+			b.queue(connectMessage.GatewayID).connect <- connectMessage
 		case disconnectMessage := <-disconnect:
-			b.disconnect <- disconnectMessage
+			b.queue(disconnectMessage.GatewayID).disconnect <- disconnectMessage
+		case downlinkAckMessage, ok := <-downlinkAck:
+			if !ok {
+				downlinkAck = nil
+				continue
+			}
+			b.queue(downlinkAckMessage.GatewayID).downlinkAck <- downlinkAckMessage
 		}
 	}
 	if err := backend.UnsubscribeConnect(); err != nil {
@@ -162,6 +185,7 @@ loop:
 	if err := backend.UnsubscribeDisconnect(); err != nil {
 		b.ctx.WithError(err).Errorf("Could not unsubscribe from disconnect on backend %v", backend)
 	}
+	b.unsubscribeDownlinkAck(backend)
 }
 
 // ConnectGateway force-connects gateways with the given IDs
@@ -184,7 +208,7 @@ func (b *Exchange) ConnectGateway(gatewayID ...string) {
 
 var errClosedChannel = errors.New("closed channel")
 
-func (b *Exchange) handleChannels() (err error) {
+func (b *Exchange) handleChannels(q *queue) (err error) {
 	errCh := make(chan error)
 	defer close(errCh)
 	doneCh := make(chan struct{})
@@ -197,16 +221,20 @@ func (b *Exchange) handleChannels() (err error) {
 	go func() {
 		var curStart time.Time
 		var curCtx log.Interface
+		var curTrace *trace.Trace
 		start := func(ctx log.Interface, msg string) {
 			watchdog.Kick()
 			curStart = time.Now()
 			curCtx = ctx
 			curMsg = msg
+			curTrace = nil
 		}
 		var err error
 		for {
 			if curMsg != "" && err == nil {
-				curCtx.WithField("Duration", time.Since(curStart)).Infof("Routed %s", curMsg)
+				duration := time.Since(curStart)
+				observeProcessing(curMsg, duration, curTrace, b.exemplars)
+				curCtx.WithField("Duration", duration).Infof("Routed %s", curMsg)
 			}
 			err = nil
 			select {
@@ -214,7 +242,7 @@ func (b *Exchange) handleChannels() (err error) {
 				return
 			case <-time.After(watchdogExpire - 100*time.Millisecond):
 				start(b.ctx, "")
-			case connectMessage, ok := <-b.connect:
+			case connectMessage, ok := <-q.connect:
 				if !ok {
 					err = errClosedChannel
 					continue
@@ -231,12 +259,22 @@ func (b *Exchange) handleChannels() (err error) {
 					}
 				}
 				if !b.gateways.Add(gatewayID) {
-					ctx.Debug("Got connect message from already-connected gateway")
+					duplicateConnects.Inc()
+					ctx.Info("Got connect message from already-connected gateway")
+					b.connected(ctx, gatewayID)
 					err = errors.New("Got connect message from already-connected gateway")
 					continue
 				}
-				if err = b.middleware.Execute(middleware.NewContext(), connectMessage); err != nil {
+				mwCtx := middleware.NewContext()
+				mwCtx.Set(middleware.ConnectResponderKey, func(response *types.ConnectResponseMessage) {
+					if b.gateways.Contains(gatewayID) {
+						b.respondConnect(ctx, response)
+					}
+				})
+				if err = b.middleware.Execute(mwCtx, connectMessage); err != nil {
 					ctx.WithError(err).Warn("Error in middleware")
+					b.gateways.Remove(gatewayID)
+					b.stats.drop(connectKind)
 					continue
 				}
 				for _, backend := range b.northboundBackends {
@@ -245,8 +283,13 @@ func (b *Exchange) handleChannels() (err error) {
 				for _, backend := range b.southboundBackends {
 					go b.activateSouthbound(backend, gatewayID)
 				}
+				if response := middleware.ConnectResponseFromContext(mwCtx); response != nil {
+					b.respondConnect(ctx, response)
+				}
 				connectedGateways.Inc()
-			case disconnectMessage, ok := <-b.disconnect:
+				b.stats.handle(connectKind)
+				b.connected(ctx, gatewayID)
+			case disconnectMessage, ok := <-q.disconnect:
 				if !ok {
 					err = errClosedChannel
 					continue
@@ -264,13 +307,20 @@ func (b *Exchange) handleChannels() (err error) {
 				}
 				if err = b.middleware.Execute(middleware.NewContext(), disconnectMessage); err != nil {
 					ctx.WithError(err).Warn("Error in middleware")
+					b.stats.drop(disconnectKind)
 					continue
 				}
 				b.deactivateNorthbound(gatewayID)
 				b.deactivateSouthbound(gatewayID)
 				b.gateways.Remove(gatewayID)
+				b.markDisconnected(gatewayID)
 				connectedGateways.Dec()
-			case uplinkMessage, ok := <-b.uplink:
+				b.stats.handle(disconnectKind)
+			case gatewayID := <-q.forceDisconnect:
+				ctx := b.ctx.WithField("GatewayID", gatewayID)
+				start(ctx, "forced disconnect")
+				b.forceDisconnect(ctx, gatewayID)
+			case uplinkMessage, ok := <-q.uplink:
 				if !ok {
 					err = errClosedChannel
 					continue
@@ -283,8 +333,11 @@ func (b *Exchange) handleChannels() (err error) {
 				start(ctx, "uplink")
 				if err = b.middleware.Execute(middleware.NewContext(), uplinkMessage); err != nil {
 					ctx.WithError(err).Warn("Error in middleware")
+					b.stats.drop(uplinkKind)
 					continue
 				}
+				b.connected(ctx, uplinkMessage.GatewayID)
+				curTrace = uplinkMessage.Message.Trace
 				uplinkMessage.Message.GatewayMetadata.GatewayID = uplinkMessage.GatewayID
 				published := 0
 				for _, backend := range b.northboundBackends {
@@ -302,11 +355,13 @@ func (b *Exchange) handleChannels() (err error) {
 				}
 				if published > 0 {
 					registerHandled(uplinkMessage.Message)
+					b.stats.handle(uplinkKind)
 				} else {
 					ctx.Warn("Uplink not accepted by any northbound backend")
+					b.stats.fail(uplinkKind)
 					err = errors.New("Uplink not accepted by any northbound backend")
 				}
-			case downlinkMessage, ok := <-b.downlink:
+			case downlinkMessage, ok := <-q.downlink:
 				if !ok {
 					err = errClosedChannel
 					continue
@@ -316,28 +371,20 @@ func (b *Exchange) handleChannels() (err error) {
 				})
 				ctx = ctxWithMessageFields(ctx, downlinkMessage.Message)
 				start(ctx, "downlink")
-				if err = b.middleware.Execute(middleware.NewContext(), downlinkMessage); err != nil {
-					ctx.WithError(err).Warn("Error in middleware")
+				if b.deferDownlink(ctx, downlinkMessage) {
 					continue
 				}
-				published := 0
-				for _, backend := range b.southboundBackends {
-					ctx := ctx.WithField("Backend", fmt.Sprintf("%T", backend))
-					err := backend.PublishDownlink(downlinkMessage)
-					if err == nil {
-						ctx.Debug("Published downlink")
-						published++
-					} else {
-						ctx.WithError(err).Debug("Did not publish downlink")
-					}
-				}
-				if published > 0 {
-					registerHandled(downlinkMessage.Message)
-				} else {
-					ctx.Warn("Downlink not accepted by any southbound backend")
-					err = errors.New("Downlink not accepted by any southbound backend")
+				err = b.handleDownlink(ctx, downlinkMessage)
+				curTrace = downlinkMessage.Message.Trace
+			case downlinkAckMessage, ok := <-q.downlinkAck:
+				if !ok {
+					err = errClosedChannel
+					continue
 				}
-			case statusMessage, ok := <-b.status:
+				ctx := b.ctx.WithField("GatewayID", downlinkAckMessage.GatewayID)
+				start(ctx, "downlink ack")
+				b.handleDownlinkAck(ctx, downlinkAckMessage)
+			case statusMessage, ok := <-q.status:
 				if !ok {
 					err = errClosedChannel
 					continue
@@ -346,8 +393,10 @@ func (b *Exchange) handleChannels() (err error) {
 				start(ctx, "status")
 				if err = b.middleware.Execute(middleware.NewContext(), statusMessage); err != nil {
 					ctx.WithError(err).Warn("Error in middleware")
+					b.stats.drop(statusKind)
 					continue
 				}
+				b.connected(ctx, statusMessage.GatewayID)
 				published := 0
 				for _, backend := range b.northboundBackends {
 					ctx := ctx.WithField("Backend", fmt.Sprintf("%T", backend))
@@ -361,8 +410,10 @@ func (b *Exchange) handleChannels() (err error) {
 				}
 				if published > 0 {
 					registerStatus()
+					b.stats.handle(statusKind)
 				} else {
 					ctx.Warn("Status not accepted by any northbound backend")
+					b.stats.fail(statusKind)
 					err = errors.New("Status not accepted by any northbound backend")
 				}
 			}
@@ -376,6 +427,44 @@ func (b *Exchange) handleChannels() (err error) {
 	}
 }
 
+// handleDownlink executes the middleware for the downlink message and publishes it to the southbound backends
+func (b *Exchange) handleDownlink(ctx *log.Entry, downlinkMessage *types.DownlinkMessage) error {
+	mwCtx := middleware.NewContext()
+	if err := b.middleware.Execute(mwCtx, downlinkMessage); err != nil {
+		ctx.WithError(err).Warn("Error in middleware")
+		b.stats.drop(downlinkKind)
+		return err
+	}
+	published := 0
+	for _, backend := range b.southboundBackends {
+		ctx := ctx.WithField("Backend", fmt.Sprintf("%T", backend))
+		err := backend.PublishDownlink(downlinkMessage)
+		if err == nil {
+			ctx.Debug("Published downlink")
+			published++
+		} else {
+			ctx.WithError(err).Debug("Did not publish downlink")
+		}
+	}
+	if published == 0 {
+		ctx.Warn("Downlink not accepted by any southbound backend")
+		b.stats.fail(downlinkKind)
+		return errors.New("Downlink not accepted by any southbound backend")
+	}
+	b.middleware.Sent(mwCtx, downlinkMessage)
+	registerHandled(downlinkMessage.Message)
+	b.stats.handle(downlinkKind)
+	return nil
+}
+
+// connected marks the gateway as known to be connected and sends the downlinks that were deferred until then
+func (b *Exchange) connected(ctx log.Interface, gatewayID string) {
+	for _, downlinkMessage := range b.markConnected(ctx, gatewayID) {
+		ctx := ctxWithMessageFields(b.ctx.WithField("GatewayID", downlinkMessage.GatewayID), downlinkMessage.Message)
+		b.handleDownlink(ctx, downlinkMessage)
+	}
+}
+
 func ctxWithMessageFields(ctx *log.Entry, m message) *log.Entry {
 	fields := make(log.Fields)
 	fields["PayloadSize"] = len(m.GetPayload())
@@ -450,7 +539,7 @@ loop:
 			if !ok {
 				continue
 			}
-			b.downlink <- downlinkMessage
+			b.queue(downlinkMessage.GatewayID).downlink <- downlinkMessage
 		}
 	}
 	if err := backend.UnsubscribeDownlink(gatewayID); err != nil {
@@ -484,12 +573,12 @@ loop:
 			if !ok {
 				continue
 			}
-			b.uplink <- uplinkMessage
+			b.queue(uplinkMessage.GatewayID).uplink <- uplinkMessage
 		case statusMessage, ok := <-status:
 			if !ok {
 				continue
 			}
-			b.status <- statusMessage
+			b.queue(statusMessage.GatewayID).status <- statusMessage
 		}
 	}
 	if err := backend.UnsubscribeUplink(gatewayID); err != nil {
@@ -523,9 +612,12 @@ func (b *Exchange) deactivateSouthbound(gatewayID string) {
 	}
 }
 
-// Start the Exchange
+// Start the Exchange with the given number of workers. Messages of the same gateway are always handled by the same
+// worker, so that messages of the same type stay in order (see queue). Messages of different gateways may be
+// reordered.
 func (b *Exchange) Start(goroutines int, timeout time.Duration) (finishedWithinTimeout bool) {
 	b.mu.Lock()
+	b.setQueues(goroutines)
 	for _, backend := range b.northboundBackends {
 		b.backendInit.Add(1)
 		go b.subscribeNorthbound(backend)
@@ -545,16 +637,19 @@ func (b *Exchange) Start(goroutines int, timeout time.Duration) (finishedWithinT
 	case <-time.After(timeout):
 		finishedWithinTimeout = false
 	}
-	for i := 0; i < goroutines; i++ {
-		go func() {
+	b.queuesMu.RLock()
+	queues := b.queues
+	b.queuesMu.RUnlock()
+	for _, q := range queues {
+		go func(q *queue) {
 			for {
-				err := b.handleChannels()
+				err := b.handleChannels(q)
 				if err == nil {
 					return
 				}
 				b.ctx.WithError(err).Error("Error in handleChannels")
 			}
-		}()
+		}(q)
 	}
 	return
 }
@@ -5,16 +5,28 @@ package exchange
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync"
 	"testing"
 	"time"
 
 	pb_gateway "github.com/TheThingsNetwork/api/gateway"
 	pb_router "github.com/TheThingsNetwork/api/router"
+	"github.com/TheThingsNetwork/api/trace"
 	"github.com/TheThingsNetwork/gateway-connector-bridge/auth"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/backend"
 	"github.com/TheThingsNetwork/gateway-connector-bridge/backend/dummy"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/events"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/middleware"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/middleware/connlimit"
 	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
 	"github.com/apex/log"
 	"github.com/apex/log/handlers/text"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -92,6 +104,21 @@ func TestExchange(t *testing.T) {
 								So(b.gateways.Contains("dev"), ShouldBeTrue)
 							})
 						})
+
+						Convey("When forcing a disconnect", func() {
+							err := b.ForceDisconnect("DEV")
+							time.Sleep(10 * time.Millisecond)
+							Convey("There should be no error", func() {
+								So(err, ShouldBeNil)
+							})
+							Convey("The gateway should be disconnected", func() {
+								So(b.gateways.Contains("dev"), ShouldBeFalse)
+								So(b.Summary().Handled["disconnect"], ShouldEqual, 1)
+							})
+							Convey("Forcing another disconnect should return an error", func() {
+								So(b.ForceDisconnect("dev"), ShouldEqual, ErrNotConnected)
+							})
+						})
 					})
 
 					Convey("When sending a connect message", func() {
@@ -105,6 +132,15 @@ func TestExchange(t *testing.T) {
 						Convey("The gateway should be connected", func() {
 							So(b.gateways.Contains("dev"), ShouldBeTrue)
 						})
+						Convey("The summary should count the connect message", func() {
+							summary := b.Summary()
+							So(summary.Handled["connect"], ShouldEqual, 1)
+							So(summary.ConnectedGateways, ShouldEqual, 1)
+							So(summary.String(), ShouldContainSubstring, "handled.connect=1")
+							var buf bytes.Buffer
+							So(b.WriteSummary(&buf, "json"), ShouldBeNil)
+							So(buf.String(), ShouldContainSubstring, `"handled":{"connect":1}`)
+						})
 
 						Convey("When sending another connect message", func() {
 							err := gateway.PublishConnect(&types.ConnectMessage{
@@ -237,3 +273,462 @@ func TestExchange(t *testing.T) {
 
 	})
 }
+
+// orderedNorthbound records the uplink messages it receives, per gateway
+type orderedNorthbound struct {
+	mu      sync.Mutex
+	uplinks map[string][]uint32
+}
+
+func (o *orderedNorthbound) Connect() error                  { return nil }
+func (o *orderedNorthbound) Disconnect() error               { return nil }
+func (o *orderedNorthbound) CleanupGateway(gatewayID string) {}
+func (o *orderedNorthbound) PublishUplink(message *types.UplinkMessage) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.uplinks[message.GatewayID] = append(o.uplinks[message.GatewayID], message.Message.GatewayMetadata.Timestamp)
+	return nil
+}
+func (o *orderedNorthbound) PublishStatus(message *types.StatusMessage) error { return nil }
+func (o *orderedNorthbound) SubscribeDownlink(gatewayID string) (<-chan *types.DownlinkMessage, error) {
+	return make(chan *types.DownlinkMessage), nil
+}
+func (o *orderedNorthbound) UnsubscribeDownlink(gatewayID string) error { return nil }
+
+func TestExchangeOrdering(t *testing.T) {
+	Convey("Given an Exchange with multiple workers", t, func(c C) {
+		const gateways, messages = 20, 100
+
+		bufferSize := dummy.BufferSize
+		dummy.BufferSize = messages
+		Reset(func() { dummy.BufferSize = bufferSize })
+
+		ctx := &log.Logger{Handler: text.New(ioutil.Discard), Level: log.ErrorLevel}
+		northbound := &orderedNorthbound{uplinks: make(map[string][]uint32)}
+		southbound := dummy.New(ctx)
+
+		b := New(ctx, 0)
+		b.SetAuth(auth.NewMemory())
+		b.AddNorthbound(northbound)
+		b.AddSouthbound(southbound)
+		b.Start(8, 10*time.Millisecond)
+		Reset(b.Stop)
+
+		for i := 0; i < gateways; i++ {
+			southbound.PublishConnect(&types.ConnectMessage{GatewayID: fmt.Sprintf("dev-%d", i)})
+		}
+		time.Sleep(50 * time.Millisecond)
+
+		Convey("When many gateways send uplink messages concurrently", func() {
+			var wg sync.WaitGroup
+			for i := 0; i < gateways; i++ {
+				wg.Add(1)
+				go func(gatewayID string) {
+					defer wg.Done()
+					for j := 0; j < messages; j++ {
+						uplink := &types.UplinkMessage{GatewayID: gatewayID, Message: &pb_router.UplinkMessage{}}
+						uplink.Message.GatewayMetadata.Timestamp = uint32(j)
+						southbound.PublishUplink(uplink)
+					}
+				}(fmt.Sprintf("dev-%d", i))
+			}
+			wg.Wait()
+
+			Convey("The messages of each gateway should arrive in order", func() {
+				deadline := time.Now().Add(5 * time.Second)
+				for {
+					northbound.mu.Lock()
+					var received int
+					for _, uplinks := range northbound.uplinks {
+						received += len(uplinks)
+					}
+					northbound.mu.Unlock()
+					if received == gateways*messages || time.Now().After(deadline) {
+						break
+					}
+					time.Sleep(10 * time.Millisecond)
+				}
+				northbound.mu.Lock()
+				defer northbound.mu.Unlock()
+				So(northbound.uplinks, ShouldHaveLength, gateways)
+				for gatewayID, uplinks := range northbound.uplinks {
+					So(uplinks, ShouldHaveLength, messages)
+					for j, timestamp := range uplinks {
+						if timestamp != uint32(j) {
+							So(fmt.Sprintf("%s: uplink %d at position %d", gatewayID, timestamp, j), ShouldBeEmpty)
+							break
+						}
+					}
+				}
+			})
+		})
+	})
+}
+
+func TestRejectedConnect(t *testing.T) {
+	Convey("Given an Exchange that allows one connected gateway", t, func(c C) {
+		ctx := &log.Logger{Handler: text.New(ioutil.Discard), Level: log.ErrorLevel}
+		gateway := dummy.New(ctx)
+
+		b := New(ctx, 0)
+		b.SetAuth(auth.NewMemory())
+		b.SetMiddleware(middleware.Chain{connlimit.NewConnLimit(1)})
+		b.AddNorthbound(dummy.New(ctx))
+		b.AddSouthbound(gateway)
+		b.Start(1, 10*time.Millisecond)
+		Reset(b.Stop)
+
+		gateway.PublishConnect(&types.ConnectMessage{GatewayID: "first"})
+		time.Sleep(10 * time.Millisecond)
+
+		Convey("When another gateway connects", func() {
+			gateway.PublishConnect(&types.ConnectMessage{GatewayID: "second"})
+			time.Sleep(10 * time.Millisecond)
+
+			Convey("It should not be connected", func() {
+				So(b.gateways.Contains("second"), ShouldBeFalse)
+				So(b.Summary().ConnectedGateways, ShouldEqual, 1)
+			})
+
+			Convey("When it retries after the first gateway disconnected", func() {
+				gateway.PublishDisconnect(&types.DisconnectMessage{GatewayID: "first"})
+				time.Sleep(10 * time.Millisecond)
+				gateway.PublishConnect(&types.ConnectMessage{GatewayID: "second"})
+				time.Sleep(10 * time.Millisecond)
+
+				Convey("It should be connected", func() {
+					So(b.gateways.Contains("second"), ShouldBeTrue)
+					So(b.Summary().ConnectedGateways, ShouldEqual, 1)
+				})
+			})
+		})
+	})
+}
+
+func TestDuplicateConnect(t *testing.T) {
+	Convey("Given an Exchange with a connected gateway", t, func(c C) {
+		ctx := &log.Logger{Handler: text.New(ioutil.Discard), Level: log.ErrorLevel}
+		gateway := dummy.New(ctx)
+
+		b := New(ctx, 0)
+		b.SetAuth(auth.NewMemory())
+		b.AddNorthbound(dummy.New(ctx))
+		b.AddSouthbound(gateway)
+		b.Start(1, 10*time.Millisecond)
+		Reset(b.Stop)
+
+		gateway.PublishConnect(&types.ConnectMessage{GatewayID: "dev"})
+		time.Sleep(10 * time.Millisecond)
+
+		duplicates := func() float64 {
+			metric := &dto.Metric{}
+			So(duplicateConnects.Write(metric), ShouldBeNil)
+			return metric.GetCounter().GetValue()
+		}
+		before := duplicates()
+
+		Convey("When the gateway connects again", func() {
+			gateway.PublishConnect(&types.ConnectMessage{GatewayID: "dev"})
+			time.Sleep(10 * time.Millisecond)
+
+			Convey("The duplicate connect should be counted", func() {
+				So(duplicates(), ShouldEqual, before+1)
+			})
+			Convey("The gateway should still be connected once", func() {
+				So(b.gateways.Contains("dev"), ShouldBeTrue)
+				So(b.Summary().ConnectedGateways, ShouldEqual, 1)
+			})
+		})
+	})
+}
+
+func TestConnectStorm(t *testing.T) {
+	Convey("Given an Exchange with connect storm detection", t, func(c C) {
+		b := New(log.Log, 0)
+		notifier := events.New(time.Hour)
+		ch, handler := events.Channel(10)
+		notifier.Handle(handler)
+		b.SetEvents(notifier)
+		b.SetConnectStorm(3, time.Minute)
+
+		Convey("When less gateways than the threshold connect", func() {
+			for i := 0; i < 3; i++ {
+				b.observeConnect()
+			}
+			Convey("No event should be emitted", func() {
+				So(ch, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When more gateways than the threshold connect", func() {
+			for i := 0; i < 10; i++ {
+				b.observeConnect()
+			}
+			Convey("A single ConnectStorm event should be emitted", func() {
+				So(ch, ShouldHaveLength, 1)
+				So((<-ch).Kind, ShouldEqual, events.ConnectStorm)
+			})
+		})
+	})
+}
+
+func TestDeferDownlinks(t *testing.T) {
+	Convey("Given an Exchange that defers downlinks until gateways are connected", t, func(c C) {
+		ctx := &log.Logger{Handler: text.New(ioutil.Discard), Level: log.ErrorLevel}
+		ttn := dummy.New(ctx)
+		gateway := dummy.New(ctx)
+
+		b := New(ctx, 0)
+		b.SetAuth(auth.NewMemory())
+		b.AddNorthbound(ttn)
+		b.AddSouthbound(gateway)
+		b.SetDeferDownlinksUntilConnected(2, 0)
+		b.Start(1, 10*time.Millisecond)
+		Reset(b.Stop)
+
+		downlink, _ := gateway.SubscribeDownlink("dev")
+		b.ConnectGateway("dev")
+		time.Sleep(10 * time.Millisecond)
+
+		for i := 0; i < 3; i++ {
+			ttn.PublishDownlink(&types.DownlinkMessage{GatewayID: "dev", Message: &pb_router.DownlinkMessage{Payload: []byte{byte(i)}}})
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		Convey("The downlinks should be held", func() {
+			So(downlink, ShouldBeEmpty)
+			So(b.Summary().Dropped["downlink"], ShouldEqual, 1)
+		})
+
+		Convey("When the gateway connects", func() {
+			gateway.PublishConnect(&types.ConnectMessage{GatewayID: "dev"})
+			time.Sleep(10 * time.Millisecond)
+
+			Convey("The newest held downlinks should be sent", func() {
+				So(downlink, ShouldHaveLength, 2)
+				So((<-downlink).Message.Payload, ShouldResemble, []byte{1})
+				So((<-downlink).Message.Payload, ShouldResemble, []byte{2})
+			})
+
+			Convey("Later downlinks should be sent right away", func() {
+				<-downlink
+				<-downlink
+				ttn.PublishDownlink(&types.DownlinkMessage{GatewayID: "dev", Message: &pb_router.DownlinkMessage{}})
+				time.Sleep(10 * time.Millisecond)
+				So(downlink, ShouldHaveLength, 1)
+			})
+		})
+
+		Convey("When the gateway disconnects", func() {
+			gateway.PublishDisconnect(&types.DisconnectMessage{GatewayID: "dev"})
+			time.Sleep(10 * time.Millisecond)
+
+			Convey("The held downlinks should be dropped", func() {
+				So(b.Summary().Dropped["downlink"], ShouldEqual, 3)
+			})
+		})
+	})
+}
+
+func TestDownlinkAck(t *testing.T) {
+	Convey("Given an Exchange with backends that support downlink acks", t, func(c C) {
+		ctx := &log.Logger{Handler: text.New(ioutil.Discard), Level: log.ErrorLevel}
+		ttn := dummy.New(ctx)
+		gateway := dummy.New(ctx)
+		broker := &ackPublisher{Southbound: dummy.New(ctx), acks: make(chan *types.DownlinkAckMessage, 10)}
+
+		b := New(ctx, 0)
+		b.SetAuth(auth.NewMemory())
+		b.AddNorthbound(ttn)
+		b.AddSouthbound(gateway, broker)
+		b.Start(1, 10*time.Millisecond)
+		Reset(b.Stop)
+
+		acks, _ := ttn.SubscribeDownlinkAck()
+
+		Convey("When a not-connected gateway acks a downlink", func() {
+			gateway.PublishDownlinkAck(&types.DownlinkAckMessage{GatewayID: "dev"})
+			time.Sleep(10 * time.Millisecond)
+
+			Convey("The ack should be dropped", func() {
+				So(acks, ShouldBeEmpty)
+				So(b.Summary().Dropped["downlink_ack"], ShouldEqual, 1)
+			})
+		})
+
+		Convey("When a connected gateway acks a downlink", func() {
+			gateway.PublishConnect(&types.ConnectMessage{GatewayID: "dev"})
+			time.Sleep(10 * time.Millisecond)
+			gateway.PublishDownlinkAck(&types.DownlinkAckMessage{GatewayID: "dev"})
+			gateway.PublishDownlinkAck(&types.DownlinkAckMessage{GatewayID: "dev", Error: "TOO_LATE"})
+			time.Sleep(10 * time.Millisecond)
+
+			Convey("The acks should be published to the northbound backend", func() {
+				So(acks, ShouldHaveLength, 2)
+				So((<-acks).Error, ShouldBeEmpty)
+				So((<-acks).Error, ShouldEqual, "TOO_LATE")
+				So(b.Summary().Handled["downlink_ack"], ShouldEqual, 2)
+			})
+		})
+
+		Convey("When a connected gateway acks a downlink with an ID", func() {
+			gateway.PublishConnect(&types.ConnectMessage{GatewayID: "dev"})
+			time.Sleep(10 * time.Millisecond)
+			gateway.PublishDownlinkAck(&types.DownlinkAckMessage{GatewayID: "dev", DownlinkID: "downlink"})
+			time.Sleep(10 * time.Millisecond)
+
+			Convey("The ack should be published to the northbound and the southbound backend", func() {
+				So(acks, ShouldHaveLength, 1)
+				So(broker.acks, ShouldHaveLength, 1)
+				So((<-broker.acks).DownlinkID, ShouldEqual, "downlink")
+			})
+
+			Convey("The ack should not be published back to the backend that emitted it", func() {
+				So(b.Summary().Handled["downlink_ack"], ShouldEqual, 1)
+			})
+		})
+	})
+}
+
+// ackPublisher is a southbound backend that publishes downlink acks, but does not emit them
+type ackPublisher struct {
+	backend.Southbound
+	acks chan *types.DownlinkAckMessage
+}
+
+func (p *ackPublisher) PublishDownlinkAck(message *types.DownlinkAckMessage) error {
+	p.acks <- message
+	return nil
+}
+
+type validator struct{ err error }
+
+func (v validator) Validate(ctx context.Context) error { return v.err }
+
+func TestValidate(t *testing.T) {
+	Convey("Given an Exchange with middleware", t, func(c C) {
+		b := New(log.Log, 0)
+		b.AddNorthbound(dummy.New(log.Log))
+
+		Convey("When all components are valid", func() {
+			b.SetMiddleware(middleware.Chain{validator{}, struct{}{}})
+			Convey("There should be no error", func() {
+				So(b.Validate(context.Background()), ShouldBeNil)
+			})
+		})
+
+		Convey("When some components are invalid", func() {
+			errRedis, errAccount := errors.New("redis unreachable"), errors.New("account server unreachable")
+			b.SetMiddleware(middleware.Chain{validator{errRedis}, validator{}, validator{errAccount}})
+			err := b.Validate(context.Background())
+			Convey("The errors of all invalid components should be returned", func() {
+				So(errors.Is(err, errRedis), ShouldBeTrue)
+				So(errors.Is(err, errAccount), ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func TestProcessingExemplars(t *testing.T) {
+	Convey("Given a message with a trace", t, func(c C) {
+		Reset(func() { types.SetTraceLevel(types.TraceVerbose) })
+
+		msgTrace := (*trace.Trace)(nil).WithEvent("receive")
+		exemplar := func(message string) *dto.Exemplar {
+			metric := &dto.Metric{}
+			So(processingDuration.WithLabelValues(message).(prometheus.Metric).Write(metric), ShouldBeNil)
+			for _, bucket := range metric.GetHistogram().GetBucket() {
+				if bucket.Exemplar != nil {
+					return bucket.Exemplar
+				}
+			}
+			return nil
+		}
+
+		Convey("The trace ID should be attached as exemplar", func() {
+			observeProcessing("traced message", time.Millisecond, msgTrace, true)
+			e := exemplar("traced_message")
+			So(e, ShouldNotBeNil)
+			So(e.GetLabel(), ShouldHaveLength, 1)
+			So(e.GetLabel()[0].GetName(), ShouldEqual, "trace_id")
+			So(e.GetLabel()[0].GetValue(), ShouldEqual, msgTrace.ID)
+		})
+
+		Convey("No exemplar should be attached if exemplars are disabled", func() {
+			observeProcessing("untraced message", time.Millisecond, msgTrace, false)
+			So(exemplar("untraced_message"), ShouldBeNil)
+		})
+
+		Convey("No exemplar should be attached if tracing is disabled", func() {
+			types.SetTraceLevel(types.TraceOff)
+			observeProcessing("tracing off", time.Millisecond, msgTrace, true)
+			So(exemplar("tracing_off"), ShouldBeNil)
+		})
+	})
+}
+
+// connectResponder is a southbound backend that records connect responses
+type connectResponder struct {
+	backend.Southbound
+	responses chan *types.ConnectResponseMessage
+}
+
+func (r *connectResponder) RespondConnect(message *types.ConnectResponseMessage) error {
+	r.responses <- message
+	return nil
+}
+
+// respondingMiddleware sets a connect response for every connect message
+type respondingMiddleware struct{}
+
+func (respondingMiddleware) HandleConnect(ctx middleware.Context, msg *types.ConnectMessage) error {
+	if msg.GatewayID == "later" {
+		respond := middleware.ConnectResponderFromContext(ctx)
+		time.AfterFunc(5*time.Millisecond, func() {
+			respond(&types.ConnectResponseMessage{GatewayID: msg.GatewayID, FrequencyPlan: "US_915"})
+		})
+		return nil
+	}
+	ctx.Set(middleware.ConnectResponseKey, &types.ConnectResponseMessage{GatewayID: msg.GatewayID, FrequencyPlan: "EU_868"})
+	return nil
+}
+
+func TestConnectResponse(t *testing.T) {
+	Convey("Given an Exchange with middleware that responds to connects", t, func(c C) {
+		ctx := &log.Logger{Handler: text.New(ioutil.Discard), Level: log.ErrorLevel}
+		gateway := dummy.New(ctx)
+		responder := &connectResponder{Southbound: dummy.New(ctx), responses: make(chan *types.ConnectResponseMessage, 10)}
+
+		b := New(ctx, 0)
+		b.SetAuth(auth.NewMemory())
+		b.SetMiddleware(middleware.Chain{respondingMiddleware{}})
+		b.AddNorthbound(dummy.New(ctx))
+		b.AddSouthbound(gateway, responder)
+		b.Start(1, 10*time.Millisecond)
+		Reset(b.Stop)
+
+		Convey("When a gateway connects", func() {
+			gateway.PublishConnect(&types.ConnectMessage{GatewayID: "dev"})
+			time.Sleep(10 * time.Millisecond)
+
+			Convey("The response should be sent to the southbound backend that supports it", func() {
+				So(responder.responses, ShouldHaveLength, 1)
+				res := <-responder.responses
+				So(res.GatewayID, ShouldEqual, "dev")
+				So(res.FrequencyPlan, ShouldEqual, "EU_868")
+			})
+		})
+
+		Convey("When the middleware responds after the connect was handled", func() {
+			gateway.PublishConnect(&types.ConnectMessage{GatewayID: "later"})
+			time.Sleep(20 * time.Millisecond)
+
+			Convey("The response should be sent to the southbound backend that supports it", func() {
+				So(responder.responses, ShouldHaveLength, 1)
+				res := <-responder.responses
+				So(res.GatewayID, ShouldEqual, "later")
+				So(res.FrequencyPlan, ShouldEqual, "US_915")
+			})
+		})
+	})
+}
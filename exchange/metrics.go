@@ -4,8 +4,13 @@
 package exchange
 
 import (
+	"strings"
+	"time"
+
 	"github.com/TheThingsNetwork/api/protocol"
 	"github.com/TheThingsNetwork/api/protocol/lorawan"
+	"github.com/TheThingsNetwork/api/trace"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -38,6 +43,83 @@ var handledCounter = prometheus.NewCounterVec(
 	}, []string{"message_type"},
 )
 
+var processedCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "ttn",
+		Subsystem: "bridge",
+		Name:      "messages_processed_total",
+		Help:      "Total number of messages processed by the exchange, by kind and result.",
+	}, []string{"kind", "result"},
+)
+
+var forcedDisconnects = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Namespace: "ttn",
+		Subsystem: "bridge",
+		Name:      "forced_disconnects_total",
+		Help:      "Total number of gateways that were forcibly disconnected.",
+	},
+)
+
+var duplicateConnects = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Namespace: "ttn",
+		Subsystem: "bridge",
+		Name:      "duplicate_connects_total",
+		Help:      "Total number of connect messages that were received from already-connected gateways.",
+	},
+)
+
+var deferredDownlinks = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Namespace: "ttn",
+		Subsystem: "bridge",
+		Name:      "deferred_downlinks_total",
+		Help:      "Total number of downlink messages that were held until the gateway was known to be connected.",
+	},
+)
+
+var droppedDownlinks = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "ttn",
+		Subsystem: "bridge",
+		Name:      "deferred_downlinks_dropped_total",
+		Help:      "Total number of downlink messages that were dropped because the gateway was not known to be connected.",
+	}, []string{"reason"},
+)
+
+var downlinkAcks = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "ttn",
+		Subsystem: "bridge",
+		Name:      "downlink_acks_total",
+		Help:      "Total number of downlink acknowledgements that were received from gateways.",
+	}, []string{"result"},
+)
+
+var processingDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Namespace: "ttn",
+		Subsystem: "bridge",
+		Name:      "processing_duration_seconds",
+		Help:      "Histogram of the time it took to route messages.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 14),
+	}, []string{"message"},
+)
+
+// observeProcessing observes the time it took to route a message. With exemplars, the trace ID of the message is
+// attached to the observation, but only if tracing is enabled and the message has a trace.
+func observeProcessing(message string, duration time.Duration, msgTrace *trace.Trace, exemplars bool) {
+	observer := processingDuration.WithLabelValues(strings.Replace(message, " ", "_", -1))
+	if exemplars && types.Tracing(types.TraceBasic) {
+		if traceID := types.TraceID(msgTrace); traceID != "" {
+			observer.(prometheus.ExemplarObserver).ObserveWithExemplar(duration.Seconds(), prometheus.Labels{"trace_id": traceID})
+			return
+		}
+	}
+	observer.Observe(duration.Seconds())
+}
+
 func mTypeToString(mType lorawan.MType) string {
 	switch mType {
 	case lorawan.MType_JOIN_REQUEST:
@@ -87,6 +169,13 @@ func init() {
 	prometheus.MustRegister(info)
 	prometheus.MustRegister(connectedGateways)
 	prometheus.MustRegister(handledCounter)
+	prometheus.MustRegister(processedCounter)
+	prometheus.MustRegister(forcedDisconnects)
+	prometheus.MustRegister(duplicateConnects)
+	prometheus.MustRegister(deferredDownlinks)
+	prometheus.MustRegister(droppedDownlinks)
+	prometheus.MustRegister(downlinkAcks)
+	prometheus.MustRegister(processingDuration)
 	for mType := lorawan.MType(0); mType < 8; mType++ {
 		handledCounter.WithLabelValues(mTypeToString(mType)).Add(0)
 	}
@@ -0,0 +1,69 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package exchange
+
+import (
+	"hash/fnv"
+	"strings"
+
+	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
+)
+
+// queue contains the channels with messages that are handled by one worker.
+//
+// The messages of a gateway are always sent to the same queue (keyed by gateway ID), and each worker publishes
+// the messages of its queue to all backends before handling the next one, so that the messages of a gateway of the
+// same type (such as its uplink messages) stay in order. As the worker selects from a channel per message type, a
+// message of one type can be handled before an earlier message of another type, for example a status message before
+// an uplink message that was received just before it. There is no ordering guarantee between messages of different
+// gateways.
+type queue struct {
+	connect    chan *types.ConnectMessage
+	disconnect chan *types.DisconnectMessage
+	uplink     chan *types.UplinkMessage
+	status     chan *types.StatusMessage
+	downlink   chan *types.DownlinkMessage
+
+	downlinkAck     chan *types.DownlinkAckMessage
+	forceDisconnect chan string
+}
+
+func newQueue() *queue {
+	return &queue{
+		connect:    make(chan *types.ConnectMessage),
+		disconnect: make(chan *types.DisconnectMessage),
+		uplink:     make(chan *types.UplinkMessage),
+		status:     make(chan *types.StatusMessage),
+		downlink:   make(chan *types.DownlinkMessage),
+
+		downlinkAck:     make(chan *types.DownlinkAckMessage),
+		forceDisconnect: make(chan string),
+	}
+}
+
+// setQueues creates a queue for each of the workers
+func (b *Exchange) setQueues(workers int) {
+	if workers < 1 {
+		workers = 1
+	}
+	queues := make([]*queue, workers)
+	for i := range queues {
+		queues[i] = newQueue()
+	}
+	b.queuesMu.Lock()
+	b.queues = queues
+	b.queuesMu.Unlock()
+}
+
+// queue returns the queue for the messages of the gateway
+func (b *Exchange) queue(gatewayID string) *queue {
+	b.queuesMu.RLock()
+	defer b.queuesMu.RUnlock()
+	if len(b.queues) == 1 {
+		return b.queues[0]
+	}
+	hash := fnv.New32a()
+	hash.Write([]byte(strings.ToLower(gatewayID)))
+	return b.queues[hash.Sum32()%uint32(len(b.queues))]
+}
@@ -0,0 +1,29 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package exchange
+
+import (
+	"fmt"
+
+	"github.com/TheThingsNetwork/gateway-connector-bridge/backend"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
+	"github.com/apex/log"
+)
+
+// respondConnect sends the response that the middleware set for a connect message to the southbound backends that
+// implement backend.ConnectResponder. Backends that can not send it are logged, but the gateway stays connected.
+func (b *Exchange) respondConnect(ctx *log.Entry, response *types.ConnectResponseMessage) {
+	for _, southbound := range b.southboundBackends {
+		responder, ok := southbound.(backend.ConnectResponder)
+		if !ok {
+			continue
+		}
+		ctx := ctx.WithField("Backend", fmt.Sprintf("%T", southbound))
+		if err := responder.RespondConnect(response); err != nil {
+			ctx.WithError(err).Warn("Could not send connect response")
+			continue
+		}
+		ctx.Debug("Sent connect response")
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package exchange
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/TheThingsNetwork/gateway-connector-bridge/events"
+)
+
+// storm detects connect storms by counting connect messages in fixed time windows
+type storm struct {
+	mu        sync.Mutex
+	threshold int
+	window    time.Duration
+	start     time.Time
+	count     int
+}
+
+// SetEvents sets the Notifier that receives the events of the Exchange
+func (b *Exchange) SetEvents(notifier *events.Notifier) {
+	b.events = notifier
+}
+
+// SetConnectStorm sets the number of connect messages within the window above which a ConnectStorm event is
+// emitted. If threshold is 0, connect storms are not detected.
+func (b *Exchange) SetConnectStorm(threshold int, window time.Duration) {
+	b.storm.mu.Lock()
+	defer b.storm.mu.Unlock()
+	b.storm.threshold = threshold
+	b.storm.window = window
+}
+
+// observeConnect counts a connect message and emits a ConnectStorm event if the threshold is exceeded
+func (b *Exchange) observeConnect() {
+	b.storm.mu.Lock()
+	if b.storm.threshold == 0 || b.storm.window == 0 {
+		b.storm.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	if now.Sub(b.storm.start) >= b.storm.window {
+		b.storm.start = now
+		b.storm.count = 0
+	}
+	b.storm.count++
+	count, threshold, window := b.storm.count, b.storm.threshold, b.storm.window
+	b.storm.mu.Unlock()
+	if count <= threshold {
+		return
+	}
+	b.events.Emit(events.Event{
+		Kind:    events.ConnectStorm,
+		Message: fmt.Sprintf("More than %d gateways connected within %s", threshold, window),
+		Fields:  map[string]interface{}{"connects": count, "threshold": threshold, "window": window.String()},
+	})
+}
@@ -0,0 +1,188 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package exchange
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Message kinds that are counted in the summary
+const (
+	connectKind    = "connect"
+	disconnectKind = "disconnect"
+	uplinkKind     = "uplink"
+	downlinkKind   = "downlink"
+	statusKind     = "status"
+
+	downlinkAckKind = "downlink_ack"
+)
+
+// Results of processed messages that are counted in the summary
+const (
+	handledResult = "handled"
+	droppedResult = "dropped"
+	errorResult   = "error"
+)
+
+// stats counts the processed messages in the processedCounter metric, so that the summary and the metrics do not
+// diverge. The summary contains the counts since the Exchange was created, so stats keeps the counts of that time.
+type stats struct {
+	base map[string]map[string]uint64 // by result and kind
+}
+
+func newStats() stats {
+	return stats{base: processedCounts()}
+}
+
+func (s *stats) handle(kind string) { processedCounter.WithLabelValues(kind, handledResult).Inc() }
+func (s *stats) drop(kind string)   { processedCounter.WithLabelValues(kind, droppedResult).Inc() }
+func (s *stats) fail(kind string)   { processedCounter.WithLabelValues(kind, errorResult).Inc() }
+
+// since returns the counts of the result that were counted since the Exchange was created
+func (s *stats) since(counts map[string]map[string]uint64, result string) map[string]uint64 {
+	since := make(map[string]uint64)
+	for kind, count := range counts[result] {
+		if count > s.base[result][kind] {
+			since[kind] = count - s.base[result][kind]
+		}
+	}
+	return since
+}
+
+// processedCounts returns the values of the processedCounter metric by result and kind
+func processedCounts() map[string]map[string]uint64 {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		processedCounter.Collect(ch)
+		close(ch)
+	}()
+	counts := make(map[string]map[string]uint64)
+	for metric := range ch {
+		var m dto.Metric
+		if err := metric.Write(&m); err != nil {
+			continue
+		}
+		var kind, result string
+		for _, label := range m.GetLabel() {
+			switch label.GetName() {
+			case "kind":
+				kind = label.GetValue()
+			case "result":
+				result = label.GetValue()
+			}
+		}
+		if counts[result] == nil {
+			counts[result] = make(map[string]uint64)
+		}
+		counts[result][kind] = uint64(m.GetCounter().GetValue())
+	}
+	return counts
+}
+
+// Summary of the messages that were processed by the Exchange
+type Summary struct {
+	Uptime            time.Duration          `json:"uptime"`
+	ConnectedGateways int                    `json:"connected_gateways"`
+	Handled           map[string]uint64      `json:"handled"`
+	Dropped           map[string]uint64      `json:"dropped"`
+	Errors            map[string]uint64      `json:"errors"`
+	Extra             map[string]interface{} `json:"extra,omitempty"`
+}
+
+// AddSummaryField adds a field to the summary, such as the size of a cache. The function is called when the summary is
+// created.
+func (b *Exchange) AddSummaryField(name string, value func() interface{}) {
+	b.summaryMu.Lock()
+	defer b.summaryMu.Unlock()
+	if b.summaryFields == nil {
+		b.summaryFields = make(map[string]func() interface{})
+	}
+	b.summaryFields[name] = value
+}
+
+// Summary returns a summary of the messages that were processed, from the ttn_bridge_messages_processed_total metric.
+// Messages are "dropped" when middleware returned an error, and "errors" when no backend accepted them.
+func (b *Exchange) Summary() Summary {
+	counts := processedCounts()
+	summary := Summary{
+		Uptime:            time.Since(b.started),
+		ConnectedGateways: len(b.gateways.ToSlice()),
+		Handled:           b.stats.since(counts, handledResult),
+		Dropped:           b.stats.since(counts, droppedResult),
+		Errors:            b.stats.since(counts, errorResult),
+	}
+	b.summaryMu.Lock()
+	defer b.summaryMu.Unlock()
+	if len(b.summaryFields) > 0 {
+		summary.Extra = make(map[string]interface{}, len(b.summaryFields))
+		for name, value := range b.summaryFields {
+			summary.Extra[name] = value()
+		}
+	}
+	return summary
+}
+
+// MarshalJSON implements json.Marshaler, formatting the uptime as a string
+func (s Summary) MarshalJSON() ([]byte, error) {
+	type summary Summary
+	return json.Marshal(struct {
+		summary
+		Uptime string `json:"uptime"`
+	}{summary(s), s.Uptime.String()})
+}
+
+// String returns the summary in a human-readable key=value format
+func (s Summary) String() string {
+	parts := []string{
+		fmt.Sprintf("uptime=%s", s.Uptime),
+		fmt.Sprintf("connected_gateways=%d", s.ConnectedGateways),
+	}
+	for _, counts := range []struct {
+		name   string
+		counts map[string]uint64
+	}{{"handled", s.Handled}, {"dropped", s.Dropped}, {"errors", s.Errors}} {
+		for _, kind := range sortedKeys(counts.counts) {
+			parts = append(parts, fmt.Sprintf("%s.%s=%d", counts.name, kind, counts.counts[kind]))
+		}
+	}
+	extra := make([]string, 0, len(s.Extra))
+	for name := range s.Extra {
+		extra = append(extra, name)
+	}
+	sort.Strings(extra)
+	for _, name := range extra {
+		parts = append(parts, fmt.Sprintf("%s=%v", name, s.Extra[name]))
+	}
+	return strings.Join(parts, " ")
+}
+
+func sortedKeys(counts map[string]uint64) []string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// WriteSummary writes the summary to w, as text or as JSON
+func (b *Exchange) WriteSummary(w io.Writer, format string) error {
+	summary := b.Summary()
+	switch format {
+	case "json":
+		return json.NewEncoder(w).Encode(summary)
+	case "text", "":
+		_, err := fmt.Fprintln(w, summary.String())
+		return err
+	}
+	return fmt.Errorf("exchange: unknown summary format %q", format)
+}
@@ -0,0 +1,55 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package exchange
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Validator is implemented by the auth component, middleware and backends that can check their configuration and
+// the connectivity to the servers they depend on before the Exchange is started
+type Validator interface {
+	Validate(ctx context.Context) error
+}
+
+// Validate runs the validation of all components of the Exchange that implement Validator, and returns the errors
+// of all components that failed. The validations run concurrently and can be bounded by the deadline of ctx.
+func (b *Exchange) Validate(ctx context.Context) error {
+	b.mu.Lock()
+	var components []interface{}
+	if b.auth != nil {
+		components = append(components, b.auth)
+	}
+	for _, middleware := range b.middleware {
+		components = append(components, middleware)
+	}
+	for _, backend := range b.northboundBackends {
+		components = append(components, backend)
+	}
+	for _, backend := range b.southboundBackends {
+		components = append(components, backend)
+	}
+	b.mu.Unlock()
+
+	errs := make([]error, len(components))
+	var wg sync.WaitGroup
+	for i, component := range components {
+		validator, ok := component.(Validator)
+		if !ok {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, component interface{}) {
+			defer wg.Done()
+			if err := validator.Validate(ctx); err != nil {
+				errs[i] = fmt.Errorf("%T: %w", component, err)
+			}
+		}(i, component)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
@@ -0,0 +1,108 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package authorize
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/TheThingsNetwork/gateway-connector-bridge/middleware"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
+	"github.com/TheThingsNetwork/go-utils/log"
+)
+
+// ErrUnauthorized is returned for messages of gateways that are not authorized
+var ErrUnauthorized = errors.New("authorize: Gateway is not authorized")
+
+// Authorizer decides if a connecting gateway is authorized. It returns nil to allow the connection, or an error to deny it.
+type Authorizer func(msg *types.ConnectMessage) error
+
+// AllowAll is an Authorizer that allows all gateways
+func AllowAll(msg *types.ConnectMessage) error {
+	return nil
+}
+
+// RequireKey is an Authorizer that denies gateways that connect without a key
+func RequireKey(msg *types.ConnectMessage) error {
+	if msg.Key == "" {
+		return errors.New("authorize: no key")
+	}
+	return nil
+}
+
+// NewAuthorize returns a middleware that asks the Authorizer if a gateway is authorized when it connects, and
+// drops the messages of gateways that are not. If authorizer is nil, AllowAll is used.
+func NewAuthorize(authorizer Authorizer) *Authorize {
+	if authorizer == nil {
+		authorizer = AllowAll
+	}
+	return &Authorize{
+		log:        log.Get(),
+		authorizer: authorizer,
+		denied:     make(map[string]struct{}),
+	}
+}
+
+// Authorize gateways when they connect
+type Authorize struct {
+	log        log.Interface
+	authorizer Authorizer
+
+	mu     sync.RWMutex
+	denied map[string]struct{}
+}
+
+func (a *Authorize) check(gatewayID string, messageType string) error {
+	a.mu.RLock()
+	_, denied := a.denied[strings.ToLower(gatewayID)]
+	a.mu.RUnlock()
+	if denied {
+		deniedCounter.WithLabelValues(messageType).Inc()
+		return ErrUnauthorized
+	}
+	return nil
+}
+
+// HandleConnect asks the Authorizer if the gateway is authorized
+func (a *Authorize) HandleConnect(ctx middleware.Context, msg *types.ConnectMessage) error {
+	err := a.authorizer(msg)
+	gatewayID := strings.ToLower(msg.GatewayID)
+	a.mu.Lock()
+	if err != nil {
+		a.denied[gatewayID] = struct{}{}
+	} else {
+		delete(a.denied, gatewayID)
+	}
+	a.mu.Unlock()
+	if err != nil {
+		a.log.WithField("GatewayID", msg.GatewayID).WithError(err).Warn("Gateway is not authorized")
+		deniedCounter.WithLabelValues("Connect").Inc()
+		return ErrUnauthorized
+	}
+	return nil
+}
+
+// HandleDisconnect cleans up
+func (a *Authorize) HandleDisconnect(ctx middleware.Context, msg *types.DisconnectMessage) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.denied, strings.ToLower(msg.GatewayID))
+	return nil
+}
+
+// HandleUplink drops uplink messages of gateways that are not authorized
+func (a *Authorize) HandleUplink(ctx middleware.Context, msg *types.UplinkMessage) error {
+	return a.check(msg.GatewayID, "Uplink")
+}
+
+// HandleStatus drops status messages of gateways that are not authorized
+func (a *Authorize) HandleStatus(ctx middleware.Context, msg *types.StatusMessage) error {
+	return a.check(msg.GatewayID, "Status")
+}
+
+// HandleDownlink drops downlink messages to gateways that are not authorized
+func (a *Authorize) HandleDownlink(ctx middleware.Context, msg *types.DownlinkMessage) error {
+	return a.check(msg.GatewayID, "Downlink")
+}
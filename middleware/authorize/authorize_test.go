@@ -0,0 +1,64 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package authorize
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/TheThingsNetwork/gateway-connector-bridge/middleware"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAuthorize(t *testing.T) {
+	Convey("Given a new Authorize that only allows gateway \"allowed\"", t, func(c C) {
+		a := NewAuthorize(func(msg *types.ConnectMessage) error {
+			if msg.GatewayID != "allowed" {
+				return errors.New("not allowed")
+			}
+			return nil
+		})
+
+		Convey("When an allowed gateway connects", func() {
+			err := a.HandleConnect(middleware.NewContext(), &types.ConnectMessage{GatewayID: "allowed"})
+			Convey("There should be no error", func() {
+				So(err, ShouldBeNil)
+			})
+			Convey("Its messages should not be dropped", func() {
+				So(a.HandleUplink(middleware.NewContext(), &types.UplinkMessage{GatewayID: "allowed"}), ShouldBeNil)
+				So(a.HandleStatus(middleware.NewContext(), &types.StatusMessage{GatewayID: "allowed"}), ShouldBeNil)
+				So(a.HandleDownlink(middleware.NewContext(), &types.DownlinkMessage{GatewayID: "allowed"}), ShouldBeNil)
+			})
+		})
+
+		Convey("When another gateway connects", func() {
+			err := a.HandleConnect(middleware.NewContext(), &types.ConnectMessage{GatewayID: "dev"})
+			Convey("There should be an error", func() {
+				So(err, ShouldEqual, ErrUnauthorized)
+			})
+			Convey("Its messages should be dropped", func() {
+				So(a.HandleUplink(middleware.NewContext(), &types.UplinkMessage{GatewayID: "dev"}), ShouldEqual, ErrUnauthorized)
+				So(a.HandleStatus(middleware.NewContext(), &types.StatusMessage{GatewayID: "dev"}), ShouldEqual, ErrUnauthorized)
+				So(a.HandleDownlink(middleware.NewContext(), &types.DownlinkMessage{GatewayID: "dev"}), ShouldEqual, ErrUnauthorized)
+			})
+			Convey("Its messages should be dropped regardless of the case of the ID", func() {
+				So(a.HandleUplink(middleware.NewContext(), &types.UplinkMessage{GatewayID: "DEV"}), ShouldEqual, ErrUnauthorized)
+			})
+			Convey("When the gateway disconnects", func() {
+				a.HandleDisconnect(middleware.NewContext(), &types.DisconnectMessage{GatewayID: "dev"})
+				Convey("Its state should be cleaned up", func() {
+					So(a.HandleUplink(middleware.NewContext(), &types.UplinkMessage{GatewayID: "dev"}), ShouldBeNil)
+				})
+			})
+		})
+	})
+
+	Convey("Given a new Authorize without Authorizer", t, func(c C) {
+		a := NewAuthorize(nil)
+		Convey("All gateways should be allowed", func() {
+			So(a.HandleConnect(middleware.NewContext(), &types.ConnectMessage{GatewayID: "dev"}), ShouldBeNil)
+		})
+	})
+}
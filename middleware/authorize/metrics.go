@@ -0,0 +1,19 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package authorize
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var deniedCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "ttn",
+		Subsystem: "bridge",
+		Name:      "unauthorized_messages_total",
+		Help:      "Total number of messages that were dropped because the gateway was not authorized.",
+	}, []string{"message_type"},
+)
+
+func init() {
+	prometheus.MustRegister(deniedCounter)
+}
@@ -0,0 +1,75 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package connlimit
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/TheThingsNetwork/gateway-connector-bridge/middleware"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
+	"github.com/TheThingsNetwork/go-utils/log"
+)
+
+// ErrTooManyConnections is returned when a gateway connects while the maximum number of connections is reached
+var ErrTooManyConnections = errors.New("connlimit: maximum number of connections reached")
+
+// NewConnLimit returns a middleware that rejects connections of new gateways when max gateways are connected. If max
+// is 0, connections are counted but not limited.
+//
+// Gateways that are reconnected by the bridge on startup do not pass through the middleware, and are not counted.
+// The middleware should be the last one that handles connect messages, so that connections rejected by other
+// middleware are not counted.
+func NewConnLimit(max int) *ConnLimit {
+	return &ConnLimit{
+		log:      log.Get(),
+		max:      max,
+		gateways: make(map[string]struct{}),
+	}
+}
+
+// ConnLimit limits the number of connected gateways
+type ConnLimit struct {
+	log log.Interface
+	max int
+
+	mu       sync.Mutex
+	gateways map[string]struct{}
+}
+
+// Connections returns the number of connected gateways
+func (l *ConnLimit) Connections() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.gateways)
+}
+
+// HandleConnect rejects the connection if the maximum number of connections is reached
+func (l *ConnLimit) HandleConnect(ctx middleware.Context, msg *types.ConnectMessage) error {
+	gatewayID := strings.ToLower(msg.GatewayID)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.gateways[gatewayID]; ok {
+		return nil
+	}
+	if l.max > 0 && len(l.gateways) >= l.max {
+		rejectedConnections.Inc()
+		l.log.WithField("GatewayID", gatewayID).WithField("Max", l.max).Warn("Rejected connection: maximum number of connections reached")
+		return ErrTooManyConnections
+	}
+	l.gateways[gatewayID] = struct{}{}
+	connections.Set(float64(len(l.gateways)))
+	return nil
+}
+
+// HandleDisconnect releases the connection of the gateway
+func (l *ConnLimit) HandleDisconnect(ctx middleware.Context, msg *types.DisconnectMessage) error {
+	gatewayID := strings.ToLower(msg.GatewayID)
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.gateways, gatewayID)
+	connections.Set(float64(len(l.gateways)))
+	return nil
+}
@@ -0,0 +1,62 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package connlimit
+
+import (
+	"testing"
+
+	"github.com/TheThingsNetwork/gateway-connector-bridge/middleware"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestConnLimit(t *testing.T) {
+	Convey("Given a new ConnLimit with a maximum of 2 connections", t, func(c C) {
+		l := NewConnLimit(2)
+
+		connect := func(gatewayID string) error {
+			return l.HandleConnect(middleware.NewContext(), &types.ConnectMessage{GatewayID: gatewayID})
+		}
+		disconnect := func(gatewayID string) error {
+			return l.HandleDisconnect(middleware.NewContext(), &types.DisconnectMessage{GatewayID: gatewayID})
+		}
+
+		So(connect("a"), ShouldBeNil)
+		So(connect("b"), ShouldBeNil)
+
+		Convey("When a third gateway connects", func() {
+			err := connect("c")
+			Convey("The connection should be rejected", func() {
+				So(err, ShouldEqual, ErrTooManyConnections)
+				So(l.Connections(), ShouldEqual, 2)
+			})
+		})
+
+		Convey("When a connected gateway connects again", func() {
+			err := connect("A")
+			Convey("The connection should be accepted", func() {
+				So(err, ShouldBeNil)
+				So(l.Connections(), ShouldEqual, 2)
+			})
+		})
+
+		Convey("When a gateway disconnects", func() {
+			So(disconnect("a"), ShouldBeNil)
+			Convey("Another gateway should be able to connect", func() {
+				So(connect("c"), ShouldBeNil)
+				So(l.Connections(), ShouldEqual, 2)
+			})
+		})
+	})
+
+	Convey("Given a new ConnLimit without a maximum", t, func(c C) {
+		l := NewConnLimit(0)
+		for _, gatewayID := range []string{"a", "b", "c"} {
+			So(l.HandleConnect(middleware.NewContext(), &types.ConnectMessage{GatewayID: gatewayID}), ShouldBeNil)
+		}
+		Convey("The connections should be counted", func() {
+			So(l.Connections(), ShouldEqual, 3)
+		})
+	})
+}
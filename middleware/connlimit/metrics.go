@@ -0,0 +1,29 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package connlimit
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var connections = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Namespace: "ttn",
+		Subsystem: "bridge",
+		Name:      "connlimit_connections",
+		Help:      "Number of gateway connections that count towards the connection limit.",
+	},
+)
+
+var rejectedConnections = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Namespace: "ttn",
+		Subsystem: "bridge",
+		Name:      "connlimit_rejected_connections_total",
+		Help:      "Total number of gateway connections that were rejected because the connection limit was reached.",
+	},
+)
+
+func init() {
+	prometheus.MustRegister(connections)
+	prometheus.MustRegister(rejectedConnections)
+}
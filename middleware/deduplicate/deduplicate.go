@@ -7,17 +7,21 @@ import (
 	"bytes"
 	"errors"
 	"sync"
+	"time"
 
 	"github.com/TheThingsNetwork/gateway-connector-bridge/middleware"
 	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
 	"github.com/TheThingsNetwork/go-utils/log"
 )
 
-// NewDeduplicate returns a middleware that deduplicates duplicate uplink messages received from broken gateways
+// NewDeduplicate returns a middleware that deduplicates duplicate uplink messages received from broken gateways,
+// and duplicate downlink messages that are published within the DownlinkWindow
 func NewDeduplicate() *Deduplicate {
 	return &Deduplicate{
-		log:         log.Get(),
-		lastMessage: make(map[string]*types.UplinkMessage),
+		log:            log.Get(),
+		lastMessage:    make(map[string]*types.UplinkMessage),
+		downlinkWindow: DownlinkWindow,
+		lastDownlinks:  make(map[string]map[downlinkKey]time.Time),
 	}
 }
 
@@ -26,6 +30,9 @@ type Deduplicate struct {
 	log         log.Interface
 	mu          sync.RWMutex
 	lastMessage map[string]*types.UplinkMessage
+
+	downlinkWindow time.Duration
+	lastDownlinks  map[string]map[downlinkKey]time.Time
 }
 
 // HandleDisconnect cleans up
@@ -33,6 +40,7 @@ func (d *Deduplicate) HandleDisconnect(ctx middleware.Context, msg *types.Discon
 	d.mu.Lock()
 	defer d.mu.Unlock()
 	delete(d.lastMessage, msg.GatewayID)
+	delete(d.lastDownlinks, msg.GatewayID)
 	return nil
 }
 
@@ -5,7 +5,9 @@ package deduplicate
 
 import (
 	"testing"
+	"time"
 
+	"github.com/TheThingsNetwork/api/gateway"
 	"github.com/TheThingsNetwork/api/router"
 	"github.com/TheThingsNetwork/gateway-connector-bridge/middleware"
 	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
@@ -50,3 +52,42 @@ func TestDeduplicate(t *testing.T) {
 		})
 	})
 }
+
+func TestDeduplicateDownlink(t *testing.T) {
+	Convey("Given a new Deduplicate", t, func(c C) {
+		i := NewDeduplicate().WithDownlinkWindow(50 * time.Millisecond)
+
+		down := func(payload ...byte) *types.DownlinkMessage {
+			return &types.DownlinkMessage{GatewayID: "test", Message: &router.DownlinkMessage{
+				Payload:              payload,
+				GatewayConfiguration: gateway.TxConfiguration{Timestamp: 1000, Frequency: 868100000},
+			}}
+		}
+
+		Convey("When sending a DownlinkMessage", func() {
+			err := i.HandleDownlink(middleware.NewContext(), down(1, 2, 3, 4))
+			Convey("There should be no error", func() {
+				So(err, ShouldBeNil)
+			})
+			Convey("When sending a duplicate of that DownlinkMessage", func() {
+				err := i.HandleDownlink(middleware.NewContext(), down(1, 2, 3, 4))
+				Convey("There should be an error", func() {
+					So(err, ShouldEqual, ErrDuplicateDownlink)
+				})
+			})
+			Convey("When sending a duplicate after the window", func() {
+				time.Sleep(60 * time.Millisecond)
+				err := i.HandleDownlink(middleware.NewContext(), down(1, 2, 3, 4))
+				Convey("There should be no error", func() {
+					So(err, ShouldBeNil)
+				})
+			})
+			Convey("When sending another DownlinkMessage", func() {
+				err := i.HandleDownlink(middleware.NewContext(), down(1, 2, 3, 4, 5))
+				Convey("There should be no error", func() {
+					So(err, ShouldBeNil)
+				})
+			})
+		})
+	})
+}
@@ -0,0 +1,72 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package deduplicate
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"time"
+
+	"github.com/TheThingsNetwork/gateway-connector-bridge/middleware"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
+)
+
+// DownlinkWindow is the default window in which identical downlink messages are considered duplicates
+var DownlinkWindow = 10 * time.Second
+
+// WithDownlinkWindow sets the window in which identical downlink messages are considered duplicates (0 disables
+// downlink deduplication)
+func (d *Deduplicate) WithDownlinkWindow(window time.Duration) *Deduplicate {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.downlinkWindow = window
+	return d
+}
+
+// ErrDuplicateDownlink is returned when a downlink message is published multiple times
+var ErrDuplicateDownlink = errors.New("deduplicate: already handled this downlink")
+
+type downlinkKey [sha1.Size]byte
+
+// getDownlinkKey returns the key that identifies a downlink: its payload and transmission parameters
+func getDownlinkKey(msg *types.DownlinkMessage) downlinkKey {
+	conf := msg.Message.GatewayConfiguration
+	var buf [16]byte
+	binary.BigEndian.PutUint32(buf[0:], conf.Timestamp)
+	binary.BigEndian.PutUint64(buf[4:], conf.Frequency)
+	binary.BigEndian.PutUint32(buf[12:], conf.RfChain)
+	return sha1.Sum(append(buf[:], msg.Message.Payload...))
+}
+
+// HandleDownlink blocks downlink messages that were already published within the downlink window
+func (d *Deduplicate) HandleDownlink(_ middleware.Context, msg *types.DownlinkMessage) error {
+	if msg.Message == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.downlinkWindow == 0 {
+		return nil
+	}
+	now := time.Now()
+	seen, ok := d.lastDownlinks[msg.GatewayID]
+	if !ok {
+		seen = make(map[downlinkKey]time.Time)
+		d.lastDownlinks[msg.GatewayID] = seen
+	}
+	for key, at := range seen {
+		if now.Sub(at) >= d.downlinkWindow {
+			delete(seen, key)
+		}
+	}
+	key := getDownlinkKey(msg)
+	if _, ok := seen[key]; ok {
+		duplicateDownlinks.Inc()
+		d.log.WithField("GatewayID", msg.GatewayID).Debug("Dropping duplicate downlink")
+		return ErrDuplicateDownlink
+	}
+	seen[key] = now
+	return nil
+}
@@ -0,0 +1,19 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package deduplicate
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var duplicateDownlinks = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Namespace: "ttn",
+		Subsystem: "bridge",
+		Name:      "duplicate_downlinks_total",
+		Help:      "Total number of duplicate downlink messages that were dropped.",
+	},
+)
+
+func init() {
+	prometheus.MustRegister(duplicateDownlinks)
+}
@@ -0,0 +1,205 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package dutycycle
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TheThingsNetwork/api/protocol/lorawan"
+	"github.com/TheThingsNetwork/api/router"
+	"github.com/TheThingsNetwork/api/trace"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/middleware"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/middleware/rxwindow"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
+	"github.com/TheThingsNetwork/go-utils/log"
+	"github.com/TheThingsNetwork/ttn/utils/toa"
+)
+
+// ErrDutyCycleExceeded is returned when a downlink would exceed the duty cycle of a gateway
+var ErrDutyCycleExceeded = errors.New("dutycycle: duty cycle exceeded")
+
+// DefaultWindow is the window over which the duty cycle is computed
+var DefaultWindow = time.Hour
+
+// FrequencyPlanFunc returns the frequency plan (such as "EU_863_870") of a gateway
+type FrequencyPlanFunc func(gatewayID string) string
+
+// Band is a sub-band of a frequency plan with a maximum duty cycle
+type Band struct {
+	MinFrequency uint64
+	MaxFrequency uint64
+	DutyCycle    float64
+}
+
+// Bands contains the duty cycle bands of frequency plans, by the names of their regional parameters. Short names of
+// frequency plans are resolved with rxwindow.FrequencyPlanAliases. Frequency plans that are not in this map have no
+// duty cycle limitations.
+var Bands = map[string][]Band{
+	"EU_863_870": {
+		{MinFrequency: 863000000, MaxFrequency: 868000000, DutyCycle: 0.01},
+		{MinFrequency: 868000000, MaxFrequency: 868600000, DutyCycle: 0.01},
+		{MinFrequency: 868700000, MaxFrequency: 869200000, DutyCycle: 0.001},
+		{MinFrequency: 869400000, MaxFrequency: 869650000, DutyCycle: 0.1},
+		{MinFrequency: 869700000, MaxFrequency: 870000000, DutyCycle: 0.01},
+	},
+	"EU_433": {
+		{MinFrequency: 433175000, MaxFrequency: 434665000, DutyCycle: 0.01},
+	},
+}
+
+// NewDutyCycle returns a middleware that drops downlink messages that exceed the duty cycle of the gateway's
+// frequency plan, which is looked up with the given function.
+func NewDutyCycle(frequencyPlan FrequencyPlanFunc) *DutyCycle {
+	return &DutyCycle{
+		log:           log.Get(),
+		frequencyPlan: frequencyPlan,
+		window:        DefaultWindow,
+		gateways:      make(map[string]*usage),
+	}
+}
+
+// DutyCycle limits downlink airtime per gateway
+type DutyCycle struct {
+	log           log.Interface
+	frequencyPlan FrequencyPlanFunc
+	window        time.Duration
+
+	mu       sync.Mutex
+	gateways map[string]*usage
+}
+
+// WithWindow sets the window over which the duty cycle is computed
+func (d *DutyCycle) WithWindow(window time.Duration) *DutyCycle {
+	d.window = window
+	return d
+}
+
+type transmission struct {
+	time    time.Time
+	airtime time.Duration
+}
+
+// usage contains the recent transmissions of a gateway, per band
+type usage struct {
+	bands map[Band][]transmission
+}
+
+// Airtime computes the time-on-air of a downlink message
+func Airtime(msg *router.DownlinkMessage) (time.Duration, error) {
+	lora := msg.ProtocolConfiguration.GetLoRaWAN()
+	if lora == nil {
+		return 0, errors.New("dutycycle: no LoRaWAN configuration in downlink")
+	}
+	payloadSize := uint(len(msg.Payload))
+	switch lora.Modulation {
+	case lorawan.Modulation_LORA:
+		return toa.ComputeLoRa(payloadSize, lora.DataRate, lora.CodingRate)
+	case lorawan.Modulation_FSK:
+		if lora.BitRate == 0 {
+			return 0, errors.New("dutycycle: no bit rate in FSK downlink")
+		}
+		return toa.ComputeFSK(payloadSize, int(lora.BitRate))
+	}
+	return 0, fmt.Errorf("dutycycle: unknown modulation %s", lora.Modulation)
+}
+
+func bandFor(frequencyPlan string, frequency uint64) (band Band, ok bool) {
+	frequencyPlan = strings.ToUpper(frequencyPlan)
+	if alias, ok := rxwindow.FrequencyPlanAliases[frequencyPlan]; ok {
+		frequencyPlan = alias
+	}
+	for _, band := range Bands[frequencyPlan] {
+		if frequency >= band.MinFrequency && frequency < band.MaxFrequency {
+			return band, true
+		}
+	}
+	return
+}
+
+// fits returns whether the transmission fits in the duty cycle of the band, and forgets transmissions that are
+// outside the window
+func (d *DutyCycle) fits(gatewayID string, band Band, airtime time.Duration, now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	gtw, ok := d.gateways[gatewayID]
+	if !ok {
+		return float64(airtime) <= float64(d.window)*band.DutyCycle
+	}
+	var used time.Duration
+	transmissions := gtw.bands[band][:0]
+	for _, t := range gtw.bands[band] {
+		if now.Sub(t.time) < d.window {
+			transmissions = append(transmissions, t)
+			used += t.airtime
+		}
+	}
+	gtw.bands[band] = transmissions
+	return float64(used+airtime) <= float64(d.window)*band.DutyCycle
+}
+
+// charge registers the transmission in the band
+func (d *DutyCycle) charge(gatewayID string, band Band, airtime time.Duration, now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	gtw, ok := d.gateways[gatewayID]
+	if !ok {
+		gtw = &usage{bands: make(map[Band][]transmission)}
+		d.gateways[gatewayID] = gtw
+	}
+	gtw.bands[band] = append(gtw.bands[band], transmission{time: now, airtime: airtime})
+}
+
+// transmission returns the band and the airtime of a downlink message, or false if it has no duty cycle limitations
+func (d *DutyCycle) transmission(msg *types.DownlinkMessage) (Band, time.Duration, bool) {
+	if msg.Message == nil {
+		return Band{}, 0, false
+	}
+	band, ok := bandFor(d.frequencyPlan(msg.GatewayID), msg.Message.GatewayConfiguration.Frequency)
+	if !ok {
+		return Band{}, 0, false
+	}
+	airtime, err := Airtime(msg.Message)
+	if err != nil {
+		d.log.WithField("GatewayID", msg.GatewayID).WithError(err).Debug("Could not compute airtime of downlink")
+		return Band{}, 0, false
+	}
+	return band, airtime, true
+}
+
+// HandleDisconnect cleans up
+func (d *DutyCycle) HandleDisconnect(ctx middleware.Context, msg *types.DisconnectMessage) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.gateways, msg.GatewayID)
+	return nil
+}
+
+// HandleDownlink drops downlink messages that would exceed the duty cycle. The airtime is only used when the
+// downlink is sent (see HandleDownlinkSent).
+func (d *DutyCycle) HandleDownlink(ctx middleware.Context, msg *types.DownlinkMessage) error {
+	band, airtime, ok := d.transmission(msg)
+	if !ok {
+		return nil
+	}
+	if !d.fits(msg.GatewayID, band, airtime, time.Now()) {
+		droppedCounter.Inc()
+		if types.Tracing(types.TraceBasic) {
+			msg.Message.Trace = msg.Message.Trace.WithEvent(trace.DropEvent, "reason", "duty cycle exceeded")
+		}
+		d.log.WithField("GatewayID", msg.GatewayID).WithField("Airtime", airtime).Warn("Dropping downlink: duty cycle exceeded")
+		return ErrDutyCycleExceeded
+	}
+	return nil
+}
+
+// HandleDownlinkSent uses the airtime of a downlink message that was sent
+func (d *DutyCycle) HandleDownlinkSent(ctx middleware.Context, msg *types.DownlinkMessage) {
+	if band, airtime, ok := d.transmission(msg); ok {
+		d.charge(msg.GatewayID, band, airtime, time.Now())
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package dutycycle
+
+import (
+	"testing"
+	"time"
+
+	"github.com/TheThingsNetwork/api/gateway"
+	"github.com/TheThingsNetwork/api/protocol"
+	"github.com/TheThingsNetwork/api/protocol/lorawan"
+	"github.com/TheThingsNetwork/api/router"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/middleware"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func downlink(gatewayID string, frequency uint64, dataRate string) *types.DownlinkMessage {
+	return &types.DownlinkMessage{
+		GatewayID: gatewayID,
+		Message: &router.DownlinkMessage{
+			Payload: make([]byte, 20),
+			ProtocolConfiguration: protocol.TxConfiguration{Protocol: &protocol.TxConfiguration_LoRaWAN{LoRaWAN: &lorawan.TxConfiguration{
+				Modulation: lorawan.Modulation_LORA,
+				DataRate:   dataRate,
+				CodingRate: "4/5",
+			}}},
+			GatewayConfiguration: gateway.TxConfiguration{Frequency: frequency},
+		},
+	}
+}
+
+func TestDutyCycle(t *testing.T) {
+	Convey("Given a new DutyCycle", t, func(c C) {
+		d := NewDutyCycle(func(gatewayID string) string {
+			if gatewayID == "us-gateway" {
+				return "US_915"
+			}
+			return "EU_863_870"
+		}).WithWindow(10 * time.Second)
+
+		send := func(msg *types.DownlinkMessage) error {
+			if err := d.HandleDownlink(middleware.NewContext(), msg); err != nil {
+				return err
+			}
+			d.HandleDownlinkSent(middleware.NewContext(), msg)
+			return nil
+		}
+
+		Convey("When computing the airtime of a downlink", func() {
+			airtime, err := Airtime(downlink("dev", 869525000, "SF9BW125").Message)
+			Convey("There should be no error", func() {
+				So(err, ShouldBeNil)
+			})
+			Convey("The airtime should be correct", func() {
+				So(airtime, ShouldEqual, 185344*time.Microsecond)
+			})
+		})
+
+		Convey("When sending downlinks in the 10% band", func() {
+			var errs []error
+			for i := 0; i < 6; i++ {
+				errs = append(errs, send(downlink("dev", 869525000, "SF9BW125")))
+			}
+			Convey("The downlinks within the budget should be allowed", func() {
+				So(errs[:5], ShouldResemble, []error{nil, nil, nil, nil, nil})
+			})
+			Convey("The downlink exceeding the budget should be dropped", func() {
+				So(errs[5], ShouldEqual, ErrDutyCycleExceeded)
+			})
+			Convey("Downlinks in other bands should still be allowed", func() {
+				So(d.HandleDownlink(middleware.NewContext(), downlink("dev", 868100000, "SF7BW125")), ShouldBeNil)
+			})
+			Convey("Downlinks of other gateways should still be allowed", func() {
+				So(d.HandleDownlink(middleware.NewContext(), downlink("other", 869525000, "SF9BW125")), ShouldBeNil)
+			})
+		})
+
+		Convey("When downlinks in the 10% band are not sent", func() {
+			var err error
+			for i := 0; i < 10; i++ {
+				if err = d.HandleDownlink(middleware.NewContext(), downlink("dev", 869525000, "SF9BW125")); err != nil {
+					break
+				}
+			}
+			Convey("They should not use the budget", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+
+		Convey("When the gateway has a short frequency plan name", func() {
+			d := NewDutyCycle(func(string) string { return "eu_868" }).WithWindow(10 * time.Second)
+			var err error
+			for i := 0; i < 6 && err == nil; i++ {
+				msg := downlink("dev", 869525000, "SF9BW125")
+				if err = d.HandleDownlink(middleware.NewContext(), msg); err == nil {
+					d.HandleDownlinkSent(middleware.NewContext(), msg)
+				}
+			}
+			Convey("The bands of the frequency plan should be used", func() {
+				So(err, ShouldEqual, ErrDutyCycleExceeded)
+			})
+		})
+
+		Convey("When sending downlinks for a gateway without duty cycle limitations", func() {
+			var err error
+			for i := 0; i < 10; i++ {
+				if err = d.HandleDownlink(middleware.NewContext(), downlink("us-gateway", 923300000, "SF12BW500")); err != nil {
+					break
+				}
+			}
+			Convey("There should be no error", func() {
+				So(err, ShouldBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,19 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package dutycycle
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var droppedCounter = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Namespace: "ttn",
+		Subsystem: "bridge",
+		Name:      "downlinks_duty_cycle_dropped_total",
+		Help:      "Total number of downlink messages that were dropped because they would exceed the duty cycle.",
+	},
+)
+
+func init() {
+	prometheus.MustRegister(droppedCounter)
+}
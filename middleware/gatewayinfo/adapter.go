@@ -0,0 +1,102 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package gatewayinfo
+
+import (
+	"strings"
+
+	"github.com/TheThingsNetwork/api/gateway"
+	"github.com/TheThingsNetwork/go-account-lib/account"
+)
+
+// The accessors in this file are the only place where the nested (pointer) fields of account.Gateway are read when
+// injecting gateway information, so that the rest of the middleware does not depend on the shape of account.Gateway
+// and a change of the account library only needs changes here. They return zero values for missing fields.
+
+// stringValue returns the value of s, or an empty string if s is nil
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func brand(info account.Gateway) string {
+	return stringValue(info.Attributes.Brand)
+}
+
+func model(info account.Gateway) string {
+	return stringValue(info.Attributes.Model)
+}
+
+// platform returns the brand and model of the gateway, separated by a space
+func platform(info account.Gateway) string {
+	platform := []string{}
+	if brand := brand(info); brand != "" {
+		platform = append(platform, brand)
+	}
+	if model := model(info); model != "" {
+		platform = append(platform, model)
+	}
+	return strings.Join(platform, " ")
+}
+
+func description(info account.Gateway) string {
+	return stringValue(info.Attributes.Description)
+}
+
+func antennaType(info account.Gateway) string {
+	return stringValue(info.Attributes.AntennaType)
+}
+
+func antennaModel(info account.Gateway) string {
+	return stringValue(info.Attributes.AntennaModel)
+}
+
+func placement(info account.Gateway) string {
+	if info.Attributes.Placement == nil {
+		return ""
+	}
+	return string(*info.Attributes.Placement)
+}
+
+// AccountAttributes are the keys of the gateway attributes of the account server that can be mapped to status
+// attributes (see WithAttributeMapping). The account library only decodes these attributes.
+var AccountAttributes = []string{"brand", "model", "placement", "antenna_type", "antenna_model", "description"}
+
+// accountAttribute returns the value of the gateway attribute with the given key, and false if the key is unknown
+func accountAttribute(info account.Gateway, key string) (string, bool) {
+	switch key {
+	case "brand":
+		return brand(info), true
+	case "model":
+		return model(info), true
+	case "placement":
+		return placement(info), true
+	case "antenna_type":
+		return antennaType(info), true
+	case "antenna_model":
+		return antennaModel(info), true
+	case "description":
+		return description(info), true
+	}
+	return "", false
+}
+
+func hasAntennaLocation(info account.Gateway) bool {
+	return info.AntennaLocation != nil
+}
+
+// cachedLocation returns the antenna location of the gateway as location metadata, or nil if it is not known
+func cachedLocation(info account.Gateway) *gateway.LocationMetadata {
+	if !hasAntennaLocation(info) {
+		return nil
+	}
+	return &gateway.LocationMetadata{
+		Latitude:  float32(info.AntennaLocation.Latitude),
+		Longitude: float32(info.AntennaLocation.Longitude),
+		Altitude:  int32(info.AntennaLocation.Altitude),
+		Source:    gateway.LocationMetadata_REGISTRY,
+	}
+}
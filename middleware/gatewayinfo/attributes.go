@@ -0,0 +1,119 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package gatewayinfo
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
+	"github.com/TheThingsNetwork/go-account-lib/account"
+)
+
+// Status attributes that are injected from the account server
+const (
+	AutoUpdateAttribute       = "auto_update"
+	TimezoneAttribute         = "timezone"
+	ExpectedFirmwareAttribute = "expected_firmware"
+)
+
+// WithInjectFlags enables or disables the injection of gateway flags (such as auto_update) into status attributes
+func (p *Public) WithInjectFlags(enabled bool) *Public {
+	p.injectFlags = enabled
+	return p
+}
+
+// WithInjectTimezone enables or disables the injection of the time zone from the overrides into status attributes
+func (p *Public) WithInjectTimezone(enabled bool) *Public {
+	p.injectTimezone = enabled
+	return p
+}
+
+// WithInjectExpectedFirmware enables or disables the injection of the firmware from the overrides into status
+// attributes, so that it can be compared with the version that the gateway reports
+func (p *Public) WithInjectExpectedFirmware(enabled bool) *Public {
+	p.injectExpectedFirmware = enabled
+	return p
+}
+
+// ErrUnknownAccountAttribute is returned when an attribute mapping refers to an attribute that the account server
+// does not provide
+var ErrUnknownAccountAttribute = errors.New("gatewayinfo: unknown account attribute")
+
+// WithAttributeMapping injects gateway attributes of the account server into the attributes of status messages. The
+// mapping is from the key of the gateway attribute (see AccountAttributes) to the key of the status attribute, such
+// as "placement" to "site_placement". Attributes that are empty on the account server are not injected, and
+// attributes that are already present in the status message are not overwritten. It returns
+// ErrUnknownAccountAttribute for keys that are not in AccountAttributes, as the fetchers decode the gateway
+// information into account.Gateway, which has no other attributes.
+func (p *Public) WithAttributeMapping(mapping map[string]string) (*Public, error) {
+	keys := make([]string, 0, len(mapping))
+	for key := range mapping {
+		if _, ok := accountAttribute(account.Gateway{}, key); !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownAccountAttribute, key)
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	p.attributeMapping = mapping
+	p.attributeKeys = keys
+	return p, nil
+}
+
+// injectMappedAttributes injects the mapped gateway attributes of the account server into the status message
+func (p *Public) injectMappedAttributes(msg *types.StatusMessage, info account.Gateway) {
+	for _, key := range p.attributeKeys {
+		value, _ := accountAttribute(info, key)
+		if value == "" {
+			continue
+		}
+		target := p.attributeMapping[key]
+		if setAttribute(msg, target, value) {
+			p.log.WithField("GatewayID", msg.GatewayID).WithField("Attribute", target).WithField("AccountAttribute", key).
+				Debug("Injected mapped status attribute")
+		}
+	}
+}
+
+// setAttribute sets the attribute of the status message if it is not already present, and returns whether it did
+func setAttribute(msg *types.StatusMessage, key, value string) bool {
+	if _, ok := msg.Attributes[key]; ok {
+		return false
+	}
+	if msg.Attributes == nil {
+		msg.Attributes = make(map[string]string)
+	}
+	msg.Attributes[key] = value
+	return true
+}
+
+func (p *Public) injectAttributes(msg *types.StatusMessage, info account.Gateway) {
+	log := p.log.WithField("GatewayID", msg.GatewayID)
+	if p.injectTimezone {
+		if override, ok := p.override(msg.GatewayID); ok && override.Timezone != "" {
+			if setAttribute(msg, TimezoneAttribute, override.Timezone) {
+				log.WithField("Attribute", TimezoneAttribute).WithField("Timezone", override.Timezone).Debug("Injected status attribute")
+			}
+		}
+	}
+	if p.injectExpectedFirmware {
+		if override, ok := p.override(msg.GatewayID); ok && override.Firmware != "" {
+			if setAttribute(msg, ExpectedFirmwareAttribute, override.Firmware) {
+				log.WithField("Attribute", ExpectedFirmwareAttribute).WithField("Firmware", override.Firmware).Debug("Injected status attribute")
+			}
+		}
+	}
+	p.injectRegionalParameters(msg)
+	if info.ID == "" {
+		return
+	}
+	if p.injectFlags {
+		if setAttribute(msg, AutoUpdateAttribute, strconv.FormatBool(info.AutoUpdate)) {
+			log.WithField("Attribute", AutoUpdateAttribute).Debug("Injected status attribute")
+		}
+	}
+	p.injectMappedAttributes(msg, info)
+}
@@ -0,0 +1,50 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package gatewayinfo
+
+import (
+	"time"
+
+	"github.com/TheThingsNetwork/go-utils/backoff"
+)
+
+// WithErrorBackoff makes the gateway information middleware back off exponentially when fetching the information
+// of a gateway keeps failing, instead of retrying after every expire. The first retry is after config.BaseDelay,
+// and the delay grows with config.Factor up to config.MaxDelay. The backoff of a gateway is reset when a fetch
+// succeeds. If config.BaseDelay is 0, failed fetches are retried according to the expire.
+func (p *Public) WithErrorBackoff(config backoff.Config) *Public {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if config.Factor < 1 {
+		config.Factor = backoff.DefaultConfig.Factor
+	}
+	if config.MaxDelay < config.BaseDelay {
+		config.MaxDelay = config.BaseDelay
+	}
+	p.errorBackoff = config
+	return p
+}
+
+// retryDelay returns the delay before retrying after the given number of consecutive failures, or 0 if there is no
+// error backoff. The caller must hold p.mu.
+func (p *Public) retryDelay(failures int) time.Duration {
+	if p.errorBackoff.BaseDelay == 0 || failures == 0 {
+		return 0
+	}
+	return p.errorBackoff.Backoff(failures - 1)
+}
+
+// retryDue returns whether the information is an error entry that is subject to the error backoff, and if so,
+// whether its fetch may be retried. If it may, the next retry is moved forward so that the fetch is not started
+// again while it is in progress. The caller must hold the lock of its shard.
+func (p *Public) retryDue(info *info) (due, backoff bool) {
+	if info.err == nil || p.errorBackoff.BaseDelay == 0 {
+		return false, false
+	}
+	if time.Now().Before(info.nextRetry) {
+		return false, true
+	}
+	info.nextRetry = time.Now().Add(p.retryDelay(info.failures))
+	return true, true
+}
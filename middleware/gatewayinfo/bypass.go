@@ -0,0 +1,40 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package gatewayinfo
+
+import "strings"
+
+const bypassEvent = "bypass inject"
+
+// WithBypass skips fetching and injecting gateway information for trusted gateways that report correct metadata
+// themselves. Gateway IDs that end with "*" match all gateways with that prefix.
+func (p *Public) WithBypass(gatewayIDs []string) *Public {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.bypass = make(map[string]struct{})
+	p.bypassPrefixes = nil
+	for _, gatewayID := range gatewayIDs {
+		if strings.HasSuffix(gatewayID, "*") {
+			p.bypassPrefixes = append(p.bypassPrefixes, strings.TrimSuffix(gatewayID, "*"))
+		} else {
+			p.bypass[gatewayID] = struct{}{}
+		}
+	}
+	return p
+}
+
+// bypassed returns whether the gateway is configured to bypass gateway information
+func (p *Public) bypassed(gatewayID string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.bypass[gatewayID]; ok {
+		return true
+	}
+	for _, prefix := range p.bypassPrefixes {
+		if strings.HasPrefix(gatewayID, prefix) {
+			return true
+		}
+	}
+	return false
+}
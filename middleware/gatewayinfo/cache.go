@@ -0,0 +1,84 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package gatewayinfo
+
+import "sync"
+
+// DefaultCacheShards is the default number of shards of the gateway information cache
+var DefaultCacheShards = 16
+
+// shard is a part of the gateway information cache. Its lock guards the maps and the entries in them, except for the
+// errElement of entries, which is guarded by p.mu. When both locks are needed, the shard lock must be taken first.
+type shard struct {
+	mu      sync.Mutex
+	info    map[string]*info
+	pending map[string]*pendingFetch // gateways without entry of which the first fetch is in progress
+}
+
+func newShards(n int) []*shard {
+	if n < 1 {
+		n = 1
+	}
+	shards := make([]*shard, n)
+	for i := range shards {
+		shards[i] = &shard{info: make(map[string]*info), pending: make(map[string]*pendingFetch)}
+	}
+	return shards
+}
+
+// WithCacheShards splits the gateway information cache into n shards (by hash of the gateway ID) that each have
+// their own lock, which reduces lock contention when many gateways send messages concurrently. It must be called
+// before the middleware is used.
+func (p *Public) WithCacheShards(n int) *Public {
+	shards := newShards(n)
+	for _, old := range p.shards {
+		old.mu.Lock()
+		for gatewayID, info := range old.info {
+			shards[shardIndex(gatewayID, len(shards))].info[gatewayID] = info
+		}
+		for gatewayID, fetch := range old.pending {
+			shards[shardIndex(gatewayID, len(shards))].pending[gatewayID] = fetch
+		}
+		old.mu.Unlock()
+	}
+	p.shards = shards
+	return p
+}
+
+// shardIndex returns the shard of a gateway with FNV-1a, which is inlined to not allocate in the hot path
+func shardIndex(gatewayID string, n int) int {
+	hash := uint32(2166136261)
+	for i := 0; i < len(gatewayID); i++ {
+		hash ^= uint32(gatewayID[i])
+		hash *= 16777619
+	}
+	return int(hash % uint32(n))
+}
+
+// shard returns the shard of the cache key of a gateway
+func (p *Public) shard(gatewayID string) *shard {
+	return p.shards[shardIndex(gatewayID, len(p.shards))]
+}
+
+// entry returns the cached information of a gateway, or nil if it is not cached. The returned entry is guarded by
+// the lock of its shard.
+func (p *Public) entry(gatewayID string) *info {
+	s := p.shard(gatewayID)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.info[gatewayID]
+}
+
+// entries returns a copy of the cache that maps the cache keys to the entries
+func (p *Public) entries() map[string]*info {
+	entries := make(map[string]*info)
+	for _, s := range p.shards {
+		s.mu.Lock()
+		for gatewayID, info := range s.info {
+			entries[gatewayID] = info
+		}
+		s.mu.Unlock()
+	}
+	return entries
+}
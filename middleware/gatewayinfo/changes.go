@@ -0,0 +1,112 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package gatewayinfo
+
+import (
+	"time"
+
+	"github.com/TheThingsNetwork/api/gateway"
+	"github.com/TheThingsNetwork/go-account-lib/account"
+)
+
+// FieldChange is the value of a field before and after a refresh. The values are of the same types as those passed
+// to a FieldInjector, and nil if the field was not set.
+type FieldChange struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+// Change is a change of the gateway information of a gateway
+type Change struct {
+	GatewayID string                `json:"gateway_id"` // cache key of the gateway
+	Time      time.Time             `json:"time"`
+	Fields    map[Field]FieldChange `json:"fields"`
+}
+
+// ChangeHandler handles changes of gateway information. Handlers are called in the goroutine that fetched the
+// gateway information, so they should not block.
+type ChangeHandler func(Change)
+
+// WithChangeHandler sets a handler that is called when refreshed gateway information differs from the cached
+// information in the fields that are injected. It is not called when a gateway is fetched for the first time.
+func (p *Public) WithChangeHandler(handler ChangeHandler) *Public {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.changeHandler = handler
+	return p
+}
+
+// ChangeChannel returns a channel that receives changes, and a ChangeHandler to pass to WithChangeHandler. Changes
+// are dropped if the buffer of the channel is full.
+func ChangeChannel(buffer int) (<-chan Change, ChangeHandler) {
+	ch := make(chan Change, buffer)
+	return ch, func(change Change) {
+		select {
+		case ch <- change:
+		default:
+			droppedChanges.Inc()
+		}
+	}
+}
+
+// fieldValue returns the value of a field in the gateway information, or nil if it is not set
+func fieldValue(info account.Gateway, field Field) interface{} {
+	var value string
+	switch field {
+	case FieldLocation:
+		if location := cachedLocation(info); location != nil {
+			return location
+		}
+		return nil
+	case FieldFrequencyPlan:
+		value = info.FrequencyPlan
+	case FieldPlatform:
+		value = platform(info)
+	case FieldDescription:
+		value = description(info)
+	}
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+func sameValue(a, b interface{}) bool {
+	if a, ok := a.(*gateway.LocationMetadata); ok {
+		b, ok := b.(*gateway.LocationMetadata)
+		return ok && *a == *b
+	}
+	return a == b
+}
+
+// diffGateway returns the fields that differ between the previous and the next gateway information
+func diffGateway(prev, next account.Gateway) map[Field]FieldChange {
+	var changes map[Field]FieldChange
+	for _, field := range []Field{FieldLocation, FieldFrequencyPlan, FieldPlatform, FieldDescription} {
+		before, after := fieldValue(prev, field), fieldValue(next, field)
+		if sameValue(before, after) {
+			continue
+		}
+		if changes == nil {
+			changes = make(map[Field]FieldChange)
+		}
+		changes[field] = FieldChange{Old: before, New: after}
+		changedFields.WithLabelValues(string(field)).Inc()
+	}
+	return changes
+}
+
+// notifyChange calls the change handler if the gateway information changed
+func (p *Public) notifyChange(gatewayID string, prev, next account.Gateway) {
+	p.mu.Lock()
+	handler := p.changeHandler
+	p.mu.Unlock()
+	if handler == nil {
+		return
+	}
+	if fields := diffGateway(prev, next); len(fields) > 0 {
+		p.log.WithField("GatewayID", gatewayID).WithField("Fields", len(fields)).Debug("Gateway information changed")
+		handler(Change{GatewayID: gatewayID, Time: time.Now(), Fields: fields})
+	}
+}
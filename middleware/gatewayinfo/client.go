@@ -0,0 +1,250 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package gatewayinfo
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TheThingsNetwork/go-account-lib/account"
+	"github.com/TheThingsNetwork/go-account-lib/util"
+)
+
+// Fetcher fetches public gateway information from the account server
+type Fetcher interface {
+	FindGateway(gatewayID string) (account.Gateway, error)
+}
+
+// ErrInvalidAccountServer is returned when the account server URL is invalid
+var ErrInvalidAccountServer = errors.New("gatewayinfo: invalid account server URL")
+
+// parseAccountServer validates the account server URL and returns it without trailing slash
+func parseAccountServer(accountServer string) (string, error) {
+	u, err := url.Parse(accountServer)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidAccountServer, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("%w: scheme should be http or https, not %q", ErrInvalidAccountServer, u.Scheme)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("%w: missing host", ErrInvalidAccountServer)
+	}
+	return strings.TrimSuffix(accountServer, "/"), nil
+}
+
+// ErrInvalidProxy is returned when the URL of the proxy for the account server is invalid
+var ErrInvalidProxy = errors.New("gatewayinfo: invalid proxy URL")
+
+// Defaults of the HTTP client for the account server
+var (
+	DefaultHTTPTimeout         = 10 * time.Second
+	DefaultMaxIdleConnsPerHost = 16
+	DefaultIdleConnTimeout     = 90 * time.Second
+)
+
+// HTTPClientConfig is the configuration of the HTTP client for the account server. Zero values are replaced by the
+// defaults.
+type HTTPClientConfig struct {
+	Proxy               string        // URL of the proxy, the proxy from the environment (HTTPS_PROXY) is used if empty
+	Timeout             time.Duration // Timeout of a request, including reading the response
+	MaxIdleConnsPerHost int           // Number of idle connections that are kept open to the account server
+	IdleConnTimeout     time.Duration // How long idle connections are kept open
+}
+
+func defaultTransport() *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   5 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   DefaultMaxIdleConnsPerHost,
+		IdleConnTimeout:       DefaultIdleConnTimeout,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+}
+
+func defaultHTTPClient() *http.Client {
+	return &http.Client{Transport: defaultTransport(), Timeout: DefaultHTTPTimeout}
+}
+
+// NewHTTPClient returns an HTTP client for the account server with a pooled transport. It returns ErrInvalidProxy
+// if the proxy is not a valid URL.
+func NewHTTPClient(config HTTPClientConfig) (*http.Client, error) {
+	client := defaultHTTPClient()
+	transport := client.Transport.(*http.Transport)
+	if config.Proxy != "" {
+		proxy, err := url.Parse(config.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidProxy, err)
+		}
+		if proxy.Host == "" {
+			return nil, fmt.Errorf("%w: missing host", ErrInvalidProxy)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	if config.Timeout > 0 {
+		client.Timeout = config.Timeout
+	}
+	if config.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = config.MaxIdleConnsPerHost
+		if transport.MaxIdleConns < config.MaxIdleConnsPerHost {
+			transport.MaxIdleConns = config.MaxIdleConnsPerHost
+		}
+	}
+	if config.IdleConnTimeout > 0 {
+		transport.IdleConnTimeout = config.IdleConnTimeout
+	}
+	return client, nil
+}
+
+// WithHTTPClient makes the gateway information middleware use the given HTTP client (for example from
+// NewHTTPClient) for requests to the account server and its read endpoint. By default, a client with a pooled
+// transport, the proxy from the environment and a timeout of DefaultHTTPTimeout is used.
+func (p *Public) WithHTTPClient(client *http.Client) *Public {
+	p.setAccountFetcher(&httpFetcher{
+		server: p.accountServer(),
+		client: client,
+		token:  &p.token,
+	})
+	return p
+}
+
+// httpClient returns the HTTP client for requests to the account server
+func (p *Public) httpClient() *http.Client {
+	if fetcher, ok := p.accountFetcher().(*httpFetcher); ok {
+		return fetcher.client
+	}
+	return defaultHTTPClient()
+}
+
+// WithTLSConfig makes the gateway information middleware use the given TLS configuration (for example with custom
+// root CAs or a client certificate) for requests to the account server. The other settings of the HTTP client (see
+// WithHTTPClient) are kept, unless it does not use an *http.Transport.
+func (p *Public) WithTLSConfig(config *tls.Config) *Public {
+	client := *p.httpClient()
+	transport, ok := client.Transport.(*http.Transport)
+	if ok {
+		transport = transport.Clone()
+	} else {
+		transport = defaultTransport()
+	}
+	transport.TLSClientConfig = config
+	client.Transport = transport
+	return p.WithHTTPClient(&client)
+}
+
+// LoadTLSConfig loads a TLS configuration with the root CAs from caFile (if not empty) and the client certificate
+// from certFile and keyFile (if not empty).
+func LoadTLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	config := new(tls.Config)
+	if caFile != "" {
+		roots, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(roots) {
+			return nil, fmt.Errorf("gatewayinfo: no certificates in %s", caFile)
+		}
+	}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// ttlFetcher is implemented by fetchers that also return how long the fetched information is valid. A TTL of 0
+// means that the configured expire is used, and the TTL uncached that the information must not be cached.
+type ttlFetcher interface {
+	FindGatewayTTL(gatewayID string) (account.Gateway, time.Duration, error)
+}
+
+// uncached is the TTL of gateway information that the account server does not allow to be cached. It expires
+// immediately, so that it is only served until it is fetched again, and it is not stored in Redis.
+const uncached time.Duration = -1
+
+// maxAge returns the max-age of a Cache-Control header, or 0 if it is not set. If caching is not allowed (no-cache,
+// no-store or max-age=0), noCache is true.
+func maxAge(cacheControl string) (age time.Duration, noCache bool) {
+	for _, directive := range strings.Split(cacheControl, ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		switch {
+		case directive == "no-cache" || directive == "no-store":
+			return 0, true
+		case strings.HasPrefix(directive, "max-age="):
+			seconds, err := strconv.Atoi(strings.TrimPrefix(directive, "max-age="))
+			if err != nil {
+				continue
+			}
+			if seconds <= 0 {
+				return 0, true
+			}
+			age = time.Duration(seconds) * time.Second
+		}
+	}
+	return age, false
+}
+
+// httpFetcher fetches gateway information with its own HTTP client, so that it can use custom TLS configuration
+// and read the Cache-Control headers of the account server, which the account library does not expose
+type httpFetcher struct {
+	server string
+	client *http.Client
+	token  *tokenSource // bearer token; no token is sent if nil or empty
+}
+
+func (f *httpFetcher) FindGateway(gatewayID string) (gateway account.Gateway, err error) {
+	gateway, _, err = f.FindGatewayTTL(gatewayID)
+	return gateway, err
+}
+
+func (f *httpFetcher) FindGatewayTTL(gatewayID string) (gateway account.Gateway, ttl time.Duration, err error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/api/v2/gateways/%s", f.server, url.PathEscape(gatewayID)), nil)
+	if err != nil {
+		return gateway, 0, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if token := f.token.get(); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	res, err := f.client.Do(req)
+	if err != nil {
+		return gateway, 0, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 400 {
+		var herr util.HTTPError
+		if err := json.NewDecoder(res.Body).Decode(&herr); err != nil || herr.Code == 0 {
+			herr.Code = res.StatusCode
+		}
+		if herr.Message == "" {
+			herr.Message = http.StatusText(res.StatusCode)
+		}
+		return gateway, 0, herr
+	}
+	err = json.NewDecoder(res.Body).Decode(&gateway)
+	ttl, noCache := maxAge(res.Header.Get("Cache-Control"))
+	if noCache {
+		ttl = uncached
+	}
+	return gateway, ttl, err
+}
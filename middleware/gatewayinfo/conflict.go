@@ -0,0 +1,69 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package gatewayinfo
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/TheThingsNetwork/api/gateway"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
+)
+
+const conflictEvent = "inject conflict"
+
+// ConflictLocationTolerance is the difference in degrees of latitude or longitude up to which the location in a
+// message and the location from the account server are not reported as conflict, as GPS locations of gateways are
+// never exactly the registered location
+var ConflictLocationTolerance = 0.001
+
+// WithConflictReporting enables or disables the reporting of conflicts between the values of fields in messages
+// and the values from the account server. Conflicts are counted, logged, and traced in uplink messages. The values
+// in the messages are not overridden.
+func (p *Public) WithConflictReporting(enabled bool) *Public {
+	p.reportConflicts = enabled
+	return p
+}
+
+// conflicting returns whether the value of a field in a message and the cached value are both set and differ
+func conflicting(current, cached interface{}) bool {
+	if isEmpty(current) || isEmpty(cached) {
+		return false
+	}
+	if current, ok := current.(*gateway.LocationMetadata); ok {
+		cached, _ := cached.(*gateway.LocationMetadata)
+		return math.Abs(float64(current.Latitude-cached.Latitude)) > ConflictLocationTolerance ||
+			math.Abs(float64(current.Longitude-cached.Longitude)) > ConflictLocationTolerance
+	}
+	return current != cached
+}
+
+func formatValue(value interface{}) string {
+	if location, ok := value.(*gateway.LocationMetadata); ok {
+		return fmt.Sprintf("%.5f,%.5f", location.Latitude, location.Longitude)
+	}
+	return fmt.Sprint(value)
+}
+
+// observeConflict reports a conflict between the value of a field in a message and the cached value, and returns
+// whether there was one
+func (p *Public) observeConflict(gatewayID string, field Field, current, cached interface{}) bool {
+	if !p.reportConflicts || !conflicting(current, cached) {
+		return false
+	}
+	conflicts.WithLabelValues(string(field)).Inc()
+	p.log.WithField("GatewayID", gatewayID).WithField("Field", field).
+		WithField("Message", formatValue(current)).WithField("Cached", formatValue(cached)).
+		Debug("Value in message conflicts with public Gateway information")
+	return true
+}
+
+// traceConflict reports a conflict between the location in an uplink message and the cached location
+func (p *Public) traceConflict(msg *types.UplinkMessage, current, cached *gateway.LocationMetadata) {
+	if !p.observeConflict(msg.GatewayID, FieldLocation, current, cached) || !types.Tracing(types.TraceVerbose) {
+		return
+	}
+	msg.Message.Trace = msg.Message.Trace.WithEvent(conflictEvent,
+		"field", string(FieldLocation), "message", formatValue(current), "cached", formatValue(cached))
+}
@@ -0,0 +1,78 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package gatewayinfo
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
+	"github.com/TheThingsNetwork/go-account-lib/account"
+)
+
+const responseEvent = "account response"
+
+// WithResponseTracing enables tracing the response of the account server for the given gateways, to debug the
+// injection of their gateway information. After each successful fetch of one of these gateways, a summary of the
+// response (before it is merged with the cached information) is added to the trace of its next uplink message. The
+// summary is only added if tracing is enabled. Passing no gateways disables it.
+func (p *Public) WithResponseTracing(gatewayIDs []string) *Public {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.traceResponses = make(map[string]struct{}, len(gatewayIDs))
+	for _, gatewayID := range gatewayIDs {
+		p.traceResponses[gatewayID] = struct{}{}
+	}
+	p.responses = nil
+	return p
+}
+
+// responseSummary returns the fields of the trace event of a response of the account server
+func responseSummary(info account.Gateway, ttl time.Duration) []interface{} {
+	summary := []interface{}{
+		"id", info.ID,
+		"frequency_plan", info.FrequencyPlan,
+		"platform", platform(info),
+		"description", description(info),
+		"antenna_type", antennaType(info),
+		"antenna_model", antennaModel(info),
+	}
+	if location := cachedLocation(info); location != nil {
+		summary = append(summary, "location", formatValue(location), "altitude", strconv.Itoa(int(location.Altitude)))
+	}
+	if ttl > 0 {
+		summary = append(summary, "ttl", ttl.String())
+	}
+	return summary
+}
+
+// recordResponse remembers the summary of a response of the account server if responses of the gateway are traced
+func (p *Public) recordResponse(gatewayID string, info account.Gateway, ttl time.Duration) {
+	_, id := splitKey(gatewayID)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.traceResponses[id]; !ok {
+		return
+	}
+	if p.responses == nil {
+		p.responses = make(map[string][]interface{})
+	}
+	p.responses[gatewayID] = responseSummary(info, ttl)
+}
+
+// traceResponse adds the summary of the last response of the account server for the gateway to the trace of the
+// uplink message, if there is one that was not traced yet
+func (p *Public) traceResponse(msg *types.UplinkMessage) {
+	if !types.Tracing(types.TraceBasic) {
+		return
+	}
+	gatewayID := p.key(p.resolve(msg.GatewayID))
+	p.mu.Lock()
+	summary, ok := p.responses[gatewayID]
+	delete(p.responses, gatewayID)
+	p.mu.Unlock()
+	if ok {
+		msg.Message.Trace = msg.Message.Trace.WithEvent(responseEvent, summary...)
+	}
+}
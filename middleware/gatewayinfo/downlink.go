@@ -0,0 +1,75 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package gatewayinfo
+
+import (
+	"github.com/TheThingsNetwork/api/gateway"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/middleware"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
+)
+
+// DownlinkInfo is the gateway information that is made available to the middleware of downlink messages, which
+// have no fields for it
+type DownlinkInfo struct {
+	FrequencyPlan string
+	Location      *gateway.LocationMetadata
+	AntennaType   string
+	AntennaModel  string
+}
+
+type downlinkInfoKey struct{}
+
+// DownlinkInfoKey is the key of the DownlinkInfo in the middleware context of downlink messages
+var DownlinkInfoKey = downlinkInfoKey{}
+
+// DownlinkInfoFromContext returns the DownlinkInfo that was set in the middleware context
+func DownlinkInfoFromContext(ctx middleware.Context) (info DownlinkInfo, ok bool) {
+	info, ok = ctx.Get(DownlinkInfoKey).(DownlinkInfo)
+	return
+}
+
+// downlinkInfo returns the cached gateway information for downlinks, with the overrides applied
+func (p *Public) downlinkInfo(gatewayID string) (info DownlinkInfo, ok bool) {
+	gtw, _ := p.get(gatewayID, FieldFrequencyPlan, FieldLocation)
+	location, _ := p.checkedLocation(gtw)
+	info = DownlinkInfo{
+		FrequencyPlan: gtw.FrequencyPlan,
+		Location:      location,
+		AntennaType:   antennaType(gtw),
+		AntennaModel:  antennaModel(gtw),
+	}
+	if override, ok := p.override(gatewayID); ok {
+		if override.FrequencyPlan != "" {
+			info.FrequencyPlan = override.FrequencyPlan
+		}
+		if location := override.location(); location != nil {
+			info.Location = location
+		}
+	}
+	return info, info != DownlinkInfo{}
+}
+
+// HandleDownlink sets the cached frequency plan and antenna information of the gateway in the context of downlink
+// messages, so that later middleware can validate downlinks against it, and injects the tags of the gateway. This
+// is skipped if the gateway is configured to bypass gateway information.
+func (p *Public) HandleDownlink(ctx middleware.Context, msg *types.DownlinkMessage) error {
+	if p.bypassed(msg.GatewayID) {
+		return nil
+	}
+	if ctx != nil {
+		if info, ok := p.downlinkInfo(msg.GatewayID); ok {
+			ctx.Set(DownlinkInfoKey, info)
+			if msg.Message != nil && types.Tracing(types.TraceVerbose) {
+				if info.FrequencyPlan != "" {
+					msg.Message.Trace = msg.Message.Trace.WithEvent(injectEvent, "field", string(FieldFrequencyPlan))
+				}
+				if info.Location != nil {
+					msg.Message.Trace = msg.Message.Trace.WithEvent(injectEvent, "field", string(FieldLocation))
+				}
+			}
+		}
+	}
+	p.tagDownlink(msg)
+	return nil
+}
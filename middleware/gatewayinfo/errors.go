@@ -0,0 +1,50 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package gatewayinfo
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/TheThingsNetwork/go-account-lib/util"
+)
+
+// ErrGatewayNotFound is returned when the account server does not know the gateway
+var ErrGatewayNotFound = errors.New("gatewayinfo: gateway not found")
+
+// ErrRateLimited is returned when the account server rate limits the request
+var ErrRateLimited = errors.New("gatewayinfo: rate limited")
+
+// ErrClosed is returned when the gateway information middleware is closed
+var ErrClosed = errors.New("gatewayinfo: closed")
+
+// ErrAccountUnavailable is returned when the account server could not be reached or returned an unexpected error
+var ErrAccountUnavailable = errors.New("gatewayinfo: account server unavailable")
+
+// ErrFetchQueueFull is returned when a fetch is dropped because too many fetches are waiting for the rate limiter
+var ErrFetchQueueFull = errors.New("gatewayinfo: fetch queue full")
+
+// ErrFetchPending is returned when there is no gateway information yet because its first fetch is in progress
+var ErrFetchPending = errors.New("gatewayinfo: fetch pending")
+
+// ErrTooStale is returned when gateway information is not served because it is older than the maximum stale age
+var ErrTooStale = errors.New("gatewayinfo: data too stale")
+
+// wrapErr wraps an error returned by the account server in one of the exported errors
+func wrapErr(err error) error {
+	if err == nil {
+		return nil
+	}
+	var httpErr util.HTTPError
+	if errors.As(err, &httpErr) {
+		switch httpErr.Code {
+		case http.StatusNotFound:
+			return fmt.Errorf("%w: %w", ErrGatewayNotFound, err)
+		case http.StatusTooManyRequests:
+			return fmt.Errorf("%w: %w", ErrRateLimited, err)
+		}
+	}
+	return fmt.Errorf("%w: %w", ErrAccountUnavailable, err)
+}
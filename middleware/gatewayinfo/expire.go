@@ -0,0 +1,58 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package gatewayinfo
+
+import "time"
+
+// FieldAttributes is used with WithFieldExpire for the status attributes that are injected when WithInjectFlags
+// is enabled. It is not passed to a FieldInjector.
+const FieldAttributes Field = "attributes"
+
+// WithFieldExpire sets the expiration of a field of the gateway information, so that for example the location can
+// be cached longer than the attributes. Information is re-fetched when a message needs a field that has expired.
+// Fields without expiration use the expiration of WithExpire. A Cache-Control max-age of the account server is
+// still respected for all fields.
+//
+// The account server returns all fields at once, so a fetch refreshes all fields and they share the time of the
+// last update.
+func (p *Public) WithFieldExpire(field Field, duration time.Duration) *Public {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.fieldExpire == nil {
+		p.fieldExpire = make(map[Field]time.Duration)
+	}
+	p.fieldExpire[field] = duration
+	return p
+}
+
+// expireFor returns the expiration of the information for a lookup that needs the given fields, which is the
+// shortest expiration of these fields. A return value of 0 means that the information does not expire. The caller
+// must hold the lock of its shard.
+func (p *Public) expireFor(info *info, fields []Field) time.Duration {
+	if len(p.fieldExpire) == 0 || len(fields) == 0 || info.ttl == uncached {
+		return p.expireOf(info)
+	}
+	var shortest time.Duration
+	for _, field := range fields {
+		expire, ok := p.fieldExpire[field]
+		if !ok {
+			expire = p.expire
+		}
+		if expire > 0 && (shortest == 0 || expire < shortest) {
+			shortest = expire
+		}
+	}
+	if info.ttl > 0 && (shortest == 0 || info.ttl < shortest) {
+		shortest = info.ttl
+	}
+	return shortest
+}
+
+// statusFields returns the fields that are injected into status messages
+func (p *Public) statusFields() []Field {
+	if p.injectFlags || len(p.attributeKeys) > 0 {
+		return []Field{FieldLocation, FieldFrequencyPlan, FieldPlatform, FieldDescription, FieldAttributes}
+	}
+	return []Field{FieldLocation, FieldFrequencyPlan, FieldPlatform, FieldDescription}
+}
@@ -0,0 +1,171 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package gatewayinfo
+
+import (
+	"github.com/TheThingsNetwork/api/gateway"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
+	"github.com/TheThingsNetwork/go-account-lib/account"
+)
+
+// Sources of the value of a field in a Decision
+const (
+	SourceNone          = "none"
+	SourceMessage       = "message"
+	SourceAccountServer = "account_server"
+	SourceOverride      = "override"
+)
+
+// Decision explains the injection decision for a field of a message
+type Decision struct {
+	Field  Field       `json:"field"`
+	Source string      `json:"source"`
+	Reason string      `json:"reason"`
+	Value  interface{} `json:"value,omitempty"`
+}
+
+// Explain returns the injection decisions that HandleUplink or HandleStatus would make for each field of the
+// message (a *types.UplinkMessage or *types.StatusMessage), without changing the message. It only uses gateway
+// information that is already cached, and does not fetch it.
+func (p *Public) Explain(gatewayID string, msg interface{}) []Decision {
+	var (
+		enabled bool
+		fields  []Field
+		current = make(map[Field]interface{})
+	)
+	switch msg := msg.(type) {
+	case *types.UplinkMessage:
+		enabled = p.injectUplink && msg.Message != nil
+		if msg.Message != nil {
+			current[FieldLocation] = validLocation(msg.Message.GatewayMetadata.Location)
+		}
+		fields = []Field{FieldLocation}
+	case *types.StatusMessage:
+		enabled = p.injectStatus && msg.Message != nil
+		if msg.Message != nil {
+			current[FieldLocation] = validLocation(msg.Message.Location)
+			current[FieldFrequencyPlan] = msg.Message.FrequencyPlan
+			current[FieldPlatform] = msg.Message.Platform
+			current[FieldDescription] = msg.Message.Description
+		}
+		fields = []Field{FieldLocation, FieldFrequencyPlan, FieldPlatform, FieldDescription}
+	default:
+		return nil
+	}
+
+	info, cached, err := p.cached(gatewayID)
+	override, overridden := p.override(gatewayID)
+
+	decisions := make([]Decision, 0, len(fields))
+	for _, field := range fields {
+		decision := Decision{Field: field, Source: SourceNone}
+		switch {
+		case !enabled:
+			decision.Reason = "injection is disabled"
+		case p.bypassed(gatewayID):
+			decision.Reason = "gateway is bypassed"
+		case overridden && overrideValue(override, field) != nil:
+			decision.Source, decision.Reason, decision.Value = SourceOverride, "overridden", overrideValue(override, field)
+		default:
+			p.explainField(&decision, gatewayID, current[field], info, cached, err)
+		}
+		decisions = append(decisions, decision)
+	}
+	return decisions
+}
+
+func (p *Public) explainField(decision *Decision, gatewayID string, current interface{}, info account.Gateway, cached bool, err error) {
+	var (
+		value    interface{}
+		rejected string
+	)
+	switch decision.Field {
+	case FieldLocation:
+		var location *gateway.LocationMetadata
+		location, rejected = p.checkedLocation(info)
+		value = location
+	case FieldFrequencyPlan:
+		value = info.FrequencyPlan
+	case FieldPlatform:
+		value = platform(info)
+	case FieldDescription:
+		value = description(info)
+	}
+	injected, ok := p.injectField(gatewayID, decision.Field, current, value)
+	switch {
+	case ok && !isEmpty(injected) && !equalValue(injected, current):
+		decision.Source, decision.Reason, decision.Value = SourceAccountServer, "injected from gateway information", injected
+	case !isEmpty(current):
+		decision.Source, decision.Reason, decision.Value = SourceMessage, "already present in message", current
+	case !cached:
+		decision.Reason = "no gateway information cached"
+	case err != nil:
+		decision.Reason = "gateway information could not be fetched: " + err.Error()
+	case rejected != "":
+		decision.Reason = "invalid location in gateway information: " + rejected
+	case isEmpty(value):
+		decision.Reason = "not available in gateway information"
+	default:
+		decision.Reason = "declined by field injector"
+	}
+}
+
+// cached returns the cached gateway information without fetching it
+func (p *Public) cached(gatewayID string) (gateway account.Gateway, ok bool, err error) {
+	key := p.key(p.resolve(gatewayID))
+	s := p.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info, ok := s.info[key]
+	if !ok {
+		return gateway, false, nil
+	}
+	return info.gateway, true, info.err
+}
+
+func validLocation(location *gateway.LocationMetadata) *gateway.LocationMetadata {
+	if location == nil || location.Validate() != nil {
+		return nil
+	}
+	return location
+}
+
+func overrideValue(override Override, field Field) interface{} {
+	var value string
+	switch field {
+	case FieldLocation:
+		if location := override.location(); location != nil {
+			return location
+		}
+		return nil
+	case FieldFrequencyPlan:
+		value = override.FrequencyPlan
+	case FieldPlatform:
+		value = override.Platform
+	case FieldDescription:
+		value = override.Description
+	}
+	if value == "" {
+		return nil
+	}
+	return value
+}
+
+func isEmpty(value interface{}) bool {
+	switch value := value.(type) {
+	case *gateway.LocationMetadata:
+		return missingLocation(value)
+	case string:
+		return value == ""
+	}
+	return value == nil
+}
+
+func equalValue(a, b interface{}) bool {
+	if a, ok := a.(*gateway.LocationMetadata); ok {
+		b, _ := b.(*gateway.LocationMetadata)
+		return b != nil && *a == *b
+	}
+	return a == b
+}
@@ -0,0 +1,114 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package gatewayinfo
+
+import (
+	"github.com/TheThingsNetwork/api/gateway"
+)
+
+// Field is a field of a message into which gateway information can be injected
+type Field string
+
+// Fields into which gateway information is injected. The values passed to a FieldInjector for FieldLocation are
+// of type *gateway.LocationMetadata, the others are strings.
+const (
+	FieldLocation      Field = "location"
+	FieldFrequencyPlan Field = "frequency_plan"
+	FieldPlatform      Field = "platform"
+	FieldDescription   Field = "description"
+)
+
+// FieldInjector decides whether and how gateway information is injected into a field of a message. It receives
+// the current value of the field in the message and the value from the gateway information (which may be nil or
+// empty), and returns the value to set and whether to set it.
+type FieldInjector interface {
+	InjectField(gatewayID string, field Field, current, cached interface{}) (value interface{}, inject bool)
+}
+
+// DefaultFieldInjector only injects values into fields that are empty, and fills the altitude of locations that
+// do not have one
+type DefaultFieldInjector struct{}
+
+// InjectField implements FieldInjector
+func (DefaultFieldInjector) InjectField(gatewayID string, field Field, current, cached interface{}) (interface{}, bool) {
+	switch field {
+	case FieldLocation:
+		current, _ := current.(*gateway.LocationMetadata)
+		cached, _ := cached.(*gateway.LocationMetadata)
+		if cached == nil {
+			return nil, false
+		}
+		location := new(gateway.LocationMetadata)
+		if current != nil {
+			*location = *current
+		}
+		if location.IsZero() {
+			location.Latitude = cached.Latitude
+			location.Longitude = cached.Longitude
+			location.Source = cached.Source
+		}
+		if location.Altitude == 0 {
+			location.Altitude = cached.Altitude
+		}
+		return location, true
+	case FieldPlatform:
+		current, _ := current.(string)
+		return cached, current == ""
+	default:
+		current, _ := current.(string)
+		cached, _ := cached.(string)
+		return cached, current == "" && cached != ""
+	}
+}
+
+// WithFieldInjector sets the FieldInjector that decides whether and how gateway information is injected. The
+// default is DefaultFieldInjector.
+func (p *Public) WithFieldInjector(injector FieldInjector) *Public {
+	p.fieldInjector = injector
+	return p
+}
+
+func (p *Public) injectField(gatewayID string, field Field, current, cached interface{}) (interface{}, bool) {
+	if p.fieldInjector != nil {
+		return p.fieldInjector.InjectField(gatewayID, field, current, cached)
+	}
+	return DefaultFieldInjector{}.InjectField(gatewayID, field, current, cached)
+}
+
+func (p *Public) injectLocation(gatewayID string, current, cached *gateway.LocationMetadata) (*gateway.LocationMetadata, bool) {
+	value, ok := p.injectField(gatewayID, FieldLocation, current, cached)
+	if !ok {
+		return current, false
+	}
+	location, _ := value.(*gateway.LocationMetadata)
+	return location, true
+}
+
+func (p *Public) injectString(gatewayID string, field Field, current *string, cached string) {
+	previous := *current
+	p.observeConflict(gatewayID, field, previous, cached)
+	if value, ok := p.injectField(gatewayID, field, *current, cached); ok {
+		*current, _ = value.(string)
+	}
+	observeInjection(field, previous != "", cached != "", *current != previous)
+}
+
+// Outcomes of the injection of a field
+const (
+	outcomeInjected       = "injected"
+	outcomeAlreadyPresent = "already-present"
+	outcomeUnavailable    = "unavailable"
+)
+
+// observeInjection counts the outcome of the injection of a field
+func observeInjection(field Field, present, available, injected bool) {
+	outcome := outcomeUnavailable
+	switch {
+	case injected:
+		outcome = outcomeInjected
+	case present:
+		outcome = outcomeAlreadyPresent
+	}
+	injections.WithLabelValues(string(field), outcome).Inc()
+}
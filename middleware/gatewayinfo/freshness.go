@@ -0,0 +1,62 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package gatewayinfo
+
+import (
+	"time"
+
+	"github.com/TheThingsNetwork/go-account-lib/account"
+)
+
+// Freshness is the state of the cached gateway information of a gateway
+type Freshness int
+
+// Freshness of cached gateway information
+const (
+	Missing Freshness = iota // not cached
+	Fresh                    // fetched within its expire
+	Stale                    // fetched longer than its expire ago, for example because refreshes failed
+	Errored                  // the last fetch failed
+)
+
+func (f Freshness) String() string {
+	switch f {
+	case Missing:
+		return "missing"
+	case Fresh:
+		return "fresh"
+	case Stale:
+		return "stale"
+	case Errored:
+		return "errored"
+	}
+	return "unknown"
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (f Freshness) MarshalText() ([]byte, error) {
+	return []byte(f.String()), nil
+}
+
+// Lookup returns the cached gateway information of a gateway with its freshness, without fetching it or otherwise
+// changing the cache. The freshness is derived from when the information was last fetched and its expire (see
+// WithExpire). For Errored gateways, the error of the last fetch is returned with the information that was cached
+// before, if any.
+func (p *Public) Lookup(gatewayID string) (account.Gateway, Freshness, error) {
+	key := p.key(p.resolve(gatewayID))
+	s := p.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info, ok := s.info[key]
+	switch {
+	case !ok:
+		return account.Gateway{}, Missing, nil
+	case info.err != nil:
+		return info.gateway, Errored, info.err
+	}
+	if expire := p.expireOf(info); expire > 0 && time.Since(info.fetched) >= expire {
+		return info.gateway, Stale, nil
+	}
+	return info.gateway, Fresh, nil
+}
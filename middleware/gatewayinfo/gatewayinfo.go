@@ -4,16 +4,20 @@
 package gatewayinfo
 
 import (
+	"container/list"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/TheThingsNetwork/api/gateway"
 	"github.com/TheThingsNetwork/gateway-connector-bridge/middleware"
 	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
 	"github.com/TheThingsNetwork/go-account-lib/account"
+	"github.com/TheThingsNetwork/go-utils/backoff"
 	"github.com/TheThingsNetwork/go-utils/log"
 	redis "gopkg.in/redis.v5"
 )
@@ -24,26 +28,51 @@ var RequestInterval = 50 * time.Millisecond
 // RequestBurst sets the burst of requests to the account server
 var RequestBurst = 50
 
-// NewPublic returns a middleware that injects public gateway information
-func NewPublic(accountServer string) *Public {
+// NewPublic returns a middleware that injects public gateway information. It returns ErrInvalidAccountServer if the
+// account server is not a valid http or https URL.
+func NewPublic(accountServer string) (*Public, error) {
+	accountServer, err := parseAccountServer(accountServer)
+	if err != nil {
+		return nil, err
+	}
 	p := &Public{
 		log:       log.Get(),
-		account:   account.New(accountServer),
-		info:      make(map[string]*info),
+		shards:    newShards(DefaultCacheShards),
+		errors:    list.New(),
 		available: make(chan struct{}, RequestBurst),
+		done:      make(chan struct{}),
+
+		injectUplink: true,
+		injectStatus: true,
+
+		maxErrorEntries: DefaultMaxErrorEntries,
+		fetchTimeout:    DefaultFetchTimeout,
+		readPathRefresh: true,
 	}
+	p.account.Store(&accountClient{
+		server:  accountServer,
+		fetcher: &httpFetcher{server: accountServer, client: defaultHTTPClient(), token: &p.token},
+	})
 	for i := 0; i < RequestBurst; i++ {
 		p.available <- struct{}{}
 	}
+	interval := RequestInterval
 	go func() {
-		for range time.Tick(RequestInterval) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.done:
+				return
+			case <-ticker.C:
+			}
 			select {
 			case p.available <- struct{}{}:
 			default:
 			}
 		}
 	}()
-	return p
+	return p, nil
 }
 
 // WithRedis initializes the Redis store for persistence between restarts
@@ -85,25 +114,151 @@ func (p *Public) WithRedis(client *redis.Client, prefix string) (*Public, error)
 	return p, nil
 }
 
-// WithExpire adds an expiration to gateway information. Information is re-fetched if expired
+// WithExpire adds an expiration to gateway information. Information is re-fetched if expired. If the account server
+// returns a Cache-Control max-age, that is used instead. Information that the account server does not allow to be
+// cached (no-cache, no-store or max-age=0) is fetched again on every lookup.
 func (p *Public) WithExpire(duration time.Duration) *Public {
 	p.expire = duration
 	return p
 }
 
+// DefaultMaxErrorEntries is the default maximum number of error entries
+var DefaultMaxErrorEntries = 1000
+
+// WithMaxErrorEntries sets the maximum number of entries for gateways that could not be fetched. When this number is
+// exceeded, the oldest error entries are removed, so that connects for many non-existent gateways do not fill memory.
+func (p *Public) WithMaxErrorEntries(max int) *Public {
+	p.mu.Lock()
+	p.maxErrorEntries = max
+	evicted := p.evictErrors()
+	p.mu.Unlock()
+	p.deleteEvicted(evicted)
+	return p
+}
+
+// WithMaxConcurrentFetches limits the number of requests to the account server that are in progress at the same
+// time. This is independent of RequestInterval and RequestBurst, which limit the rate of requests. If max is 0,
+// the number of concurrent requests is not limited.
+func (p *Public) WithMaxConcurrentFetches(max int) *Public {
+	if max > 0 {
+		p.fetches = make(chan struct{}, max)
+	} else {
+		p.fetches = nil
+	}
+	return p
+}
+
+// WithUplinkInjection enables or disables the injection of gateway information into uplink messages
+func (p *Public) WithUplinkInjection(enabled bool) *Public {
+	p.injectUplink = enabled
+	return p
+}
+
+// WithStatusInjection enables or disables the injection of gateway information into status messages
+func (p *Public) WithStatusInjection(enabled bool) *Public {
+	p.injectStatus = enabled
+	return p
+}
+
 // Public gateway information will be injected
 type Public struct {
 	log     log.Interface
-	account *account.Account
+	account atomic.Pointer[accountClient]
 	expire  time.Duration
 
+	injectUplink bool
+	injectStatus bool
+	injectFlags  bool
+
+	injectTimezone         bool
+	injectExpectedFirmware bool
+	injectRegional         []string                       // regional parameters that are injected into status
+	attributeMapping       map[string]string              // status attribute keys by account attribute key
+	attributeKeys          []string                       // sorted keys of attributeMapping
+	regional               map[string]*RegionalParameters // by frequency plan, nil if it has none
+
+	connectResponse bool
+	lazyFetch       bool
+	readPathRefresh bool
+
+	disconnectGrace    time.Duration
+	minFetchInterval   time.Duration
+	fetchTimeout       time.Duration // after which pending first fetches expire, 0 if they do not expire
+	pendingDisconnects map[string]*time.Timer
+
+	fieldExpire map[Field]time.Duration
+	maxStaleAge time.Duration
+
+	locationCheck  bool
+	locationBounds *BoundingBox // expected region of the gateways, nil if not configured
+
+	reportConflicts bool
+
+	errorBackoff backoff.Config
+
+	prefetched map[string]bool // gateway IDs listed by the auto-prefetch Lister
+
+	overridesFile string
+	overrides     map[string]Override
+
 	redisClient *redis.Client
 	redisPrefix string
 
-	mu   sync.Mutex
-	info map[string]*info
+	shards []*shard // gateway information cache
+
+	mu            sync.Mutex
+	resolver      Resolver
+	lookupKeyFunc LookupKeyFunc
+	changeHandler ChangeHandler
+
+	maxErrorEntries int
+	errors          *list.List // gateway IDs of error entries, oldest first
+
+	resolved   map[string]string
+	unresolved map[string]time.Time // gateway IDs that could not be resolved, until they are retried
 
-	available chan struct{}
+	bypass         map[string]struct{}
+	bypassPrefixes []string
+
+	missHandler MissHandler
+
+	fieldInjector FieldInjector
+
+	health health
+
+	oldestStale struct {
+		gatewayID string
+		fetched   time.Time
+	}
+
+	readEndpoint string // read-only replica of the account server, empty to fetch from the account server
+	token        tokenSource
+
+	networks        map[string]string // network by gateway ID
+	networkFetchers map[string]Fetcher
+	regions         []*region // regional account servers
+
+	traceResponses map[string]struct{}      // gateway IDs of which responses are traced
+	responses      map[string][]interface{} // summaries of responses that were not traced yet, by cache key
+
+	available   chan struct{}
+	fetches     chan struct{}            // semaphore for concurrent fetches, nil if unlimited
+	fetchQueue  chan struct{}            // semaphore for fetches waiting for the rate limiter, nil if unbounded
+	tenants     map[string]chan struct{} // rate-limit tokens by tenant, nil if tenants are not limited
+	tenantBurst int
+	workers     *workQueue // background tasks, nil to start a goroutine for each task
+	priority    PriorityFunc
+	tokenQueue  *tokenQueue // fetches that wait for p.available by priority, nil without PriorityFunc
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Close stops the background goroutines of the gateway information middleware
+func (p *Public) Close() {
+	p.closeOnce.Do(func() {
+		close(p.done)
+	})
 }
 
 func (p *Public) redisKey(gatewayID string) string {
@@ -114,133 +269,510 @@ type info struct {
 	lastUpdated time.Time
 	err         error
 	gateway     account.Gateway
+	refreshing  bool
+	errElement  *list.Element
+	ttl         time.Duration // suggested by the account server, 0 to use the configured expire
+	fetched     time.Time     // when the gateway information was last fetched successfully
+	completed   time.Time     // when the last fetch completed, successfully or not
+	staleLogged bool
+	failures    int       // consecutive failed fetches, reset on success
+	nextRetry   time.Time // when a failed fetch may be retried, if there is an error backoff
+	snapshot    bool      // loaded from a snapshot, served until it is fetched successfully
+}
+
+// expireOf returns after how long info expires, 0 if it does not expire, or uncached if it expires immediately
+func (p *Public) expireOf(info *info) time.Duration {
+	if info.ttl != 0 {
+		return info.ttl
+	}
+	return p.expire
+}
+
+// AvailableTokens returns the number of requests that can currently be made to the account server without waiting
+// for the rate limiter, so that callers that fetch in bulk can pace themselves
+func (p *Public) AvailableTokens() int {
+	return len(p.available)
+}
+
+// Refresh synchronously fetches the public information of a gateway from the account server.
+// The returned error can be compared to ErrGatewayNotFound, ErrRateLimited, ErrClosed and ErrAccountUnavailable.
+func (p *Public) Refresh(gatewayID string) error {
+	return p.fetch(p.key(p.resolve(gatewayID)))
 }
 
 func (p *Public) fetch(gatewayID string) error {
-	<-p.available
-	gateway, err := p.account.FindGateway(gatewayID)
+	return p.fetchWith(gatewayID, false)
+}
+
+// fetchWith fetches the gateway information. Bounded fetches return ErrFetchQueueFull instead of waiting for the
+// rate limiter if the fetch queue is full (see WithFetchQueueBound).
+func (p *Public) fetchWith(gatewayID string, bounded bool) error {
+	select {
+	case <-p.done:
+		return ErrClosed
+	default:
+	}
+	if recent, err := p.recentFetch(gatewayID); recent {
+		suppressedFetches.Inc()
+		p.log.WithField("GatewayID", gatewayID).Debug("Not fetching public Gateway information: fetched within minimum interval")
+		return err
+	}
+	if p.handleMiss(gatewayID) {
+		return nil
+	}
+	// The tenant limit is waited for first, so that a throttled tenant does not hold a concurrent fetch
+	network, id := splitKey(gatewayID)
+	if err := p.waitTenant(tenant(network)); err != nil {
+		return err
+	}
+	if p.fetches != nil {
+		select {
+		case p.fetches <- struct{}{}:
+			defer func() { <-p.fetches }()
+		case <-p.done:
+			return ErrClosed
+		}
+	}
+	fetcher, available := p.fetcher(network), p.available
+	r := p.region(network, id)
+	if r != nil {
+		fetcher, available = r.fetcher, r.available
+	}
+	if err := p.takeToken(available, id, bounded); err != nil {
+		return err
+	}
+	concurrentFetches.Inc()
+	tenantFetches.WithLabelValues(tenant(network)).Inc()
+	if r != nil {
+		regionalFetches.WithLabelValues(r.prefix).Inc()
+	}
+	var (
+		gateway account.Gateway
+		ttl     time.Duration
+		err     error
+	)
+	if key := p.lookupKey(id); key != id {
+		p.log.WithField("GatewayID", id).WithField("LookupKey", key).Debug("Looking up gateway with transformed key")
+		id = key
+	}
+	if ttlFetcher, ok := fetcher.(ttlFetcher); ok {
+		gateway, ttl, err = ttlFetcher.FindGatewayTTL(id)
+	} else {
+		gateway, err = fetcher.FindGateway(id)
+	}
+	concurrentFetches.Dec()
 	if err != nil {
+		err = wrapErr(err)
 		p.setErr(gatewayID, err)
 		return err
 	}
-	p.set(gatewayID, gateway)
+	p.recordResponse(gatewayID, gateway, ttl)
+	p.setTTL(gatewayID, gateway, ttl)
 	return nil
 }
 
 func (p *Public) setErr(gatewayID string, err error) {
+	s := p.shard(gatewayID)
+	s.mu.Lock()
 	p.mu.Lock()
-	defer p.mu.Unlock()
-	if gtw, ok := p.info[gatewayID]; ok {
+	var evicted []*list.Element
+	if gtw, ok := s.info[gatewayID]; ok {
 		gtw.lastUpdated = time.Now()
+		gtw.completed = time.Now()
 		gtw.err = err
+		gtw.refreshing = false
+		gtw.failures++
+		gtw.nextRetry = time.Now().Add(p.retryDelay(gtw.failures))
+		if gtw.errElement != nil {
+			p.errors.MoveToBack(gtw.errElement)
+		}
 	} else {
-		p.info[gatewayID] = &info{
+		s.info[gatewayID] = &info{
 			lastUpdated: time.Now(),
+			completed:   time.Now(),
 			err:         err,
+			errElement:  p.errors.PushBack(gatewayID),
+			failures:    1,
+			nextRetry:   time.Now().Add(p.retryDelay(1)),
 		}
+		evicted = p.evictErrors()
+	}
+	p.mu.Unlock()
+	s.mu.Unlock()
+	p.deleteEvicted(evicted)
+}
+
+// evictErrors removes the oldest error entries from the error list until there are at most maxErrorEntries, and
+// returns their elements. As the entries may be in other shards, the caller must remove them from the cache with
+// deleteEvicted after releasing the locks. The caller must hold p.mu.
+func (p *Public) evictErrors() (evicted []*list.Element) {
+	for p.maxErrorEntries > 0 && p.errors.Len() > p.maxErrorEntries {
+		element := p.errors.Front()
+		p.errors.Remove(element)
+		evicted = append(evicted, element)
+	}
+	errorEntries.Set(float64(p.errors.Len()))
+	return evicted
+}
+
+// deleteEvicted removes the entries of evicted error elements from the cache, unless they were replaced since
+func (p *Public) deleteEvicted(evicted []*list.Element) {
+	for _, element := range evicted {
+		gatewayID := element.Value.(string)
+		s := p.shard(gatewayID)
+		s.mu.Lock()
+		p.mu.Lock()
+		if gtw, ok := s.info[gatewayID]; ok && gtw.errElement == element {
+			delete(s.info, gatewayID)
+		}
+		p.mu.Unlock()
+		s.mu.Unlock()
+	}
+}
+
+// removeError stops tracking gtw as error entry. The caller must hold p.mu.
+func (p *Public) removeError(gtw *info) {
+	if gtw != nil && gtw.errElement != nil {
+		p.errors.Remove(gtw.errElement)
+		gtw.errElement = nil
+		errorEntries.Set(float64(p.errors.Len()))
 	}
 }
 
 func (p *Public) set(gatewayID string, gateway account.Gateway) {
+	p.setTTL(gatewayID, gateway, 0)
+}
+
+// setTTL sets the gateway information with the TTL that the account server suggested (0 for the configured expire).
+// The information is merged into previously set information (see mergeGateway).
+func (p *Public) setTTL(gatewayID string, gateway account.Gateway, ttl time.Duration) {
 	log := p.log.WithField("GatewayID", gatewayID)
-	p.mu.Lock()
+	s := p.shard(gatewayID)
+	s.mu.Lock()
 	log.Debug("Setting public gateway info")
-	p.info[gatewayID] = &info{
+	prev, ok := s.info[gatewayID]
+	refreshed := ok && prev.err == nil
+	if refreshed {
+		gateway = mergeGateway(prev.gateway, gateway)
+	}
+	p.mu.Lock()
+	p.removeError(s.info[gatewayID])
+	p.resetStale(gatewayID)
+	p.mu.Unlock()
+	info := &info{
 		lastUpdated: time.Now(),
+		fetched:     time.Now(),
+		completed:   time.Now(),
 		gateway:     gateway,
+		ttl:         ttl,
 	}
-	p.mu.Unlock()
-	if p.redisClient != nil {
+	s.info[gatewayID] = info
+	expire := p.expireOf(info)
+	s.mu.Unlock()
+	if refreshed {
+		p.notifyChange(gatewayID, prev.gateway, gateway)
+	}
+	if p.redisClient != nil && expire != uncached {
 		data, _ := json.Marshal(gateway)
-		if err := p.redisClient.Set(p.redisKey(gatewayID), string(data), p.expire).Err(); err != nil {
+		if err := p.redisClient.Set(p.redisKey(gatewayID), string(data), expire).Err(); err != nil {
 			log.WithError(err).Warn("Could not set public Gateway information in Redis")
 		}
 	}
 }
 
-func (p *Public) get(gatewayID string) (gateway account.Gateway, err error) {
-	if gatewayID == "" {
+// get returns the gateway information for a lookup that needs the given fields (or all fields if none are given),
+// and fetches it in the background if it is not cached or if one of these fields has expired, unless refreshes on
+// the read path are disabled (see WithReadPathRefresh)
+func (p *Public) get(gatewayID string, fields ...Field) (gateway account.Gateway, err error) {
+	return p.getWith(gatewayID, p.readPathRefresh, fields...)
+}
+
+// getWith returns the gateway information like get, and only fetches it if fetch is true
+func (p *Public) getWith(gatewayID string, fetch bool, fields ...Field) (gateway account.Gateway, err error) {
+	if gatewayID == "" || p.bypassed(gatewayID) {
 		return
 	}
+	gatewayID = p.key(p.resolve(gatewayID))
 	log := p.log.WithField("GatewayID", gatewayID)
-	p.mu.Lock()
-	defer p.mu.Unlock()
-	info, ok := p.info[gatewayID]
+	s := p.shard(gatewayID)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info, ok := s.info[gatewayID]
+	if !fetch {
+		if !ok {
+			return
+		}
+		p.checkStale(gatewayID, info)
+		return p.serve(gatewayID, info)
+	}
+	var pending *pendingFetch
 	if ok {
-		if p.expire == 0 || time.Since(info.lastUpdated) < p.expire {
-			return info.gateway, info.err
+		if due, backoff := p.retryDue(info); backoff {
+			if !due {
+				return p.serve(gatewayID, info)
+			}
+		} else if info.snapshot {
+			if time.Since(info.lastUpdated) < SnapshotRetryInterval {
+				return p.serve(gatewayID, info)
+			}
+		} else if expire := p.expireFor(info, fields); expire == 0 || time.Since(info.lastUpdated) < expire {
+			p.checkStale(gatewayID, info)
+			return p.serve(gatewayID, info)
 		}
 		info.lastUpdated = time.Now()
+		if info.snapshot || info.ttl == uncached {
+			gateway, err = p.serve(gatewayID, info) // served while it is refreshed
+		}
+	} else {
+		var first bool
+		if pending, first = p.startPending(s, gatewayID); !first {
+			return gateway, ErrFetchPending
+		}
+		err = ErrFetchPending
 	}
-	go func() {
-		err := p.fetch(gatewayID)
-		if err != nil {
+	p.background(func() {
+		err := p.fetchWith(gatewayID, true)
+		if pending != nil {
+			p.finishPending(gatewayID, pending)
+			for _, respond := range pending.connects {
+				respond()
+			}
+		}
+		if errors.Is(err, ErrFetchQueueFull) {
+			p.dropFetch(gatewayID)
+			log.Debug("Dropped fetch of public Gateway information: fetch queue full")
+		} else if err != nil {
 			log.WithError(err).Warn("Could not get public Gateway information")
 		} else {
 			log.Debug("Got public Gateway information")
 		}
-	}()
-	return gateway, nil
+	})
+	return gateway, err
 }
 
 func (p *Public) unset(gatewayID string) {
+	s := p.shard(gatewayID)
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	p.mu.Lock()
-	defer p.mu.Unlock()
-	delete(p.info, gatewayID)
+	p.removeError(s.info[gatewayID])
+	p.resetStale(gatewayID)
+	p.mu.Unlock()
+	delete(s.info, gatewayID)
+}
+
+// Len returns the number of gateways in the cache
+func (p *Public) Len() (n int) {
+	for _, s := range p.shards {
+		s.mu.Lock()
+		n += len(s.info)
+		s.mu.Unlock()
+	}
+	return n
 }
 
-// HandleConnect fetches public gateway information in the background when a ConnectMessage is received
+// Range calls f for each cached gateway, until f returns false. The entries are copied under the locks, so f is
+// called without holding them and may call other methods of Public.
+func (p *Public) Range(f func(gatewayID string, gateway account.Gateway, err error) bool) {
+	type entry struct {
+		gatewayID string
+		gateway   account.Gateway
+		err       error
+	}
+	var entries []entry
+	for _, s := range p.shards {
+		s.mu.Lock()
+		for gatewayID, info := range s.info {
+			entries = append(entries, entry{gatewayID, info.gateway, info.err})
+		}
+		s.mu.Unlock()
+	}
+	for _, entry := range entries {
+		if !f(entry.gatewayID, entry.gateway, entry.err) {
+			return
+		}
+	}
+}
+
+// FrequencyPlan returns the frequency plan of a gateway, or an empty string if it is not known (yet)
+func (p *Public) FrequencyPlan(gatewayID string) string {
+	info, _ := p.get(gatewayID, FieldFrequencyPlan)
+	return info.FrequencyPlan
+}
+
+// Platform returns the platform (brand and model) of a gateway, or an empty string if it is not known (yet)
+func (p *Public) Platform(gatewayID string) string {
+	info, _ := p.get(gatewayID, FieldPlatform)
+	return platform(info)
+}
+
+// HandleConnect fetches public gateway information in the background when a ConnectMessage is received and sets the
+// tags of the gateway in the context, unless the gateway is configured to bypass gateway information
 func (p *Public) HandleConnect(ctx middleware.Context, msg *types.ConnectMessage) error {
-	p.get(msg.GatewayID)
+	if p.cancelDisconnect(msg.GatewayID) {
+		p.log.WithField("GatewayID", msg.GatewayID).Debug("Gateway reconnected within disconnect grace")
+	}
+	p.setNetwork(p.resolve(msg.GatewayID), msg.Network)
+	p.tagConnect(ctx, msg)
+	if p.lazyFetch {
+		return nil
+	}
+	info, err := p.getWith(msg.GatewayID, true)
+	if errors.Is(err, ErrFetchPending) {
+		p.respondWhenFetched(ctx, msg)
+		return nil
+	}
+	p.setConnectResponse(ctx, msg, info)
 	return nil
 }
 
 // HandleDisconnect cleans up
 func (p *Public) HandleDisconnect(ctx middleware.Context, msg *types.DisconnectMessage) error {
-	go p.unset(msg.GatewayID)
+	p.scheduleDisconnect(msg.GatewayID)
 	return nil
 }
 
-// HandleStatus inserts metadata if set in info, but not present in message
-func (p *Public) HandleStatus(ctx middleware.Context, msg *types.StatusMessage) error {
-	info, _ := p.get(msg.GatewayID)
+const (
+	injectEvent     = "inject"
+	skipInjectEvent = "skip inject"
+)
 
-	if msg.Message.Location == nil || msg.Message.Location.Validate() != nil {
-		msg.Message.Location = nil
+// Inject inserts public gateway information into uplink and status messages, so that Public can be used as an injector
+func (p *Public) Inject(msg interface{}) error {
+	switch msg := msg.(type) {
+	case *types.UplinkMessage:
+		return p.HandleUplink(nil, msg)
+	case *types.StatusMessage:
+		return p.HandleStatus(nil, msg)
 	}
+	return nil
+}
 
-	if info.AntennaLocation != nil {
-		if msg.Message.Location == nil {
-			msg.Message.Location = new(gateway.LocationMetadata)
+// HandleUplink inserts the gateway location if set in info, but not present in message.
+//
+// Only a single location is injected, also for gateways with multiple antennas: the per-antenna metadata of uplink
+// messages (gateway.RxMetadata_Antenna) has no location field, and the account server only provides a single
+// antenna location per gateway.
+func (p *Public) HandleUplink(ctx middleware.Context, msg *types.UplinkMessage) error {
+	if !p.injectUplink {
+		return nil
+	}
+
+	if msg.Message == nil {
+		// Without a message there is nothing to inject into, and nowhere to trace that
+		p.log.WithField("GatewayID", msg.GatewayID).Debug("No metadata container to inject into")
+		return nil
+	}
+
+	if p.bypassed(msg.GatewayID) {
+		if types.Tracing(types.TraceVerbose) {
+			msg.Message.Trace = msg.Message.Trace.WithEvent(bypassEvent)
 		}
-		if msg.Message.Location.IsZero() {
-			msg.Message.Location.Latitude = float32(info.AntennaLocation.Latitude)
-			msg.Message.Location.Longitude = float32(info.AntennaLocation.Longitude)
-			msg.Message.Location.Source = gateway.LocationMetadata_REGISTRY
+		return nil
+	}
+
+	// The GatewayMetadata is not nullable, so uplinks without metadata get a zero-valued container to inject into
+	meta := &msg.Message.GatewayMetadata
+
+	if meta.Location == nil || meta.Location.Validate() != nil {
+		meta.Location = nil
+	}
+
+	// Uplinks of gateways that send complete metadata take the fast path, without looking up the cache
+	var info account.Gateway
+	if !p.completeUplink(meta.Location) && (!p.lazyFetch || missingLocation(meta.Location)) {
+		var err error
+		info, err = p.get(msg.GatewayID, FieldLocation)
+		p.traceLookupKey(msg)
+		if errors.Is(err, ErrTooStale) && types.Tracing(types.TraceVerbose) {
+			msg.Message.Trace = msg.Message.Trace.WithEvent(skipInjectEvent, "reason", "data too stale")
 		}
-		if msg.Message.Location.Altitude == 0 {
-			msg.Message.Location.Altitude = int32(info.AntennaLocation.Altitude)
+		if errors.Is(err, ErrFetchPending) && missingLocation(meta.Location) {
+			skipPending("uplink")
+			if types.Tracing(types.TraceVerbose) {
+				msg.Message.Trace = msg.Message.Trace.WithEvent(skipInjectEvent, "reason", "fetch pending")
+			}
 		}
 	}
 
-	if msg.Message.FrequencyPlan == "" && info.FrequencyPlan != "" {
-		msg.Message.FrequencyPlan = info.FrequencyPlan
-	}
+	p.traceResponse(msg)
 
-	if msg.Message.Platform == "" {
-		platform := []string{}
-		if info.Attributes.Brand != nil {
-			platform = append(platform, *info.Attributes.Brand)
+	previous := meta.Location
+	cached, rejected := p.checkedLocation(info)
+	if rejected != "" && missingLocation(meta.Location) {
+		invalidLocations.WithLabelValues(rejected).Inc()
+		if types.Tracing(types.TraceVerbose) {
+			msg.Message.Trace = msg.Message.Trace.WithEvent(skipInjectEvent, "reason", "invalid location: "+rejected)
+		}
+	}
+	p.traceConflict(msg, meta.Location, cached)
+	if location, ok := p.injectLocation(msg.GatewayID, meta.Location, cached); ok {
+		meta.Location = location
+		if injectedCoordinates(previous, location) && types.Tracing(types.TraceVerbose) {
+			msg.Message.Trace = msg.Message.Trace.WithEvent(injectEvent, "field", "location")
 		}
-		if info.Attributes.Model != nil {
-			platform = append(platform, *info.Attributes.Model)
+	}
+	observeInjection(FieldLocation, !missingLocation(previous), hasAntennaLocation(info), injectedCoordinates(previous, meta.Location))
+
+	p.overrideUplink(msg)
+	p.tagUplink(msg)
+
+	return nil
+}
+
+// injectedCoordinates returns whether the coordinates of the location were changed by injection
+func injectedCoordinates(previous, location *gateway.LocationMetadata) bool {
+	if location == nil || location.IsZero() {
+		return false
+	}
+	return previous == nil || previous.Latitude != location.Latitude || previous.Longitude != location.Longitude
+}
+
+// HandleStatus inserts metadata if set in info, but not present in message
+func (p *Public) HandleStatus(ctx middleware.Context, msg *types.StatusMessage) error {
+	if !p.injectStatus {
+		return nil
+	}
+
+	if p.bypassed(msg.GatewayID) {
+		p.log.WithField("GatewayID", msg.GatewayID).Debug("Bypassing status injection")
+		return nil
+	}
+
+	if msg.Message.Location == nil || msg.Message.Location.Validate() != nil {
+		msg.Message.Location = nil
+	}
+
+	var info account.Gateway
+	if !p.lazyFetch || p.needsStatusInfo(msg) {
+		var err error
+		info, err = p.get(msg.GatewayID, p.statusFields()...)
+		if errors.Is(err, ErrFetchPending) {
+			skipPending("status")
+			p.log.WithField("GatewayID", msg.GatewayID).Debug("Not injecting into status: fetch of public Gateway information pending")
 		}
-		msg.Message.Platform = strings.Join(platform, " ")
 	}
 
-	if msg.Message.Description == "" && info.Attributes.Description != nil {
-		msg.Message.Description = *info.Attributes.Description
+	previous := msg.Message.Location
+	cached, rejected := p.checkedLocation(info)
+	if rejected != "" && missingLocation(msg.Message.Location) {
+		invalidLocations.WithLabelValues(rejected).Inc()
+		p.log.WithField("GatewayID", msg.GatewayID).WithField("Reason", rejected).Debug("Not injecting invalid location into status")
+	}
+	p.observeConflict(msg.GatewayID, FieldLocation, msg.Message.Location, cached)
+	if location, ok := p.injectLocation(msg.GatewayID, msg.Message.Location, cached); ok {
+		msg.Message.Location = location
 	}
+	observeInjection(FieldLocation, !missingLocation(previous), hasAntennaLocation(info), injectedCoordinates(previous, msg.Message.Location))
+
+	p.injectString(msg.GatewayID, FieldFrequencyPlan, &msg.Message.FrequencyPlan, info.FrequencyPlan)
+	p.injectString(msg.GatewayID, FieldPlatform, &msg.Message.Platform, platform(info))
+	p.injectString(msg.GatewayID, FieldDescription, &msg.Message.Description, description(info))
+
+	p.injectAttributes(msg, info)
+
+	p.overrideStatus(msg)
+	p.tagStatus(msg)
 
 	return nil
 }
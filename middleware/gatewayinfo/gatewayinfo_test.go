@@ -4,15 +4,33 @@
 package gatewayinfo
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/TheThingsNetwork/api/gateway"
+	"github.com/TheThingsNetwork/api/router"
 	"github.com/TheThingsNetwork/gateway-connector-bridge/middleware"
 	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
 	"github.com/TheThingsNetwork/go-account-lib/account"
+	"github.com/TheThingsNetwork/go-account-lib/util"
+	"github.com/TheThingsNetwork/go-utils/backoff"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	. "github.com/smartystreets/goconvey/convey"
 	redis "gopkg.in/redis.v5"
 )
@@ -29,133 +47,2611 @@ func getRedisClient() *redis.Client {
 	})
 }
 
+func newPublic() *Public {
+	p, err := NewPublic("https://account.thethingsnetwork.org")
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+func TestNewPublic(t *testing.T) {
+	Convey("When creating a Public GatewayInfo", t, func(c C) {
+		Convey("A valid account server should be accepted", func() {
+			p, err := NewPublic("https://account.thethingsnetwork.org/")
+			So(err, ShouldBeNil)
+			So(p.accountServer(), ShouldEqual, "https://account.thethingsnetwork.org")
+			p.Close()
+		})
+		Convey("An account server without scheme should be rejected", func() {
+			_, err := NewPublic("account.thethingsnetwork.org")
+			So(errors.Is(err, ErrInvalidAccountServer), ShouldBeTrue)
+		})
+		Convey("An account server with another scheme should be rejected", func() {
+			_, err := NewPublic("ftp://account.thethingsnetwork.org")
+			So(errors.Is(err, ErrInvalidAccountServer), ShouldBeTrue)
+		})
+		Convey("An account server without host should be rejected", func() {
+			_, err := NewPublic("https://")
+			So(errors.Is(err, ErrInvalidAccountServer), ShouldBeTrue)
+		})
+	})
+
+	Convey("Given an account server with a private CA", t, func(c C) {
+		server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/api/v2/gateways/dev" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(account.Gateway{ID: "dev", FrequencyPlan: "EU_868"})
+		}))
+		Reset(server.Close)
+
+		p, err := NewPublic(server.URL)
+		So(err, ShouldBeNil)
+		Reset(p.Close)
+
+		Convey("When fetching without the CA", func() {
+			err := p.Refresh("dev")
+			Convey("There should be an error", func() {
+				So(errors.Is(err, ErrAccountUnavailable), ShouldBeTrue)
+			})
+		})
+
+		Convey("When fetching with the CA", func() {
+			roots := x509.NewCertPool()
+			roots.AddCert(server.Certificate())
+			p.WithTLSConfig(&tls.Config{RootCAs: roots})
+			err := p.Refresh("dev")
+			Convey("There should be no error", func() {
+				So(err, ShouldBeNil)
+				So(p.FrequencyPlan("dev"), ShouldEqual, "EU_868")
+			})
+			Convey("Unknown gateways should not be found", func() {
+				So(errors.Is(p.Refresh("other"), ErrGatewayNotFound), ShouldBeTrue)
+			})
+		})
+	})
+}
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestHTTPClient(t *testing.T) {
+	Convey("Given an account server", t, func(c C) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			json.NewEncoder(w).Encode(account.Gateway{ID: "dev", FrequencyPlan: "EU_868"})
+		}))
+		Reset(server.Close)
+
+		Convey("The default HTTP client should have a pooled transport and a timeout", func() {
+			p, err := NewPublic(server.URL)
+			So(err, ShouldBeNil)
+			defer p.Close()
+			client := p.httpClient()
+			So(client, ShouldNotEqual, http.DefaultClient)
+			So(client.Timeout, ShouldEqual, DefaultHTTPTimeout)
+			So(client.Transport.(*http.Transport).MaxIdleConnsPerHost, ShouldEqual, DefaultMaxIdleConnsPerHost)
+		})
+
+		Convey("When using a custom HTTP client", func() {
+			var requests int32
+			p, err := NewPublic(server.URL)
+			So(err, ShouldBeNil)
+			defer p.Close()
+			p.WithHTTPClient(&http.Client{Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				atomic.AddInt32(&requests, 1)
+				return http.DefaultTransport.RoundTrip(req)
+			})})
+			So(p.Refresh("dev"), ShouldBeNil)
+			So(atomic.LoadInt32(&requests), ShouldEqual, 1)
+			So(p.FrequencyPlan("dev"), ShouldEqual, "EU_868")
+		})
+
+		Convey("When using a proxy", func() {
+			var proxied string
+			proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				proxied = r.URL.String()
+				json.NewEncoder(w).Encode(account.Gateway{ID: "dev", FrequencyPlan: "US_915"})
+			}))
+			defer proxy.Close()
+			client, err := NewHTTPClient(HTTPClientConfig{Proxy: proxy.URL, Timeout: time.Second})
+			So(err, ShouldBeNil)
+			So(client.Timeout, ShouldEqual, time.Second)
+			p, err := NewPublic("http://account.example.com")
+			So(err, ShouldBeNil)
+			defer p.Close()
+			p.WithHTTPClient(client)
+			So(p.Refresh("dev"), ShouldBeNil)
+			So(proxied, ShouldEqual, "http://account.example.com/api/v2/gateways/dev")
+			So(p.FrequencyPlan("dev"), ShouldEqual, "US_915")
+
+			Convey("A TLS configuration should keep the proxy and timeout", func() {
+				p.WithTLSConfig(&tls.Config{})
+				So(p.httpClient().Timeout, ShouldEqual, time.Second)
+				So(p.httpClient().Transport.(*http.Transport).TLSClientConfig, ShouldNotBeNil)
+				proxied = ""
+				So(p.Refresh("dev"), ShouldBeNil)
+				So(proxied, ShouldNotBeEmpty)
+			})
+		})
+
+		Convey("An invalid proxy should be rejected", func() {
+			_, err := NewHTTPClient(HTTPClientConfig{Proxy: "proxy:3128"})
+			So(errors.Is(err, ErrInvalidProxy), ShouldBeTrue)
+		})
+	})
+}
+
+type fetcherFunc func(gatewayID string) (account.Gateway, error)
+
+func (f fetcherFunc) FindGateway(gatewayID string) (account.Gateway, error) { return f(gatewayID) }
+
+func TestNetworks(t *testing.T) {
+	Convey("Given a Public GatewayInfo with a fetcher per network", t, func(c C) {
+		p := newPublic()
+		Reset(p.Close)
+		for _, network := range []string{"red", "blue"} {
+			network := network
+			p.WithNetworkFetcher(network, fetcherFunc(func(gatewayID string) (account.Gateway, error) {
+				return account.Gateway{ID: gatewayID, FrequencyPlan: network}, nil
+			}))
+		}
+
+		Convey("When a gateway connects in a network", func() {
+			p.HandleConnect(middleware.NewContext(), &types.ConnectMessage{GatewayID: "dev", Network: "red"})
+			So(p.Refresh("dev"), ShouldBeNil)
+			Convey("Its information should be fetched from that network", func() {
+				So(p.FrequencyPlan("dev"), ShouldEqual, "red")
+				So(p.entries(), ShouldContainKey, "red/dev")
+			})
+
+			Convey("When it reconnects in another network", func() {
+				p.HandleConnect(middleware.NewContext(), &types.ConnectMessage{GatewayID: "dev", Network: "blue"})
+				So(p.Refresh("dev"), ShouldBeNil)
+				Convey("The information of the networks should not collide", func() {
+					So(p.FrequencyPlan("dev"), ShouldEqual, "blue")
+					So(p.entry("red/dev").gateway.FrequencyPlan, ShouldEqual, "red")
+				})
+			})
+		})
+
+		Convey("Cache keys should be split into network and gateway ID", func() {
+			network, gatewayID := splitKey("red/dev")
+			So(network, ShouldEqual, "red")
+			So(gatewayID, ShouldEqual, "dev")
+			network, gatewayID = splitKey("dev")
+			So(network, ShouldBeEmpty)
+			So(gatewayID, ShouldEqual, "dev")
+		})
+	})
+}
+
+func TestLookupKeyFunc(t *testing.T) {
+	Convey("Given a Public GatewayInfo with a lookup key function", t, func(c C) {
+		p := newPublic()
+		Reset(p.Close)
+		var looked []string
+		p.setAccountFetcher(fetcherFunc(func(gatewayID string) (account.Gateway, error) {
+			looked = append(looked, gatewayID)
+			return account.Gateway{ID: gatewayID, AntennaLocation: &account.Location{Latitude: 52, Longitude: 4}}, nil
+		}))
+		p.WithLookupKeyFunc(func(gatewayID string) string {
+			return strings.ToLower(strings.TrimPrefix(gatewayID, "ns1."))
+		})
+
+		Convey("When a gateway is refreshed", func() {
+			So(p.Refresh("ns1.DEV"), ShouldBeNil)
+			Convey("It should be looked up with the transformed key", func() {
+				So(looked, ShouldResemble, []string{"dev"})
+			})
+			Convey("It should be cached under the original gateway ID", func() {
+				So(p.entries(), ShouldContainKey, "ns1.DEV")
+				So(p.entries(), ShouldNotContainKey, "dev")
+			})
+
+			Convey("Uplinks should keep the original gateway ID and trace the lookup key", func() {
+				msg := &types.UplinkMessage{GatewayID: "ns1.DEV", Message: &router.UplinkMessage{}}
+				So(p.HandleUplink(middleware.NewContext(), msg), ShouldBeNil)
+				So(msg.GatewayID, ShouldEqual, "ns1.DEV")
+				So(msg.Message.GatewayMetadata.Location, ShouldNotBeNil)
+				So(msg.Message.Trace.Event, ShouldEqual, injectEvent)
+				So(msg.Message.Trace.Parents, ShouldHaveLength, 1)
+				So(msg.Message.Trace.Parents[0].Event, ShouldEqual, lookupKeyEvent)
+				So(msg.Message.Trace.Parents[0].Metadata["key"], ShouldEqual, "dev")
+			})
+		})
+	})
+}
+
+func TestChangeHandler(t *testing.T) {
+	Convey("Given a Public GatewayInfo with a change channel", t, func(c C) {
+		p := newPublic()
+		Reset(p.Close)
+		changes, handler := ChangeChannel(10)
+		p.WithChangeHandler(handler)
+		p.set("dev", account.Gateway{ID: "dev", FrequencyPlan: "EU_863_870", AntennaLocation: &account.Location{Latitude: 52, Longitude: 4}})
+
+		Convey("No change should be emitted for the first fetch", func() {
+			So(changes, ShouldBeEmpty)
+		})
+
+		Convey("When the gateway information is refreshed without changes", func() {
+			p.set("dev", account.Gateway{ID: "dev", FrequencyPlan: "EU_863_870"})
+			Convey("No change should be emitted", func() {
+				So(changes, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When the gateway moved", func() {
+			p.set("dev", account.Gateway{ID: "dev", FrequencyPlan: "EU_863_870", AntennaLocation: &account.Location{Latitude: 53, Longitude: 5}})
+			Convey("The old and new location should be emitted", func() {
+				So(changes, ShouldHaveLength, 1)
+				change := <-changes
+				So(change.GatewayID, ShouldEqual, "dev")
+				So(change.Fields, ShouldHaveLength, 1)
+				So(change.Fields[FieldLocation].Old.(*gateway.LocationMetadata).Latitude, ShouldEqual, 52)
+				So(change.Fields[FieldLocation].New.(*gateway.LocationMetadata).Latitude, ShouldEqual, 53)
+			})
+		})
+
+		Convey("When a field is set", func() {
+			description := "rooftop"
+			p.set("dev", account.Gateway{ID: "dev", Attributes: account.GatewayAttributes{Description: &description}})
+			Convey("It should be emitted with a nil old value", func() {
+				So(changes, ShouldHaveLength, 1)
+				change := <-changes
+				So(change.Fields[FieldDescription], ShouldResemble, FieldChange{New: "rooftop"})
+			})
+		})
+	})
+}
+
+func TestMinFetchInterval(t *testing.T) {
+	Convey("Given a Public GatewayInfo with a minimum fetch interval", t, func(c C) {
+		p := newPublic().WithMinFetchInterval(time.Hour)
+		Reset(p.Close)
+		var fetches int32
+		p.setAccountFetcher(fetcherFunc(func(gatewayID string) (account.Gateway, error) {
+			atomic.AddInt32(&fetches, 1)
+			if gatewayID == "unknown" {
+				return account.Gateway{}, ErrGatewayNotFound
+			}
+			return account.Gateway{ID: gatewayID, FrequencyPlan: "EU_863_870"}, nil
+		}))
+
+		Convey("When a gateway is refreshed twice", func() {
+			So(p.Refresh("dev"), ShouldBeNil)
+			So(p.Refresh("dev"), ShouldBeNil)
+			Convey("It should only be fetched once", func() {
+				So(atomic.LoadInt32(&fetches), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When a gateway that is not found is refreshed twice", func() {
+			So(errors.Is(p.Refresh("unknown"), ErrGatewayNotFound), ShouldBeTrue)
+			Convey("The cached error should be returned", func() {
+				So(errors.Is(p.Refresh("unknown"), ErrGatewayNotFound), ShouldBeTrue)
+				So(atomic.LoadInt32(&fetches), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When a gateway disconnects and reconnects", func() {
+			So(p.Refresh("dev"), ShouldBeNil)
+			p.HandleDisconnect(middleware.NewContext(), &types.DisconnectMessage{GatewayID: "dev"})
+			Convey("Its information should be kept", func() {
+				So(p.entry("dev"), ShouldNotBeNil)
+			})
+			p.HandleConnect(middleware.NewContext(), &types.ConnectMessage{GatewayID: "dev"})
+			Convey("It should not be fetched again", func() {
+				time.Sleep(10 * time.Millisecond)
+				So(atomic.LoadInt32(&fetches), ShouldEqual, 1)
+				So(p.FrequencyPlan("dev"), ShouldEqual, "EU_863_870")
+			})
+		})
+	})
+}
+
+func TestConflictReporting(t *testing.T) {
+	Convey("Given a Public GatewayInfo with conflict reporting", t, func(c C) {
+		p := newPublic().WithUplinkInjection(true).WithStatusInjection(true).WithConflictReporting(true)
+		Reset(p.Close)
+		p.set("dev", account.Gateway{ID: "dev", FrequencyPlan: "EU_863_870", AntennaLocation: &account.Location{Latitude: 52, Longitude: 4}})
+		uplink := func(latitude, longitude float32) *types.UplinkMessage {
+			msg := &types.UplinkMessage{GatewayID: "dev", Message: &router.UplinkMessage{}}
+			msg.Message.GatewayMetadata.Location = &gateway.LocationMetadata{Latitude: latitude, Longitude: longitude, Source: gateway.LocationMetadata_GPS}
+			So(p.HandleUplink(middleware.NewContext(), msg), ShouldBeNil)
+			return msg
+		}
+
+		Convey("When an uplink has a different location", func() {
+			before := counterValue(conflicts.WithLabelValues(string(FieldLocation)))
+			msg := uplink(48.85, 2.35)
+			Convey("The conflict should be traced and counted", func() {
+				So(msg.Message.Trace, ShouldNotBeNil)
+				So(msg.Message.Trace.Event, ShouldEqual, conflictEvent)
+				So(msg.Message.Trace.Metadata["message"], ShouldEqual, "48.85000,2.35000")
+				So(msg.Message.Trace.Metadata["cached"], ShouldEqual, "52.00000,4.00000")
+				So(counterValue(conflicts.WithLabelValues(string(FieldLocation)))-before, ShouldEqual, 1)
+			})
+			Convey("The location should not be overridden", func() {
+				So(msg.Message.GatewayMetadata.Location.Latitude, ShouldEqual, float32(48.85))
+			})
+		})
+
+		Convey("When an uplink has a location close to the registered location", func() {
+			msg := uplink(52.0001, 4.0001)
+			Convey("No conflict should be reported", func() {
+				So(msg.Message.Trace, ShouldBeNil)
+			})
+		})
+
+		Convey("When a status has a different frequency plan", func() {
+			before := counterValue(conflicts.WithLabelValues(string(FieldFrequencyPlan)))
+			status := &types.StatusMessage{GatewayID: "dev", Message: &gateway.Status{FrequencyPlan: "US_902_928"}}
+			So(p.HandleStatus(middleware.NewContext(), status), ShouldBeNil)
+			Convey("The conflict should be counted and the frequency plan should not be overridden", func() {
+				So(counterValue(conflicts.WithLabelValues(string(FieldFrequencyPlan)))-before, ShouldEqual, 1)
+				So(status.Message.FrequencyPlan, ShouldEqual, "US_902_928")
+			})
+		})
+	})
+}
+
+func TestTokenFile(t *testing.T) {
+	Convey("Given an account server and a token file", t, func(c C) {
+		var mu sync.Mutex
+		var authorization string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			authorization = r.Header.Get("Authorization")
+			mu.Unlock()
+			json.NewEncoder(w).Encode(account.Gateway{ID: "dev"})
+		}))
+		Reset(server.Close)
+		lastAuthorization := func() string {
+			mu.Lock()
+			defer mu.Unlock()
+			return authorization
+		}
+
+		dir, err := ioutil.TempDir("", "gatewayinfo")
+		So(err, ShouldBeNil)
+		Reset(func() { os.RemoveAll(dir) })
+		path := filepath.Join(dir, "token")
+		So(ioutil.WriteFile(path, []byte("first\n"), 0600), ShouldBeNil)
+
+		p, err := NewPublic(server.URL)
+		So(err, ShouldBeNil)
+		Reset(p.Close)
+
+		Convey("When the token file does not exist", func() {
+			_, err := p.WithTokenFile(filepath.Join(dir, "missing"))
+			Convey("There should be an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When using the token file", func() {
+			_, err := p.WithTokenFile(path)
+			So(err, ShouldBeNil)
+			So(p.Refresh("dev"), ShouldBeNil)
+
+			Convey("The token should be sent to the account server", func() {
+				So(lastAuthorization(), ShouldEqual, "Bearer first")
+			})
+
+			Convey("When the token is rotated", func() {
+				So(ioutil.WriteFile(path+".new", []byte("second"), 0600), ShouldBeNil)
+				So(os.Rename(path+".new", path), ShouldBeNil)
+				time.Sleep(50 * time.Millisecond)
+				So(p.Refresh("dev"), ShouldBeNil)
+				Convey("The new token should be sent to the account server", func() {
+					So(lastAuthorization(), ShouldEqual, "Bearer second")
+				})
+			})
+
+			Convey("When the token file is emptied", func() {
+				So(ioutil.WriteFile(path, nil, 0600), ShouldBeNil)
+				time.Sleep(50 * time.Millisecond)
+				So(p.Refresh("dev"), ShouldBeNil)
+				Convey("The last token should be kept", func() {
+					So(lastAuthorization(), ShouldEqual, "Bearer first")
+				})
+			})
+		})
+	})
+}
+
+func TestRegionalAccountServer(t *testing.T) {
+	Convey("Given a default and regional account servers", t, func(c C) {
+		var mu sync.Mutex
+		hits := make(map[string]int)
+		newServer := func(name string) *httptest.Server {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				hits[name]++
+				mu.Unlock()
+				json.NewEncoder(w).Encode(account.Gateway{ID: strings.TrimPrefix(r.URL.Path, "/api/v2/gateways/")})
+			}))
+			Reset(server.Close)
+			return server
+		}
+		hitsOf := func(name string) int {
+			mu.Lock()
+			defer mu.Unlock()
+			return hits[name]
+		}
+		def, eu, euWest := newServer("default"), newServer("eu"), newServer("eu-west")
+
+		p, err := NewPublic(def.URL)
+		So(err, ShouldBeNil)
+		Reset(p.Close)
+		_, err = p.WithRegionalAccountServer("eu-", eu.URL, time.Hour, 1)
+		So(err, ShouldBeNil)
+		_, err = p.WithRegionalAccountServer("eu-west-", euWest.URL, time.Hour, 10)
+		So(err, ShouldBeNil)
+
+		Convey("An invalid regional account server should be rejected", func() {
+			_, err := p.WithRegionalAccountServer("us-", "ftp://account.thethingsnetwork.org", time.Hour, 1)
+			So(errors.Is(err, ErrInvalidAccountServer), ShouldBeTrue)
+		})
+
+		Convey("When fetching gateways", func() {
+			So(p.Refresh("eu-dev"), ShouldBeNil)
+			So(p.Refresh("EU-WEST-dev"), ShouldBeNil)
+			So(p.Refresh("us-dev"), ShouldBeNil)
+			Convey("They should be fetched from the account server with the longest matching prefix", func() {
+				So(hitsOf("eu"), ShouldEqual, 1)
+				So(hitsOf("eu-west"), ShouldEqual, 1)
+				So(hitsOf("default"), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When the rate limit of a region is exhausted", func() {
+			p.WithFetchQueueBound(0)
+			So(p.Refresh("eu-dev"), ShouldBeNil)
+			Convey("Fetches of the region should be limited", func() {
+				So(p.fetchWith("eu-other", true), ShouldEqual, ErrFetchQueueFull)
+			})
+			Convey("Fetches of other regions should not be limited", func() {
+				So(p.fetchWith("eu-west-other", true), ShouldBeNil)
+				So(p.fetchWith("other", true), ShouldBeNil)
+			})
+		})
+
+		Convey("When a gateway has a network with a Fetcher", func() {
+			p.WithNetworkFetcher("private", fetcherFunc(func(gatewayID string) (account.Gateway, error) {
+				return account.Gateway{ID: gatewayID}, nil
+			}))
+			p.setNetwork("eu-dev", "private")
+			So(p.Refresh("eu-dev"), ShouldBeNil)
+			Convey("It should not be fetched from the regional account server", func() {
+				So(hitsOf("eu"), ShouldEqual, 0)
+			})
+		})
+	})
+}
+
+func TestResponseTracing(t *testing.T) {
+	Convey("Given a gateway information middleware that traces the responses of a gateway", t, func(c C) {
+		p := newPublic()
+		p.setAccountFetcher(fetcherFunc(func(gatewayID string) (account.Gateway, error) {
+			return account.Gateway{ID: gatewayID, FrequencyPlan: "EU_863_870", AntennaLocation: &account.Location{Latitude: 52, Longitude: 4}}, nil
+		}))
+		p.WithResponseTracing([]string{"dev"})
+
+		Convey("When the gateway is refreshed", func() {
+			So(p.Refresh("dev"), ShouldBeNil)
+			msg := &types.UplinkMessage{GatewayID: "dev", Message: &router.UplinkMessage{}}
+			So(p.HandleUplink(middleware.NewContext(), msg), ShouldBeNil)
+			Convey("The next uplink should trace the response", func() {
+				So(msg.Message.Trace.Event, ShouldEqual, injectEvent)
+				So(msg.Message.Trace.Parents, ShouldHaveLength, 1)
+				response := msg.Message.Trace.Parents[0]
+				So(response.Event, ShouldEqual, responseEvent)
+				So(response.Metadata["id"], ShouldEqual, "dev")
+				So(response.Metadata["frequency_plan"], ShouldEqual, "EU_863_870")
+				So(response.Metadata["location"], ShouldEqual, "52.00000,4.00000")
+			})
+			Convey("Later uplinks should not trace the response again", func() {
+				msg := &types.UplinkMessage{GatewayID: "dev", Message: &router.UplinkMessage{}}
+				So(p.HandleUplink(middleware.NewContext(), msg), ShouldBeNil)
+				So(msg.Message.Trace.Event, ShouldEqual, injectEvent)
+				So(msg.Message.Trace.Parents, ShouldBeEmpty)
+			})
+		})
+
+		Convey("When another gateway is refreshed", func() {
+			So(p.Refresh("other"), ShouldBeNil)
+			msg := &types.UplinkMessage{GatewayID: "other", Message: &router.UplinkMessage{}}
+			So(p.HandleUplink(middleware.NewContext(), msg), ShouldBeNil)
+			Convey("Its response should not be traced", func() {
+				So(msg.Message.Trace.Event, ShouldEqual, injectEvent)
+				So(msg.Message.Trace.Parents, ShouldBeEmpty)
+			})
+		})
+	})
+}
+
+func TestReconfigure(t *testing.T) {
+	Convey("Given a gateway information middleware and two account servers", t, func(c C) {
+		var mu sync.Mutex
+		hits := make(map[string]int)
+		entered, release := make(chan struct{}, 1), make(chan struct{})
+		newServer := func(name string, block bool) *httptest.Server {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				hits[name]++
+				mu.Unlock()
+				if block {
+					entered <- struct{}{}
+					<-release
+				}
+				json.NewEncoder(w).Encode(account.Gateway{ID: "dev"})
+			}))
+			Reset(server.Close)
+			return server
+		}
+		hitsOf := func(name string) int {
+			mu.Lock()
+			defer mu.Unlock()
+			return hits[name]
+		}
+		old, next := newServer("old", true), newServer("new", false)
+
+		p, err := NewPublic(old.URL)
+		So(err, ShouldBeNil)
+		Reset(p.Close)
+
+		Convey("An invalid account server should be rejected", func() {
+			err := p.Reconfigure("ftp://account.thethingsnetwork.org")
+			So(errors.Is(err, ErrInvalidAccountServer), ShouldBeTrue)
+			So(p.accountServer(), ShouldEqual, old.URL)
+		})
+
+		Convey("When the account server is reconfigured during a fetch", func() {
+			done := make(chan error)
+			go func() { done <- p.Refresh("dev") }()
+			<-entered
+			So(p.Reconfigure(next.URL), ShouldBeNil)
+			close(release)
+			Convey("The fetch in progress should complete against the previous account server", func() {
+				So(<-done, ShouldBeNil)
+				So(hitsOf("old"), ShouldEqual, 1)
+				So(hitsOf("new"), ShouldEqual, 0)
+			})
+			Convey("Later fetches should use the new account server", func() {
+				So(<-done, ShouldBeNil)
+				So(p.Refresh("dev"), ShouldBeNil)
+				So(hitsOf("new"), ShouldEqual, 1)
+				So(p.accountServer(), ShouldEqual, next.URL)
+			})
+		})
+	})
+}
+
+func TestRegionalParameters(t *testing.T) {
+	Convey("Given a Public GatewayInfo with gateways with frequency plans", t, func(c C) {
+		p := newPublic()
+		Reset(p.Close)
+		p.setAccountFetcher(fetcherFunc(func(gatewayID string) (account.Gateway, error) {
+			plans := map[string]string{"eu": "EU_863_870", "as": "AS_920_923", "unknown": "XX_123"}
+			return account.Gateway{ID: gatewayID, FrequencyPlan: plans[gatewayID]}, nil
+		}))
+		for _, gatewayID := range []string{"eu", "as", "unknown"} {
+			So(p.Refresh(gatewayID), ShouldBeNil)
+		}
+
+		Convey("The regional parameters should be resolved from the frequency plan", func() {
+			params, ok := p.RegionalParameters("eu")
+			So(ok, ShouldBeTrue)
+			So(params.Band, ShouldEqual, "EU_863_870")
+			So(params.UplinkChannels, ShouldResemble, []int{868100000, 868300000, 868500000})
+			So(params.RX2Frequency, ShouldEqual, 869525000)
+			So(params.RX2DataRate, ShouldEqual, "SF9BW125")
+			So(params.DataRates[0], ShouldEqual, "SF12BW125")
+			So(params.DataRates[7], ShouldEqual, "FSK50000")
+		})
+
+		Convey("Frequency plans of the account server should be mapped to their band", func() {
+			params, ok := p.RegionalParameters("as")
+			So(ok, ShouldBeTrue)
+			So(params.Band, ShouldEqual, "AS_923")
+		})
+
+		Convey("The resolution should be cached", func() {
+			first, _ := p.RegionalParameters("eu")
+			second, _ := p.RegionalParameters("eu")
+			So(second, ShouldEqual, first)
+		})
+
+		Convey("Unknown frequency plans should have no regional parameters", func() {
+			_, ok := p.RegionalParameters("unknown")
+			So(ok, ShouldBeFalse)
+			_, ok = p.RegionalParameters("missing")
+			So(ok, ShouldBeFalse)
+		})
+
+		Convey("Unknown regional parameters should not be injected", func() {
+			_, err := p.WithInjectRegionalParameters([]string{"channels"})
+			So(errors.Is(err, ErrUnknownRegionalParameter), ShouldBeTrue)
+		})
+
+		Convey("When sending StatusMessages with regional parameter injection", func() {
+			_, err := p.WithInjectRegionalParameters([]string{RegionalRX2Frequency, RegionalUplinkChannels})
+			So(err, ShouldBeNil)
+			status := &types.StatusMessage{GatewayID: "eu", Message: &gateway.Status{}}
+			p.HandleStatus(middleware.NewContext(), status)
+			unknown := &types.StatusMessage{GatewayID: "unknown", Message: &gateway.Status{}}
+			p.HandleStatus(middleware.NewContext(), unknown)
+			Convey("The selected regional parameters should be set", func() {
+				So(status.Attributes, ShouldResemble, map[string]string{
+					RegionalAttributePrefix + RegionalRX2Frequency:   "869525000",
+					RegionalAttributePrefix + RegionalUplinkChannels: "868100000,868300000,868500000",
+				})
+				So(unknown.Attributes, ShouldBeEmpty)
+			})
+		})
+	})
+}
+
+func TestLookup(t *testing.T) {
+	Convey("Given a Public GatewayInfo with an expire", t, func(c C) {
+		p := newPublic().WithExpire(time.Hour)
+		Reset(p.Close)
+		p.set("fresh", account.Gateway{ID: "fresh"})
+		p.set("stale", account.Gateway{ID: "stale"})
+		p.shard("stale").info["stale"].fetched = time.Now().Add(-2 * time.Hour)
+		p.setErr("errored", ErrGatewayNotFound)
+
+		Convey("The freshness of cached gateway information should be returned", func() {
+			info, freshness, err := p.Lookup("fresh")
+			So(err, ShouldBeNil)
+			So(freshness, ShouldEqual, Fresh)
+			So(info.ID, ShouldEqual, "fresh")
+
+			info, freshness, err = p.Lookup("stale")
+			So(err, ShouldBeNil)
+			So(freshness, ShouldEqual, Stale)
+			So(info.ID, ShouldEqual, "stale")
+
+			_, freshness, err = p.Lookup("errored")
+			So(err, ShouldEqual, ErrGatewayNotFound)
+			So(freshness, ShouldEqual, Errored)
+
+			_, freshness, err = p.Lookup("missing")
+			So(err, ShouldBeNil)
+			So(freshness, ShouldEqual, Missing)
+			So(freshness.String(), ShouldEqual, "missing")
+		})
+
+		Convey("Lookups should not change the cache", func() {
+			updated := p.entries()["stale"].lastUpdated
+			p.Lookup("missing")
+			p.Lookup("stale")
+			So(p.entries(), ShouldNotContainKey, "missing")
+			So(p.entries()["stale"].lastUpdated, ShouldEqual, updated)
+			So(pending(p, "missing"), ShouldBeFalse)
+		})
+	})
+}
+
+func TestAttributeMapping(t *testing.T) {
+	Convey("Given a Public GatewayInfo with a gateway with attributes", t, func(c C) {
+		p := newPublic()
+		Reset(p.Close)
+		placement, antennaType := account.Outdoor, "omni"
+		p.set("dev", account.Gateway{ID: "dev", Attributes: account.GatewayAttributes{Placement: &placement, AntennaType: &antennaType}})
+
+		Convey("Unknown account attributes should be rejected", func() {
+			_, err := p.WithAttributeMapping(map[string]string{"site_id": "site"})
+			So(errors.Is(err, ErrUnknownAccountAttribute), ShouldBeTrue)
+		})
+
+		Convey("When sending StatusMessages with an attribute mapping", func() {
+			_, err := p.WithAttributeMapping(map[string]string{"placement": "site_placement", "antenna_type": "antenna", "model": "model"})
+			So(err, ShouldBeNil)
+			status := &types.StatusMessage{GatewayID: "dev", Message: &gateway.Status{}, Attributes: map[string]string{"antenna": "sector"}}
+			p.HandleStatus(middleware.NewContext(), status)
+			Convey("The mapped attributes should be set if they are absent", func() {
+				So(status.Attributes, ShouldResemble, map[string]string{"site_placement": "outdoor", "antenna": "sector"})
+			})
+		})
+	})
+}
+
+func TestReadPathRefresh(t *testing.T) {
+	Convey("Given a Public GatewayInfo without refreshes on the read path", t, func(c C) {
+		p := newPublic().WithExpire(time.Minute).WithReadPathRefresh(false)
+		Reset(p.Close)
+		var fetches int32
+		p.setAccountFetcher(fetcherFunc(func(gatewayID string) (account.Gateway, error) {
+			atomic.AddInt32(&fetches, 1)
+			return account.Gateway{ID: gatewayID, AntennaLocation: &account.Location{Latitude: 52, Longitude: 4}}, nil
+		}))
+		p.set("dev", account.Gateway{ID: "dev", AntennaLocation: &account.Location{Latitude: 52, Longitude: 4}})
+		p.shard("dev").info["dev"].lastUpdated = time.Now().Add(-time.Hour)
+		uplink := func(gatewayID string) *types.UplinkMessage {
+			msg := &types.UplinkMessage{GatewayID: gatewayID, Message: &router.UplinkMessage{}}
+			So(p.HandleUplink(middleware.NewContext(), msg), ShouldBeNil)
+			return msg
+		}
+
+		Convey("When uplinks are received", func() {
+			expired, missing := uplink("dev"), uplink("other")
+			time.Sleep(10 * time.Millisecond)
+			Convey("Expired information should be injected without fetching", func() {
+				So(expired.Message.GatewayMetadata.Location, ShouldNotBeNil)
+				So(missing.Message.GatewayMetadata.Location, ShouldBeNil)
+				So(atomic.LoadInt32(&fetches), ShouldEqual, 0)
+				So(pending(p, "other"), ShouldBeFalse)
+			})
+		})
+
+		Convey("When a gateway connects", func() {
+			So(p.HandleConnect(middleware.NewContext(), &types.ConnectMessage{GatewayID: "other"}), ShouldBeNil)
+			for deadline := time.Now().Add(time.Second); atomic.LoadInt32(&fetches) == 0 && time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+			}
+			Convey("It should be fetched", func() {
+				So(atomic.LoadInt32(&fetches), ShouldEqual, 1)
+			})
+		})
+	})
+}
+
+func TestTenantRateLimit(t *testing.T) {
+	Convey("Given a Public GatewayInfo with a rate limit per tenant", t, func(c C) {
+		p := newPublic().WithTenantRateLimit(time.Hour, 1)
+		Reset(p.Close)
+		for _, network := range []string{"red", "blue"} {
+			p.WithNetworkFetcher(network, fetcherFunc(func(gatewayID string) (account.Gateway, error) {
+				return account.Gateway{ID: gatewayID}, nil
+			}))
+		}
+
+		Convey("When a tenant used up its budget", func() {
+			So(p.fetch("red/dev-1"), ShouldBeNil)
+			before := counterValue(tenantRateLimited.WithLabelValues("red"))
+			fetched := make(chan error, 1)
+			go func() { fetched <- p.fetch("red/dev-2") }()
+
+			Convey("Its fetches should wait", func() {
+				select {
+				case <-fetched:
+					t.Error("fetch did not wait for the tenant rate limit")
+				case <-time.After(50 * time.Millisecond):
+				}
+				So(counterValue(tenantRateLimited.WithLabelValues("red"))-before, ShouldEqual, 1)
+			})
+
+			Convey("Other tenants should not be affected", func() {
+				So(p.fetch("blue/dev-1"), ShouldBeNil)
+				So(counterValue(tenantFetches.WithLabelValues("blue")), ShouldBeGreaterThanOrEqualTo, 1)
+			})
+		})
+	})
+}
+
+func TestFetchPriority(t *testing.T) {
+	Convey("Given a Public GatewayInfo with fetch priorities and no available requests", t, func(c C) {
+		interval := RequestInterval
+		RequestInterval = time.Hour
+		p := newPublic().WithFetchPriority(func(gatewayID string) int {
+			if strings.HasPrefix(gatewayID, "prod-") {
+				return 1
+			}
+			return 0
+		})
+		RequestInterval = interval
+		Reset(p.Close)
+		var mu sync.Mutex
+		var order []string
+		p.setAccountFetcher(fetcherFunc(func(gatewayID string) (account.Gateway, error) {
+			mu.Lock()
+			order = append(order, gatewayID)
+			mu.Unlock()
+			return account.Gateway{ID: gatewayID}, nil
+		}))
+		for i := 0; i < RequestBurst; i++ {
+			<-p.available
+		}
+		waiting := func(priority string) float64 {
+			var m dto.Metric
+			fetchPriorityQueue.WithLabelValues(priority).Write(&m)
+			return m.GetGauge().GetValue()
+		}
+
+		Convey("When fetches of gateways with different priorities wait for the rate limiter", func() {
+			var done sync.WaitGroup
+			for _, gatewayID := range []string{"test-1", "test-2", "prod-1", "prod-2"} {
+				done.Add(1)
+				go func(gatewayID string) {
+					defer done.Done()
+					c.So(p.Refresh(gatewayID), ShouldBeNil)
+				}(gatewayID)
+				// Start waiting one by one, so that the order within a priority is known
+				for deadline := time.Now().Add(time.Second); !p.tokenQueue.waiting() && time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			Convey("The queue depth per priority should be reported", func() {
+				So(waiting("0"), ShouldEqual, 2)
+				So(waiting("1"), ShouldEqual, 2)
+				for i := 0; i < 4; i++ {
+					p.available <- struct{}{}
+				}
+				done.Wait()
+			})
+
+			Convey("Higher priorities should acquire tokens first", func() {
+				for i := 0; i < 4; i++ {
+					p.available <- struct{}{}
+					time.Sleep(10 * time.Millisecond)
+				}
+				done.Wait()
+				So(order, ShouldResemble, []string{"prod-1", "prod-2", "test-1", "test-2"})
+				So(waiting("0"), ShouldEqual, 0)
+				So(waiting("1"), ShouldEqual, 0)
+			})
+		})
+	})
+}
+
+func TestFetchQueueBound(t *testing.T) {
+	Convey("Given a Public GatewayInfo with a bounded fetch queue and no available requests", t, func(c C) {
+		interval := RequestInterval
+		RequestInterval = time.Hour
+		p := newPublic().WithFetchQueueBound(1)
+		RequestInterval = interval
+		Reset(p.Close)
+		p.setAccountFetcher(fetcherFunc(func(gatewayID string) (account.Gateway, error) {
+			return account.Gateway{ID: gatewayID}, nil
+		}))
+		for i := 0; i < RequestBurst; i++ {
+			<-p.available
+		}
+		fetched := func(gatewayID string) bool {
+			s := p.shard(gatewayID)
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			info, ok := s.info[gatewayID]
+			return ok && info.gateway.ID == gatewayID
+		}
+		waitFor := func(condition func() bool) bool {
+			for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+				if condition() {
+					return true
+				}
+			}
+			return false
+		}
+
+		Convey("When more gateways connect than fit in the queue", func() {
+			before := counterValue(fetchQueueOverflows)
+			p.HandleConnect(middleware.NewContext(), &types.ConnectMessage{GatewayID: "dev-1"})
+			So(waitFor(func() bool { return len(p.fetchQueue) == 1 }), ShouldBeTrue)
+			p.HandleConnect(middleware.NewContext(), &types.ConnectMessage{GatewayID: "dev-2"})
+
+			Convey("The fetch that does not fit should be dropped", func() {
+				So(waitFor(func() bool { return counterValue(fetchQueueOverflows)-before == 1 }), ShouldBeTrue)
+			})
+
+			Convey("The queued fetch should be done when a request can be made", func() {
+				p.available <- struct{}{}
+				So(waitFor(func() bool { return fetched("dev-1") }), ShouldBeTrue)
+			})
+
+			Convey("The dropped gateway should be fetched on its next message", func() {
+				So(waitFor(func() bool { return counterValue(fetchQueueOverflows)-before == 1 }), ShouldBeTrue)
+				So(waitFor(func() bool { return !pending(p, "dev-2") }), ShouldBeTrue)
+				p.available <- struct{}{}
+				p.available <- struct{}{}
+				p.HandleUplink(middleware.NewContext(), &types.UplinkMessage{GatewayID: "dev-2", Message: &router.UplinkMessage{}})
+				So(waitFor(func() bool { return fetched("dev-2") }), ShouldBeTrue)
+			})
+		})
+
+		Convey("Refresh should wait for the rate limiter", func() {
+			p.WithFetchQueueBound(0)
+			refreshed := make(chan error, 1)
+			go func() { refreshed <- p.Refresh("dev-3") }()
+			p.available <- struct{}{}
+			So(<-refreshed, ShouldBeNil)
+		})
+	})
+}
+
+func pending(p *Public, gatewayID string) bool {
+	s := p.shard(gatewayID)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.pending[gatewayID]
+	return ok
+}
+
+func TestPendingFetch(t *testing.T) {
+	Convey("Given a Public GatewayInfo with a slow account server", t, func(c C) {
+		p := newPublic()
+		Reset(p.Close)
+		var fetches int32
+		release := make(chan struct{})
+		p.setAccountFetcher(fetcherFunc(func(gatewayID string) (account.Gateway, error) {
+			atomic.AddInt32(&fetches, 1)
+			<-release
+			return account.Gateway{ID: gatewayID, AntennaLocation: &account.Location{Latitude: 52, Longitude: 4}}, nil
+		}))
+		uplink := func() *types.UplinkMessage {
+			msg := &types.UplinkMessage{GatewayID: "dev", Message: &router.UplinkMessage{}}
+			So(p.HandleUplink(middleware.NewContext(), msg), ShouldBeNil)
+			return msg
+		}
+
+		Convey("When uplinks are received before the first fetch completed", func() {
+			before := counterValue(pendingInjections.WithLabelValues("uplink"))
+			first, second := uplink(), uplink()
+
+			Convey("They should not be injected and the pending state should be traced", func() {
+				for _, msg := range []*types.UplinkMessage{first, second} {
+					So(msg.Message.GatewayMetadata.Location, ShouldBeNil)
+					So(msg.Message.Trace, ShouldNotBeNil)
+					So(msg.Message.Trace.Event, ShouldEqual, skipInjectEvent)
+					So(msg.Message.Trace.Metadata["reason"], ShouldEqual, "fetch pending")
+				}
+				So(counterValue(pendingInjections.WithLabelValues("uplink"))-before, ShouldEqual, 2)
+				close(release)
+			})
+
+			Convey("When the fetch completes", func() {
+				close(release)
+				for deadline := time.Now().Add(time.Second); pending(p, "dev") && time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+				}
+				So(pending(p, "dev"), ShouldBeFalse)
+
+				Convey("Only one fetch should have been started", func() {
+					So(atomic.LoadInt32(&fetches), ShouldEqual, 1)
+				})
+
+				Convey("The next uplink should be injected", func() {
+					So(uplink().Message.GatewayMetadata.Location, ShouldNotBeNil)
+				})
+			})
+		})
+
+		Convey("When the first fetch does not complete within the fetch timeout", func() {
+			p.WithFetchTimeout(20 * time.Millisecond)
+			before := counterValue(expiredPendingFetches)
+			uplink()
+			So(pending(p, "dev"), ShouldBeTrue)
+			for deadline := time.Now().Add(time.Second); pending(p, "dev") && time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+			}
+			Reset(func() { close(release) })
+
+			Convey("The pending state should be removed", func() {
+				So(pending(p, "dev"), ShouldBeFalse)
+				So(counterValue(expiredPendingFetches)-before, ShouldEqual, 1)
+			})
+
+			Convey("The next uplink should start a new fetch", func() {
+				uplink()
+				for deadline := time.Now().Add(time.Second); atomic.LoadInt32(&fetches) < 2 && time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+				}
+				So(atomic.LoadInt32(&fetches), ShouldEqual, 2)
+			})
+		})
+	})
+}
+
+func TestLocationCheck(t *testing.T) {
+	Convey("When parsing bounding boxes", t, func(c C) {
+		box, err := ParseBoundingBox("35, -10, 72, 40")
+		So(err, ShouldBeNil)
+		So(box, ShouldResemble, BoundingBox{MinLatitude: 35, MinLongitude: -10, MaxLatitude: 72, MaxLongitude: 40})
+		for _, invalid := range []string{"", "35,-10,72", "a,b,c,d", "35,-10,95,40", "72,-10,35,40"} {
+			_, err := ParseBoundingBox(invalid)
+			So(err, ShouldEqual, ErrInvalidBoundingBox)
+		}
+	})
+
+	Convey("Bounding boxes that cross the antimeridian should contain both sides", t, func(c C) {
+		box := BoundingBox{MinLatitude: -50, MinLongitude: 160, MaxLatitude: -30, MaxLongitude: -170}
+		So(box.Contains(-40, 175), ShouldBeTrue)
+		So(box.Contains(-40, -175), ShouldBeTrue)
+		So(box.Contains(-40, 0), ShouldBeFalse)
+	})
+
+	Convey("Given a Public GatewayInfo with a location check and bounding box", t, func(c C) {
+		p := newPublic().WithLocationBounds(BoundingBox{MinLatitude: 35, MinLongitude: -10, MaxLatitude: 72, MaxLongitude: 40})
+		Reset(p.Close)
+		setLocation := func(gatewayID string, latitude, longitude float64) {
+			// Surveyed antennas have an altitude
+			p.shard(gatewayID).info[gatewayID] = &info{lastUpdated: time.Now(), gateway: account.Gateway{ID: gatewayID, AntennaLocation: &account.Location{Latitude: latitude, Longitude: longitude, Altitude: 10}}}
+		}
+		uplink := func(gatewayID string) *types.UplinkMessage {
+			msg := &types.UplinkMessage{GatewayID: gatewayID, Message: &router.UplinkMessage{}}
+			So(p.HandleUplink(middleware.NewContext(), msg), ShouldBeNil)
+			return msg
+		}
+
+		Convey("Valid locations should be injected", func() {
+			setLocation("dev", 52, 4)
+			So(uplink("dev").Message.GatewayMetadata.Location, ShouldNotBeNil)
+		})
+
+		Convey("Locations at 0,0 should not be injected", func() {
+			setLocation("dev", 0, 0)
+			before := counterValue(invalidLocations.WithLabelValues(locationZero))
+			msg := uplink("dev")
+			So(msg.Message.GatewayMetadata.Location, ShouldBeNil)
+			So(msg.Message.Trace, ShouldNotBeNil)
+			So(msg.Message.Trace.Event, ShouldEqual, skipInjectEvent)
+			So(msg.Message.Trace.Metadata["reason"], ShouldEqual, "invalid location: "+locationZero)
+			So(counterValue(invalidLocations.WithLabelValues(locationZero))-before, ShouldEqual, 1)
+		})
+
+		Convey("Locations out of range should not be injected", func() {
+			setLocation("dev", 120, 52)
+			So(uplink("dev").Message.GatewayMetadata.Location, ShouldBeNil)
+		})
+
+		Convey("Locations outside the bounding box should not be injected", func() {
+			setLocation("dev", -52, 4)
+			So(uplink("dev").Message.GatewayMetadata.Location, ShouldBeNil)
+			status := &types.StatusMessage{GatewayID: "dev", Message: &gateway.Status{}}
+			So(p.HandleStatus(middleware.NewContext(), status), ShouldBeNil)
+			So(status.Message.Location, ShouldBeNil)
+		})
+
+		Convey("Locations in the message should not be affected", func() {
+			setLocation("dev", 0, 0)
+			msg := &types.UplinkMessage{GatewayID: "dev", Message: &router.UplinkMessage{GatewayMetadata: gateway.RxMetadata{Location: &gateway.LocationMetadata{Latitude: 52, Longitude: 4}}}}
+			So(p.HandleUplink(middleware.NewContext(), msg), ShouldBeNil)
+			So(msg.Message.GatewayMetadata.Location.Latitude, ShouldEqual, 52)
+			So(msg.Message.Trace, ShouldBeNil)
+		})
+
+		Convey("Without the location check, locations at 0,0 should be injected", func() {
+			p.WithLocationCheck(false)
+			setLocation("dev", 0, 0)
+			So(uplink("dev").Message.GatewayMetadata.Location, ShouldNotBeNil)
+		})
+
+		Convey("Unsurveyed antennas should not be injected, also without the location check", func() {
+			p.WithLocationCheck(false)
+			p.shard("dev").info["dev"] = &info{lastUpdated: time.Now(), gateway: account.Gateway{ID: "dev", AntennaLocation: &account.Location{}}}
+			before := counterValue(invalidLocations.WithLabelValues(locationUnsurveyed))
+			msg := uplink("dev")
+			So(msg.Message.GatewayMetadata.Location, ShouldBeNil)
+			So(msg.Message.Trace, ShouldNotBeNil)
+			So(msg.Message.Trace.Event, ShouldEqual, skipInjectEvent)
+			So(msg.Message.Trace.Metadata["reason"], ShouldEqual, "invalid location: "+locationUnsurveyed)
+			status := &types.StatusMessage{GatewayID: "dev", Message: &gateway.Status{}}
+			So(p.HandleStatus(middleware.NewContext(), status), ShouldBeNil)
+			So(status.Message.Location, ShouldBeNil)
+			So(counterValue(invalidLocations.WithLabelValues(locationUnsurveyed))-before, ShouldEqual, 2)
+		})
+	})
+}
+
+func TestCacheShards(t *testing.T) {
+	Convey("Given a Public GatewayInfo with cached gateways", t, func(c C) {
+		p := newPublic()
+		Reset(p.Close)
+		for i := 0; i < 100; i++ {
+			p.set(fmt.Sprintf("dev-%d", i), account.Gateway{ID: fmt.Sprintf("dev-%d", i)})
+		}
+		So(p.shards, ShouldHaveLength, DefaultCacheShards)
+
+		Convey("Changing the number of shards should keep the cached gateways", func() {
+			p.WithCacheShards(4)
+			So(p.shards, ShouldHaveLength, 4)
+			So(p.Len(), ShouldEqual, 100)
+			for i := 0; i < 100; i++ {
+				gatewayID := fmt.Sprintf("dev-%d", i)
+				So(p.shard(gatewayID).info, ShouldContainKey, gatewayID)
+			}
+		})
+
+		Convey("The cache should have at least one shard", func() {
+			p.WithCacheShards(0)
+			So(p.shards, ShouldHaveLength, 1)
+			So(p.Len(), ShouldEqual, 100)
+		})
+	})
+}
+
+func TestReadEndpoint(t *testing.T) {
+	Convey("Given a primary account server and a read replica", t, func(c C) {
+		var primaryRequests, replicaRequests int32
+		primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&primaryRequests, 1)
+			json.NewEncoder(w).Encode(account.Gateway{ID: "dev", FrequencyPlan: "EU_868"})
+		}))
+		Reset(primary.Close)
+		replica := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&replicaRequests, 1)
+			if strings.HasSuffix(r.URL.Path, "/new") {
+				http.Error(w, `{"code":404,"error":"not found"}`, http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(account.Gateway{ID: "dev", FrequencyPlan: "US_902_928"})
+		}))
+		Reset(replica.Close)
+
+		p, err := NewPublic(primary.URL)
+		So(err, ShouldBeNil)
+		Reset(p.Close)
+		_, err = p.WithReadEndpoint("ftp://replica")
+		So(err, ShouldNotBeNil)
+		p, err = p.WithReadEndpoint(replica.URL)
+		So(err, ShouldBeNil)
+
+		Convey("Gateway information should be fetched from the replica", func() {
+			So(p.Refresh("dev"), ShouldBeNil)
+			So(p.FrequencyPlan("dev"), ShouldEqual, "US_902_928")
+			So(atomic.LoadInt32(&primaryRequests), ShouldEqual, 0)
+		})
+
+		Convey("The primary should be used if the replica fails", func() {
+			before := counterValue(replicaFallbacks)
+			So(p.Refresh("new"), ShouldBeNil)
+			So(p.FrequencyPlan("new"), ShouldEqual, "EU_868")
+			So(atomic.LoadInt32(&replicaRequests), ShouldEqual, 1)
+			So(atomic.LoadInt32(&primaryRequests), ShouldEqual, 1)
+			So(counterValue(replicaFallbacks)-before, ShouldEqual, 1)
+		})
+	})
+}
+
+type noLocationInjector struct{ DefaultFieldInjector }
+
+func (i noLocationInjector) InjectField(gatewayID string, field Field, current, cached interface{}) (interface{}, bool) {
+	if field == FieldLocation {
+		return nil, false
+	}
+	return i.DefaultFieldInjector.InjectField(gatewayID, field, current, cached)
+}
+
+func TestFieldInjector(t *testing.T) {
+	Convey("Given a Public GatewayInfo with a custom FieldInjector", t, func(c C) {
+		p := newPublic().WithFieldInjector(noLocationInjector{})
+		Reset(p.Close)
+		p.set("dev", account.Gateway{
+			ID:              "dev",
+			FrequencyPlan:   "EU_868",
+			AntennaLocation: &account.Location{Latitude: 52, Longitude: 4},
+		})
+
+		Convey("When sending a StatusMessage", func() {
+			status := &types.StatusMessage{GatewayID: "dev", Message: &gateway.Status{}}
+			err := p.HandleStatus(middleware.NewContext(), status)
+			So(err, ShouldBeNil)
+			Convey("The location should not be injected", func() {
+				So(status.Message.Location, ShouldBeNil)
+			})
+			Convey("The other fields should be injected", func() {
+				So(status.Message.FrequencyPlan, ShouldEqual, "EU_868")
+			})
+		})
+
+		Convey("When sending an UplinkMessage", func() {
+			uplink := &types.UplinkMessage{GatewayID: "dev", Message: &router.UplinkMessage{}}
+			err := p.HandleUplink(middleware.NewContext(), uplink)
+			So(err, ShouldBeNil)
+			Convey("The location should not be injected", func() {
+				So(uplink.Message.GatewayMetadata.Location, ShouldBeNil)
+				So(uplink.Message.Trace, ShouldBeNil)
+			})
+		})
+	})
+}
+
+func TestSnapshot(t *testing.T) {
+	Convey("Given a Public GatewayInfo with cached gateways", t, func(c C) {
+		p := newPublic()
+		Reset(p.Close)
+		p.set("dev-1", account.Gateway{ID: "dev-1", FrequencyPlan: "EU_868"})
+		p.setErr("dev-2", ErrGatewayNotFound)
+
+		for _, format := range []SnapshotFormat{SnapshotJSON, SnapshotGzip} {
+			format := format
+			Convey(fmt.Sprintf("When exporting a %s snapshot", format), func() {
+				var buf bytes.Buffer
+				err := p.Export(&buf, format)
+				So(err, ShouldBeNil)
+
+				Convey("The header should contain the format", func() {
+					So(buf.String(), ShouldStartWith, "gatewayinfo-snapshot "+string(format)+"\n")
+				})
+
+				Convey("It should be imported into another Public", func() {
+					other := newPublic()
+					defer other.Close()
+					n, err := other.Import(&buf)
+					So(err, ShouldBeNil)
+					So(n, ShouldEqual, 1)
+					So(other.FrequencyPlan("dev-1"), ShouldEqual, "EU_868")
+				})
+			})
+		}
+
+		Convey("Invalid snapshots should not be imported", func() {
+			_, err := p.Import(strings.NewReader("{}\n"))
+			So(err, ShouldNotBeNil)
+			_, err = p.Import(strings.NewReader("gatewayinfo-snapshot xml\n"))
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestLoadSnapshot(t *testing.T) {
+	Convey("Given a snapshot file", t, func(c C) {
+		dir, err := ioutil.TempDir("", "gatewayinfo")
+		So(err, ShouldBeNil)
+		Reset(func() { os.RemoveAll(dir) })
+		filename := dir + "/snapshot"
+
+		p := newPublic()
+		p.set("dev", account.Gateway{ID: "dev", FrequencyPlan: "EU_868"})
+		So(p.SaveSnapshot(filename, SnapshotGzip), ShouldBeNil)
+		p.Close()
+
+		var requests int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		}))
+		Reset(server.Close)
+
+		other, err := NewPublic(server.URL)
+		So(err, ShouldBeNil)
+		Reset(other.Close)
+
+		Convey("When the account server is unreachable at startup", func() {
+			n, err := other.LoadSnapshot(filename, time.Hour)
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 1)
+
+			Convey("The last-known information should be served", func() {
+				So(other.FrequencyPlan("dev"), ShouldEqual, "EU_868")
+			})
+
+			Convey("It should be refreshed", func() {
+				other.FrequencyPlan("dev")
+				time.Sleep(50 * time.Millisecond)
+				So(atomic.LoadInt32(&requests), ShouldEqual, 1)
+				So(other.FrequencyPlan("dev"), ShouldEqual, "EU_868")
+			})
+		})
+
+		Convey("A snapshot that is too old should not be loaded", func() {
+			old := time.Now().Add(-2 * time.Hour)
+			So(os.Chtimes(filename, old, old), ShouldBeNil)
+			n, err := other.LoadSnapshot(filename, time.Hour)
+			So(errors.Is(err, ErrSnapshotTooOld), ShouldBeTrue)
+			So(n, ShouldEqual, 0)
+		})
+
+		Convey("A missing snapshot should be ignored", func() {
+			n, err := other.LoadSnapshot(dir+"/missing", time.Hour)
+			So(err, ShouldBeNil)
+			So(n, ShouldEqual, 0)
+		})
+	})
+}
+
+func TestMaxStaleAge(t *testing.T) {
+	Convey("Given a Public GatewayInfo with a maximum stale age", t, func(c C) {
+		p := newPublic().WithExpire(time.Hour).WithMaxStaleAge(time.Minute)
+		Reset(p.Close)
+		p.set("dev", account.Gateway{ID: "dev", FrequencyPlan: "EU_868"})
+		p.entry("dev").fetched = time.Now().Add(-time.Hour)
+
+		Convey("Old information that was refreshed should be served", func() {
+			_, err := p.get("dev")
+			So(err, ShouldBeNil)
+			So(p.FrequencyPlan("dev"), ShouldEqual, "EU_868")
+		})
+
+		Convey("When the information could not be refreshed", func() {
+			p.setErr("dev", ErrAccountUnavailable)
+			before := counterValue(staleRefusals)
+			Convey("It should not be served", func() {
+				_, err := p.get("dev")
+				So(err, ShouldEqual, ErrTooStale)
+				So(p.FrequencyPlan("dev"), ShouldBeEmpty)
+				So(counterValue(staleRefusals)-before, ShouldEqual, 2)
+			})
+			Convey("It should not be injected into uplink messages", func() {
+				uplink := &types.UplinkMessage{GatewayID: "dev", Message: &router.UplinkMessage{}}
+				p.set("dev", account.Gateway{ID: "dev", AntennaLocation: &account.Location{Latitude: 12.34, Longitude: 56.78}})
+				p.entry("dev").fetched = time.Now().Add(-time.Hour)
+				p.setErr("dev", ErrAccountUnavailable)
+				p.HandleUplink(middleware.NewContext(), uplink)
+				So(uplink.Message.GatewayMetadata.Location, ShouldBeNil)
+			})
+		})
+	})
+}
+
+func TestCacheControl(t *testing.T) {
+	Convey("When parsing Cache-Control headers", t, func(c C) {
+		cacheControl := func(header string) []interface{} {
+			age, noCache := maxAge(header)
+			return []interface{}{age, noCache}
+		}
+		So(cacheControl("max-age=60"), ShouldResemble, []interface{}{time.Minute, false})
+		So(cacheControl("public, Max-Age=120"), ShouldResemble, []interface{}{2 * time.Minute, false})
+		So(cacheControl("no-cache, max-age=60"), ShouldResemble, []interface{}{time.Duration(0), true})
+		So(cacheControl("no-store"), ShouldResemble, []interface{}{time.Duration(0), true})
+		So(cacheControl("max-age=0"), ShouldResemble, []interface{}{time.Duration(0), true})
+		So(cacheControl("max-age=invalid"), ShouldResemble, []interface{}{time.Duration(0), false})
+		So(cacheControl(""), ShouldResemble, []interface{}{time.Duration(0), false})
+	})
+
+	Convey("Given an account server that does not allow caching", t, func(c C) {
+		var fetches int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&fetches, 1)
+			w.Header().Set("Cache-Control", "no-store")
+			json.NewEncoder(w).Encode(account.Gateway{ID: "dev", FrequencyPlan: "EU_863_870"})
+		}))
+		Reset(server.Close)
+
+		p, err := NewPublic(server.URL)
+		So(err, ShouldBeNil)
+		p.WithExpire(time.Hour)
+		Reset(p.Close)
+
+		Convey("When fetching the info of a Gateway", func() {
+			So(p.Refresh("dev"), ShouldBeNil)
+			Convey("The entry should expire immediately", func() {
+				So(p.entry("dev").ttl, ShouldEqual, uncached)
+				So(p.expireOf(p.entry("dev")), ShouldEqual, uncached)
+			})
+			Convey("The next lookup should fetch it again", func() {
+				So(p.FrequencyPlan("dev"), ShouldEqual, "EU_863_870")
+				for deadline := time.Now().Add(time.Second); atomic.LoadInt32(&fetches) < 2 && time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+				}
+				So(atomic.LoadInt32(&fetches), ShouldEqual, 2)
+			})
+		})
+	})
+
+	Convey("Given an account server that returns Cache-Control headers", t, func(c C) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", "max-age=60")
+			json.NewEncoder(w).Encode(account.Gateway{ID: "dev"})
+		}))
+		Reset(server.Close)
+
+		p, err := NewPublic(server.URL)
+		So(err, ShouldBeNil)
+		p.WithExpire(time.Hour)
+		Reset(p.Close)
+
+		Convey("When fetching the info of a Gateway", func() {
+			So(p.Refresh("dev"), ShouldBeNil)
+			Convey("The entry should use the TTL of the account server", func() {
+				So(p.entry("dev").ttl, ShouldEqual, time.Minute)
+				So(p.expireOf(p.entry("dev")), ShouldEqual, time.Minute)
+			})
+		})
+
+		Convey("Entries without TTL should use the configured expire", func() {
+			p.set("other", account.Gateway{ID: "other"})
+			So(p.expireOf(p.entry("other")), ShouldEqual, time.Hour)
+		})
+	})
+}
+
+func counterValue(c prometheus.Counter) float64 {
+	var m dto.Metric
+	c.Write(&m)
+	return m.GetCounter().GetValue()
+}
+
+func TestWorkers(t *testing.T) {
+	Convey("Given a Public GatewayInfo with a single worker", t, func(c C) {
+		p := newPublic().WithWorkers(1)
+		Reset(p.Close)
+
+		Convey("When submitting tasks while the worker is busy", func() {
+			release := make(chan struct{})
+			var done sync.WaitGroup
+			var mu sync.Mutex
+			var order []int
+			done.Add(4)
+			p.background(func() {
+				<-release
+				done.Done()
+			})
+			time.Sleep(10 * time.Millisecond)
+			for i := 0; i < 3; i++ {
+				i := i
+				p.background(func() {
+					mu.Lock()
+					order = append(order, i)
+					mu.Unlock()
+					done.Done()
+				})
+			}
+
+			Convey("They should be queued", func() {
+				var m dto.Metric
+				backgroundQueue.Write(&m)
+				So(m.GetGauge().GetValue(), ShouldEqual, 3)
+				close(release)
+				done.Wait()
+				Convey("And run in order once the worker is available", func() {
+					So(order, ShouldResemble, []int{0, 1, 2})
+				})
+			})
+		})
+	})
+
+	Convey("Given a Public GatewayInfo with multiple workers", t, func(c C) {
+		p := newPublic().WithWorkers(4)
+		Reset(p.Close)
+
+		Convey("When submitting a burst of blocking tasks", func() {
+			release := make(chan struct{})
+			started := make(chan struct{}, 4)
+			for i := 0; i < 4; i++ {
+				p.background(func() {
+					started <- struct{}{}
+					<-release
+				})
+			}
+			Reset(func() { close(release) })
+
+			Convey("They should all start concurrently", func() {
+				running := 0
+				timeout := time.After(time.Second)
+			wait:
+				for running < 4 {
+					select {
+					case <-started:
+						running++
+					case <-timeout:
+						break wait
+					}
+				}
+				So(running, ShouldEqual, 4)
+			})
+		})
+
+		Convey("When setting the workers again while tasks are queued", func() {
+			release := make(chan struct{})
+			started := make(chan struct{}, 4)
+			for i := 0; i < 4; i++ {
+				p.background(func() {
+					started <- struct{}{}
+					<-release
+				})
+			}
+			Reset(func() { close(release) })
+			for i := 0; i < 4; i++ {
+				<-started
+			}
+			ran := make(chan struct{})
+			p.background(func() { close(ran) })
+			old := p.workers
+			p.WithWorkers(1)
+
+			Convey("The previous workers should be stopped", func() {
+				_, open := <-old.stopped
+				So(open, ShouldBeFalse)
+			})
+			Convey("The queued tasks should run on the new workers", func() {
+				var done bool
+				select {
+				case <-ran:
+					done = true
+				case <-time.After(time.Second):
+				}
+				So(done, ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func TestInjectionMetrics(t *testing.T) {
+	Convey("Given a Public GatewayInfo with a Gateway", t, func(c C) {
+		p := newPublic()
+		Reset(p.Close)
+		p.set("dev", account.Gateway{ID: "dev", FrequencyPlan: "EU_868", AntennaLocation: &account.Location{Latitude: 12.34, Longitude: 56.78}})
+
+		injected := injections.WithLabelValues(string(FieldFrequencyPlan), outcomeInjected)
+		present := injections.WithLabelValues(string(FieldFrequencyPlan), outcomeAlreadyPresent)
+		unavailable := injections.WithLabelValues(string(FieldDescription), outcomeUnavailable)
+		injectedBefore, presentBefore, unavailableBefore := counterValue(injected), counterValue(present), counterValue(unavailable)
+
+		Convey("When sending StatusMessages", func() {
+			p.HandleStatus(middleware.NewContext(), &types.StatusMessage{GatewayID: "dev", Message: &gateway.Status{}})
+			p.HandleStatus(middleware.NewContext(), &types.StatusMessage{GatewayID: "dev", Message: &gateway.Status{FrequencyPlan: "US_902_928"}})
+			Convey("The outcomes should be counted", func() {
+				So(counterValue(injected)-injectedBefore, ShouldEqual, 1)
+				So(counterValue(present)-presentBefore, ShouldEqual, 1)
+				So(counterValue(unavailable)-unavailableBefore, ShouldEqual, 2)
+			})
+		})
+	})
+}
+
+func TestHealthCheck(t *testing.T) {
+	Convey("Given an account server", t, func(c C) {
+		status := http.StatusNotFound
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+		}))
+		Reset(server.Close)
+
+		p, err := NewPublic(server.URL)
+		So(err, ShouldBeNil)
+		p.WithHealthCheck(time.Nanosecond, 2)
+		Reset(p.Close)
+
+		Convey("When the account server responds", func() {
+			Convey("It should be healthy", func() {
+				So(p.CheckHealth(), ShouldBeNil)
+			})
+		})
+
+		Convey("When the account server fails", func() {
+			status = http.StatusBadGateway
+			Convey("It should only be unhealthy after the threshold", func() {
+				So(p.CheckHealth(), ShouldBeNil)
+				time.Sleep(time.Millisecond)
+				So(errors.Is(p.CheckHealth(), ErrAccountServerUnhealthy), ShouldBeTrue)
+			})
+		})
+
+		Convey("When probing within the interval", func() {
+			p.WithHealthCheck(time.Hour, 1)
+			So(p.CheckHealth(), ShouldBeNil)
+			status = http.StatusBadGateway
+			Convey("It should return the cached result", func() {
+				So(p.CheckHealth(), ShouldBeNil)
+			})
+			Convey("Validate should probe the account server", func() {
+				So(errors.Is(p.Validate(context.Background()), ErrAccountServerUnhealthy), ShouldBeTrue)
+				So(p.CheckHealth(), ShouldBeNil)
+			})
+		})
+
+		Convey("When validating a reachable account server", func() {
+			Convey("There should be no error", func() {
+				So(p.Validate(context.Background()), ShouldBeNil)
+			})
+		})
+	})
+}
+
 func TestPublic(t *testing.T) {
 	Convey("Given a new Public GatewayInfo", t, func(c C) {
-		p := NewPublic("https://account.thethingsnetwork.org")
+		p := newPublic()
+		gatewayID := "eui-0000024b08060112"
+
+		Convey("When fetching the info of a non-existent Gateway", func() {
+			err := p.fetch("dev")
+			Convey("There should be an error", func() {
+				So(err, ShouldNotBeNil)
+			})
+			Convey("The error should be ErrGatewayNotFound", func() {
+				So(errors.Is(err, ErrGatewayNotFound), ShouldBeTrue)
+			})
+			gateway, err := p.get("dev")
+			Convey("The info should not be stored", func() {
+				So(gateway.ID, ShouldBeEmpty)
+			})
+			Convey("An error should be stored", func() {
+				So(err, ShouldNotBeNil)
+			})
+		})
+
+		Convey("When fetching the info of a Gateway", func() {
+			err := p.fetch(gatewayID)
+			Convey("There should be no error", func() {
+				So(err, ShouldBeNil)
+			})
+			Convey("The info should be stored", func() {
+				gateway, _ := p.get(gatewayID)
+				So(gateway.ID, ShouldEqual, gatewayID)
+			})
+		})
+
+		Convey("When handling ConnectMessages", func() {
+			Convey("For a non-existent Gateway", func() {
+				err := p.HandleConnect(middleware.NewContext(), &types.ConnectMessage{
+					GatewayID: "dev",
+				})
+				Convey("There should be no error (we don't want to break on this)", func() {
+					So(err, ShouldBeNil)
+				})
+			})
+
+			err := p.HandleConnect(middleware.NewContext(), &types.ConnectMessage{
+				GatewayID: gatewayID,
+			})
+			Convey("There should be no error", func() {
+				So(err, ShouldBeNil)
+			})
+
+			time.Sleep(500 * time.Millisecond)
+			Convey("The info should be stored", func() {
+				gateway, _ := p.get(gatewayID)
+				So(gateway.ID, ShouldEqual, gatewayID)
+			})
+		})
+
+		Convey("Given some stored gateway information", func() {
+			strptr := func(s string) *string { return &s }
+
+			gatewayID := "gateway-id"
+			p.set(gatewayID, account.Gateway{
+				ID:            gatewayID,
+				FrequencyPlan: "EU_868",
+				AntennaLocation: &account.Location{
+					Latitude:  12.34,
+					Longitude: 56.78,
+				},
+				Attributes: account.GatewayAttributes{
+					Brand:       strptr("Test"),
+					Model:       strptr("Gateway"),
+					Description: strptr("My Test Gateway"),
+				},
+			})
+
+			Convey("When sending a DisconnectMessage", func() {
+				err := p.HandleDisconnect(middleware.NewContext(), &types.DisconnectMessage{
+					GatewayID: gatewayID,
+				})
+				Convey("There should be no error", func() {
+					So(err, ShouldBeNil)
+				})
+				time.Sleep(10 * time.Millisecond)
+				Convey("The info should no longer be stored", func() {
+					gateway, _ := p.get(gatewayID)
+					So(gateway.ID, ShouldBeEmpty)
+				})
+			})
+
+			Convey("When sending a StatusMessage", func() {
+				status := &types.StatusMessage{
+					GatewayID: gatewayID,
+					Message:   &gateway.Status{},
+				}
+				err := p.HandleStatus(middleware.NewContext(), status)
+				Convey("There should be no error", func() {
+					So(err, ShouldBeNil)
+				})
+				Convey("The StatusMessage should have Metadata", func() {
+					So(status.Message.GetLocation(), ShouldNotBeNil)
+					So(status.Message.GetLocation().Latitude, ShouldEqual, 12.34)
+					So(status.Message.Description, ShouldEqual, "My Test Gateway")
+					So(status.Message.Platform, ShouldEqual, "Test Gateway")
+					So(status.Message.FrequencyPlan, ShouldEqual, "EU_868")
+				})
+			})
+
+			Convey("When sending a StatusMessage with status injection disabled", func() {
+				p.WithStatusInjection(false)
+				status := &types.StatusMessage{
+					GatewayID: gatewayID,
+					Message:   &gateway.Status{},
+				}
+				err := p.HandleStatus(middleware.NewContext(), status)
+				Convey("There should be no error", func() {
+					So(err, ShouldBeNil)
+				})
+				Convey("The StatusMessage should not have Metadata", func() {
+					So(status.Message.GetLocation(), ShouldBeNil)
+					So(status.Message.FrequencyPlan, ShouldBeEmpty)
+				})
+			})
+
+			Convey("When sending a StatusMessage with flag injection", func() {
+				p.WithInjectFlags(true)
+				status := &types.StatusMessage{
+					GatewayID: gatewayID,
+					Message:   &gateway.Status{},
+				}
+				err := p.HandleStatus(middleware.NewContext(), status)
+				Convey("There should be no error", func() {
+					So(err, ShouldBeNil)
+				})
+				Convey("The StatusMessage should have the auto_update attribute", func() {
+					So(status.Attributes, ShouldContainKey, AutoUpdateAttribute)
+					So(status.Attributes[AutoUpdateAttribute], ShouldEqual, "false")
+				})
+				Convey("When the StatusMessage already has the attribute", func() {
+					status := &types.StatusMessage{
+						GatewayID:  gatewayID,
+						Message:    &gateway.Status{},
+						Attributes: map[string]string{AutoUpdateAttribute: "true"},
+					}
+					p.HandleStatus(middleware.NewContext(), status)
+					Convey("It should not be overwritten", func() {
+						So(status.Attributes[AutoUpdateAttribute], ShouldEqual, "true")
+					})
+				})
+			})
+
+			Convey("When sending an UplinkMessage", func() {
+				uplink := &types.UplinkMessage{
+					GatewayID: gatewayID,
+					Message:   &router.UplinkMessage{},
+				}
+				err := p.HandleUplink(middleware.NewContext(), uplink)
+				Convey("There should be no error", func() {
+					So(err, ShouldBeNil)
+				})
+				Convey("The UplinkMessage should have a Location", func() {
+					So(uplink.Message.GatewayMetadata.GetLocation(), ShouldNotBeNil)
+					So(uplink.Message.GatewayMetadata.GetLocation().Latitude, ShouldAlmostEqual, 12.34, 0.001)
+					So(uplink.Message.GatewayMetadata.GetLocation().Longitude, ShouldAlmostEqual, 56.78, 0.001)
+				})
+			})
+
+			Convey("When sending an UplinkMessage with uplink injection disabled", func() {
+				p.WithUplinkInjection(false)
+				uplink := &types.UplinkMessage{
+					GatewayID: gatewayID,
+					Message:   &router.UplinkMessage{},
+				}
+				err := p.HandleUplink(middleware.NewContext(), uplink)
+				Convey("There should be no error", func() {
+					So(err, ShouldBeNil)
+				})
+				Convey("The UplinkMessage should not have a Location", func() {
+					So(uplink.Message.GatewayMetadata.GetLocation(), ShouldBeNil)
+				})
+			})
+		})
+
+	})
+
+	Convey("Given a new Public GatewayInfo that Expires", t, func(c C) {
+		p := newPublic().WithExpire(10 * time.Millisecond)
+		gatewayID := "eui-0000024b08060112"
+
+		Convey("When setting the info of a Gateway", func() {
+			p.set(gatewayID, account.Gateway{})
+			lastUpdated := p.entry(gatewayID).lastUpdated
+			Convey("When getting the info of a Gateway some time later", func() {
+				time.Sleep(20 * time.Millisecond)
+				p.get(gatewayID)
+				time.Sleep(500 * time.Millisecond)
+				Convey("It should have updated", func() {
+					So(p.entry(gatewayID).lastUpdated, ShouldNotEqual, lastUpdated)
+				})
+			})
+		})
+	})
+
+	Convey("Given a new Public GatewayInfo with proactive refresh", t, func(c C) {
+		p := newPublic().WithExpire(time.Second).WithProactiveRefresh(10*time.Millisecond, 900*time.Millisecond)
+		Reset(p.Close)
+		gatewayID := "eui-0000024b08060112"
+
+		Convey("When setting the info of a Gateway", func() {
+			p.set(gatewayID, account.Gateway{})
+			p.mu.Lock()
+			lastUpdated := p.entry(gatewayID).lastUpdated
+			p.mu.Unlock()
+			Convey("When waiting until it is about to expire", func() {
+				time.Sleep(600 * time.Millisecond)
+				Convey("It should have updated", func() {
+					p.mu.Lock()
+					defer p.mu.Unlock()
+					So(p.entry(gatewayID).lastUpdated, ShouldNotEqual, lastUpdated)
+				})
+			})
+		})
+	})
+
+	Convey("Given a new Public GatewayInfo with an EUI resolver", t, func(c C) {
+		p := newPublic().WithResolver(EUIToID)
 		gatewayID := "eui-0000024b08060112"
 
-		Convey("When fetching the info of a non-existent Gateway", func() {
-			err := p.fetch("dev")
-			Convey("There should be an error", func() {
-				So(err, ShouldNotBeNil)
+		Convey("When setting the info of a Gateway", func() {
+			p.set(gatewayID, account.Gateway{ID: gatewayID})
+			Convey("It should be returned for the EUI", func() {
+				gateway, _ := p.get("0000024B08060112")
+				So(gateway.ID, ShouldEqual, gatewayID)
+			})
+			Convey("It should be returned for the ID", func() {
+				gateway, _ := p.get(gatewayID)
+				So(gateway.ID, ShouldEqual, gatewayID)
+			})
+		})
+
+		Convey("When resolving something that is not an EUI", func() {
+			So(p.resolve("my-gateway"), ShouldEqual, "my-gateway")
+		})
+
+		Convey("When forgetting a resolved EUI", func() {
+			p.resolve("0000024B08060112")
+			p.forget("0000024B08060112")
+			Convey("Both identifiers should be removed", func() {
+				So(p.resolved, ShouldBeEmpty)
+			})
+		})
+	})
+
+	Convey("Given a new Public GatewayInfo with a failing resolver", t, func(c C) {
+		var resolves int
+		p := newPublic().WithResolver(func(gatewayID string) (string, error) {
+			resolves++
+			return "", errors.New("unavailable")
+		})
+		ttl := ResolveErrorTTL
+		Reset(func() { ResolveErrorTTL = ttl })
+
+		Convey("When resolving a gateway twice", func() {
+			So(p.resolve("dev"), ShouldEqual, "dev")
+			So(p.resolve("dev"), ShouldEqual, "dev")
+			Convey("The failure should be cached", func() {
+				So(resolves, ShouldEqual, 1)
+			})
+		})
+
+		Convey("When resolving a gateway after the failure expired", func() {
+			ResolveErrorTTL = 0
+			p.resolve("dev")
+			p.resolve("dev")
+			Convey("The resolver should be tried again", func() {
+				So(resolves, ShouldEqual, 2)
+			})
+		})
+
+		Convey("When more gateways fail to resolve than are cached", func() {
+			for i := 0; i < maxUnresolved; i++ {
+				p.resolve(fmt.Sprintf("gw-%d", i))
+			}
+			p.resolve("dev")
+			Convey("The cache should not grow beyond the cap", func() {
+				So(p.unresolved, ShouldHaveLength, maxUnresolved)
+				So(p.unresolved, ShouldNotContainKey, "dev")
+			})
+			Convey("When the cached failures expired", func() {
+				for id := range p.unresolved {
+					p.unresolved[id] = time.Now()
+				}
+				p.resolve("dev")
+				Convey("They should be removed", func() {
+					So(p.unresolved, ShouldHaveLength, 1)
+					So(p.unresolved, ShouldContainKey, "dev")
+				})
+			})
+		})
+	})
+
+	Convey("Given a Public GatewayInfo with partial gateway information", t, func(c C) {
+		p := newPublic()
+		Reset(p.Close)
+		brand := "Kerlink"
+		p.set("dev", account.Gateway{
+			ID:              "dev",
+			FrequencyPlan:   "EU_868",
+			AntennaLocation: &account.Location{Latitude: 52, Longitude: 4},
+			Attributes:      account.GatewayAttributes{Brand: &brand},
+		})
+
+		Convey("When setting other partial information", func() {
+			model := "iStation"
+			p.set("dev", account.Gateway{ID: "dev", FrequencyPlan: "EU_433", Attributes: account.GatewayAttributes{Model: &model}})
+			gateway := p.entry("dev").gateway
+			Convey("New fields should take precedence", func() {
+				So(gateway.FrequencyPlan, ShouldEqual, "EU_433")
+				So(*gateway.Attributes.Model, ShouldEqual, "iStation")
+			})
+			Convey("Missing fields should be kept", func() {
+				So(gateway.AntennaLocation, ShouldNotBeNil)
+				So(*gateway.Attributes.Brand, ShouldEqual, "Kerlink")
+			})
+		})
+
+		Convey("When the previous entry was an error", func() {
+			p.setErr("dev", ErrAccountUnavailable)
+			p.set("dev", account.Gateway{ID: "dev"})
+			Convey("Nothing should be merged", func() {
+				So(p.entry("dev").gateway.FrequencyPlan, ShouldBeEmpty)
+			})
+		})
+	})
+
+	Convey("Given a Public GatewayInfo with cached gateways", t, func(c C) {
+		p := newPublic()
+		Reset(p.Close)
+		p.set("dev-1", account.Gateway{ID: "dev-1"})
+		p.set("dev-2", account.Gateway{ID: "dev-2"})
+		p.setErr("dev-3", ErrGatewayNotFound)
+
+		Convey("Range should visit all of them", func() {
+			visited := make(map[string]error)
+			p.Range(func(gatewayID string, gateway account.Gateway, err error) bool {
+				visited[gatewayID] = err
+				p.Len() // must not deadlock
+				return true
+			})
+			So(visited, ShouldHaveLength, 3)
+			So(visited["dev-3"], ShouldEqual, ErrGatewayNotFound)
+		})
+
+		Convey("Range should stop when the callback returns false", func() {
+			var calls int
+			p.Range(func(gatewayID string, gateway account.Gateway, err error) bool {
+				calls++
+				return false
+			})
+			So(calls, ShouldEqual, 1)
+		})
+	})
+
+	Convey("Given a Public GatewayInfo with information that could not be refreshed", t, func(c C) {
+		p := newPublic().WithExpire(time.Minute)
+		Reset(p.Close)
+		p.set("dev", account.Gateway{ID: "dev", FrequencyPlan: "EU_868"})
+		p.entry("dev").fetched = time.Now().Add(-time.Hour)
+		p.setErr("dev", ErrAccountUnavailable)
+
+		Convey("When getting the information", func() {
+			gateway, _ := p.get("dev")
+			Convey("The stale information should be served", func() {
+				So(gateway.FrequencyPlan, ShouldEqual, "EU_868")
+			})
+			Convey("It should be recorded as oldest stale entry", func() {
+				So(p.oldestStale.gatewayID, ShouldEqual, "dev")
+				So(p.entry("dev").staleLogged, ShouldBeTrue)
+			})
+			Convey("When the information is refreshed", func() {
+				p.set("dev", account.Gateway{ID: "dev", FrequencyPlan: "EU_868"})
+				Convey("It should no longer be recorded", func() {
+					So(p.oldestStale.gatewayID, ShouldBeEmpty)
+				})
+			})
+		})
+	})
+
+	Convey("Given a Public GatewayInfo with multiple gateways", t, func(c C) {
+		p := newPublic()
+		Reset(p.Close)
+		p.set("eu-1", account.Gateway{ID: "eu-1"})
+		p.set("eu-2", account.Gateway{ID: "eu-2"})
+		p.set("us-1", account.Gateway{ID: "us-1"})
+
+		Convey("When invalidating by prefix", func() {
+			n := p.InvalidatePrefix("eu-")
+			Convey("The matching entries should be removed", func() {
+				So(n, ShouldEqual, 2)
+				So(p.Len(), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When invalidating by predicate", func() {
+			n := p.InvalidateWhere(func(id string) bool { return id == "us-1" })
+			Convey("The matching entries should be removed", func() {
+				So(n, ShouldEqual, 1)
+				So(p.Len(), ShouldEqual, 2)
+			})
+		})
+	})
+
+	Convey("Given a Public GatewayInfo with a Gateway location", t, func(c C) {
+		p := newPublic()
+		Reset(p.Close)
+		p.set("dev", account.Gateway{ID: "dev", AntennaLocation: &account.Location{Latitude: 12.34, Longitude: 56.78}})
+
+		Convey("When sending an UplinkMessage without metadata", func() {
+			uplink := &types.UplinkMessage{GatewayID: "dev", Message: &router.UplinkMessage{Payload: []byte{1}}}
+			err := p.HandleUplink(middleware.NewContext(), uplink)
+			Convey("The Location should be injected into the metadata", func() {
+				So(err, ShouldBeNil)
+				So(uplink.Message.GatewayMetadata.GetLocation(), ShouldNotBeNil)
+				So(uplink.Message.GatewayMetadata.GetLocation().Latitude, ShouldAlmostEqual, 12.34, 0.001)
+			})
+		})
+
+		Convey("When sending an UplinkMessage without a message", func() {
+			uplink := &types.UplinkMessage{GatewayID: "dev"}
+			err := p.HandleUplink(middleware.NewContext(), uplink)
+			Convey("There should be no error", func() {
+				So(err, ShouldBeNil)
+				So(uplink.Message, ShouldBeNil)
+			})
+		})
+	})
+
+	Convey("Given a Public GatewayInfo with connect responses", t, func(c C) {
+		p := newPublic().WithConnectResponse(true)
+		Reset(p.Close)
+		p.set("dev", account.Gateway{ID: "dev", FrequencyPlan: "EU_868", AntennaLocation: &account.Location{Latitude: 12.34, Longitude: 56.78}})
+
+		Convey("When a known gateway connects", func() {
+			ctx := middleware.NewContext()
+			err := p.HandleConnect(ctx, &types.ConnectMessage{GatewayID: "dev"})
+			Convey("The response should contain the gateway information", func() {
+				So(err, ShouldBeNil)
+				res := middleware.ConnectResponseFromContext(ctx)
+				So(res, ShouldNotBeNil)
+				So(res.FrequencyPlan, ShouldEqual, "EU_868")
+				So(res.Location, ShouldNotBeNil)
+				So(res.Location.Latitude, ShouldAlmostEqual, 12.34, 0.001)
+			})
+		})
+
+		Convey("When connect responses are disabled", func() {
+			p.WithConnectResponse(false)
+			ctx := middleware.NewContext()
+			p.HandleConnect(ctx, &types.ConnectMessage{GatewayID: "dev"})
+			Convey("There should be no response", func() {
+				So(middleware.ConnectResponseFromContext(ctx), ShouldBeNil)
 			})
-			gateway, err := p.get("dev")
-			Convey("The info should not be stored", func() {
-				So(gateway.ID, ShouldBeEmpty)
+		})
+
+		Convey("When a gateway connects that is not in the cache yet", func() {
+			p.setAccountFetcher(fetcherFunc(func(gatewayID string) (account.Gateway, error) {
+				time.Sleep(10 * time.Millisecond)
+				return account.Gateway{ID: gatewayID, FrequencyPlan: "US_915"}, nil
+			}))
+			responses := make(chan *types.ConnectResponseMessage, 1)
+			ctx := middleware.NewContext()
+			ctx.Set(middleware.ConnectResponderKey, func(res *types.ConnectResponseMessage) { responses <- res })
+			err := p.HandleConnect(ctx, &types.ConnectMessage{GatewayID: "new"})
+			Convey("There should be no response yet", func() {
+				So(err, ShouldBeNil)
+				So(middleware.ConnectResponseFromContext(ctx), ShouldBeNil)
 			})
-			Convey("An error should be stored", func() {
-				So(err, ShouldNotBeNil)
+			Convey("The response should be sent when the gateway information is fetched", func() {
+				select {
+				case res := <-responses:
+					So(res.GatewayID, ShouldEqual, "new")
+					So(res.FrequencyPlan, ShouldEqual, "US_915")
+				case <-time.After(time.Second):
+					So("no response", ShouldBeEmpty)
+				}
 			})
 		})
+	})
 
-		Convey("When fetching the info of a Gateway", func() {
-			err := p.fetch(gatewayID)
-			Convey("There should be no error", func() {
-				So(err, ShouldBeNil)
+	Convey("Given a Public GatewayInfo with lazy fetching", t, func(c C) {
+		var mu sync.Mutex
+		var fetched []string
+		getFetched := func() []string {
+			mu.Lock()
+			defer mu.Unlock()
+			return fetched
+		}
+		p := newPublic().WithLazyFetch(true)
+		p.setAccountFetcher(fetcherFunc(func(gatewayID string) (account.Gateway, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			fetched = append(fetched, gatewayID)
+			return account.Gateway{ID: gatewayID}, nil
+		}))
+		Reset(p.Close)
+
+		Convey("When a gateway connects", func() {
+			p.HandleConnect(middleware.NewContext(), &types.ConnectMessage{GatewayID: "dev"})
+			time.Sleep(10 * time.Millisecond)
+			Convey("Nothing should be fetched", func() {
+				So(getFetched(), ShouldBeEmpty)
 			})
-			Convey("The info should be stored", func() {
-				gateway, _ := p.get(gatewayID)
-				So(gateway.ID, ShouldEqual, gatewayID)
+		})
+
+		Convey("When sending an uplink with a location", func() {
+			uplink := &types.UplinkMessage{GatewayID: "dev", Message: &router.UplinkMessage{}}
+			uplink.Message.GatewayMetadata.Location = &gateway.LocationMetadata{Latitude: 1, Longitude: 2}
+			p.HandleUplink(middleware.NewContext(), uplink)
+			time.Sleep(10 * time.Millisecond)
+			Convey("Nothing should be fetched", func() {
+				So(getFetched(), ShouldBeEmpty)
 			})
 		})
 
-		Convey("When handling ConnectMessages", func() {
-			Convey("For a non-existent Gateway", func() {
-				err := p.HandleConnect(middleware.NewContext(), &types.ConnectMessage{
-					GatewayID: "dev",
-				})
-				Convey("There should be no error (we don't want to break on this)", func() {
-					So(err, ShouldBeNil)
+		Convey("When sending an uplink without a location", func() {
+			p.HandleUplink(middleware.NewContext(), &types.UplinkMessage{GatewayID: "dev", Message: &router.UplinkMessage{}})
+			time.Sleep(10 * time.Millisecond)
+			Convey("The gateway information should be fetched", func() {
+				So(getFetched(), ShouldResemble, []string{"dev"})
+			})
+		})
+
+		Convey("When sending a status message that only lacks a mapped attribute", func() {
+			_, err := p.WithAttributeMapping(map[string]string{"placement": "site_placement"})
+			So(err, ShouldBeNil)
+			status := &types.StatusMessage{GatewayID: "dev", Message: &gateway.Status{
+				Location:      &gateway.LocationMetadata{Latitude: 1, Longitude: 2},
+				FrequencyPlan: "EU_863_870",
+				Platform:      "Kerlink",
+				Description:   "Gateway",
+			}}
+			p.HandleStatus(middleware.NewContext(), status)
+			time.Sleep(10 * time.Millisecond)
+			Convey("The gateway information should be fetched", func() {
+				So(getFetched(), ShouldResemble, []string{"dev"})
+			})
+			Convey("The attributes should expire with the status fields", func() {
+				So(p.statusFields(), ShouldContain, FieldAttributes)
+			})
+		})
+	})
+
+	Convey("Given a Public GatewayInfo", t, func(c C) {
+		var fetches int32
+		p := newPublic()
+		p.setAccountFetcher(fetcherFunc(func(gatewayID string) (account.Gateway, error) {
+			atomic.AddInt32(&fetches, 1)
+			return account.Gateway{ID: gatewayID}, nil
+		}))
+		Reset(p.Close)
+		complete := &gateway.LocationMetadata{Latitude: 1, Longitude: 2, Altitude: 3}
+
+		Convey("When sending an uplink with a complete location", func() {
+			uplink := &types.UplinkMessage{GatewayID: "dev", Message: &router.UplinkMessage{}}
+			uplink.Message.GatewayMetadata.Location = complete
+			p.HandleUplink(middleware.NewContext(), uplink)
+			time.Sleep(10 * time.Millisecond)
+			Convey("The cache should not be looked up", func() {
+				So(atomic.LoadInt32(&fetches), ShouldEqual, 0)
+				So(uplink.Message.GatewayMetadata.Location, ShouldEqual, complete)
+			})
+		})
+
+		Convey("When sending an uplink with a location without altitude", func() {
+			uplink := &types.UplinkMessage{GatewayID: "dev", Message: &router.UplinkMessage{}}
+			uplink.Message.GatewayMetadata.Location = &gateway.LocationMetadata{Latitude: 1, Longitude: 2}
+			p.HandleUplink(middleware.NewContext(), uplink)
+			time.Sleep(10 * time.Millisecond)
+			Convey("The gateway information should be fetched", func() {
+				So(atomic.LoadInt32(&fetches), ShouldEqual, 1)
+			})
+		})
+
+		Convey("When reporting conflicts", func() {
+			p.WithConflictReporting(true)
+			uplink := &types.UplinkMessage{GatewayID: "dev", Message: &router.UplinkMessage{}}
+			uplink.Message.GatewayMetadata.Location = complete
+			p.HandleUplink(middleware.NewContext(), uplink)
+			time.Sleep(10 * time.Millisecond)
+			Convey("Uplinks with a complete location should not take the fast path", func() {
+				So(atomic.LoadInt32(&fetches), ShouldEqual, 1)
+			})
+		})
+	})
+
+	Convey("Given a Public GatewayInfo with overrides", t, func(c C) {
+		file, err := ioutil.TempFile("", "overrides")
+		So(err, ShouldBeNil)
+		Reset(func() { os.Remove(file.Name()) })
+		file.WriteString("dev:\n  gps:\n    latitude: 1.5\n    longitude: 2.5\n  frequency_plan: US_902_928\n  min_rssi: -110\n  min_snr: -5\n  timezone: Europe/Amsterdam\n  firmware: 2.1.0\n  tags:\n    site: rooftop\n    customer: acme\n")
+		file.Close()
+
+		p, err := newPublic().WithOverrides(file.Name())
+		So(err, ShouldBeNil)
+		Reset(p.Close)
+		p.set("dev", account.Gateway{ID: "dev", FrequencyPlan: "EU_868", AntennaLocation: &account.Location{Latitude: 12.34, Longitude: 56.78}})
+
+		Convey("When sending an UplinkMessage", func() {
+			uplink := &types.UplinkMessage{GatewayID: "dev", Message: &router.UplinkMessage{}}
+			p.HandleUplink(middleware.NewContext(), uplink)
+			Convey("The overridden Location should be set", func() {
+				So(uplink.Message.GatewayMetadata.GetLocation().Latitude, ShouldAlmostEqual, 1.5, 0.001)
+				So(uplink.Message.GatewayMetadata.GetLocation().Source, ShouldEqual, gateway.LocationMetadata_CONFIG)
+			})
+		})
+
+		Convey("The signal-quality thresholds should be returned", func() {
+			minRSSI, minSNR := p.SignalThresholds("dev")
+			So(*minRSSI, ShouldEqual, -110)
+			So(*minSNR, ShouldEqual, -5)
+			minRSSI, minSNR = p.SignalThresholds("other")
+			So(minRSSI, ShouldBeNil)
+			So(minSNR, ShouldBeNil)
+		})
+
+		Convey("When sending a StatusMessage", func() {
+			status := &types.StatusMessage{GatewayID: "dev", Message: &gateway.Status{FrequencyPlan: "AS_923"}}
+			p.HandleStatus(middleware.NewContext(), status)
+			Convey("The overridden fields should be set", func() {
+				So(status.Message.FrequencyPlan, ShouldEqual, "US_902_928")
+				So(status.Message.Location.Longitude, ShouldAlmostEqual, 2.5, 0.001)
+			})
+		})
+
+		Convey("When sending a StatusMessage with time zone injection", func() {
+			p.WithInjectTimezone(true)
+			status := &types.StatusMessage{GatewayID: "dev", Message: &gateway.Status{}}
+			p.HandleStatus(middleware.NewContext(), status)
+			Convey("The time zone attribute should be set", func() {
+				So(status.Attributes[TimezoneAttribute], ShouldEqual, "Europe/Amsterdam")
+			})
+		})
+
+		Convey("The time zone of the gateway should be returned", func() {
+			So(p.Timezone("dev").String(), ShouldEqual, "Europe/Amsterdam")
+			So(p.Timezone("other"), ShouldBeNil)
+		})
+
+		Convey("When sending StatusMessages with expected firmware injection", func() {
+			p.WithInjectExpectedFirmware(true)
+			status := &types.StatusMessage{GatewayID: "dev", Message: &gateway.Status{}}
+			p.HandleStatus(middleware.NewContext(), status)
+			other := &types.StatusMessage{GatewayID: "other", Message: &gateway.Status{}}
+			p.HandleStatus(middleware.NewContext(), other)
+			Convey("The expected firmware attribute should be set for gateways with a firmware version", func() {
+				So(status.Attributes[ExpectedFirmwareAttribute], ShouldEqual, "2.1.0")
+				So(other.Attributes, ShouldNotContainKey, ExpectedFirmwareAttribute)
+			})
+		})
+
+		Convey("When sending messages of a gateway with tags", func() {
+			ctx := middleware.NewContext()
+			p.HandleConnect(ctx, &types.ConnectMessage{GatewayID: "dev"})
+			uplink := &types.UplinkMessage{GatewayID: "dev", Message: &router.UplinkMessage{}, Attributes: map[string]string{"site": "basement"}}
+			p.HandleUplink(middleware.NewContext(), uplink)
+			status := &types.StatusMessage{GatewayID: "dev", Message: &gateway.Status{}}
+			p.HandleStatus(middleware.NewContext(), status)
+			downlink := &types.DownlinkMessage{GatewayID: "dev", Message: &router.DownlinkMessage{}}
+			p.HandleDownlink(middleware.NewContext(), downlink)
+			Convey("The tags should be injected", func() {
+				So(ctx.Get(TagsKey), ShouldResemble, map[string]string{"site": "rooftop", "customer": "acme"})
+				So(status.Attributes, ShouldResemble, map[string]string{"site": "rooftop", "customer": "acme"})
+				So(downlink.Attributes, ShouldResemble, map[string]string{"site": "rooftop", "customer": "acme"})
+			})
+			Convey("Attributes that are already present should not be replaced", func() {
+				So(uplink.Attributes, ShouldResemble, map[string]string{"site": "basement", "customer": "acme"})
+			})
+		})
+
+		Convey("When the overrides contain an invalid time zone", func() {
+			ioutil.WriteFile(file.Name(), []byte(`{"dev": {"timezone": "Mars/Olympus_Mons"}}`), 0644)
+			Convey("They should not be loaded", func() {
+				So(p.ReloadOverrides(), ShouldNotBeNil)
+				override, _ := p.override("dev")
+				So(override.Timezone, ShouldEqual, "Europe/Amsterdam")
+			})
+		})
+
+		Convey("When the overrides are reloaded", func() {
+			ioutil.WriteFile(file.Name(), []byte(`{"other": {"platform": "Kerlink"}}`), 0644)
+			So(p.ReloadOverrides(), ShouldBeNil)
+			Convey("The new overrides should be used", func() {
+				_, ok := p.override("dev")
+				So(ok, ShouldBeFalse)
+				override, ok := p.override("other")
+				So(ok, ShouldBeTrue)
+				So(override.Platform, ShouldEqual, "Kerlink")
+			})
+		})
+	})
+
+	Convey("Given a Public GatewayInfo with a disconnect grace", t, func(c C) {
+		p := newPublic().WithDisconnectGrace(20 * time.Millisecond)
+		Reset(p.Close)
+		p.set("dev", account.Gateway{ID: "dev"})
+		p.HandleDisconnect(middleware.NewContext(), &types.DisconnectMessage{GatewayID: "dev"})
+
+		Convey("When the gateway does not reconnect", func() {
+			time.Sleep(50 * time.Millisecond)
+			Convey("The information should be removed", func() {
+				So(p.Len(), ShouldEqual, 0)
+			})
+		})
+
+		Convey("When the gateway reconnects within the grace", func() {
+			p.HandleConnect(middleware.NewContext(), &types.ConnectMessage{GatewayID: "dev"})
+			time.Sleep(50 * time.Millisecond)
+			Convey("The information should be kept", func() {
+				So(p.Len(), ShouldEqual, 1)
+			})
+		})
+	})
+
+	Convey("Given a Public GatewayInfo with a Gateway to explain", t, func(c C) {
+		p := newPublic()
+		Reset(p.Close)
+		p.set("dev", account.Gateway{ID: "dev", FrequencyPlan: "EU_868", AntennaLocation: &account.Location{Latitude: 12.34, Longitude: 56.78}})
+
+		Convey("When explaining a StatusMessage", func() {
+			status := &types.StatusMessage{GatewayID: "dev", Message: &gateway.Status{Platform: "Kerlink"}}
+			decisions := p.Explain("dev", status)
+			Convey("The message should not be changed", func() {
+				So(status.Message.Location, ShouldBeNil)
+				So(status.Message.FrequencyPlan, ShouldBeEmpty)
+			})
+			Convey("Each field should be explained", func() {
+				So(decisions, ShouldHaveLength, 4)
+				So(decisions[0].Field, ShouldEqual, FieldLocation)
+				So(decisions[0].Source, ShouldEqual, SourceAccountServer)
+				So(decisions[1].Source, ShouldEqual, SourceAccountServer)
+				So(decisions[1].Value, ShouldEqual, "EU_868")
+				So(decisions[2].Source, ShouldEqual, SourceMessage)
+				So(decisions[3].Source, ShouldEqual, SourceNone)
+				So(decisions[3].Reason, ShouldEqual, "not available in gateway information")
+			})
+		})
+
+		Convey("When explaining an UplinkMessage of an unknown gateway", func() {
+			decisions := p.Explain("other", &types.UplinkMessage{GatewayID: "other", Message: &router.UplinkMessage{}})
+			Convey("It should explain that nothing is cached", func() {
+				So(decisions, ShouldHaveLength, 1)
+				So(decisions[0].Reason, ShouldEqual, "no gateway information cached")
+			})
+		})
+	})
+
+	Convey("Given a Public GatewayInfo with a Lister", t, func(c C) {
+		p := newPublic()
+		p.setAccountFetcher(fetcherFunc(func(gatewayID string) (account.Gateway, error) {
+			return account.Gateway{ID: gatewayID}, nil
+		}))
+		Reset(p.Close)
+		listed := []string{"dev-1", "dev-2"}
+		lister := ListerFunc(func() ([]string, error) { return listed, nil })
+
+		Convey("When prefetching", func() {
+			p.prefetch(lister)
+			Convey("The listed gateways should be fetched", func() {
+				So(p.Len(), ShouldEqual, 2)
+				_, ok, _ := p.cached("dev-2")
+				So(ok, ShouldBeTrue)
+			})
+			Convey("When a gateway is removed from the list", func() {
+				listed = []string{"dev-2", "dev-3"}
+				p.prefetch(lister)
+				Convey("It should be removed from the cache", func() {
+					So(p.Len(), ShouldEqual, 2)
+					_, ok, _ := p.cached("dev-1")
+					So(ok, ShouldBeFalse)
+					_, ok, _ = p.cached("dev-3")
+					So(ok, ShouldBeTrue)
 				})
 			})
+		})
+	})
 
-			err := p.HandleConnect(middleware.NewContext(), &types.ConnectMessage{
-				GatewayID: gatewayID,
+	Convey("Given a Public GatewayInfo with field expiration", t, func(c C) {
+		p := newPublic().WithExpire(time.Hour).WithFieldExpire(FieldLocation, 24*time.Hour).WithFieldExpire(FieldAttributes, 5*time.Minute)
+		Reset(p.Close)
+		p.set("dev", account.Gateway{ID: "dev"})
+		info := p.entry("dev")
+
+		Convey("The expiration should depend on the needed fields", func() {
+			So(p.expireFor(info, nil), ShouldEqual, time.Hour)
+			So(p.expireFor(info, []Field{FieldLocation}), ShouldEqual, 24*time.Hour)
+			So(p.expireFor(info, []Field{FieldLocation, FieldFrequencyPlan}), ShouldEqual, time.Hour)
+			So(p.expireFor(info, []Field{FieldLocation, FieldAttributes}), ShouldEqual, 5*time.Minute)
+		})
+
+		Convey("The TTL of the account server should be respected", func() {
+			info.ttl = time.Minute
+			So(p.expireFor(info, []Field{FieldLocation}), ShouldEqual, time.Minute)
+		})
+
+		Convey("When a needed field has expired", func() {
+			info.lastUpdated = time.Now().Add(-2 * time.Hour)
+			p.setAccountFetcher(fetcherFunc(func(gatewayID string) (account.Gateway, error) {
+				return account.Gateway{ID: gatewayID, FrequencyPlan: "EU_868"}, nil
+			}))
+			Convey("The location should not trigger a refetch", func() {
+				p.get("dev", FieldLocation)
+				time.Sleep(10 * time.Millisecond)
+				So(p.FrequencyPlan("dev"), ShouldBeEmpty)
+			})
+			Convey("The frequency plan should trigger a refetch", func() {
+				p.get("dev", FieldFrequencyPlan)
+				time.Sleep(10 * time.Millisecond)
+				So(p.FrequencyPlan("dev"), ShouldEqual, "EU_868")
+			})
+		})
+	})
+
+	Convey("Given a Public GatewayInfo with an error backoff", t, func(c C) {
+		p := newPublic().WithExpire(time.Millisecond).WithErrorBackoff(backoff.Config{BaseDelay: 20 * time.Millisecond, MaxDelay: 40 * time.Millisecond, Factor: 2})
+		Reset(p.Close)
+		var fetches int32
+		p.setAccountFetcher(fetcherFunc(func(gatewayID string) (account.Gateway, error) {
+			atomic.AddInt32(&fetches, 1)
+			return account.Gateway{}, errors.New("not found")
+		}))
+
+		Convey("When the fetch keeps failing", func() {
+			p.fetch("dev")
+			for i := 0; i < 5; i++ {
+				p.get("dev")
+				time.Sleep(2 * time.Millisecond)
+			}
+			Convey("It should not be retried before the backoff", func() {
+				So(atomic.LoadInt32(&fetches), ShouldEqual, 1)
+			})
+			Convey("The delay should grow up to the maximum", func() {
+				p.mu.Lock()
+				defer p.mu.Unlock()
+				So(p.entry("dev").failures, ShouldEqual, 1)
+				So(p.retryDelay(2), ShouldEqual, 40*time.Millisecond)
+				So(p.retryDelay(5), ShouldEqual, 40*time.Millisecond)
+			})
+			Convey("It should be retried after the backoff", func() {
+				time.Sleep(25 * time.Millisecond)
+				p.get("dev")
+				time.Sleep(10 * time.Millisecond)
+				So(atomic.LoadInt32(&fetches), ShouldEqual, 2)
+				p.mu.Lock()
+				defer p.mu.Unlock()
+				So(p.entry("dev").failures, ShouldEqual, 2)
+			})
+			Convey("The backoff should be reset on success", func() {
+				p.set("dev", account.Gateway{ID: "dev"})
+				p.mu.Lock()
+				defer p.mu.Unlock()
+				So(p.entry("dev").failures, ShouldEqual, 0)
 			})
+		})
+	})
+
+	Convey("Given a new Public GatewayInfo with a miss handler", t, func(c C) {
+		var lookups []string
+		p := newPublic().WithMissHandler(func(gatewayID string) (account.Gateway, bool, error) {
+			lookups = append(lookups, gatewayID)
+			if gatewayID == "inventory" {
+				return account.Gateway{ID: gatewayID, FrequencyPlan: "EU_868"}, true, nil
+			}
+			return account.Gateway{}, false, nil
+		})
+		Reset(p.Close)
+
+		Convey("When fetching a gateway that the handler knows", func() {
+			err := p.fetch("inventory")
 			Convey("There should be no error", func() {
 				So(err, ShouldBeNil)
 			})
+			Convey("The information of the handler should be cached", func() {
+				So(p.entry("inventory").gateway.FrequencyPlan, ShouldEqual, "EU_868")
+			})
+		})
 
-			time.Sleep(500 * time.Millisecond)
-			Convey("The info should be stored", func() {
-				gateway, _ := p.get(gatewayID)
-				So(gateway.ID, ShouldEqual, gatewayID)
+		Convey("When a gateway is already cached", func() {
+			p.setErr("inventory", ErrGatewayNotFound)
+			found := p.handleMiss("inventory")
+			Convey("The handler should not be called", func() {
+				So(found, ShouldBeFalse)
+				So(lookups, ShouldBeEmpty)
 			})
 		})
+	})
 
-		Convey("Given some stored gateway information", func() {
-			strptr := func(s string) *string { return &s }
+	Convey("Given a new Public GatewayInfo with bypassed gateways", t, func(c C) {
+		p := newPublic().WithBypass([]string{"trusted", "fleet-*"})
+		Reset(p.Close)
 
-			gatewayID := "gateway-id"
-			p.set(gatewayID, account.Gateway{
-				ID:            gatewayID,
-				FrequencyPlan: "EU_868",
-				AntennaLocation: &account.Location{
-					Latitude:  12.34,
-					Longitude: 56.78,
-				},
-				Attributes: account.GatewayAttributes{
-					Brand:       strptr("Test"),
-					Model:       strptr("Gateway"),
-					Description: strptr("My Test Gateway"),
-				},
+		Convey("Exact and prefix matches should be bypassed", func() {
+			So(p.bypassed("trusted"), ShouldBeTrue)
+			So(p.bypassed("fleet-1"), ShouldBeTrue)
+			So(p.bypassed("trusted-2"), ShouldBeFalse)
+			So(p.bypassed("dev"), ShouldBeFalse)
+		})
+
+		Convey("When a bypassed gateway connects", func() {
+			p.HandleConnect(middleware.NewContext(), &types.ConnectMessage{GatewayID: "fleet-1"})
+			Convey("Its information should not be fetched", func() {
+				So(p.entries(), ShouldNotContainKey, "fleet-1")
 			})
+		})
 
-			Convey("When sending a DisconnectMessage", func() {
-				err := p.HandleDisconnect(middleware.NewContext(), &types.DisconnectMessage{
-					GatewayID: gatewayID,
-				})
-				Convey("There should be no error", func() {
-					So(err, ShouldBeNil)
-				})
-				time.Sleep(10 * time.Millisecond)
-				Convey("The info should no longer be stored", func() {
-					gateway, _ := p.get(gatewayID)
-					So(gateway.ID, ShouldBeEmpty)
-				})
+		Convey("When a bypassed gateway sends an uplink", func() {
+			p.shard("fleet-1").info["fleet-1"] = &info{lastUpdated: time.Now(), gateway: account.Gateway{ID: "fleet-1", AntennaLocation: &account.Location{Latitude: 52, Longitude: 4}}}
+			uplink := &types.UplinkMessage{GatewayID: "fleet-1", Message: &router.UplinkMessage{}}
+			err := p.HandleUplink(middleware.NewContext(), uplink)
+			Convey("There should be no error", func() {
+				So(err, ShouldBeNil)
+			})
+			Convey("Nothing should be injected", func() {
+				So(uplink.Message.GatewayMetadata.Location, ShouldBeNil)
+			})
+			Convey("The bypass should be traced", func() {
+				So(uplink.Message.Trace, ShouldNotBeNil)
+				So(uplink.Message.Trace.Event, ShouldEqual, bypassEvent)
 			})
+		})
+	})
 
-			Convey("When sending a StatusMessage", func() {
-				status := &types.StatusMessage{
-					GatewayID: gatewayID,
-					Message:   &gateway.Status{},
+	Convey("Given a new Public GatewayInfo with a maximum number of error entries", t, func(c C) {
+		p := newPublic().WithMaxErrorEntries(2)
+
+		Convey("When storing more errors than the maximum", func() {
+			p.setErr("dev-1", ErrGatewayNotFound)
+			p.setErr("dev-2", ErrGatewayNotFound)
+			p.setErr("dev-3", ErrGatewayNotFound)
+			Convey("The oldest error should be removed", func() {
+				So(p.entries(), ShouldNotContainKey, "dev-1")
+				So(p.entries(), ShouldContainKey, "dev-2")
+				So(p.entries(), ShouldContainKey, "dev-3")
+			})
+		})
+
+		Convey("When an error entry is replaced by gateway information", func() {
+			p.setErr("dev-1", ErrGatewayNotFound)
+			p.set("dev-1", account.Gateway{ID: "dev-1"})
+			p.setErr("dev-2", ErrGatewayNotFound)
+			p.setErr("dev-3", ErrGatewayNotFound)
+			Convey("It should no longer count as error entry", func() {
+				So(p.errors.Len(), ShouldEqual, 2)
+				So(p.entries(), ShouldContainKey, "dev-1")
+			})
+		})
+
+		Convey("When successful entries exceed the maximum", func() {
+			for _, gatewayID := range []string{"dev-1", "dev-2", "dev-3"} {
+				p.set(gatewayID, account.Gateway{ID: gatewayID})
+			}
+			Convey("They should not be removed", func() {
+				So(p.entries(), ShouldHaveLength, 3)
+			})
+		})
+	})
+
+	Convey("Given a new Public GatewayInfo with a maximum number of concurrent fetches", t, func(c C) {
+		p := newPublic().WithMaxConcurrentFetches(1)
+		Reset(p.Close)
+
+		Convey("When the maximum number of fetches is in progress", func() {
+			p.fetches <- struct{}{}
+			result := make(chan error, 1)
+			go func() { result <- p.fetch("eui-0000024b08060112") }()
+			Convey("Another fetch should wait", func() {
+				select {
+				case <-result:
+					c.So("fetch returned", ShouldBeEmpty)
+				case <-time.After(50 * time.Millisecond):
 				}
-				err := p.HandleStatus(middleware.NewContext(), status)
-				Convey("There should be no error", func() {
-					So(err, ShouldBeNil)
-				})
-				Convey("The StatusMessage should have Metadata", func() {
-					So(status.Message.GetLocation(), ShouldNotBeNil)
-					So(status.Message.GetLocation().Latitude, ShouldEqual, 12.34)
-					So(status.Message.Description, ShouldEqual, "My Test Gateway")
-					So(status.Message.Platform, ShouldEqual, "Test Gateway")
-					So(status.Message.FrequencyPlan, ShouldEqual, "EU_868")
+				Convey("Until the middleware is closed", func() {
+					p.Close()
+					So(<-result, ShouldEqual, ErrClosed)
 				})
 			})
 		})
+	})
 
+	Convey("Given a new Public GatewayInfo", t, func(c C) {
+		p := newPublic()
+		Reset(p.Close)
+		Convey("All request tokens should be available", func() {
+			So(p.AvailableTokens(), ShouldEqual, RequestBurst)
+		})
+		Convey("When a token is used", func() {
+			<-p.available
+			Convey("One less token should be available", func() {
+				So(p.AvailableTokens(), ShouldEqual, RequestBurst-1)
+			})
+		})
 	})
 
-	Convey("Given a new Public GatewayInfo that Expires", t, func(c C) {
-		p := NewPublic("https://account.thethingsnetwork.org").WithExpire(10 * time.Millisecond)
-		gatewayID := "eui-0000024b08060112"
+	Convey("Given a closed Public GatewayInfo", t, func(c C) {
+		p := newPublic()
+		p.Close()
 
-		Convey("When setting the info of a Gateway", func() {
-			p.set(gatewayID, account.Gateway{})
-			lastUpdated := p.info[gatewayID].lastUpdated
-			Convey("When getting the info of a Gateway some time later", func() {
-				time.Sleep(20 * time.Millisecond)
-				p.get(gatewayID)
-				time.Sleep(500 * time.Millisecond)
-				Convey("It should have updated", func() {
-					So(p.info[gatewayID].lastUpdated, ShouldNotEqual, lastUpdated)
-				})
+		Convey("When fetching the info of a Gateway", func() {
+			err := p.fetch("eui-0000024b08060112")
+			Convey("There should be an error", func() {
+				So(err, ShouldEqual, ErrClosed)
+			})
+		})
+
+		Convey("When refreshing the info of a Gateway", func() {
+			err := p.Refresh("eui-0000024b08060112")
+			Convey("The error should be ErrClosed", func() {
+				So(errors.Is(err, ErrClosed), ShouldBeTrue)
 			})
 		})
 	})
 
 	Convey("Given a new Public GatewayInfo with Redis", t, func(c C) {
-		p, _ := NewPublic("https://account.thethingsnetwork.org").WithRedis(getRedisClient(), "test-public")
+		p, _ := newPublic().WithRedis(getRedisClient(), "test-public")
 		gatewayID := "eui-0000024b08060112"
 		Reset(func() {
 			getRedisClient().Del(p.redisKey(gatewayID)).Err()
@@ -168,7 +2664,7 @@ func TestPublic(t *testing.T) {
 		})
 		Convey("After re-initializing", func() {
 			getRedisClient().Set(p.redisKey(gatewayID), `{"activated":true}`, 0).Err()
-			p.info = make(map[string]*info)
+			p.shards = newShards(len(p.shards))
 			_, err := p.WithRedis(getRedisClient(), "test-public")
 			Convey("There should be no error", func() {
 				So(err, ShouldBeNil)
@@ -185,3 +2681,165 @@ func TestPublic(t *testing.T) {
 		})
 	})
 }
+
+func TestDownlinkInfo(t *testing.T) {
+	Convey("Given a Public GatewayInfo with a Gateway", t, func(c C) {
+		p := newPublic()
+		Reset(p.Close)
+		antenna := "omni"
+		p.set("dev", account.Gateway{
+			ID:              "dev",
+			FrequencyPlan:   "EU_868",
+			AntennaLocation: &account.Location{Latitude: 12.34, Longitude: 56.78},
+			Attributes:      account.GatewayAttributes{AntennaType: &antenna},
+		})
+
+		Convey("When sending a DownlinkMessage", func() {
+			ctx := middleware.NewContext()
+			So(p.HandleDownlink(ctx, &types.DownlinkMessage{GatewayID: "dev", Message: &router.DownlinkMessage{}}), ShouldBeNil)
+			Convey("The gateway information should be set in the context", func() {
+				info, ok := DownlinkInfoFromContext(ctx)
+				So(ok, ShouldBeTrue)
+				So(info.FrequencyPlan, ShouldEqual, "EU_868")
+				So(info.Location.Latitude, ShouldAlmostEqual, 12.34, 0.001)
+				So(info.AntennaType, ShouldEqual, "omni")
+			})
+		})
+
+		Convey("When sending a DownlinkMessage of a bypassed Gateway", func() {
+			p.WithBypass([]string{"dev"})
+			ctx := middleware.NewContext()
+			p.HandleDownlink(ctx, &types.DownlinkMessage{GatewayID: "dev"})
+			Convey("The gateway information should not be set in the context", func() {
+				_, ok := DownlinkInfoFromContext(ctx)
+				So(ok, ShouldBeFalse)
+			})
+		})
+	})
+}
+
+func TestWrapErr(t *testing.T) {
+	Convey("Given errors returned by the account server", t, func(c C) {
+		Convey("A 404 should be ErrGatewayNotFound", func() {
+			err := wrapErr(util.HTTPError{Code: 404, Message: "Not Found"})
+			So(errors.Is(err, ErrGatewayNotFound), ShouldBeTrue)
+			var httpErr util.HTTPError
+			So(errors.As(err, &httpErr), ShouldBeTrue)
+			So(httpErr.Code, ShouldEqual, 404)
+		})
+		Convey("A 429 should be ErrRateLimited", func() {
+			err := wrapErr(util.HTTPError{Code: 429, Message: "Too Many Requests"})
+			So(errors.Is(err, ErrRateLimited), ShouldBeTrue)
+		})
+		Convey("Other errors should be ErrAccountUnavailable", func() {
+			So(errors.Is(wrapErr(util.HTTPError{Code: 500}), ErrAccountUnavailable), ShouldBeTrue)
+			So(errors.Is(wrapErr(errors.New("connection refused")), ErrAccountUnavailable), ShouldBeTrue)
+		})
+		Convey("A nil error should stay nil", func() {
+			So(wrapErr(nil), ShouldBeNil)
+		})
+	})
+}
+
+func TestAdapter(t *testing.T) {
+	Convey("Given gateway information without attributes and location", t, func(c C) {
+		var info account.Gateway
+
+		Convey("The accessors should return zero values", func() {
+			So(stringValue(nil), ShouldBeEmpty)
+			So(brand(info), ShouldBeEmpty)
+			So(model(info), ShouldBeEmpty)
+			So(platform(info), ShouldBeEmpty)
+			So(description(info), ShouldBeEmpty)
+			So(hasAntennaLocation(info), ShouldBeFalse)
+			So(cachedLocation(info), ShouldBeNil)
+		})
+	})
+
+	Convey("Given gateway information with attributes and location", t, func(c C) {
+		brandName, modelName, desc := "Kerlink", "iBTS", "Rooftop"
+		info := account.Gateway{
+			Attributes:      account.GatewayAttributes{Brand: &brandName, Model: &modelName, Description: &desc},
+			AntennaLocation: &account.Location{Latitude: 52.5, Longitude: 4.5, Altitude: 10},
+		}
+
+		Convey("The accessors should return the values", func() {
+			So(brand(info), ShouldEqual, "Kerlink")
+			So(model(info), ShouldEqual, "iBTS")
+			So(platform(info), ShouldEqual, "Kerlink iBTS")
+			So(description(info), ShouldEqual, "Rooftop")
+			So(hasAntennaLocation(info), ShouldBeTrue)
+			So(cachedLocation(info).Altitude, ShouldEqual, 10)
+			So(cachedLocation(info).Source, ShouldEqual, gateway.LocationMetadata_REGISTRY)
+		})
+
+		Convey("The platform should only contain the model if there is no brand", func() {
+			info.Attributes.Brand = nil
+			So(platform(info), ShouldEqual, "iBTS")
+		})
+	})
+}
+
+func BenchmarkHandleUplink(b *testing.B) {
+	const gateways = 1000
+	gatewayIDs := make([]string, gateways)
+	for i := range gatewayIDs {
+		gatewayIDs[i] = fmt.Sprintf("gateway-%d", i)
+	}
+	for _, bm := range []struct {
+		name     string
+		location gateway.LocationMetadata
+		injector FieldInjector
+	}{
+		{name: "Complete", location: gateway.LocationMetadata{Latitude: 1, Longitude: 2, Altitude: 3}},
+		{name: "CompleteWithoutFastPath", location: gateway.LocationMetadata{Latitude: 1, Longitude: 2, Altitude: 3}, injector: DefaultFieldInjector{}},
+		{name: "MissingLocation"},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			p := newPublic()
+			defer p.Close()
+			if bm.injector != nil {
+				p.WithFieldInjector(bm.injector)
+			}
+			for _, gatewayID := range gatewayIDs {
+				p.set(gatewayID, account.Gateway{ID: gatewayID, AntennaLocation: &account.Location{Latitude: 1, Longitude: 2, Altitude: 3}})
+			}
+			ctx := middleware.NewContext()
+			msg := &types.UplinkMessage{Message: &router.UplinkMessage{}}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				location := bm.location
+				msg.GatewayID = gatewayIDs[i%gateways]
+				msg.Message.GatewayMetadata.Location = &location
+				msg.Message.Trace = nil
+				p.HandleUplink(ctx, msg)
+			}
+		})
+	}
+}
+
+func BenchmarkCacheShards(b *testing.B) {
+	const gateways = 10000
+	gatewayIDs := make([]string, gateways)
+	for i := range gatewayIDs {
+		gatewayIDs[i] = fmt.Sprintf("gateway-%d", i)
+	}
+	for _, shards := range []int{1, DefaultCacheShards, 64} {
+		b.Run(fmt.Sprintf("Shards=%d", shards), func(b *testing.B) {
+			p := newPublic().WithCacheShards(shards)
+			defer p.Close()
+			for _, gatewayID := range gatewayIDs {
+				p.set(gatewayID, account.Gateway{ID: gatewayID, FrequencyPlan: "EU_868"})
+			}
+			var next uint32
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := int(atomic.AddUint32(&next, 7919))
+				for pb.Next() {
+					p.get(gatewayIDs[i%gateways], FieldFrequencyPlan)
+					i++
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package gatewayinfo
+
+import "time"
+
+// WithDisconnectGrace delays removing the gateway information of disconnected gateways. If the gateway connects
+// again within the grace period, its information is kept, so that flapping gateways are not fetched again on every
+// reconnect. The default of 0 removes the information immediately.
+func (p *Public) WithDisconnectGrace(grace time.Duration) *Public {
+	p.disconnectGrace = grace
+	return p
+}
+
+// scheduleDisconnect removes the gateway information after the disconnect grace period, or after the minimum fetch
+// interval if that passes later
+func (p *Public) scheduleDisconnect(gatewayID string) {
+	grace := p.disconnectGrace
+	if remaining := p.fetchIntervalRemaining(gatewayID); remaining > grace {
+		grace = remaining
+	}
+	if grace == 0 {
+		p.background(func() { p.disconnect(gatewayID) })
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.pendingDisconnects == nil {
+		p.pendingDisconnects = make(map[string]*time.Timer)
+	}
+	if timer, ok := p.pendingDisconnects[gatewayID]; ok {
+		timer.Stop()
+	}
+	var timer *time.Timer
+	timer = time.AfterFunc(grace, func() {
+		p.mu.Lock()
+		if p.pendingDisconnects[gatewayID] != timer {
+			p.mu.Unlock()
+			return
+		}
+		delete(p.pendingDisconnects, gatewayID)
+		p.mu.Unlock()
+		p.disconnect(gatewayID)
+	})
+	p.pendingDisconnects[gatewayID] = timer
+}
+
+// cancelDisconnect cancels the removal of gateway information of a gateway that connected again, and returns
+// whether there was a pending removal
+func (p *Public) cancelDisconnect(gatewayID string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	timer, ok := p.pendingDisconnects[gatewayID]
+	if ok {
+		timer.Stop()
+		delete(p.pendingDisconnects, gatewayID)
+	}
+	return ok
+}
+
+// disconnect removes the gateway information of a disconnected gateway
+func (p *Public) disconnect(gatewayID string) {
+	resolved := p.resolve(gatewayID)
+	p.unset(p.key(resolved))
+	p.setNetwork(resolved, "")
+	p.forget(gatewayID)
+}
@@ -0,0 +1,138 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package gatewayinfo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/TheThingsNetwork/gateway-connector-bridge/events"
+)
+
+// DefaultHealthInterval is the default minimum interval between two probes of the account server
+var DefaultHealthInterval = 30 * time.Second
+
+// DefaultHealthThreshold is the default number of consecutive failed probes after which the account server is
+// considered unhealthy
+var DefaultHealthThreshold = 3
+
+// HealthTimeout is the timeout of a single probe of the account server
+var HealthTimeout = 5 * time.Second
+
+// ErrAccountServerUnhealthy is returned by CheckHealth if the account server could not be reached
+var ErrAccountServerUnhealthy = errors.New("gatewayinfo: account server unreachable")
+
+type health struct {
+	mu        sync.Mutex
+	interval  time.Duration
+	threshold int
+	probed    time.Time
+	failures  int
+	err       error
+	events    *events.Notifier
+}
+
+// WithHealthCheck configures how often CheckHealth may probe the account server, and after how many consecutive
+// failed probes the account server is considered unhealthy.
+func (p *Public) WithHealthCheck(interval time.Duration, threshold int) *Public {
+	p.health.mu.Lock()
+	defer p.health.mu.Unlock()
+	p.health.interval = interval
+	p.health.threshold = threshold
+	return p
+}
+
+// WithEvents sets the Notifier that receives AccountServerDown and AccountServerUp events when CheckHealth detects
+// that the health of the account server changed
+func (p *Public) WithEvents(notifier *events.Notifier) *Public {
+	p.health.mu.Lock()
+	defer p.health.mu.Unlock()
+	p.health.events = notifier
+	return p
+}
+
+// CheckHealth returns ErrAccountServerUnhealthy if the account server could not be reached by the last probes. The
+// account server is probed at most once per interval, other calls return the result of the last probe. Responses
+// with a 4xx status (such as a 404 for an unknown gateway) mean that the account server is reachable.
+func (p *Public) CheckHealth() error {
+	p.health.mu.Lock()
+	defer p.health.mu.Unlock()
+	interval, threshold := p.health.interval, p.health.threshold
+	if interval == 0 {
+		interval = DefaultHealthInterval
+	}
+	if threshold == 0 {
+		threshold = DefaultHealthThreshold
+	}
+	if time.Since(p.health.probed) < interval {
+		return p.health.err
+	}
+	p.health.probed = time.Now()
+	if err := p.probe(context.Background()); err != nil {
+		p.health.failures++
+		p.log.WithError(err).WithField("Failures", p.health.failures).Warn("Could not reach account server")
+		if p.health.failures >= threshold {
+			if p.health.err == nil {
+				p.health.events.Emit(events.Event{
+					Kind:    events.AccountServerDown,
+					Source:  p.accountServer(),
+					Message: err.Error(),
+					Fields:  map[string]interface{}{"failures": p.health.failures},
+				})
+			}
+			p.health.err = fmt.Errorf("%w: %w", ErrAccountServerUnhealthy, err)
+			accountServerUp.Set(0)
+		}
+		return p.health.err
+	}
+	if p.health.err != nil {
+		p.health.events.Emit(events.Event{
+			Kind:    events.AccountServerUp,
+			Source:  p.accountServer(),
+			Message: "Account server is reachable again",
+		})
+	}
+	p.health.failures = 0
+	p.health.err = nil
+	accountServerUp.Set(1)
+	return nil
+}
+
+// Validate checks that the account server and Redis (if configured) can be reached. Unlike CheckHealth, it probes
+// the account server regardless of the previous probes, and does not change the reported health.
+func (p *Public) Validate(ctx context.Context) error {
+	if err := p.probe(ctx); err != nil {
+		return fmt.Errorf("%w: %w", ErrAccountServerUnhealthy, err)
+	}
+	if p.redisClient != nil {
+		if err := p.redisClient.Ping().Err(); err != nil {
+			return fmt.Errorf("gatewayinfo: could not reach Redis: %w", err)
+		}
+	}
+	return nil
+}
+
+// probe sends a HEAD request to the account server
+func (p *Public) probe(ctx context.Context) error {
+	client := p.httpClient()
+	ctx, cancel := context.WithTimeout(ctx, HealthTimeout)
+	defer cancel()
+	req, err := http.NewRequest("HEAD", p.accountServer(), nil)
+	if err != nil {
+		return err
+	}
+	res, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode >= 500 {
+		return fmt.Errorf("gatewayinfo: account server returned %s", res.Status)
+	}
+	return nil
+}
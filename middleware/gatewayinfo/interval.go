@@ -0,0 +1,48 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package gatewayinfo
+
+import "time"
+
+// WithMinFetchInterval sets the minimum interval between fetches of the same gateway. A fetch within the interval
+// after the previous fetch of the gateway completed returns the cached result (including a cached error) instead.
+// Gateways that disconnect are kept in the cache until the interval has passed (or until the disconnect grace has
+// passed, if that is longer), so that gateways that reconnect rapidly are not fetched on every connect.
+func (p *Public) WithMinFetchInterval(interval time.Duration) *Public {
+	p.minFetchInterval = interval
+	return p
+}
+
+// recentFetch returns whether the gateway was fetched within the minimum fetch interval, and the error of that
+// fetch if it was
+func (p *Public) recentFetch(gatewayID string) (bool, error) {
+	if p.minFetchInterval == 0 {
+		return false, nil
+	}
+	s := p.shard(gatewayID)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info, ok := s.info[gatewayID]
+	if !ok || info.completed.IsZero() || time.Since(info.completed) >= p.minFetchInterval {
+		return false, nil
+	}
+	info.refreshing = false
+	return true, info.err
+}
+
+// fetchIntervalRemaining returns how long it takes until the minimum fetch interval of the gateway has passed
+func (p *Public) fetchIntervalRemaining(gatewayID string) time.Duration {
+	if p.minFetchInterval == 0 {
+		return 0
+	}
+	key := p.key(p.resolve(gatewayID))
+	s := p.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info, ok := s.info[key]
+	if !ok || info.completed.IsZero() {
+		return 0
+	}
+	return p.minFetchInterval - time.Since(info.completed)
+}
@@ -0,0 +1,41 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package gatewayinfo
+
+import "strings"
+
+// InvalidatePrefix removes the information of all gateways whose ID starts with the prefix from the cache, so that
+// it is fetched again when it is needed. It returns the number of removed entries.
+func (p *Public) InvalidatePrefix(prefix string) int {
+	return p.InvalidateWhere(func(gatewayID string) bool {
+		return strings.HasPrefix(gatewayID, prefix)
+	})
+}
+
+// InvalidateWhere removes the information of all gateways for which the predicate returns true from the cache, so
+// that it is fetched again when it is needed. It returns the number of removed entries.
+func (p *Public) InvalidateWhere(predicate func(gatewayID string) bool) int {
+	var invalidated int
+	for _, s := range p.shards {
+		s.mu.Lock()
+		p.mu.Lock()
+		for key, info := range s.info {
+			_, gatewayID := splitKey(key)
+			if !predicate(gatewayID) {
+				continue
+			}
+			p.removeError(info)
+			p.resetStale(key)
+			delete(s.info, key)
+			invalidated++
+		}
+		p.mu.Unlock()
+		s.mu.Unlock()
+	}
+	invalidations.Add(float64(invalidated))
+	if invalidated > 0 {
+		p.log.WithField("Entries", invalidated).Debug("Invalidated public Gateway information")
+	}
+	return invalidated
+}
@@ -0,0 +1,47 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package gatewayinfo
+
+import (
+	"github.com/TheThingsNetwork/api/gateway"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
+)
+
+// WithLazyFetch enables or disables lazy fetching. In lazy mode, gateway information is not fetched when a gateway
+// connects, but only when an uplink or status message lacks a field that would be injected. This saves requests to
+// the account server for gateways that already send complete metadata.
+func (p *Public) WithLazyFetch(enabled bool) *Public {
+	p.lazyFetch = enabled
+	return p
+}
+
+func missingLocation(location *gateway.LocationMetadata) bool {
+	return location == nil || location.IsZero()
+}
+
+// completeUplink returns whether an uplink message with the location already has all the fields that would be
+// injected, so that the gateway information does not have to be looked up at all, even if fetching is not lazy.
+// This is only known for the DefaultFieldInjector, which does not change complete locations, and not if conflicts
+// are reported, because they are detected by comparing with the gateway information.
+func (p *Public) completeUplink(location *gateway.LocationMetadata) bool {
+	return p.fieldInjector == nil && !p.reportConflicts && !missingLocation(location) && location.Altitude != 0
+}
+
+// needsStatusInfo returns whether the status message lacks a field that would be injected
+func (p *Public) needsStatusInfo(msg *types.StatusMessage) bool {
+	if missingLocation(msg.Message.Location) || msg.Message.FrequencyPlan == "" || msg.Message.Platform == "" || msg.Message.Description == "" {
+		return true
+	}
+	if p.injectFlags {
+		if _, ok := msg.Attributes[AutoUpdateAttribute]; !ok {
+			return true
+		}
+	}
+	for _, key := range p.attributeKeys {
+		if _, ok := msg.Attributes[p.attributeMapping[key]]; !ok {
+			return true
+		}
+	}
+	return false
+}
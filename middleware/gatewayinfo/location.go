@@ -0,0 +1,116 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package gatewayinfo
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/TheThingsNetwork/api/gateway"
+	"github.com/TheThingsNetwork/go-account-lib/account"
+)
+
+// ErrInvalidBoundingBox is returned when a bounding box can not be parsed or is out of range
+var ErrInvalidBoundingBox = errors.New("gatewayinfo: invalid bounding box")
+
+// Reasons for rejecting the location of a gateway
+const (
+	locationUnsurveyed  = "unsurveyed antenna"
+	locationZero        = "zero coordinates"
+	locationOutOfRange  = "out of range"
+	locationOutOfBounds = "outside bounding box"
+)
+
+// BoundingBox is the region in which gateways are expected to be. If MinLongitude is larger than MaxLongitude, the
+// box crosses the antimeridian.
+type BoundingBox struct {
+	MinLatitude  float64
+	MinLongitude float64
+	MaxLatitude  float64
+	MaxLongitude float64
+}
+
+// ParseBoundingBox parses a bounding box in the "min-lat,min-lng,max-lat,max-lng" format
+func ParseBoundingBox(s string) (box BoundingBox, err error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return box, ErrInvalidBoundingBox
+	}
+	var values [4]float64
+	for i, part := range parts {
+		if values[i], err = strconv.ParseFloat(strings.TrimSpace(part), 64); err != nil {
+			return box, ErrInvalidBoundingBox
+		}
+	}
+	box = BoundingBox{MinLatitude: values[0], MinLongitude: values[1], MaxLatitude: values[2], MaxLongitude: values[3]}
+	if !inRange(box.MinLatitude, box.MinLongitude) || !inRange(box.MaxLatitude, box.MaxLongitude) || box.MinLatitude > box.MaxLatitude {
+		return BoundingBox{}, ErrInvalidBoundingBox
+	}
+	return box, nil
+}
+
+// Contains returns whether the coordinates are in the bounding box
+func (b BoundingBox) Contains(latitude, longitude float64) bool {
+	if latitude < b.MinLatitude || latitude > b.MaxLatitude {
+		return false
+	}
+	if b.MinLongitude > b.MaxLongitude {
+		return longitude >= b.MinLongitude || longitude <= b.MaxLongitude
+	}
+	return longitude >= b.MinLongitude && longitude <= b.MaxLongitude
+}
+
+func inRange(latitude, longitude float64) bool {
+	return math.Abs(latitude) <= 90 && math.Abs(longitude) <= 180 // false for NaN
+}
+
+// WithLocationCheck enables or disables the sanity check of locations from the account server. Locations at 0,0
+// (usually a gateway of which the location was never set) and coordinates out of range (usually swapped latitude and
+// longitude) are not injected. Antennas of which all coordinates are zero (never surveyed) are not injected, also
+// without the location check.
+func (p *Public) WithLocationCheck(enabled bool) *Public {
+	p.locationCheck = enabled
+	return p
+}
+
+// WithLocationBounds enables the location check (see WithLocationCheck), and also does not inject locations from
+// the account server that are outside the region in which the gateways are expected to be
+func (p *Public) WithLocationBounds(box BoundingBox) *Public {
+	p.locationCheck = true
+	p.locationBounds = &box
+	return p
+}
+
+// unsurveyed returns whether all coordinates of the antenna location are zero, which is how the account server
+// returns antennas of which the location was never surveyed
+func unsurveyed(location *account.Location) bool {
+	return location.Latitude == 0 && location.Longitude == 0 && location.Altitude == 0
+}
+
+// checkedLocation returns the cached location of the gateway, or nil and the reason why it was rejected if it does
+// not pass the location check. Unsurveyed antennas are rejected even if the location check is disabled.
+func (p *Public) checkedLocation(info account.Gateway) (*gateway.LocationMetadata, string) {
+	location := cachedLocation(info)
+	if location == nil {
+		return nil, ""
+	}
+	if unsurveyed(info.AntennaLocation) {
+		return nil, locationUnsurveyed
+	}
+	if !p.locationCheck {
+		return location, ""
+	}
+	latitude, longitude := info.AntennaLocation.Latitude, info.AntennaLocation.Longitude
+	switch {
+	case latitude == 0 && longitude == 0:
+		return nil, locationZero
+	case !inRange(latitude, longitude):
+		return nil, locationOutOfRange
+	case p.locationBounds != nil && !p.locationBounds.Contains(latitude, longitude):
+		return nil, locationOutOfBounds
+	}
+	return location, ""
+}
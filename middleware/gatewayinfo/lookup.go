@@ -0,0 +1,46 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package gatewayinfo
+
+import "github.com/TheThingsNetwork/gateway-connector-bridge/types"
+
+const lookupKeyEvent = "lookup key"
+
+// LookupKeyFunc transforms a gateway ID to the key that is used to look up the gateway on the account server
+type LookupKeyFunc func(gatewayID string) string
+
+// WithLookupKeyFunc sets a function that transforms gateway IDs before they are looked up on the account server,
+// for example to normalize the case or to strip a prefix. Unlike with WithResolver, the gateway information is
+// cached under the original gateway ID, and messages keep the original gateway ID.
+func (p *Public) WithLookupKeyFunc(f LookupKeyFunc) *Public {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lookupKeyFunc = f
+	return p
+}
+
+// lookupKey returns the key that is used to look up the (resolved) gateway ID on the account server
+func (p *Public) lookupKey(gatewayID string) string {
+	p.mu.Lock()
+	f := p.lookupKeyFunc
+	p.mu.Unlock()
+	if f == nil {
+		return gatewayID
+	}
+	if key := f(gatewayID); key != "" {
+		return key
+	}
+	return gatewayID
+}
+
+// traceLookupKey adds the lookup key to the trace of the uplink message if it is not the gateway ID
+func (p *Public) traceLookupKey(msg *types.UplinkMessage) {
+	if !types.Tracing(types.TraceVerbose) {
+		return
+	}
+	gatewayID := p.resolve(msg.GatewayID)
+	if key := p.lookupKey(gatewayID); key != gatewayID {
+		msg.Message.Trace = msg.Message.Trace.WithEvent(lookupKeyEvent, "key", key)
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package gatewayinfo
+
+import "github.com/TheThingsNetwork/go-account-lib/account"
+
+// mergeGateway merges newly fetched gateway information into previously fetched information, so that fields that
+// are missing from a partial response are not lost. Non-empty fields of next take precedence over those of prev.
+// Booleans can not be distinguished from missing fields, so they are always taken from next.
+func mergeGateway(prev, next account.Gateway) account.Gateway {
+	mergeString(&next.ID, prev.ID)
+	mergeString(&next.FrequencyPlan, prev.FrequencyPlan)
+	mergeString(&next.FrequencyPlanURL, prev.FrequencyPlanURL)
+	mergeString(&next.Key, prev.Key)
+	mergeString(&next.Owner.ID, prev.Owner.ID)
+	mergeString(&next.Owner.Username, prev.Owner.Username)
+	if next.AntennaLocation == nil {
+		next.AntennaLocation = prev.AntennaLocation
+	}
+	if next.Token == nil {
+		next.Token = prev.Token
+	}
+	if next.Router == nil {
+		next.Router = prev.Router
+	}
+	if len(next.Collaborators) == 0 {
+		next.Collaborators = prev.Collaborators
+	}
+	if len(next.FallbackRouters) == 0 {
+		next.FallbackRouters = prev.FallbackRouters
+	}
+	mergeStringPtr(&next.Attributes.Brand, prev.Attributes.Brand)
+	mergeStringPtr(&next.Attributes.Model, prev.Attributes.Model)
+	mergeStringPtr(&next.Attributes.AntennaType, prev.Attributes.AntennaType)
+	mergeStringPtr(&next.Attributes.AntennaModel, prev.Attributes.AntennaModel)
+	mergeStringPtr(&next.Attributes.Description, prev.Attributes.Description)
+	if next.Attributes.Placement == nil {
+		next.Attributes.Placement = prev.Attributes.Placement
+	}
+	return next
+}
+
+func mergeString(next *string, prev string) {
+	if *next == "" {
+		*next = prev
+	}
+}
+
+func mergeStringPtr(next **string, prev *string) {
+	if *next == nil {
+		*next = prev
+	}
+}
@@ -0,0 +1,249 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package gatewayinfo
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var errorEntries = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Namespace: "ttn",
+		Subsystem: "bridge",
+		Name:      "gatewayinfo_error_entries",
+		Help:      "Number of gateways for which fetching public gateway information failed.",
+	},
+)
+
+var concurrentFetches = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Namespace: "ttn",
+		Subsystem: "bridge",
+		Name:      "gatewayinfo_concurrent_fetches",
+		Help:      "Number of requests to the account server that are in progress.",
+	},
+)
+
+var backgroundQueue = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Namespace: "ttn",
+		Subsystem: "bridge",
+		Name:      "gatewayinfo_background_queue",
+		Help:      "Number of background tasks of connects and disconnects that are waiting for a worker.",
+	},
+)
+
+var staleServes = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Namespace: "ttn",
+		Subsystem: "bridge",
+		Name:      "gatewayinfo_stale_serves_total",
+		Help:      "Total number of times that public gateway information was served past its expire.",
+	},
+)
+
+var staleRefusals = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Namespace: "ttn",
+		Subsystem: "bridge",
+		Name:      "gatewayinfo_stale_refusals_total",
+		Help:      "Total number of times that public gateway information was not served because it exceeded the maximum stale age.",
+	},
+)
+
+var oldestStaleAge = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Namespace: "ttn",
+		Subsystem: "bridge",
+		Name:      "gatewayinfo_oldest_stale_age_seconds",
+		Help:      "Age of the oldest public gateway information that was served past its expire.",
+	},
+)
+
+var invalidations = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Namespace: "ttn",
+		Subsystem: "bridge",
+		Name:      "gatewayinfo_invalidations_total",
+		Help:      "Total number of public gateway information entries that were invalidated.",
+	},
+)
+
+var accountServerUp = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Namespace: "ttn",
+		Subsystem: "bridge",
+		Name:      "gatewayinfo_account_server_up",
+		Help:      "Whether the account server could be reached by the last health probe.",
+	},
+)
+
+var injections = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "ttn",
+		Subsystem: "bridge",
+		Name:      "gatewayinfo_injections_total",
+		Help:      "Total number of fields handled by gateway information injection, by outcome.",
+	}, []string{"field", "outcome"},
+)
+
+var tenantFetches = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "ttn",
+		Subsystem: "bridge",
+		Name:      "gatewayinfo_tenant_fetches_total",
+		Help:      "Total number of requests for public gateway information per tenant.",
+	}, []string{"tenant"},
+)
+
+var fetchPriorityQueue = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Namespace: "ttn",
+		Subsystem: "bridge",
+		Name:      "gatewayinfo_fetch_priority_queue",
+		Help:      "Number of requests for public gateway information that wait for the rate limiter per priority.",
+	}, []string{"priority"},
+)
+
+var regionalFetches = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "ttn",
+		Subsystem: "bridge",
+		Name:      "gatewayinfo_regional_fetches_total",
+		Help:      "Total number of requests for public gateway information to regional account servers per gateway ID prefix.",
+	}, []string{"prefix"},
+)
+
+var tenantRateLimited = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "ttn",
+		Subsystem: "bridge",
+		Name:      "gatewayinfo_tenant_rate_limited_total",
+		Help:      "Total number of requests for public gateway information that waited for the rate limit of their tenant.",
+	}, []string{"tenant"},
+)
+
+var replicaFallbacks = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Namespace: "ttn",
+		Subsystem: "bridge",
+		Name:      "gatewayinfo_replica_fallbacks_total",
+		Help:      "Total number of requests for public gateway information that fell back from the read replica to the account server.",
+	},
+)
+
+var fetchQueueOverflows = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Namespace: "ttn",
+		Subsystem: "bridge",
+		Name:      "gatewayinfo_fetch_queue_overflows_total",
+		Help:      "Total number of public gateway information fetches that were dropped because the fetch queue was full.",
+	},
+)
+
+var invalidLocations = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "ttn",
+		Subsystem: "bridge",
+		Name:      "gatewayinfo_invalid_locations_total",
+		Help:      "Total number of times that a location from the account server was not injected because it did not pass the location check.",
+	}, []string{"reason"},
+)
+
+var pendingFetches = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Namespace: "ttn",
+		Subsystem: "bridge",
+		Name:      "gatewayinfo_pending_fetches",
+		Help:      "Number of gateways without public gateway information of which the first fetch is in progress.",
+	},
+)
+
+var expiredPendingFetches = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Namespace: "ttn",
+		Subsystem: "bridge",
+		Name:      "gatewayinfo_expired_pending_fetches_total",
+		Help:      "Total number of first fetches of public gateway information that did not complete within the fetch timeout.",
+	},
+)
+
+var pendingInjections = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "ttn",
+		Subsystem: "bridge",
+		Name:      "gatewayinfo_pending_injections_total",
+		Help:      "Total number of messages that were not injected because the first fetch of public gateway information was in progress.",
+	}, []string{"message"},
+)
+
+var changedFields = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "ttn",
+		Subsystem: "bridge",
+		Name:      "gatewayinfo_changed_fields_total",
+		Help:      "Total number of fields of public gateway information that changed on refresh and were notified.",
+	}, []string{"field"},
+)
+
+var droppedChanges = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Namespace: "ttn",
+		Subsystem: "bridge",
+		Name:      "gatewayinfo_dropped_changes_total",
+		Help:      "Total number of changes of public gateway information that were dropped because the channel was full.",
+	},
+)
+
+var suppressedFetches = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Namespace: "ttn",
+		Subsystem: "bridge",
+		Name:      "gatewayinfo_suppressed_fetches_total",
+		Help:      "Total number of fetches of public gateway information that were suppressed by the minimum fetch interval.",
+	},
+)
+
+var conflicts = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "ttn",
+		Subsystem: "bridge",
+		Name:      "gatewayinfo_conflicts_total",
+		Help:      "Total number of fields of messages of which the value conflicts with public gateway information.",
+	}, []string{"field"},
+)
+
+var tokenReloads = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "ttn",
+		Subsystem: "bridge",
+		Name:      "gatewayinfo_token_reloads_total",
+		Help:      "Total number of reloads of the token file for the account server.",
+	}, []string{"result"},
+)
+
+func init() {
+	prometheus.MustRegister(errorEntries)
+	prometheus.MustRegister(concurrentFetches)
+	prometheus.MustRegister(backgroundQueue)
+	prometheus.MustRegister(staleServes)
+	prometheus.MustRegister(staleRefusals)
+	prometheus.MustRegister(oldestStaleAge)
+	prometheus.MustRegister(invalidations)
+	prometheus.MustRegister(accountServerUp)
+	prometheus.MustRegister(injections)
+	prometheus.MustRegister(tenantFetches)
+	prometheus.MustRegister(tenantRateLimited)
+	prometheus.MustRegister(regionalFetches)
+	prometheus.MustRegister(fetchPriorityQueue)
+	prometheus.MustRegister(replicaFallbacks)
+	prometheus.MustRegister(fetchQueueOverflows)
+	prometheus.MustRegister(invalidLocations)
+	prometheus.MustRegister(pendingFetches)
+	prometheus.MustRegister(expiredPendingFetches)
+	prometheus.MustRegister(pendingInjections)
+	prometheus.MustRegister(changedFields)
+	prometheus.MustRegister(droppedChanges)
+	prometheus.MustRegister(suppressedFetches)
+	prometheus.MustRegister(conflicts)
+	prometheus.MustRegister(tokenReloads)
+}
@@ -0,0 +1,43 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package gatewayinfo
+
+import "github.com/TheThingsNetwork/go-account-lib/account"
+
+// MissHandler looks up gateway information in another source than the account server. It returns whether it found
+// the gateway.
+type MissHandler func(gatewayID string) (gateway account.Gateway, found bool, err error)
+
+// WithMissHandler sets a handler that is called before fetching from the account server when there is no cache
+// entry for a gateway. If the handler finds the gateway, its information is cached and the account server is not
+// queried.
+func (p *Public) WithMissHandler(handler MissHandler) *Public {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.missHandler = handler
+	return p
+}
+
+// handleMiss calls the miss handler if there is no cache entry for the gateway, and returns whether it found the
+// gateway
+func (p *Public) handleMiss(gatewayID string) bool {
+	p.mu.Lock()
+	handler := p.missHandler
+	p.mu.Unlock()
+	cached := p.entry(gatewayID) != nil
+	if handler == nil || cached {
+		return false
+	}
+	_, id := splitKey(gatewayID)
+	gateway, found, err := handler(id)
+	if err != nil {
+		p.log.WithField("GatewayID", gatewayID).WithError(err).Warn("Could not get Gateway information from miss handler")
+		return false
+	}
+	if !found {
+		return false
+	}
+	p.set(gatewayID, gateway)
+	return true
+}
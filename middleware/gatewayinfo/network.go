@@ -0,0 +1,69 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package gatewayinfo
+
+import "strings"
+
+// Gateway information of gateways that connect with a network (see types.ConnectMessage) is cached under the key
+// "network/gateway-id", so that gateways with the same ID in different networks do not collide. Gateways that
+// connect without a network use their gateway ID as key. Uplink and status messages do not carry the network, so
+// the network of a gateway is remembered from its connect message until it disconnects. This is sufficient, as
+// the bridge only handles one connection per gateway ID at a time.
+
+const networkSeparator = "/"
+
+// WithNetworkFetcher sets the Fetcher that is used for gateways of the given network. Gateways of networks without
+// a Fetcher use the account server of the middleware.
+func (p *Public) WithNetworkFetcher(network string, fetcher Fetcher) *Public {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.networkFetchers == nil {
+		p.networkFetchers = make(map[string]Fetcher)
+	}
+	p.networkFetchers[network] = fetcher
+	return p
+}
+
+// setNetwork remembers the network of a gateway, or forgets it if network is empty
+func (p *Public) setNetwork(gatewayID, network string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if network == "" {
+		delete(p.networks, gatewayID)
+		return
+	}
+	if p.networks == nil {
+		p.networks = make(map[string]string)
+	}
+	p.networks[gatewayID] = network
+}
+
+// key returns the cache key of a (resolved) gateway ID
+func (p *Public) key(gatewayID string) string {
+	p.mu.Lock()
+	network := p.networks[gatewayID]
+	p.mu.Unlock()
+	if network == "" {
+		return gatewayID
+	}
+	return network + networkSeparator + gatewayID
+}
+
+// splitKey returns the network and gateway ID of a cache key
+func splitKey(key string) (network, gatewayID string) {
+	if idx := strings.Index(key, networkSeparator); idx >= 0 {
+		return key[:idx], key[idx+1:]
+	}
+	return "", key
+}
+
+// fetcher returns the Fetcher for a network
+func (p *Public) fetcher(network string) Fetcher {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if fetcher, ok := p.networkFetchers[network]; ok {
+		return fetcher
+	}
+	return p.defaultFetcher()
+}
@@ -0,0 +1,157 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package gatewayinfo
+
+import (
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"github.com/TheThingsNetwork/api/gateway"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
+	"github.com/TheThingsNetwork/go-utils/log"
+	"gopkg.in/yaml.v2"
+)
+
+// OverrideLocation is the location of a gateway in an overrides file
+type OverrideLocation struct {
+	Latitude  float32 `yaml:"latitude" json:"latitude"`
+	Longitude float32 `yaml:"longitude" json:"longitude"`
+	Altitude  int32   `yaml:"altitude" json:"altitude"`
+}
+
+// Override contains static metadata for a gateway that takes precedence over the gateway information from the
+// account server. Empty fields are not overridden. MinRSSI and MinSNR are the signal-quality thresholds below which
+// uplink messages are tagged (see SignalThresholds). Tags are operator-defined attributes that are injected into all messages of the gateway.
+type Override struct {
+	GPS           *OverrideLocation `yaml:"gps" json:"gps"`
+	FrequencyPlan string            `yaml:"frequency_plan" json:"frequency_plan"`
+	Platform      string            `yaml:"platform" json:"platform"`
+	Description   string            `yaml:"description" json:"description"`
+	MinRSSI       *float32          `yaml:"min_rssi" json:"min_rssi"`
+	MinSNR        *float32          `yaml:"min_snr" json:"min_snr"`
+	Timezone      string            `yaml:"timezone" json:"timezone"`
+	Firmware      string            `yaml:"firmware" json:"firmware"`
+	Tags          map[string]string `yaml:"tags" json:"tags"`
+}
+
+func (o Override) location() *gateway.LocationMetadata {
+	if o.GPS == nil {
+		return nil
+	}
+	return &gateway.LocationMetadata{
+		Latitude:  o.GPS.Latitude,
+		Longitude: o.GPS.Longitude,
+		Altitude:  o.GPS.Altitude,
+		Source:    gateway.LocationMetadata_CONFIG,
+	}
+}
+
+// LoadOverrides reads a YAML (or JSON) file that maps gateway IDs to overrides
+func LoadOverrides(filename string) (map[string]Override, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	overrides := make(map[string]Override)
+	if err := yaml.Unmarshal(data, &overrides); err != nil {
+		return nil, err
+	}
+	for gatewayID, override := range overrides {
+		if override.Timezone == "" {
+			continue
+		}
+		if _, err := time.LoadLocation(override.Timezone); err != nil {
+			return nil, fmt.Errorf("gatewayinfo: invalid time zone %q for %s: %w", override.Timezone, gatewayID, err)
+		}
+	}
+	return overrides, nil
+}
+
+// WithOverrides loads the overrides from the given file. Overrides are applied with the highest precedence, after
+// gateway information from the account server is injected. Call ReloadOverrides to read the file again. The
+// overrides are also where the metadata is configured that the account server does not provide, such as the time
+// zone, the expected firmware, the signal-quality thresholds and the tags of gateways.
+func (p *Public) WithOverrides(filename string) (*Public, error) {
+	p.overridesFile = filename
+	if err := p.ReloadOverrides(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// ReloadOverrides reads the overrides file again. If it can not be read, the previous overrides are kept.
+func (p *Public) ReloadOverrides() error {
+	if p.overridesFile == "" {
+		return nil
+	}
+	overrides, err := LoadOverrides(p.overridesFile)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.overrides = overrides
+	p.mu.Unlock()
+	p.log.WithField("Gateways", len(overrides)).Info("Loaded Gateway overrides")
+	return nil
+}
+
+func (p *Public) override(gatewayID string) (override Override, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	override, ok = p.overrides[gatewayID]
+	return
+}
+
+// Timezone returns the time zone of the gateway from the overrides, or nil if the gateway has none
+func (p *Public) Timezone(gatewayID string) *time.Location {
+	override, ok := p.override(gatewayID)
+	if !ok || override.Timezone == "" {
+		return nil
+	}
+	location, err := time.LoadLocation(override.Timezone)
+	if err != nil {
+		return nil
+	}
+	return location
+}
+
+const overrideEvent = "override"
+
+// overrideUplink applies the overrides to an uplink message
+func (p *Public) overrideUplink(msg *types.UplinkMessage) {
+	override, ok := p.override(msg.GatewayID)
+	if !ok {
+		return
+	}
+	if location := override.location(); location != nil {
+		msg.Message.GatewayMetadata.Location = location
+		if types.Tracing(types.TraceVerbose) {
+			msg.Message.Trace = msg.Message.Trace.WithEvent(overrideEvent, "field", string(FieldLocation))
+		}
+	}
+}
+
+// overrideStatus applies the overrides to a status message. Status messages have no trace, so overrides are logged.
+func (p *Public) overrideStatus(msg *types.StatusMessage) {
+	override, ok := p.override(msg.GatewayID)
+	if !ok {
+		return
+	}
+	log := p.log.WithField("GatewayID", msg.GatewayID)
+	if location := override.location(); location != nil {
+		msg.Message.Location = location
+		log.WithField("Field", FieldLocation).Debug("Applied override")
+	}
+	overrideString(log, FieldFrequencyPlan, &msg.Message.FrequencyPlan, override.FrequencyPlan)
+	overrideString(log, FieldPlatform, &msg.Message.Platform, override.Platform)
+	overrideString(log, FieldDescription, &msg.Message.Description, override.Description)
+}
+
+func overrideString(log log.Interface, field Field, current *string, value string) {
+	if value != "" {
+		*current = value
+		log.WithField("Field", field).Debug("Applied override")
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package gatewayinfo
+
+import "time"
+
+// DefaultFetchTimeout is the default time after which a first fetch of a gateway that did not complete is considered
+// stuck
+var DefaultFetchTimeout = time.Minute
+
+// WithFetchTimeout sets the time after which a first fetch of a gateway that did not complete (for example because a
+// Fetcher hangs while the account server stalls) is considered stuck. Its pending state is then removed, so that the
+// pending fetches do not pile up, and the next message of the gateway starts a new fetch. The stuck fetch still
+// updates the cache if it completes later. If timeout is 0, pending fetches do not expire.
+func (p *Public) WithFetchTimeout(timeout time.Duration) *Public {
+	p.fetchTimeout = timeout
+	return p
+}
+
+// pendingFetch is a first fetch of a gateway that is in progress
+type pendingFetch struct {
+	timer    *time.Timer // expires the pending fetch after the fetch timeout, nil if it does not expire
+	connects []func()    // responses to connect messages that are sent when the fetch completes
+}
+
+// startPending records that the first fetch of a gateway without cache entry is in progress, and returns false if it
+// already was. Messages that are handled while the fetch is pending are not injected, and look up the gateway
+// information again on the next message, without starting another fetch. The caller must hold the lock of the shard.
+func (p *Public) startPending(s *shard, gatewayID string) (*pendingFetch, bool) {
+	if _, pending := s.pending[gatewayID]; pending {
+		return nil, false
+	}
+	fetch := &pendingFetch{}
+	if p.fetchTimeout > 0 {
+		fetch.timer = time.AfterFunc(p.fetchTimeout, func() { p.expirePending(gatewayID, fetch) })
+	}
+	s.pending[gatewayID] = fetch
+	pendingFetches.Inc()
+	return fetch, true
+}
+
+// finishPending records that the first fetch of a gateway is done, whether it succeeded or not, and returns false if
+// the fetch was no longer pending because it expired
+func (p *Public) finishPending(gatewayID string, fetch *pendingFetch) bool {
+	s := p.shard(gatewayID)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pending[gatewayID] != fetch {
+		return false
+	}
+	delete(s.pending, gatewayID)
+	pendingFetches.Dec()
+	if fetch.timer != nil {
+		fetch.timer.Stop()
+	}
+	return true
+}
+
+// expirePending removes the pending state of a first fetch that did not complete within the fetch timeout
+func (p *Public) expirePending(gatewayID string, fetch *pendingFetch) {
+	if !p.finishPending(gatewayID, fetch) {
+		return
+	}
+	expiredPendingFetches.Inc()
+	p.log.WithField("GatewayID", gatewayID).WithField("Timeout", p.fetchTimeout).Warn("First fetch of public Gateway information did not complete in time")
+}
+
+// skipPending records that a message was not injected because the first fetch of its gateway was in progress
+func skipPending(message string) {
+	pendingInjections.WithLabelValues(message).Inc()
+}
@@ -0,0 +1,102 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package gatewayinfo
+
+import (
+	"time"
+
+	"github.com/TheThingsNetwork/go-account-lib/account"
+)
+
+// Lister lists the IDs of the gateways for which gateway information should be prefetched
+type Lister interface {
+	ListGateways() ([]string, error)
+}
+
+// ListerFunc is a function that implements Lister
+type ListerFunc func() ([]string, error)
+
+// ListGateways implements Lister
+func (f ListerFunc) ListGateways() ([]string, error) { return f() }
+
+// AccountLister returns a Lister that lists the gateways that can be accessed with the access key on the account
+// server
+func AccountLister(accountServer, accessKey string) Lister {
+	acct := account.NewWithKey(accountServer, accessKey)
+	return ListerFunc(func() ([]string, error) {
+		gateways, err := acct.ListGateways()
+		if err != nil {
+			return nil, err
+		}
+		gatewayIDs := make([]string, len(gateways))
+		for i, gateway := range gateways {
+			gatewayIDs[i] = gateway.ID
+		}
+		return gatewayIDs, nil
+	})
+}
+
+// WithAutoPrefetch periodically lists the gateways with the lister, and fetches the information of gateways that
+// were added, so that it is available before they connect. The information of gateways that are no longer listed
+// is removed from the cache. The fetches respect RequestInterval and RequestBurst.
+func (p *Public) WithAutoPrefetch(lister Lister, interval time.Duration) *Public {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			p.prefetch(lister)
+			select {
+			case <-p.done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return p
+}
+
+// prefetch fetches the information of gateways that were added to the lister, and removes gateways that were
+// removed from the lister
+func (p *Public) prefetch(lister Lister) {
+	gatewayIDs, err := lister.ListGateways()
+	if err != nil {
+		p.log.WithError(err).Warn("Could not list gateways to prefetch")
+		return
+	}
+	listed := make(map[string]bool, len(gatewayIDs))
+	for _, gatewayID := range gatewayIDs {
+		listed[gatewayID] = true
+	}
+
+	p.mu.Lock()
+	previous := p.prefetched
+	p.prefetched = listed
+	p.mu.Unlock()
+
+	var added, removed int
+	for gatewayID := range previous {
+		if !listed[gatewayID] {
+			p.unset(p.key(p.resolve(gatewayID)))
+			removed++
+		}
+	}
+	for _, gatewayID := range gatewayIDs {
+		if previous[gatewayID] || p.bypassed(gatewayID) {
+			continue
+		}
+		key := p.key(p.resolve(gatewayID))
+		if _, ok, _ := p.cached(gatewayID); ok {
+			continue
+		}
+		if err := p.fetch(key); err == ErrClosed {
+			return
+		} else if err != nil {
+			p.log.WithField("GatewayID", gatewayID).WithError(err).Debug("Could not prefetch public Gateway information")
+		}
+		added++
+	}
+	if added > 0 || removed > 0 {
+		p.log.WithField("Added", added).WithField("Removed", removed).Info("Prefetched public Gateway information")
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package gatewayinfo
+
+import (
+	"container/heap"
+	"strconv"
+	"sync"
+)
+
+// PriorityFunc returns the fetch priority of a gateway. Gateways with a higher priority are fetched first.
+type PriorityFunc func(gatewayID string) int
+
+// WithFetchPriority makes fetches that wait for the rate limiter (see RequestInterval and RequestBurst) acquire
+// tokens in order of the priority of their gateway, so that important gateways (such as production gateways) are
+// fetched before others (such as test gateways) during a connect storm. Fetches with the same priority acquire tokens
+// in the order in which they started waiting. Without a PriorityFunc, which is the default, all fetches have the same
+// priority. The rate limits of regional account servers (see WithRegionalAccountServer) do not use priorities. It
+// must be called before the middleware is used.
+func (p *Public) WithFetchPriority(priority PriorityFunc) *Public {
+	p.priority = priority
+	if priority != nil && p.tokenQueue == nil {
+		p.tokenQueue = &tokenQueue{signal: make(chan struct{}, 1)}
+		go p.tokenQueue.dispatch(p.available, p.done)
+	}
+	return p
+}
+
+// tokenWaiter is a fetch that waits for a token of the rate limiter
+type tokenWaiter struct {
+	priority int
+	seq      uint64
+	ready    chan struct{}
+}
+
+// tokenWaiters is a heap of waiters, with the highest priority (and then the longest waiting) first
+type tokenWaiters []*tokenWaiter
+
+func (w tokenWaiters) Len() int { return len(w) }
+func (w tokenWaiters) Less(i, j int) bool {
+	if w[i].priority != w[j].priority {
+		return w[i].priority > w[j].priority
+	}
+	return w[i].seq < w[j].seq
+}
+func (w tokenWaiters) Swap(i, j int)       { w[i], w[j] = w[j], w[i] }
+func (w *tokenWaiters) Push(x interface{}) { *w = append(*w, x.(*tokenWaiter)) }
+func (w *tokenWaiters) Pop() interface{} {
+	old := *w
+	waiter := old[len(old)-1]
+	old[len(old)-1] = nil
+	*w = old[:len(old)-1]
+	return waiter
+}
+
+// tokenQueue hands out the tokens of the rate limiter to waiting fetches by priority
+type tokenQueue struct {
+	mu      sync.Mutex
+	waiters tokenWaiters
+	depth   map[int]int // number of waiters by priority
+	seq     uint64
+	signal  chan struct{}
+}
+
+// waiting returns whether fetches are waiting for a token
+func (q *tokenQueue) waiting() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.waiters) > 0
+}
+
+// wait adds a waiter with the given priority, and returns the channel that is closed when it gets a token
+func (q *tokenQueue) wait(priority int) chan struct{} {
+	q.mu.Lock()
+	q.seq++
+	waiter := &tokenWaiter{priority: priority, seq: q.seq, ready: make(chan struct{})}
+	heap.Push(&q.waiters, waiter)
+	q.setDepth(priority, 1)
+	q.mu.Unlock()
+	select {
+	case q.signal <- struct{}{}:
+	default:
+	}
+	return waiter.ready
+}
+
+// setDepth changes the number of waiters with the given priority by delta. The caller must hold q.mu.
+func (q *tokenQueue) setDepth(priority, delta int) {
+	if q.depth == nil {
+		q.depth = make(map[int]int)
+	}
+	q.depth[priority] += delta
+	fetchPriorityQueue.WithLabelValues(strconv.Itoa(priority)).Set(float64(q.depth[priority]))
+	if q.depth[priority] == 0 {
+		delete(q.depth, priority)
+	}
+}
+
+// dispatch gives each token of available to the waiter with the highest priority, until done is closed
+func (q *tokenQueue) dispatch(available, done chan struct{}) {
+	for {
+		if !q.waiting() {
+			select {
+			case <-q.signal:
+				continue
+			case <-done:
+				return
+			}
+		}
+		select {
+		case <-available:
+		case <-done:
+			return
+		}
+		q.mu.Lock()
+		waiter := heap.Pop(&q.waiters).(*tokenWaiter)
+		q.setDepth(waiter.priority, -1)
+		q.mu.Unlock()
+		close(waiter.ready)
+	}
+}
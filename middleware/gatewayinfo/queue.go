@@ -0,0 +1,64 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package gatewayinfo
+
+import "time"
+
+// WithFetchQueueBound limits the number of background fetches (of connecting gateways and of messages with missing
+// information) that wait for the rate limiter when RequestBurst is exhausted. Fetches that do not fit in the queue
+// are dropped, and fetched again on the next message of the gateway, so that connect storms do not pile up blocked
+// fetches. If bound is 0, fetches are dropped as soon as no request can be made without waiting. If bound is
+// negative, the queue is unbounded. Refresh and prefetching always wait for the rate limiter.
+func (p *Public) WithFetchQueueBound(bound int) *Public {
+	if bound >= 0 {
+		p.fetchQueue = make(chan struct{}, bound)
+	} else {
+		p.fetchQueue = nil
+	}
+	return p
+}
+
+// takeToken waits for a token of the rate limiter (p.available, or that of a region) for a fetch of a gateway. Bounded
+// fetches return ErrFetchQueueFull instead of waiting if the fetch queue is full.
+func (p *Public) takeToken(available chan struct{}, gatewayID string, bounded bool) error {
+	prioritized := p.priority != nil && p.tokenQueue != nil && available == p.available
+	// Without waiting fetches, a token can be taken right away; otherwise it goes to the fetch with the highest
+	// priority
+	if !prioritized || !p.tokenQueue.waiting() {
+		select {
+		case <-available:
+			return nil
+		default:
+		}
+	}
+	if bounded && p.fetchQueue != nil {
+		select {
+		case p.fetchQueue <- struct{}{}:
+			defer func() { <-p.fetchQueue }()
+		default:
+			fetchQueueOverflows.Inc()
+			return ErrFetchQueueFull
+		}
+	}
+	if prioritized {
+		available = p.tokenQueue.wait(p.priority(gatewayID))
+	}
+	select {
+	case <-available:
+		return nil
+	case <-p.done:
+		return ErrClosed
+	}
+}
+
+// dropFetch marks the cached information of a gateway of which the fetch was dropped as expired, so that it is
+// fetched again on the next message
+func (p *Public) dropFetch(gatewayID string) {
+	s := p.shard(gatewayID)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if info, ok := s.info[gatewayID]; ok {
+		info.lastUpdated = time.Time{}
+	}
+}
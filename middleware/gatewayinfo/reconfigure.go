@@ -0,0 +1,48 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package gatewayinfo
+
+// accountClient is the account server with the Fetcher for it. It is replaced as a whole (see Reconfigure), so that
+// fetches that are in progress complete against the client that they started with.
+type accountClient struct {
+	server  string
+	fetcher Fetcher
+}
+
+// accountServer returns the URL of the account server
+func (p *Public) accountServer() string {
+	return p.account.Load().server
+}
+
+// accountFetcher returns the Fetcher for the account server
+func (p *Public) accountFetcher() Fetcher {
+	return p.account.Load().fetcher
+}
+
+// setAccountFetcher replaces the Fetcher for the account server, keeping the account server
+func (p *Public) setAccountFetcher(fetcher Fetcher) {
+	p.account.Store(&accountClient{server: p.accountServer(), fetcher: fetcher})
+}
+
+// Reconfigure switches the gateway information middleware to another account server at runtime, for example when
+// the configuration is reloaded. The new account server uses the same HTTP client (see WithHTTPClient and
+// WithTLSConfig) and token (see WithTokenFile). Fetches that are in progress complete against the previous account
+// server; the cached gateway information is kept. It returns ErrInvalidAccountServer if the account server is not a
+// valid http or https URL.
+func (p *Public) Reconfigure(accountServer string) error {
+	accountServer, err := parseAccountServer(accountServer)
+	if err != nil {
+		return err
+	}
+	previous := p.accountServer()
+	if accountServer == previous {
+		return nil
+	}
+	p.account.Store(&accountClient{
+		server:  accountServer,
+		fetcher: &httpFetcher{server: accountServer, client: p.httpClient(), token: &p.token},
+	})
+	p.log.WithField("Previous", previous).WithField("AccountServer", accountServer).Info("Switched account server")
+	return nil
+}
@@ -0,0 +1,69 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package gatewayinfo
+
+import "time"
+
+// WithProactiveRefresh starts a background sweeper that checks the gateway information every interval and
+// refreshes entries that expire within the given lead time. The sweeper is stopped by Close.
+func (p *Public) WithProactiveRefresh(interval, lead time.Duration) *Public {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.done:
+				return
+			case <-ticker.C:
+				p.sweep(lead)
+			}
+		}
+	}()
+	return p
+}
+
+// WithReadPathRefresh enables or disables fetching gateway information when messages find it missing or expired in
+// the cache, which is enabled by default. When disabled, handling messages never starts a fetch, so that its latency
+// is predictable: expired gateway information is served until it is refreshed by the sweeper (see
+// WithProactiveRefresh) or by Refresh, and gateways that are not cached are fetched when they connect (so it should
+// not be combined with WithLazyFetch).
+func (p *Public) WithReadPathRefresh(enabled bool) *Public {
+	p.readPathRefresh = enabled
+	return p
+}
+
+// sweep refreshes the gateway information that is about to expire. The refreshes wait for the
+// rate limiter, just like the refreshes that are triggered by get().
+func (p *Public) sweep(lead time.Duration) {
+	var gatewayIDs []string
+	for _, s := range p.shards {
+		s.mu.Lock()
+		for gatewayID, info := range s.info {
+			if info.refreshing {
+				continue
+			}
+			expire := p.expireOf(info)
+			if expire == 0 || expire == uncached {
+				continue
+			}
+			if time.Since(info.lastUpdated) >= expire-lead {
+				info.refreshing = true
+				gatewayIDs = append(gatewayIDs, gatewayID)
+			}
+		}
+		s.mu.Unlock()
+	}
+
+	for _, gatewayID := range gatewayIDs {
+		gatewayID := gatewayID
+		p.background(func() {
+			log := p.log.WithField("GatewayID", gatewayID)
+			if err := p.fetch(gatewayID); err != nil {
+				log.WithError(err).Warn("Could not refresh public Gateway information")
+			} else {
+				log.Debug("Refreshed public Gateway information")
+			}
+		})
+	}
+}
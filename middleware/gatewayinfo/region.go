@@ -0,0 +1,96 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package gatewayinfo
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// region is a regional account server for the gateways of which the ID starts with prefix
+type region struct {
+	prefix    string
+	fetcher   Fetcher
+	available chan struct{} // rate-limit tokens of the regional account server
+}
+
+// WithRegionalAccountServer makes the gateway information middleware fetch the information of gateways of which the
+// ID starts with prefix from a regional account server instead of the default account server. If the prefixes of
+// multiple regions match, the longest prefix is used; gateways that match no region use the default account server.
+// Each regional account server has its own HTTP client, which starts with the settings of the client of the default
+// account server (see WithHTTPClient and WithTLSConfig) but does not share its connections, and its own rate limit
+// of a request every interval, up to burst, instead of RequestInterval and RequestBurst. Gateways of networks with a
+// Fetcher (see WithNetworkFetcher) are not routed to regions. It returns ErrInvalidAccountServer if the account
+// server is not a valid http or https URL.
+func (p *Public) WithRegionalAccountServer(prefix, accountServer string, interval time.Duration, burst int) (*Public, error) {
+	accountServer, err := parseAccountServer(accountServer)
+	if err != nil {
+		return nil, err
+	}
+	if burst <= 0 {
+		burst = 1
+	}
+	client := *p.httpClient()
+	if transport, ok := client.Transport.(*http.Transport); ok {
+		client.Transport = transport.Clone()
+	}
+	r := &region{
+		prefix:    strings.ToLower(prefix),
+		fetcher:   &httpFetcher{server: accountServer, client: &client, token: &p.token},
+		available: make(chan struct{}, burst),
+	}
+	for i := 0; i < burst; i++ {
+		r.available <- struct{}{}
+	}
+	p.mu.Lock()
+	regions := make([]*region, 0, len(p.regions)+1)
+	for _, existing := range p.regions {
+		if existing.prefix != r.prefix {
+			regions = append(regions, existing)
+		}
+	}
+	p.regions = append(regions, r)
+	p.mu.Unlock()
+	if interval > 0 {
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-p.done:
+					return
+				case <-ticker.C:
+				}
+				select {
+				case r.available <- struct{}{}:
+				default:
+				}
+			}
+		}()
+	}
+	p.log.WithField("Prefix", prefix).WithField("AccountServer", accountServer).Debug("Added regional account server")
+	return p, nil
+}
+
+// region returns the region of a gateway, or nil if the gateway uses the default account server or the Fetcher of
+// its network
+func (p *Public) region(network, gatewayID string) *region {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.regions) == 0 {
+		return nil
+	}
+	if _, ok := p.networkFetchers[network]; ok {
+		return nil
+	}
+	gatewayID = strings.ToLower(gatewayID)
+	var match *region
+	for _, r := range p.regions {
+		if strings.HasPrefix(gatewayID, r.prefix) && (match == nil || len(r.prefix) > len(match.prefix)) {
+			match = r
+		}
+	}
+	return match
+}
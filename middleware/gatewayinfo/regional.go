@@ -0,0 +1,187 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package gatewayinfo
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
+	"github.com/brocaar/lorawan"
+	"github.com/brocaar/lorawan/band"
+)
+
+// RegionalParameters are the regional parameters of the band of a frequency plan
+type RegionalParameters struct {
+	Band             string   `json:"band"`              // such as "EU_863_870"
+	UplinkChannels   []int    `json:"uplink_channels"`   // default uplink channels in Hz
+	DownlinkChannels []int    `json:"downlink_channels"` // default downlink channels in Hz
+	DataRates        []string `json:"data_rates"`        // by index, such as "SF12BW125" or "FSK50000"
+	RX2Frequency     int      `json:"rx2_frequency"`     // in Hz
+	RX2DataRate      string   `json:"rx2_data_rate"`
+	DefaultTXPower   int      `json:"default_tx_power"` // in dBm
+}
+
+// FrequencyPlanBands maps the names of frequency plans of the account server that differ from the names of their
+// bands to the bands
+var FrequencyPlanBands = map[string]string{
+	"AS_920_923": string(band.AS_923),
+	"AS_923_925": string(band.AS_923),
+}
+
+// Regional parameters that can be injected into the attributes of status messages, with RegionalAttributePrefix
+const (
+	RegionalBand             = "band"
+	RegionalUplinkChannels   = "uplink_channels"
+	RegionalDownlinkChannels = "downlink_channels"
+	RegionalDataRates        = "data_rates"
+	RegionalRX2Frequency     = "rx2_frequency"
+	RegionalRX2DataRate      = "rx2_data_rate"
+	RegionalDefaultTXPower   = "default_tx_power"
+)
+
+// RegionalAttributePrefix is the prefix of the status attributes of regional parameters
+const RegionalAttributePrefix = "regional_"
+
+// ErrUnknownRegionalParameter is returned for regional parameters that can not be injected
+var ErrUnknownRegionalParameter = errors.New("gatewayinfo: unknown regional parameter")
+
+// dataRateName returns the name of a data rate, such as "SF12BW125"
+func dataRateName(dr band.DataRate) string {
+	if dr.Modulation == band.FSKModulation {
+		return fmt.Sprintf("FSK%d", dr.BitRate)
+	}
+	return fmt.Sprintf("SF%dBW%d", dr.SpreadFactor, dr.Bandwidth)
+}
+
+func channelFrequencies(channels []band.Channel) []int {
+	frequencies := make([]int, len(channels))
+	for i, channel := range channels {
+		frequencies[i] = channel.Frequency
+	}
+	return frequencies
+}
+
+// resolveRegionalParameters returns the regional parameters of a frequency plan from the bands of the LoRaWAN
+// regional parameters, or nil if the frequency plan is not known
+func resolveRegionalParameters(frequencyPlan string) *RegionalParameters {
+	name := strings.ToUpper(frequencyPlan)
+	if bandName, ok := FrequencyPlanBands[name]; ok {
+		name = bandName
+	}
+	b, err := band.GetConfig(band.Name(name), false, lorawan.DwellTimeNoLimit)
+	if err != nil {
+		return nil
+	}
+	if band.Name(name) == band.EU_863_870 {
+		b.RX2DataRate = 3 // TTN uses SF9BW125 in RX2
+	}
+	params := &RegionalParameters{
+		Band:             name,
+		UplinkChannels:   channelFrequencies(b.UplinkChannels),
+		DownlinkChannels: channelFrequencies(b.DownlinkChannels),
+		DataRates:        make([]string, len(b.DataRates)),
+		RX2Frequency:     b.RX2Frequency,
+		DefaultTXPower:   b.DefaultTXPower,
+	}
+	for i, dr := range b.DataRates {
+		params.DataRates[i] = dataRateName(dr)
+	}
+	if b.RX2DataRate < len(params.DataRates) {
+		params.RX2DataRate = params.DataRates[b.RX2DataRate]
+	}
+	return params
+}
+
+// regionalParameters returns the (cached) regional parameters of a frequency plan, or nil if it is not known
+func (p *Public) regionalParameters(frequencyPlan string) *RegionalParameters {
+	if frequencyPlan == "" {
+		return nil
+	}
+	p.mu.Lock()
+	params, ok := p.regional[frequencyPlan]
+	p.mu.Unlock()
+	if ok {
+		return params
+	}
+	params = resolveRegionalParameters(frequencyPlan)
+	p.mu.Lock()
+	if p.regional == nil {
+		p.regional = make(map[string]*RegionalParameters)
+	}
+	p.regional[frequencyPlan] = params
+	p.mu.Unlock()
+	return params
+}
+
+// RegionalParameters returns the regional parameters of the frequency plan of a gateway, and false if the frequency
+// plan is not known (yet) or has no regional parameters. The regional parameters are shared between gateways with the
+// same frequency plan, so they must not be modified.
+func (p *Public) RegionalParameters(gatewayID string) (*RegionalParameters, bool) {
+	info, _ := p.get(gatewayID, FieldFrequencyPlan)
+	params := p.regionalParameters(info.FrequencyPlan)
+	return params, params != nil
+}
+
+// WithInjectRegionalParameters sets the regional parameters (such as RegionalRX2Frequency) of the frequency plan of
+// gateways that are injected into the attributes of status messages, with RegionalAttributePrefix. Lists are
+// injected as comma-separated values. It returns ErrUnknownRegionalParameter for unknown parameters.
+func (p *Public) WithInjectRegionalParameters(params []string) (*Public, error) {
+	for _, param := range params {
+		switch param {
+		case RegionalBand, RegionalUplinkChannels, RegionalDownlinkChannels, RegionalDataRates,
+			RegionalRX2Frequency, RegionalRX2DataRate, RegionalDefaultTXPower:
+		default:
+			return nil, fmt.Errorf("%w: %q", ErrUnknownRegionalParameter, param)
+		}
+	}
+	p.injectRegional = params
+	return p, nil
+}
+
+func joinInts(values []int) string {
+	s := make([]string, len(values))
+	for i, value := range values {
+		s[i] = strconv.Itoa(value)
+	}
+	return strings.Join(s, ",")
+}
+
+// regionalValue returns the value of a regional parameter as attribute value
+func regionalValue(params *RegionalParameters, param string) string {
+	switch param {
+	case RegionalBand:
+		return params.Band
+	case RegionalUplinkChannels:
+		return joinInts(params.UplinkChannels)
+	case RegionalDownlinkChannels:
+		return joinInts(params.DownlinkChannels)
+	case RegionalDataRates:
+		return strings.Join(params.DataRates, ",")
+	case RegionalRX2Frequency:
+		return strconv.Itoa(params.RX2Frequency)
+	case RegionalRX2DataRate:
+		return params.RX2DataRate
+	case RegionalDefaultTXPower:
+		return strconv.Itoa(params.DefaultTXPower)
+	}
+	return ""
+}
+
+// injectRegionalParameters injects the selected regional parameters of the frequency plan of the status message
+func (p *Public) injectRegionalParameters(msg *types.StatusMessage) {
+	if len(p.injectRegional) == 0 {
+		return
+	}
+	params := p.regionalParameters(msg.Message.FrequencyPlan)
+	if params == nil {
+		return
+	}
+	for _, param := range p.injectRegional {
+		setAttribute(msg, RegionalAttributePrefix+param, regionalValue(params, param))
+	}
+	p.log.WithField("GatewayID", msg.GatewayID).WithField("Band", params.Band).Debug("Injected regional parameters")
+}
@@ -0,0 +1,61 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package gatewayinfo
+
+import (
+	"time"
+
+	"github.com/TheThingsNetwork/go-account-lib/account"
+)
+
+// WithReadEndpoint makes the gateway information middleware fetch gateway information from a read-only replica of
+// the account server, to offload the primary account server. If the replica fails (also if it does not know the
+// gateway yet), the information is fetched from the primary account server. The replica uses the same HTTP
+// client as the primary account server (see WithHTTPClient and WithTLSConfig). It returns ErrInvalidAccountServer if
+// the read endpoint is not a valid http or https URL.
+func (p *Public) WithReadEndpoint(readEndpoint string) (*Public, error) {
+	readEndpoint, err := parseAccountServer(readEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	p.readEndpoint = readEndpoint
+	p.mu.Unlock()
+	return p, nil
+}
+
+// defaultFetcher returns the Fetcher for gateways without a network. The caller must hold p.mu.
+func (p *Public) defaultFetcher() Fetcher {
+	if p.readEndpoint == "" {
+		return p.accountFetcher()
+	}
+	return &replicaFetcher{
+		replica: &httpFetcher{server: p.readEndpoint, client: p.httpClient(), token: &p.token},
+		primary: p.accountFetcher(),
+	}
+}
+
+// replicaFetcher fetches from a replica, and falls back to the primary if the replica fails
+type replicaFetcher struct {
+	replica *httpFetcher
+	primary Fetcher
+}
+
+func (f *replicaFetcher) FindGateway(gatewayID string) (gateway account.Gateway, err error) {
+	gateway, _, err = f.FindGatewayTTL(gatewayID)
+	return gateway, err
+}
+
+func (f *replicaFetcher) FindGatewayTTL(gatewayID string) (account.Gateway, time.Duration, error) {
+	gateway, ttl, err := f.replica.FindGatewayTTL(gatewayID)
+	if err == nil {
+		return gateway, ttl, nil
+	}
+	replicaFallbacks.Inc()
+	if primary, ok := f.primary.(ttlFetcher); ok {
+		return primary.FindGatewayTTL(gatewayID)
+	}
+	gateway, err = f.primary.FindGateway(gatewayID)
+	return gateway, 0, err
+}
@@ -0,0 +1,107 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package gatewayinfo
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Resolver resolves the identifier that a connector uses for a gateway to the ID that the account server uses
+type Resolver func(gatewayID string) (string, error)
+
+// ResolveErrorTTL sets how long a gateway identifier that could not be resolved is used unchanged before the
+// resolver is tried again
+var ResolveErrorTTL = 30 * time.Second
+
+// maxUnresolved caps the number of identifiers that could not be resolved that are cached
+const maxUnresolved = 10000
+
+// WithResolver sets a resolver that is used to translate gateway identifiers before fetching and caching
+// gateway information. The resolved identifiers are cached, so that messages with either identifier use
+// the same gateway information. Identifiers that could not be resolved are cached for ResolveErrorTTL.
+func (p *Public) WithResolver(resolver Resolver) *Public {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.resolver = resolver
+	p.resolved = make(map[string]string)
+	p.unresolved = make(map[string]time.Time)
+	return p
+}
+
+var errNotAnEUI = errors.New("gatewayinfo: not an EUI")
+
+// EUIToID is a Resolver that translates gateway EUIs to the "eui-" IDs used by the account server.
+// Identifiers that are not an EUI are returned unchanged.
+func EUIToID(gatewayID string) (string, error) {
+	if strings.HasPrefix(gatewayID, "eui-") {
+		return gatewayID, nil
+	}
+	eui, err := hex.DecodeString(gatewayID)
+	if err != nil || len(eui) != 8 {
+		return gatewayID, errNotAnEUI
+	}
+	return "eui-" + hex.EncodeToString(eui), nil
+}
+
+func (p *Public) resolve(gatewayID string) string {
+	p.mu.Lock()
+	resolver := p.resolver
+	resolved, ok := p.resolved[gatewayID]
+	retry, failed := p.unresolved[gatewayID]
+	p.mu.Unlock()
+	if resolver == nil {
+		return gatewayID
+	}
+	if ok {
+		return resolved
+	}
+	if failed && time.Now().Before(retry) {
+		return gatewayID
+	}
+	resolved, err := resolver(gatewayID)
+	if err != nil || resolved == "" {
+		p.log.WithField("GatewayID", gatewayID).WithError(err).Debug("Could not resolve Gateway ID")
+		p.mu.Lock()
+		p.cacheUnresolved(gatewayID)
+		p.mu.Unlock()
+		return gatewayID
+	}
+	p.mu.Lock()
+	delete(p.unresolved, gatewayID)
+	p.resolved[gatewayID] = resolved
+	p.resolved[resolved] = resolved
+	p.mu.Unlock()
+	return resolved
+}
+
+// cacheUnresolved caches that the gateway identifier could not be resolved. When the cache is full, the expired
+// identifiers are removed; if it is still full, the identifier is not cached and is resolved again the next time.
+// The caller must hold p.mu.
+func (p *Public) cacheUnresolved(gatewayID string) {
+	now := time.Now()
+	if len(p.unresolved) >= maxUnresolved {
+		for id, retry := range p.unresolved {
+			if !now.Before(retry) {
+				delete(p.unresolved, id)
+			}
+		}
+	}
+	if _, ok := p.unresolved[gatewayID]; ok || len(p.unresolved) < maxUnresolved {
+		p.unresolved[gatewayID] = now.Add(ResolveErrorTTL)
+	}
+}
+
+// forget removes the resolved identifiers of the gateway
+func (p *Public) forget(gatewayID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if resolved, ok := p.resolved[gatewayID]; ok {
+		delete(p.resolved, resolved)
+	}
+	delete(p.resolved, gatewayID)
+	delete(p.unresolved, gatewayID)
+}
@@ -0,0 +1,80 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package gatewayinfo
+
+import (
+	"github.com/TheThingsNetwork/gateway-connector-bridge/middleware"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
+	"github.com/TheThingsNetwork/go-account-lib/account"
+)
+
+// WithConnectResponse enables or disables setting a response with the resolved gateway information in the middleware
+// context of connect messages (see middleware.ConnectResponseKey). If the first fetch of the gateway information is
+// still in progress, the response is sent when it completes (see middleware.ConnectResponderKey).
+func (p *Public) WithConnectResponse(enabled bool) *Public {
+	p.connectResponse = enabled
+	return p
+}
+
+// setConnectResponse sets the response to the connect message in the middleware context. Connect messages have no
+// trace, so the content of the response is logged instead.
+func (p *Public) setConnectResponse(ctx middleware.Context, msg *types.ConnectMessage, info account.Gateway) {
+	if !p.connectResponse || ctx == nil {
+		return
+	}
+	res := p.newConnectResponse(msg, info)
+	if res == nil {
+		return
+	}
+	ctx.Set(middleware.ConnectResponseKey, res)
+	p.log.WithField("GatewayID", msg.GatewayID).WithField("FrequencyPlan", res.FrequencyPlan).WithField("Location", res.Location).Debug("Set connect response")
+}
+
+// respondWhenFetched sends the response to the connect message with the responder in the middleware context when the
+// first fetch of the gateway information completes. The fetch may already have completed since the lookup, in which
+// case the response is sent right away.
+func (p *Public) respondWhenFetched(ctx middleware.Context, msg *types.ConnectMessage) {
+	if !p.connectResponse || ctx == nil {
+		return
+	}
+	respond := middleware.ConnectResponderFromContext(ctx)
+	if respond == nil {
+		return
+	}
+	send := func() {
+		info, _ := p.getWith(msg.GatewayID, false)
+		if res := p.newConnectResponse(msg, info); res != nil {
+			respond(res)
+			p.log.WithField("GatewayID", msg.GatewayID).WithField("FrequencyPlan", res.FrequencyPlan).WithField("Location", res.Location).Debug("Sent connect response after fetch")
+		}
+	}
+	gatewayID := p.key(p.resolve(msg.GatewayID))
+	s := p.shard(gatewayID)
+	s.mu.Lock()
+	fetch, pending := s.pending[gatewayID]
+	if pending {
+		fetch.connects = append(fetch.connects, send)
+	}
+	s.mu.Unlock()
+	if !pending {
+		send()
+	}
+}
+
+// newConnectResponse returns the response to the connect message with the gateway information, or nil if the gateway
+// information is not known
+func (p *Public) newConnectResponse(msg *types.ConnectMessage, info account.Gateway) *types.ConnectResponseMessage {
+	if info.ID == "" {
+		return nil
+	}
+	res := &types.ConnectResponseMessage{
+		GatewayID:     msg.GatewayID,
+		FrequencyPlan: info.FrequencyPlan,
+	}
+	cached, _ := p.checkedLocation(info)
+	if location, ok := p.injectLocation(msg.GatewayID, nil, cached); ok {
+		res.Location = location
+	}
+	return res
+}
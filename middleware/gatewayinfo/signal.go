@@ -0,0 +1,14 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package gatewayinfo
+
+// SignalThresholds returns the minimum RSSI and SNR of the gateway from the overrides, or nil for thresholds that are
+// not configured, so that it can be used with the threshold middleware
+func (p *Public) SignalThresholds(gatewayID string) (minRSSI, minSNR *float32) {
+	override, ok := p.override(gatewayID)
+	if !ok {
+		return nil, nil
+	}
+	return override.MinRSSI, override.MinSNR
+}
@@ -0,0 +1,169 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package gatewayinfo
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/TheThingsNetwork/go-account-lib/account"
+)
+
+// SnapshotFormat is the format of a snapshot of the gateway information
+type SnapshotFormat string
+
+// Snapshot formats. Plain JSON snapshots are kept human-readable for debugging.
+const (
+	SnapshotJSON SnapshotFormat = "json"
+	SnapshotGzip SnapshotFormat = "gzip"
+)
+
+const snapshotMagic = "gatewayinfo-snapshot"
+
+// Export writes a snapshot of the gateway information to w. Entries of gateways that could never be fetched are not
+// included. The snapshot starts with a header line
+// that contains the format, followed by the (compressed) JSON of the gateway information by gateway ID.
+func (p *Public) Export(w io.Writer, format SnapshotFormat) error {
+	gateways := make(map[string]account.Gateway)
+	p.Range(func(gatewayID string, gateway account.Gateway, err error) bool {
+		if err == nil || gateway.ID != "" {
+			gateways[gatewayID] = gateway
+		}
+		return true
+	})
+	if _, err := fmt.Fprintf(w, "%s %s\n", snapshotMagic, format); err != nil {
+		return err
+	}
+	switch format {
+	case SnapshotJSON:
+		return json.NewEncoder(w).Encode(gateways)
+	case SnapshotGzip:
+		zw := gzip.NewWriter(w)
+		if err := json.NewEncoder(zw).Encode(gateways); err != nil {
+			return err
+		}
+		return zw.Close()
+	}
+	return fmt.Errorf("gatewayinfo: unknown snapshot format %q", format)
+}
+
+// Import reads a snapshot that was written by Export, detecting its format from the header, and sets the gateway
+// information in it. It returns the number of imported gateways.
+func (p *Public) Import(r io.Reader) (int, error) {
+	gateways, err := readSnapshot(r)
+	if err != nil {
+		return 0, err
+	}
+	for gatewayID, gateway := range gateways {
+		p.set(gatewayID, gateway)
+	}
+	return len(gateways), nil
+}
+
+func readSnapshot(r io.Reader) (map[string]account.Gateway, error) {
+	br := bufio.NewReader(r)
+	header, err := br.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("gatewayinfo: could not read snapshot header: %w", err)
+	}
+	fields := strings.Fields(header)
+	if len(fields) != 2 || fields[0] != snapshotMagic {
+		return nil, fmt.Errorf("gatewayinfo: invalid snapshot header %q", strings.TrimSpace(header))
+	}
+	var body io.Reader
+	switch SnapshotFormat(fields[1]) {
+	case SnapshotJSON:
+		body = br
+	case SnapshotGzip:
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		body = zr
+	default:
+		return nil, fmt.Errorf("gatewayinfo: unknown snapshot format %q", fields[1])
+	}
+	var gateways map[string]account.Gateway
+	if err := json.NewDecoder(body).Decode(&gateways); err != nil {
+		return nil, err
+	}
+	return gateways, nil
+}
+
+// SnapshotRetryInterval is the minimum interval between attempts to refresh gateway information that was loaded
+// from a snapshot
+var SnapshotRetryInterval = time.Minute
+
+// ErrSnapshotTooOld is returned by LoadSnapshot if the snapshot is older than the maximum age
+var ErrSnapshotTooOld = errors.New("gatewayinfo: snapshot too old")
+
+// SaveSnapshot exports the gateway information to the given file. The snapshot is written to a temporary file
+// that is renamed, so that the file always contains a complete snapshot.
+func (p *Public) SaveSnapshot(filename string, format SnapshotFormat) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := p.Export(tmp, format); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
+
+// LoadSnapshot imports the snapshot in the given file, so that last-known gateway information can be injected when
+// the account server is unreachable at startup. If the file does not exist, nothing is loaded. If maxAge is not
+// zero, snapshots that were written longer than maxAge ago are not loaded and ErrSnapshotTooOld is returned.
+//
+// The loaded entries are stale: they are served until they are refreshed, which is attempted when they are needed.
+// It returns the number of loaded gateways.
+func (p *Public) LoadSnapshot(filename string, maxAge time.Duration) (int, error) {
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	written := stat.ModTime()
+	if maxAge > 0 && time.Since(written) > maxAge {
+		return 0, fmt.Errorf("%w: written %s ago", ErrSnapshotTooOld, time.Since(written).Truncate(time.Second))
+	}
+	gateways, err := readSnapshot(file)
+	if err != nil {
+		return 0, err
+	}
+	for gatewayID, gateway := range gateways {
+		s := p.shard(gatewayID)
+		s.mu.Lock()
+		if _, ok := s.info[gatewayID]; !ok { // not already fetched
+			s.info[gatewayID] = &info{
+				gateway:  gateway,
+				fetched:  written,
+				snapshot: true,
+			}
+		}
+		s.mu.Unlock()
+	}
+	return len(gateways), nil
+}
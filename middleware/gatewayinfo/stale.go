@@ -0,0 +1,73 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package gatewayinfo
+
+import (
+	"time"
+
+	"github.com/TheThingsNetwork/go-account-lib/account"
+)
+
+// WithMaxStaleAge stops serving gateway information that could not be refreshed and that was fetched longer than
+// maxAge ago, so that no metadata is injected rather than metadata that may be wrong (such as the location of a
+// gateway that was moved). Such information is served as ErrTooStale. The default of 0 serves stale information
+// regardless of its age.
+func (p *Public) WithMaxStaleAge(maxAge time.Duration) *Public {
+	p.maxStaleAge = maxAge
+	return p
+}
+
+// tooStale returns whether the information could not be refreshed and is older than the maximum stale age. The
+// caller must hold the lock of its shard.
+func (p *Public) tooStale(info *info) bool {
+	if p.maxStaleAge == 0 || info.gateway.ID == "" || (info.err == nil && !info.snapshot) {
+		return false
+	}
+	return time.Since(info.fetched) > p.maxStaleAge
+}
+
+// serve returns the cached information, or ErrTooStale if it is too stale to be served. The caller must hold the lock
+// of its shard.
+func (p *Public) serve(gatewayID string, info *info) (account.Gateway, error) {
+	if p.tooStale(info) {
+		staleRefusals.Inc()
+		p.log.WithField("GatewayID", gatewayID).WithField("Fetched", info.fetched).Debug("Not serving stale public Gateway information")
+		return account.Gateway{}, ErrTooStale
+	}
+	return info.gateway, info.err
+}
+
+// checkStale records it when gateway information is served that was fetched longer than its expire ago, which
+// happens when refreshes fail (for example during an outage of the account server). The caller must hold the lock of
+// its shard.
+func (p *Public) checkStale(gatewayID string, info *info) {
+	expire := p.expireOf(info)
+	if expire == 0 || expire == uncached || info.gateway.ID == "" {
+		return
+	}
+	age := time.Since(info.fetched)
+	if age < expire {
+		return
+	}
+	staleServes.Inc()
+	if !info.staleLogged {
+		info.staleLogged = true
+		p.log.WithField("GatewayID", gatewayID).WithField("Age", age).Warn("Serving stale public Gateway information")
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.oldestStale.gatewayID == "" || p.oldestStale.gatewayID == gatewayID || info.fetched.Before(p.oldestStale.fetched) {
+		p.oldestStale.gatewayID = gatewayID
+		p.oldestStale.fetched = info.fetched
+		oldestStaleAge.Set(age.Seconds())
+	}
+}
+
+// resetStale resets the age of the oldest served entry if it was that of the given gateway. The caller must hold p.mu.
+func (p *Public) resetStale(gatewayID string) {
+	if p.oldestStale.gatewayID == gatewayID {
+		p.oldestStale.gatewayID = ""
+		oldestStaleAge.Set(0)
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package gatewayinfo
+
+import (
+	"sort"
+
+	"github.com/TheThingsNetwork/gateway-connector-bridge/middleware"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
+)
+
+type tagsKey struct{}
+
+// TagsKey is the key in the middleware context of connect messages of gateways that have tags. The value is a
+// map[string]string. Connect messages have no attributes, so their tags are only available to later middleware.
+var TagsKey = tagsKey{}
+
+const tagEvent = "tag"
+
+// tags returns the operator-defined tags of the gateway from the overrides
+func (p *Public) tags(gatewayID string) map[string]string {
+	override, ok := p.override(gatewayID)
+	if !ok {
+		return nil
+	}
+	return override.Tags
+}
+
+// setTags adds the tags to the attributes without replacing attributes that are already present, and returns the
+// keys of the tags that were added in sorted order
+func setTags(attributes *map[string]string, tags map[string]string) (added []string) {
+	for key, value := range tags {
+		if _, ok := (*attributes)[key]; ok {
+			continue
+		}
+		if *attributes == nil {
+			*attributes = make(map[string]string, len(tags))
+		}
+		(*attributes)[key] = value
+		added = append(added, key)
+	}
+	sort.Strings(added)
+	return added
+}
+
+func (p *Public) tagConnect(ctx middleware.Context, msg *types.ConnectMessage) {
+	tags := p.tags(msg.GatewayID)
+	if len(tags) == 0 || ctx == nil || p.bypassed(msg.GatewayID) {
+		return
+	}
+	ctx.Set(TagsKey, tags)
+}
+
+func (p *Public) tagUplink(msg *types.UplinkMessage) {
+	added := setTags(&msg.Attributes, p.tags(msg.GatewayID))
+	if len(added) > 0 && types.Tracing(types.TraceVerbose) {
+		for _, key := range added {
+			msg.Message.Trace = msg.Message.Trace.WithEvent(tagEvent, "tag", key)
+		}
+	}
+}
+
+// tagStatus adds the tags to the attributes of a status message. Status messages have no trace, so tags are logged.
+func (p *Public) tagStatus(msg *types.StatusMessage) {
+	if added := setTags(&msg.Attributes, p.tags(msg.GatewayID)); len(added) > 0 {
+		p.log.WithField("GatewayID", msg.GatewayID).WithField("Tags", added).Debug("Injected tags")
+	}
+}
+
+func (p *Public) tagDownlink(msg *types.DownlinkMessage) {
+	added := setTags(&msg.Attributes, p.tags(msg.GatewayID))
+	if len(added) > 0 && msg.Message != nil && types.Tracing(types.TraceVerbose) {
+		for _, key := range added {
+			msg.Message.Trace = msg.Message.Trace.WithEvent(tagEvent, "tag", key)
+		}
+	}
+}
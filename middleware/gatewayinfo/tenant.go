@@ -0,0 +1,91 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package gatewayinfo
+
+import "time"
+
+// DefaultTenant is the tenant label of fetches from the account server of the middleware, for gateways that connect
+// without a network
+const DefaultTenant = "default"
+
+// WithTenantRateLimit gives each tenant its own rate limit for fetches, so that the churn of one tenant can not
+// exhaust the global budget (see RequestInterval and RequestBurst) that is shared with the others. Tenants are keyed
+// by the account that is used for the fetch: the network of the gateway (see WithNetworkFetcher), or DefaultTenant
+// for the account server of the middleware. The tenant limits are layered under the global limit: a fetch first
+// waits for a token of its tenant, then for a global token. Each tenant gets a token every interval, up to burst.
+func (p *Public) WithTenantRateLimit(interval time.Duration, burst int) *Public {
+	if interval <= 0 || burst <= 0 {
+		return p
+	}
+	p.mu.Lock()
+	p.tenantBurst = burst
+	p.tenants = make(map[string]chan struct{})
+	p.mu.Unlock()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.done:
+				return
+			case <-ticker.C:
+			}
+			p.mu.Lock()
+			for _, tokens := range p.tenants {
+				select {
+				case tokens <- struct{}{}:
+				default:
+				}
+			}
+			p.mu.Unlock()
+		}
+	}()
+	return p
+}
+
+// tenant returns the tenant of a network
+func tenant(network string) string {
+	if network == "" {
+		return DefaultTenant
+	}
+	return network
+}
+
+// tenantTokens returns the tokens of a tenant, or nil if there are no tenant rate limits
+func (p *Public) tenantTokens(tenant string) chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.tenants == nil {
+		return nil
+	}
+	tokens, ok := p.tenants[tenant]
+	if !ok {
+		tokens = make(chan struct{}, p.tenantBurst)
+		for i := 0; i < p.tenantBurst; i++ {
+			tokens <- struct{}{}
+		}
+		p.tenants[tenant] = tokens
+	}
+	return tokens
+}
+
+// waitTenant waits for a token of the tenant, and returns ErrClosed if the middleware is closed while waiting
+func (p *Public) waitTenant(tenant string) error {
+	tokens := p.tenantTokens(tenant)
+	if tokens == nil {
+		return nil
+	}
+	select {
+	case <-tokens:
+		return nil
+	default:
+	}
+	tenantRateLimited.WithLabelValues(tenant).Inc()
+	select {
+	case <-tokens:
+		return nil
+	case <-p.done:
+		return ErrClosed
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+// Package testutil contains a fake account server for testing how the gateway information middleware handles
+// latency, failures and rate limiting of the account server.
+package testutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TheThingsNetwork/go-account-lib/account"
+)
+
+// AccountServer is a fake account server that serves the gateways that were added with SetGateway on
+// /api/v2/gateways/{id}. It can inject latency, errors and rate-limit responses into these requests and into the
+// HEAD requests of the health check.
+type AccountServer struct {
+	// URL of the account server, to pass to gatewayinfo.NewPublic
+	URL string
+
+	server *httptest.Server
+
+	mu          sync.Mutex
+	gateways    map[string]account.Gateway
+	latency     time.Duration
+	jitter      time.Duration
+	errorRate   float64
+	limitRate   float64
+	retryAfter  time.Duration
+	maxAge      time.Duration
+	rand        *rand.Rand
+	requests    int
+	failures    int
+	rateLimited int
+}
+
+// NewAccountServer starts a fake account server. Faults are injected pseudo-randomly from the given seed, so that
+// tests are reproducible. Call Close to stop the server.
+func NewAccountServer(seed int64) *AccountServer {
+	s := &AccountServer{
+		gateways: make(map[string]account.Gateway),
+		rand:     rand.New(rand.NewSource(seed)),
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.server.URL
+	return s
+}
+
+// Close stops the account server
+func (s *AccountServer) Close() {
+	s.server.Close()
+}
+
+// SetGateway adds or replaces a gateway
+func (s *AccountServer) SetGateway(gateway account.Gateway) *AccountServer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gateways[gateway.ID] = gateway
+	return s
+}
+
+// RemoveGateway removes a gateway, so that it is not found
+func (s *AccountServer) RemoveGateway(gatewayID string) *AccountServer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.gateways, gatewayID)
+	return s
+}
+
+// WithLatency delays every response by latency plus a random duration up to jitter
+func (s *AccountServer) WithLatency(latency, jitter time.Duration) *AccountServer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency, s.jitter = latency, jitter
+	return s
+}
+
+// WithErrorRate makes the given fraction (0 to 1) of requests fail with 500 Internal Server Error
+func (s *AccountServer) WithErrorRate(rate float64) *AccountServer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errorRate = rate
+	return s
+}
+
+// WithRateLimit makes the given fraction (0 to 1) of requests fail with 429 Too Many Requests, with a Retry-After
+// header if retryAfter is not zero
+func (s *AccountServer) WithRateLimit(rate float64, retryAfter time.Duration) *AccountServer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limitRate, s.retryAfter = rate, retryAfter
+	return s
+}
+
+// WithMaxAge sets the Cache-Control max-age of successful responses (none if zero)
+func (s *AccountServer) WithMaxAge(maxAge time.Duration) *AccountServer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxAge = maxAge
+	return s
+}
+
+// Stats returns the number of requests, and how many of them failed with an injected error or were rate limited
+func (s *AccountServer) Stats() (requests, failures, rateLimited int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests, s.failures, s.rateLimited
+}
+
+type fault int
+
+const (
+	noFault fault = iota
+	errorFault
+	limitFault
+)
+
+// next returns the delay and the fault to inject for the next request
+func (s *AccountServer) next() (delay time.Duration, f fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	delay = s.latency
+	if s.jitter > 0 {
+		delay += time.Duration(s.rand.Int63n(int64(s.jitter)))
+	}
+	switch r := s.rand.Float64(); {
+	case r < s.errorRate:
+		s.failures++
+		f = errorFault
+	case r < s.errorRate+s.limitRate:
+		s.rateLimited++
+		f = limitFault
+	}
+	return delay, f
+}
+
+func writeError(w http.ResponseWriter, code int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{"code": code, "error": http.StatusText(code)})
+}
+
+func (s *AccountServer) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	delay, fault := s.next()
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	switch fault {
+	case errorFault:
+		writeError(w, http.StatusInternalServerError)
+		return
+	case limitFault:
+		s.mu.Lock()
+		retryAfter := s.retryAfter
+		s.mu.Unlock()
+		if retryAfter > 0 {
+			w.Header().Set("Retry-After", fmt.Sprintf("%d", int(retryAfter.Seconds())))
+		}
+		writeError(w, http.StatusTooManyRequests)
+		return
+	}
+	if r.Method == http.MethodHead {
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, "/api/v2/gateways/") {
+		writeError(w, http.StatusNotFound)
+		return
+	}
+	s.mu.Lock()
+	gateway, ok := s.gateways[strings.TrimPrefix(r.URL.Path, "/api/v2/gateways/")]
+	maxAge := s.maxAge
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound)
+		return
+	}
+	if maxAge > 0 {
+		w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d", int(maxAge.Seconds())))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(gateway)
+}
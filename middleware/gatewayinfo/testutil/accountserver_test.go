@@ -0,0 +1,70 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package testutil
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/TheThingsNetwork/gateway-connector-bridge/middleware/gatewayinfo"
+	"github.com/TheThingsNetwork/go-account-lib/account"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestAccountServer(t *testing.T) {
+	Convey("Given a fake account server with a gateway", t, func(c C) {
+		s := NewAccountServer(42).SetGateway(account.Gateway{ID: "dev", FrequencyPlan: "EU_868"})
+		Reset(s.Close)
+		p, err := gatewayinfo.NewPublic(s.URL)
+		So(err, ShouldBeNil)
+		Reset(p.Close)
+
+		Convey("The gateway should be fetched", func() {
+			So(p.Refresh("dev"), ShouldBeNil)
+			So(p.FrequencyPlan("dev"), ShouldEqual, "EU_868")
+		})
+
+		Convey("Unknown gateways should not be found", func() {
+			So(errors.Is(p.Refresh("other"), gatewayinfo.ErrGatewayNotFound), ShouldBeTrue)
+		})
+
+		Convey("When all requests fail", func() {
+			s.WithErrorRate(1)
+			Convey("The account server should be unavailable", func() {
+				So(errors.Is(p.Refresh("dev"), gatewayinfo.ErrAccountUnavailable), ShouldBeTrue)
+				requests, failures, _ := s.Stats()
+				So(failures, ShouldEqual, requests)
+			})
+		})
+
+		Convey("When all requests are rate limited", func() {
+			s.WithRateLimit(1, time.Second)
+			Convey("The fetch should be rate limited", func() {
+				So(errors.Is(p.Refresh("dev"), gatewayinfo.ErrRateLimited), ShouldBeTrue)
+			})
+		})
+
+		Convey("When half of the requests fail", func() {
+			s.WithErrorRate(0.5)
+			for i := 0; i < 100; i++ {
+				s.next()
+			}
+			Convey("About half of the requests should have failed", func() {
+				requests, failures, _ := s.Stats()
+				So(requests, ShouldEqual, 100)
+				So(failures, ShouldBeBetween, 30, 70)
+			})
+		})
+
+		Convey("When responses are delayed", func() {
+			s.WithLatency(20*time.Millisecond, 0)
+			start := time.Now()
+			So(p.Refresh("dev"), ShouldBeNil)
+			Convey("The fetch should take at least the latency", func() {
+				So(time.Since(start), ShouldBeGreaterThanOrEqualTo, 20*time.Millisecond)
+			})
+		})
+	})
+}
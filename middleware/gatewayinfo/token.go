@@ -0,0 +1,108 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package gatewayinfo
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// ErrEmptyToken is returned when the token file is empty
+var ErrEmptyToken = errors.New("gatewayinfo: empty token")
+
+// tokenSource holds the token that is sent to the account server
+type tokenSource struct {
+	mu    sync.RWMutex
+	token string
+}
+
+func (t *tokenSource) get() string {
+	if t == nil {
+		return ""
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.token
+}
+
+func (t *tokenSource) set(token string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.token = token
+}
+
+func readToken(path string) (string, error) {
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	token := strings.TrimSpace(string(contents))
+	if token == "" {
+		return "", ErrEmptyToken
+	}
+	return token, nil
+}
+
+// WithTokenFile makes the gateway information middleware send the token in the file as bearer token to the account
+// server and its read endpoint. The file is watched, and the token is updated when the file changes, so that it can
+// be rotated (for example by Kubernetes or Vault agent) without restarting the bridge. If the file can not be read
+// after a change, or if it is empty, the last token is kept. It returns an error if the file can not be read or
+// watched initially.
+func (p *Public) WithTokenFile(path string) (*Public, error) {
+	token, err := readToken(path)
+	if err != nil {
+		return nil, err
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	// Watch the directory instead of the file, as secrets are usually rotated by replacing the file (or a symlink
+	// to it), which ends a watch on the file itself
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return nil, fmt.Errorf("gatewayinfo: could not watch token file: %w", err)
+	}
+	p.token.set(token)
+	go func() {
+		defer watcher.Close()
+		for {
+			select {
+			case <-p.done:
+				return
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				p.log.WithError(err).Warn("Error while watching token file")
+			case _, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				p.reloadToken(path)
+			}
+		}
+	}()
+	return p, nil
+}
+
+// reloadToken reads the token from the file, keeping the last token if that fails
+func (p *Public) reloadToken(path string) {
+	token, err := readToken(path)
+	switch {
+	case err != nil:
+		tokenReloads.WithLabelValues("error").Inc()
+		p.log.WithError(err).WithField("Path", path).Warn("Could not read token file, keeping the last token")
+	case token != p.token.get():
+		p.token.set(token)
+		tokenReloads.WithLabelValues("ok").Inc()
+		p.log.WithField("Path", path).Info("Reloaded token")
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package gatewayinfo
+
+import "sync"
+
+// WithWorkers runs the background tasks of connects and disconnects (such as fetching and removing gateway
+// information) on a pool of n workers, instead of starting a goroutine for each task. Tasks that are submitted while
+// all workers are busy are queued, so that a connect storm does not start tens of thousands of goroutines at once.
+// The workers are stopped by Close, dropping the tasks that are still queued. If n is 0, a goroutine is started for
+// each task. Calling WithWorkers again stops the previous workers and moves their queued tasks to the new ones.
+func (p *Public) WithWorkers(n int) *Public {
+	var queued []func()
+	if p.workers != nil {
+		queued = p.workers.stop()
+	}
+	if n <= 0 {
+		p.workers = nil
+		for _, task := range queued {
+			go task()
+		}
+		return p
+	}
+	p.workers = &workQueue{signal: make(chan struct{}, 1), stopped: make(chan struct{})}
+	for i := 0; i < n; i++ {
+		go p.workers.run(p.done)
+	}
+	for _, task := range queued {
+		p.workers.submit(task)
+	}
+	return p
+}
+
+// workQueue is an unbounded queue of tasks, so that submitting never blocks (callers may hold p.mu)
+type workQueue struct {
+	mu      sync.Mutex
+	tasks   []func()
+	signal  chan struct{}
+	stopped chan struct{}
+}
+
+// stop stops the workers of the queue and returns the tasks that are still queued
+func (q *workQueue) stop() []func() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	close(q.stopped)
+	tasks := q.tasks
+	q.tasks = nil
+	backgroundQueue.Set(0)
+	return tasks
+}
+
+func (q *workQueue) submit(task func()) {
+	q.mu.Lock()
+	q.tasks = append(q.tasks, task)
+	backgroundQueue.Set(float64(len(q.tasks)))
+	q.mu.Unlock()
+	q.wake()
+}
+
+// wake wakes up an idle worker, if there is one that is not woken up yet
+func (q *workQueue) wake() {
+	select {
+	case q.signal <- struct{}{}:
+	default:
+	}
+}
+
+// pop returns the next task, and whether more tasks are queued
+func (q *workQueue) pop() (task func(), more bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.tasks) == 0 {
+		return nil, false
+	}
+	task = q.tasks[0]
+	q.tasks[0] = nil
+	q.tasks = q.tasks[1:]
+	backgroundQueue.Set(float64(len(q.tasks)))
+	return task, len(q.tasks) > 0
+}
+
+// run executes tasks until done is closed or the queue is stopped. The signal only wakes up one worker, so a worker that takes a task while
+// more tasks are queued wakes up the next worker before it runs its task. This way, a burst of tasks is spread over
+// all idle workers.
+func (q *workQueue) run(done chan struct{}) {
+	for {
+		select {
+		case <-done:
+			return
+		case <-q.stopped:
+			return
+		default:
+		}
+		if task, more := q.pop(); task != nil {
+			if more {
+				q.wake()
+			}
+			task()
+			continue
+		}
+		select {
+		case <-done:
+			return
+		case <-q.stopped:
+			return
+		case <-q.signal:
+		}
+	}
+}
+
+// background runs the task on the workers, or in a new goroutine if there are no workers
+func (p *Public) background(task func()) {
+	if p.workers == nil {
+		go task()
+		return
+	}
+	p.workers.submit(task)
+}
@@ -29,6 +29,14 @@ type Inject struct {
 	fields Fields
 }
 
+// Inject implements the Injector interface
+func (i *Inject) Inject(msg interface{}) error {
+	if msg, ok := msg.(*types.StatusMessage); ok {
+		return i.HandleStatus(nil, msg)
+	}
+	return nil
+}
+
 // HandleStatus inserts fields into status messages if not present
 func (i *Inject) HandleStatus(ctx middleware.Context, msg *types.StatusMessage) error {
 	if msg.Message.FrequencyPlan == "" {
@@ -34,3 +34,72 @@ func TestInject(t *testing.T) {
 		})
 	})
 }
+
+type connectInjector struct {
+	connected  string
+	downlinked string
+}
+
+func (c *connectInjector) HandleConnect(ctx middleware.Context, msg *types.ConnectMessage) error {
+	c.connected = msg.GatewayID
+	return nil
+}
+
+func (c *connectInjector) HandleDownlink(ctx middleware.Context, msg *types.DownlinkMessage) error {
+	c.downlinked = msg.GatewayID
+	return nil
+}
+
+func (c *connectInjector) Inject(msg interface{}) error {
+	if msg, ok := msg.(*types.StatusMessage); ok && msg.Message.Description == "" {
+		msg.Message.Description = "injected"
+	}
+	return nil
+}
+
+func TestComposite(t *testing.T) {
+	Convey("Given a new Composite", t, func(c C) {
+		connect := &connectInjector{}
+		i := NewComposite(
+			NewInject(Fields{FrequencyPlan: "EU_868"}),
+			NewInject(Fields{FrequencyPlan: "US_915", Bridge: "bridge"}),
+		).Add(connect)
+
+		Convey("When sending a StatusMessage", func() {
+			status := &types.StatusMessage{
+				Message: &gateway.Status{},
+			}
+			err := i.HandleStatus(middleware.NewContext(), status)
+			Convey("There should be no error", func() {
+				So(err, ShouldBeNil)
+			})
+			Convey("The first injector should take precedence", func() {
+				So(status.Message.FrequencyPlan, ShouldEqual, "EU_868")
+			})
+			Convey("Later injectors should fill the remaining fields", func() {
+				So(status.Message.Bridge, ShouldEqual, "bridge")
+				So(status.Message.Description, ShouldEqual, "injected")
+			})
+		})
+
+		Convey("When sending a DownlinkMessage", func() {
+			err := i.HandleDownlink(middleware.NewContext(), &types.DownlinkMessage{GatewayID: "dev"})
+			Convey("There should be no error", func() {
+				So(err, ShouldBeNil)
+			})
+			Convey("It should be passed to the injectors that handle it", func() {
+				So(connect.downlinked, ShouldEqual, "dev")
+			})
+		})
+
+		Convey("When sending a ConnectMessage", func() {
+			err := i.HandleConnect(middleware.NewContext(), &types.ConnectMessage{GatewayID: "dev"})
+			Convey("There should be no error", func() {
+				So(err, ShouldBeNil)
+			})
+			Convey("It should be passed to the injectors that handle it", func() {
+				So(connect.connected, ShouldEqual, "dev")
+			})
+		})
+	})
+}
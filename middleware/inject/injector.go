@@ -0,0 +1,120 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package inject
+
+import (
+	"context"
+	"errors"
+
+	"github.com/TheThingsNetwork/gateway-connector-bridge/middleware"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
+	"github.com/TheThingsNetwork/go-utils/log"
+)
+
+// Injector injects metadata into uplink and status messages. An Injector
+// should only fill fields that are still empty, and ignore message types that
+// it does not handle.
+type Injector interface {
+	Inject(msg interface{}) error
+}
+
+// NewComposite returns a middleware that runs the given injectors in order.
+// Because injectors only fill fields that are still empty, injectors that come
+// first take precedence over the ones that come later.
+func NewComposite(injectors ...Injector) *Composite {
+	return &Composite{
+		log:       log.Get(),
+		injectors: injectors,
+	}
+}
+
+// Composite runs multiple injectors in order
+type Composite struct {
+	log       log.Interface
+	injectors []Injector
+}
+
+// Add an injector to the end of the composite
+func (c *Composite) Add(injector Injector) *Composite {
+	c.injectors = append(c.injectors, injector)
+	return c
+}
+
+// Inject runs all injectors in order and returns the first error
+func (c *Composite) Inject(msg interface{}) (err error) {
+	for _, injector := range c.injectors {
+		if injectErr := injector.Inject(msg); injectErr != nil && err == nil {
+			err = injectErr
+		}
+	}
+	return
+}
+
+func (c *Composite) inject(gatewayID string, msg interface{}) {
+	if err := c.Inject(msg); err != nil {
+		c.log.WithField("GatewayID", gatewayID).WithError(err).Warn("Could not inject metadata")
+	}
+}
+
+// HandleConnect passes ConnectMessages to the injectors that handle them
+func (c *Composite) HandleConnect(ctx middleware.Context, msg *types.ConnectMessage) error {
+	for _, injector := range c.injectors {
+		if injector, ok := injector.(middleware.Connect); ok {
+			if err := injector.HandleConnect(ctx, msg); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// HandleDisconnect passes DisconnectMessages to the injectors that handle them
+func (c *Composite) HandleDisconnect(ctx middleware.Context, msg *types.DisconnectMessage) error {
+	for _, injector := range c.injectors {
+		if injector, ok := injector.(middleware.Disconnect); ok {
+			if err := injector.HandleDisconnect(ctx, msg); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// HandleUplink injects metadata into uplink messages. Errors of injectors are logged, but do not drop the message.
+func (c *Composite) HandleUplink(ctx middleware.Context, msg *types.UplinkMessage) error {
+	c.inject(msg.GatewayID, msg)
+	return nil
+}
+
+// HandleStatus injects metadata into status messages. Errors of injectors are logged, but do not drop the message.
+func (c *Composite) HandleStatus(ctx middleware.Context, msg *types.StatusMessage) error {
+	c.inject(msg.GatewayID, msg)
+	return nil
+}
+
+// HandleDownlink passes DownlinkMessages to the injectors that handle them
+func (c *Composite) HandleDownlink(ctx middleware.Context, msg *types.DownlinkMessage) error {
+	for _, injector := range c.injectors {
+		if injector, ok := injector.(middleware.Downlink); ok {
+			if err := injector.HandleDownlink(ctx, msg); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Validate runs the validation of the injectors that implement it (such as the gateway information middleware), and
+// returns the errors of all injectors that failed
+func (c *Composite) Validate(ctx context.Context) error {
+	var errs []error
+	for _, injector := range c.injectors {
+		if injector, ok := injector.(interface{ Validate(context.Context) error }); ok {
+			if err := injector.Validate(ctx); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
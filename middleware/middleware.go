@@ -41,6 +41,35 @@ func (c *context) Get(k interface{}) interface{} {
 	return nil
 }
 
+type connectResponseKey struct{}
+
+// ConnectResponseKey is the key of the *types.ConnectResponseMessage in the context of connect messages. The
+// Exchange sends the response to the southbound backends that support it.
+var ConnectResponseKey = connectResponseKey{}
+
+// ConnectResponseFromContext returns the response to the connect message that was set in the context, or nil
+func ConnectResponseFromContext(ctx Context) *types.ConnectResponseMessage {
+	if res, ok := ctx.Get(ConnectResponseKey).(*types.ConnectResponseMessage); ok {
+		return res
+	}
+	return nil
+}
+
+type connectResponderKey struct{}
+
+// ConnectResponderKey is the key of the func(*types.ConnectResponseMessage) in the context of connect messages that
+// the Exchange sets to receive responses after the connect message was handled, for example when the information for
+// the response is still being fetched.
+var ConnectResponderKey = connectResponderKey{}
+
+// ConnectResponderFromContext returns the function to respond to the connect message after it was handled, or nil
+func ConnectResponderFromContext(ctx Context) func(*types.ConnectResponseMessage) {
+	if respond, ok := ctx.Get(ConnectResponderKey).(func(*types.ConnectResponseMessage)); ok {
+		return respond
+	}
+	return nil
+}
+
 // Chain of middleware
 type Chain []interface{}
 
@@ -200,3 +229,18 @@ func (c Chain) filterDownlink() (filtered downlinkChain) {
 	}
 	return
 }
+
+// DownlinkSent middleware is notified of downlink messages that were published to a southbound backend, for example
+// to account for resources only when a downlink is actually sent
+type DownlinkSent interface {
+	HandleDownlinkSent(Context, *types.DownlinkMessage)
+}
+
+// Sent notifies the middleware that implements DownlinkSent that the downlink message was published
+func (c Chain) Sent(ctx Context, msg *types.DownlinkMessage) {
+	for _, middleware := range c {
+		if middleware, ok := middleware.(DownlinkSent); ok {
+			middleware.HandleDownlinkSent(ctx, msg)
+		}
+	}
+}
@@ -42,6 +42,7 @@ type testMiddleware struct {
 	uplink     int
 	status     int
 	downlink   int
+	sent       int
 }
 
 func (c *testMiddleware) HandleConnect(ctx Context, msg *types.ConnectMessage) error {
@@ -64,6 +65,9 @@ func (c *testMiddleware) HandleDownlink(ctx Context, msg *types.DownlinkMessage)
 	c.downlink++
 	return c.err
 }
+func (c *testMiddleware) HandleDownlinkSent(ctx Context, msg *types.DownlinkMessage) {
+	c.sent++
+}
 
 func TestMiddleware(t *testing.T) {
 	Convey("Given a new Middleware Chain", t, func(c C) {
@@ -120,6 +124,13 @@ func TestMiddleware(t *testing.T) {
 			})
 		})
 
+		Convey("When a DownlinkMessage was sent", func() {
+			chain.Sent(NewContext(), &types.DownlinkMessage{})
+			Convey("The middleware should have been notified", func() {
+				So(m.sent, ShouldEqual, 1)
+			})
+		})
+
 		Convey("When the middleware would return an error", func() {
 			m.err = errors.New("some error")
 
@@ -0,0 +1,19 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package payloadschema
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var rejectedCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "ttn",
+		Subsystem: "bridge",
+		Name:      "payloadschema_rejected_uplinks_total",
+		Help:      "Total number of uplink messages that were dropped because their payload does not match a rule.",
+	}, []string{"rule"},
+)
+
+func init() {
+	prometheus.MustRegister(rejectedCounter)
+}
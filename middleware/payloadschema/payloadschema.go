@@ -0,0 +1,187 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package payloadschema
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/TheThingsNetwork/api/trace"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/middleware"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
+	"github.com/TheThingsNetwork/go-utils/log"
+	"github.com/brocaar/lorawan"
+)
+
+// ErrInvalidPayload is returned when the payload of an uplink message does not match a rule
+var ErrInvalidPayload = errors.New("payloadschema: payload does not match schema")
+
+// Rule for the payload of uplink messages
+type Rule struct {
+	Name      string          // Name of the rule in logs, traces and metrics
+	MinLength int             // Minimum length of the payload in bytes, 0 for no minimum
+	MaxLength int             // Maximum length of the payload in bytes, 0 for no maximum
+	MTypes    []lorawan.MType // Allowed LoRaWAN message types, all message types are allowed if empty
+}
+
+// check returns why the payload does not match the rule, or an empty string if it does
+func (r Rule) check(payload []byte) string {
+	if len(payload) < r.MinLength {
+		return fmt.Sprintf("%d payload bytes is less than %d", len(payload), r.MinLength)
+	}
+	if r.MaxLength > 0 && len(payload) > r.MaxLength {
+		return fmt.Sprintf("%d payload bytes is more than %d", len(payload), r.MaxLength)
+	}
+	if len(r.MTypes) == 0 {
+		return ""
+	}
+	if len(payload) == 0 {
+		return "no payload"
+	}
+	var mhdr lorawan.MHDR
+	if err := mhdr.UnmarshalBinary(payload[:1]); err != nil {
+		return err.Error()
+	}
+	for _, mType := range r.MTypes {
+		if mhdr.MType == mType {
+			return ""
+		}
+	}
+	return fmt.Sprintf("message type %s is not allowed", mhdr.MType)
+}
+
+var mTypes = func() map[string]lorawan.MType {
+	mTypes := make(map[string]lorawan.MType)
+	for mType := lorawan.JoinRequest; mType <= lorawan.Proprietary; mType++ {
+		mTypes[strings.ToLower(mType.String())] = mType
+	}
+	return mTypes
+}()
+
+// ParseRule parses a rule from its configuration: "name:length" or "name:length/mtype|mtype", where the length is
+// "min-max", "min-", "-max" or an exact length, and the message types are names such as "UnconfirmedDataUp".
+func ParseRule(rule string) (Rule, error) {
+	invalid := func(reason string) (Rule, error) {
+		return Rule{}, fmt.Errorf("payloadschema: invalid rule %q: %s", rule, reason)
+	}
+	parts := strings.SplitN(rule, ":", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return invalid("missing name")
+	}
+	r := Rule{Name: parts[0]}
+	spec := strings.SplitN(parts[1], "/", 2)
+	if length := spec[0]; length != "" {
+		bounds := strings.SplitN(length, "-", 2)
+		if len(bounds) == 1 {
+			bounds = append(bounds, bounds[0])
+		}
+		var err error
+		if bounds[0] != "" {
+			if r.MinLength, err = strconv.Atoi(bounds[0]); err != nil || r.MinLength < 0 {
+				return invalid("invalid minimum length")
+			}
+		}
+		if bounds[1] != "" {
+			if r.MaxLength, err = strconv.Atoi(bounds[1]); err != nil || r.MaxLength < 1 {
+				return invalid("invalid maximum length")
+			}
+		}
+		if r.MaxLength > 0 && r.MaxLength < r.MinLength {
+			return invalid("maximum length is less than minimum length")
+		}
+	}
+	if len(spec) == 2 {
+		for _, name := range strings.Split(spec[1], "|") {
+			mType, ok := mTypes[strings.ToLower(name)]
+			if !ok {
+				return invalid(fmt.Sprintf("unknown message type %q", name))
+			}
+			r.MTypes = append(r.MTypes, mType)
+		}
+	}
+	return r, nil
+}
+
+// TypeFunc returns the type of a gateway (such as its platform from the gateway information), or an empty string if
+// it is not known
+type TypeFunc func(gatewayID string) string
+
+// NewPayloadSchema returns a middleware that drops uplink messages of which the payload does not match the rules of
+// the gateway or of its type
+func NewPayloadSchema() *PayloadSchema {
+	return &PayloadSchema{
+		log:      log.Get(),
+		gateways: make(map[string][]Rule),
+		types:    make(map[string][]Rule),
+	}
+}
+
+// PayloadSchema validates the payload of uplink messages
+type PayloadSchema struct {
+	log log.Interface
+
+	mu          sync.RWMutex
+	gateways    map[string][]Rule
+	types       map[string][]Rule
+	gatewayType TypeFunc
+}
+
+// WithGateway adds rules for the gateway. Rules of a gateway replace the rules of its type.
+func (s *PayloadSchema) WithGateway(gatewayID string, rules ...Rule) *PayloadSchema {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	gatewayID = strings.ToLower(gatewayID)
+	s.gateways[gatewayID] = append(s.gateways[gatewayID], rules...)
+	return s
+}
+
+// WithType adds rules for gateways of the type, which is looked up with the function set with WithTypeFunc
+func (s *PayloadSchema) WithType(gatewayType string, rules ...Rule) *PayloadSchema {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.types[gatewayType] = append(s.types[gatewayType], rules...)
+	return s
+}
+
+// WithTypeFunc sets the function that looks up the type of gateways
+func (s *PayloadSchema) WithTypeFunc(gatewayType TypeFunc) *PayloadSchema {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gatewayType = gatewayType
+	return s
+}
+
+// rules returns the rules for the gateway
+func (s *PayloadSchema) rules(gatewayID string) []Rule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if rules, ok := s.gateways[strings.ToLower(gatewayID)]; ok {
+		return rules
+	}
+	if s.gatewayType == nil || len(s.types) == 0 {
+		return nil
+	}
+	return s.types[s.gatewayType(gatewayID)]
+}
+
+// HandleUplink drops uplink messages of which the payload does not match the rules
+func (s *PayloadSchema) HandleUplink(_ middleware.Context, msg *types.UplinkMessage) error {
+	for _, rule := range s.rules(msg.GatewayID) {
+		reason := rule.check(msg.Message.GetPayload())
+		if reason == "" {
+			continue
+		}
+		rejectedCounter.WithLabelValues(rule.Name).Inc()
+		if types.Tracing(types.TraceBasic) {
+			msg.Message.Trace = msg.Message.Trace.WithEvent(trace.DropEvent, "reason", "payload schema", "rule", rule.Name)
+		}
+		s.log.WithField("GatewayID", msg.GatewayID).WithField("Rule", rule.Name).WithField("Reason", reason).
+			Debug("Dropping uplink: payload does not match schema")
+		return fmt.Errorf("%w: rule %s: %s", ErrInvalidPayload, rule.Name, reason)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package payloadschema
+
+import (
+	"errors"
+	"testing"
+
+	pb_router "github.com/TheThingsNetwork/api/router"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/middleware"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
+	"github.com/brocaar/lorawan"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseRule(t *testing.T) {
+	Convey("Given rule configurations", t, func(c C) {
+		Convey("A length range with message types should be parsed", func() {
+			rule, err := ParseRule("data:12-64/UnconfirmedDataUp|confirmeddataup")
+			So(err, ShouldBeNil)
+			So(rule, ShouldResemble, Rule{Name: "data", MinLength: 12, MaxLength: 64, MTypes: []lorawan.MType{lorawan.UnconfirmedDataUp, lorawan.ConfirmedDataUp}})
+		})
+		Convey("An exact length should be parsed", func() {
+			rule, err := ParseRule("join:23")
+			So(err, ShouldBeNil)
+			So(rule, ShouldResemble, Rule{Name: "join", MinLength: 23, MaxLength: 23})
+		})
+		Convey("Open ranges should be parsed", func() {
+			rule, err := ParseRule("min:12-")
+			So(err, ShouldBeNil)
+			So(rule, ShouldResemble, Rule{Name: "min", MinLength: 12})
+			rule, err = ParseRule("max:-64")
+			So(err, ShouldBeNil)
+			So(rule, ShouldResemble, Rule{Name: "max", MaxLength: 64})
+		})
+		Convey("Invalid rules should return an error", func() {
+			for _, rule := range []string{"12-64", ":12-64", "name:a-64", "name:64-12", "name:12-64/Unknown"} {
+				_, err := ParseRule(rule)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+}
+
+func TestPayloadSchema(t *testing.T) {
+	Convey("Given a new PayloadSchema", t, func(c C) {
+		data, _ := ParseRule("data:12-64/UnconfirmedDataUp|ConfirmedDataUp")
+		short, _ := ParseRule("short:-16")
+		s := NewPayloadSchema().WithType("Kerlink", data).WithGateway("dev", short).WithTypeFunc(func(gatewayID string) string {
+			if gatewayID == "kerlink" {
+				return "Kerlink"
+			}
+			return ""
+		})
+
+		uplink := func(gatewayID string, payload []byte) error {
+			return s.HandleUplink(middleware.NewContext(), &types.UplinkMessage{
+				GatewayID: gatewayID,
+				Message:   &pb_router.UplinkMessage{Payload: payload},
+			})
+		}
+		unconfirmed := append([]byte{0x40}, make([]byte, 19)...)
+		join := append([]byte{0x00}, make([]byte, 22)...)
+
+		Convey("Uplinks of gateways without rules should be accepted", func() {
+			So(uplink("other", join), ShouldBeNil)
+		})
+
+		Convey("Uplinks that match the rules of the type of the gateway should be accepted", func() {
+			So(uplink("kerlink", unconfirmed), ShouldBeNil)
+		})
+
+		Convey("Uplinks that do not match the rules of the type of the gateway should be dropped", func() {
+			So(errors.Is(uplink("kerlink", join), ErrInvalidPayload), ShouldBeTrue)
+			So(errors.Is(uplink("kerlink", unconfirmed[:8]), ErrInvalidPayload), ShouldBeTrue)
+		})
+
+		Convey("Rules of the gateway should be used", func() {
+			So(uplink("DEV", unconfirmed[:16]), ShouldBeNil)
+			So(errors.Is(uplink("dev", unconfirmed), ErrInvalidPayload), ShouldBeTrue)
+		})
+	})
+}
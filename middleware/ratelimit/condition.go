@@ -0,0 +1,81 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package ratelimit
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
+)
+
+// ErrorCondition returns whether a status message indicates that the gateway is in an error or degraded condition
+type ErrorCondition func(msg *types.StatusMessage) bool
+
+// HasMessages is an ErrorCondition that matches status messages that contain (error) messages
+func HasMessages(msg *types.StatusMessage) bool {
+	return msg.Message != nil && len(msg.Message.Messages) > 0
+}
+
+// HasTxErrors is an ErrorCondition that matches status messages that report failed transmissions
+func HasTxErrors(msg *types.StatusMessage) bool {
+	return msg.Message != nil && msg.Message.TxIn > msg.Message.TxOk
+}
+
+// HasAttribute returns an ErrorCondition that matches status messages that have the attribute set to one of the
+// given values, or to any value if no values are given
+func HasAttribute(key string, values ...string) ErrorCondition {
+	return func(msg *types.StatusMessage) bool {
+		value, ok := msg.Attributes[key]
+		if !ok {
+			return false
+		}
+		if len(values) == 0 {
+			return true
+		}
+		for _, v := range values {
+			if v == value {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// ParseErrorCondition parses an ErrorCondition from its configuration: "messages", "tx-errors",
+// "attribute:key" or "attribute:key=value1|value2"
+func ParseErrorCondition(condition string) (ErrorCondition, error) {
+	switch {
+	case condition == "messages":
+		return HasMessages, nil
+	case condition == "tx-errors":
+		return HasTxErrors, nil
+	case strings.HasPrefix(condition, "attribute:"):
+		attribute := strings.SplitN(strings.TrimPrefix(condition, "attribute:"), "=", 2)
+		if attribute[0] == "" {
+			break
+		}
+		if len(attribute) == 1 {
+			return HasAttribute(attribute[0]), nil
+		}
+		return HasAttribute(attribute[0], strings.Split(attribute[1], "|")...), nil
+	}
+	return nil, fmt.Errorf("ratelimit: invalid error condition %q", condition)
+}
+
+// WithStatusBypass makes status messages that match any of the error conditions bypass the status rate limit,
+// because these are the most valuable status messages of a gateway that is in trouble
+func (l *RateLimit) WithStatusBypass(conditions ...ErrorCondition) *RateLimit {
+	l.statusBypass = append(l.statusBypass, conditions...)
+	return l
+}
+
+func (l *RateLimit) bypassStatus(msg *types.StatusMessage) bool {
+	for _, condition := range l.statusBypass {
+		if condition(msg) {
+			return true
+		}
+	}
+	return false
+}
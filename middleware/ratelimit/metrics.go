@@ -0,0 +1,19 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package ratelimit
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var bypassedStatusCounter = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Namespace: "ttn",
+		Subsystem: "bridge",
+		Name:      "ratelimit_bypassed_status_messages_total",
+		Help:      "Total number of status messages with an error condition that bypassed the rate limit.",
+	},
+)
+
+func init() {
+	prometheus.MustRegister(bypassedStatusCounter)
+}
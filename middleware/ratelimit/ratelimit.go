@@ -45,51 +45,41 @@ type RateLimit struct {
 	limits Limits
 	client *redis.Client
 
+	statusBypass []ErrorCondition
+
 	mu       sync.RWMutex
 	gateways map[string]*limits
 }
 
-func (l *RateLimit) newLimits(gatewayID string) *limits {
-	limits := new(limits)
-
-	if l.limits.Uplink != 0 {
-		var uplink rate.Counter
-		if l.client != nil {
-			uplink = rate.NewRedisCounter(l.client, fmt.Sprintf("ratelimit:%s:uplink", gatewayID), time.Second, time.Minute)
-		} else {
-			uplink = rate.NewCounter(time.Second, time.Minute)
-		}
-		limits.uplink = rate.NewLimiter(uplink, time.Minute, uint64(l.limits.Uplink))
+func (l *RateLimit) newLimiter(gatewayID, messageType string, limit int) *limiter {
+	if limit == 0 {
+		return nil
 	}
-
-	if l.limits.Downlink != 0 {
-		var downlink rate.Counter
-		if l.client != nil {
-			downlink = rate.NewRedisCounter(l.client, fmt.Sprintf("ratelimit:%s:downlink", gatewayID), time.Second, time.Minute)
-		} else {
-			downlink = rate.NewCounter(time.Second, time.Minute)
-		}
-		limits.downlink = rate.NewLimiter(downlink, time.Minute, uint64(l.limits.Downlink))
+	var counter rate.Counter
+	if l.client != nil {
+		counter = rate.NewRedisCounter(l.client, fmt.Sprintf("ratelimit:%s:%s", gatewayID, messageType), time.Second, time.Minute)
+	} else {
+		counter = rate.NewCounter(time.Second, time.Minute)
 	}
-
-	if l.limits.Status != 0 {
-		var status rate.Counter
-		if l.client != nil {
-			status = rate.NewRedisCounter(l.client, fmt.Sprintf("ratelimit:%s:status", gatewayID), time.Second, time.Minute)
-		} else {
-			status = rate.NewCounter(time.Second, time.Minute)
-		}
-		limits.status = rate.NewLimiter(status, time.Minute, uint64(l.limits.Status))
+	return &limiter{
+		Limiter: rate.NewLimiter(counter, time.Minute, uint64(limit)),
+		counter: counter,
+		limit:   uint64(limit),
 	}
+}
 
-	return limits
-
+func (l *RateLimit) newLimits(gatewayID string) *limits {
+	return &limits{
+		uplink:   l.newLimiter(gatewayID, "uplink", l.limits.Uplink),
+		downlink: l.newLimiter(gatewayID, "downlink", l.limits.Downlink),
+		status:   l.newLimiter(gatewayID, "status", l.limits.Status),
+	}
 }
 
 type limits struct {
-	uplink   rate.Limiter
-	downlink rate.Limiter
-	status   rate.Limiter
+	uplink   *limiter
+	downlink *limiter
+	status   *limiter
 }
 
 // HandleConnect initializes the rate limiter
@@ -163,8 +153,12 @@ func (l *RateLimit) HandleDownlink(ctx middleware.Context, msg *types.DownlinkMe
 	return nil
 }
 
-// HandleStatus rate-limits status messages
+// HandleStatus rate-limits status messages, except for status messages that match an error condition
 func (l *RateLimit) HandleStatus(ctx middleware.Context, msg *types.StatusMessage) error {
+	if l.bypassStatus(msg) {
+		bypassedStatusCounter.Inc()
+		return nil
+	}
 	if limits := l.get(msg.GatewayID); limits != nil && limits.status != nil {
 		limit, err := limits.status.Limit()
 		if err != nil {
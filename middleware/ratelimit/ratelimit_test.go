@@ -6,6 +6,7 @@ package ratelimit
 import (
 	"testing"
 
+	"github.com/TheThingsNetwork/api/gateway"
 	"github.com/TheThingsNetwork/gateway-connector-bridge/middleware"
 	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
 	. "github.com/smartystreets/goconvey/convey"
@@ -95,3 +96,88 @@ func TestRateLimit(t *testing.T) {
 
 	})
 }
+
+func TestStatusBypass(t *testing.T) {
+	Convey("Given a new RateLimit with status bypass", t, func(c C) {
+		degraded, err := ParseErrorCondition("attribute:health=degraded|down")
+		So(err, ShouldBeNil)
+		i := NewRateLimit(Limits{Status: 1}).WithStatusBypass(HasMessages, degraded)
+
+		Convey("When the status rate limit is reached", func() {
+			So(i.HandleStatus(middleware.NewContext(), &types.StatusMessage{GatewayID: "test"}), ShouldBeNil)
+			So(i.HandleStatus(middleware.NewContext(), &types.StatusMessage{GatewayID: "test"}), ShouldEqual, ErrRateLimited)
+
+			Convey("Status messages with error messages should bypass it", func() {
+				err := i.HandleStatus(middleware.NewContext(), &types.StatusMessage{
+					GatewayID: "test",
+					Message:   &gateway.Status{Messages: []string{"concentrator error"}},
+				})
+				So(err, ShouldBeNil)
+			})
+
+			Convey("Status messages with a matching attribute should bypass it", func() {
+				err := i.HandleStatus(middleware.NewContext(), &types.StatusMessage{
+					GatewayID:  "test",
+					Attributes: map[string]string{"health": "down"},
+				})
+				So(err, ShouldBeNil)
+			})
+
+			Convey("Status messages with another attribute value should not bypass it", func() {
+				err := i.HandleStatus(middleware.NewContext(), &types.StatusMessage{
+					GatewayID:  "test",
+					Attributes: map[string]string{"health": "ok"},
+				})
+				So(err, ShouldEqual, ErrRateLimited)
+			})
+		})
+	})
+
+	Convey("When parsing error conditions", t, func(c C) {
+		_, err := ParseErrorCondition("messages")
+		So(err, ShouldBeNil)
+		_, err = ParseErrorCondition("tx-errors")
+		So(err, ShouldBeNil)
+		_, err = ParseErrorCondition("attribute:")
+		So(err, ShouldNotBeNil)
+		_, err = ParseErrorCondition("cpu")
+		So(err, ShouldNotBeNil)
+	})
+}
+
+func TestState(t *testing.T) {
+	Convey("Given a new RateLimit", t, func(c C) {
+		i := NewRateLimit(Limits{Uplink: 2, Status: 1})
+
+		Convey("Unknown gateways should have no state", func() {
+			_, err := i.State("test")
+			So(err, ShouldEqual, ErrUnknownGateway)
+		})
+
+		Convey("When a gateway is throttled", func() {
+			So(i.HandleUplink(middleware.NewContext(), &types.UplinkMessage{GatewayID: "test"}), ShouldBeNil)
+			So(i.HandleUplink(middleware.NewContext(), &types.UplinkMessage{GatewayID: "test"}), ShouldBeNil)
+			So(i.HandleUplink(middleware.NewContext(), &types.UplinkMessage{GatewayID: "test"}), ShouldEqual, ErrRateLimited)
+			So(i.HandleStatus(middleware.NewContext(), &types.StatusMessage{GatewayID: "test"}), ShouldBeNil)
+
+			state, err := i.State("test")
+			So(err, ShouldBeNil)
+			So(state.GatewayID, ShouldEqual, "test")
+
+			Convey("The state should contain the available and dropped messages", func() {
+				So(state.Uplink.Limit, ShouldEqual, 2)
+				So(state.Uplink.Available, ShouldEqual, 0)
+				So(state.Uplink.Dropped, ShouldEqual, 1)
+				So(state.Uplink.LastAllowed.IsZero(), ShouldBeFalse)
+				So(state.Uplink.LastDropped.IsZero(), ShouldBeFalse)
+				So(state.Status.Available, ShouldEqual, 0)
+				So(state.Status.Dropped, ShouldEqual, 0)
+				So(state.Status.LastDropped.IsZero(), ShouldBeTrue)
+			})
+
+			Convey("Message types without limit should have no state", func() {
+				So(state.Downlink, ShouldBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,105 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package ratelimit
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/TheThingsNetwork/go-utils/rate"
+)
+
+// ErrUnknownGateway is returned by State if the gateway has no rate limit state
+var ErrUnknownGateway = errors.New("ratelimit: unknown gateway")
+
+// limiter wraps a rate.Limiter and keeps track of the messages that it allowed and dropped
+type limiter struct {
+	rate.Limiter
+	counter rate.Counter
+	limit   uint64
+
+	mu          sync.Mutex
+	dropped     uint64
+	lastAllowed time.Time
+	lastDropped time.Time
+}
+
+func (l *limiter) Limit() (bool, error) {
+	limited, err := l.Limiter.Limit()
+	if err != nil {
+		return limited, err
+	}
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if limited {
+		l.dropped++
+		l.lastDropped = now
+	} else {
+		l.lastAllowed = now
+	}
+	return limited, nil
+}
+
+// LimiterState is the state of the rate limiter of one message type of a gateway. The limiter counts the messages of
+// the last minute, so messages become available again one minute after they were allowed, instead of with periodic
+// refills.
+type LimiterState struct {
+	Limit       uint64    `json:"limit"`        // Messages per minute
+	Available   uint64    `json:"available"`    // Messages that are allowed before messages are dropped
+	Dropped     uint64    `json:"dropped"`      // Messages dropped by this bridge since the gateway connected
+	LastAllowed time.Time `json:"last_allowed"` // Last message allowed by this bridge
+	LastDropped time.Time `json:"last_dropped"` // Last message dropped by this bridge
+}
+
+func (l *limiter) state() (*LimiterState, error) {
+	if l == nil {
+		return nil, nil
+	}
+	events, err := l.counter.Get(time.Now(), time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	state := &LimiterState{Limit: l.limit}
+	if events < l.limit {
+		state.Available = l.limit - events
+	}
+	l.mu.Lock()
+	state.Dropped, state.LastAllowed, state.LastDropped = l.dropped, l.lastAllowed, l.lastDropped
+	l.mu.Unlock()
+	return state, nil
+}
+
+// State is the rate limit state of a gateway. The state of message types that are not rate-limited is nil.
+type State struct {
+	GatewayID string        `json:"gateway_id"`
+	Uplink    *LimiterState `json:"uplink,omitempty"`
+	Downlink  *LimiterState `json:"downlink,omitempty"`
+	Status    *LimiterState `json:"status,omitempty"`
+}
+
+// State returns the rate limit state of a gateway. It returns ErrUnknownGateway if the gateway did not connect or send
+// messages. With Redis, the available messages are shared by all bridges, but the dropped messages are those of this
+// bridge only.
+func (l *RateLimit) State(gatewayID string) (*State, error) {
+	l.mu.RLock()
+	limits, ok := l.gateways[gatewayID]
+	l.mu.RUnlock()
+	if !ok {
+		return nil, ErrUnknownGateway
+	}
+	state := &State{GatewayID: gatewayID}
+	var err error
+	if state.Uplink, err = limits.uplink.state(); err != nil {
+		return nil, err
+	}
+	if state.Downlink, err = limits.downlink.state(); err != nil {
+		return nil, err
+	}
+	if state.Status, err = limits.status.state(); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
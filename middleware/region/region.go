@@ -0,0 +1,132 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package region
+
+import (
+	"strings"
+
+	"github.com/TheThingsNetwork/gateway-connector-bridge/middleware"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
+	"github.com/TheThingsNetwork/go-utils/log"
+)
+
+// Attribute is the attribute of uplink, downlink and status messages that contains the region
+const Attribute = "region"
+
+type contextKey struct{}
+
+// ContextKey is the key of the region in the middleware context, for the middleware that comes after the Region in
+// the chain. The middleware context does not reach the backends, which get the region from the Attribute.
+var ContextKey = contextKey{}
+
+// FromContext returns the region that was set in the middleware context
+func FromContext(ctx middleware.Context) string {
+	if region, ok := ctx.Get(ContextKey).(string); ok {
+		return region
+	}
+	return ""
+}
+
+// FrequencyPlanRegions maps the prefixes of frequency plans to regions
+var FrequencyPlanRegions = map[string]string{
+	"EU": "eu",
+	"US": "us",
+	"AU": "au",
+	"AS": "as",
+	"KR": "kr",
+	"IN": "in",
+	"CN": "cn",
+	"RU": "ru",
+}
+
+// FrequencyPlanFunc returns the frequency plan (such as "EU_868") of a gateway
+type FrequencyPlanFunc func(gatewayID string) string
+
+// NewRegion returns a middleware that tags messages with the region of the gateway. The region is taken from the
+// configured mapping of gateway IDs, or derived from the frequency plan of the gateway. The bridge does not route
+// messages by region itself; the tag is published by the backends that publish attributes, so that the systems that
+// consume the messages can route them.
+func NewRegion(frequencyPlan FrequencyPlanFunc) *Region {
+	return &Region{
+		log:           log.Get(),
+		frequencyPlan: frequencyPlan,
+		gateways:      make(map[string]string),
+	}
+}
+
+// Region tags messages with the region of the gateway
+type Region struct {
+	log           log.Interface
+	frequencyPlan FrequencyPlanFunc
+	gateways      map[string]string
+	fallback      string
+}
+
+// WithGateways sets the regions of specific gateways, which take precedence over their frequency plans
+func (r *Region) WithGateways(regions map[string]string) *Region {
+	for gatewayID, region := range regions {
+		r.gateways[gatewayID] = region
+	}
+	return r
+}
+
+// WithFallback sets the region for gateways of which the region is not known
+func (r *Region) WithFallback(region string) *Region {
+	r.fallback = region
+	return r
+}
+
+// Get the region of a gateway
+func (r *Region) Get(gatewayID string) string {
+	if region, ok := r.gateways[gatewayID]; ok {
+		return region
+	}
+	if r.frequencyPlan != nil {
+		plan := strings.ToUpper(r.frequencyPlan(gatewayID))
+		if idx := strings.Index(plan, "_"); idx > 0 {
+			plan = plan[:idx]
+		}
+		if region, ok := FrequencyPlanRegions[plan]; ok {
+			return region
+		}
+	}
+	return r.fallback
+}
+
+func (r *Region) tag(ctx middleware.Context, gatewayID string, attributes *map[string]string) string {
+	region := r.Get(gatewayID)
+	if region == "" {
+		return ""
+	}
+	ctx.Set(ContextKey, region)
+	if _, ok := (*attributes)[Attribute]; !ok {
+		if *attributes == nil {
+			*attributes = make(map[string]string)
+		}
+		(*attributes)[Attribute] = region
+	}
+	return region
+}
+
+// HandleUplink tags uplink messages with the region of the gateway
+func (r *Region) HandleUplink(ctx middleware.Context, msg *types.UplinkMessage) error {
+	if region := r.tag(ctx, msg.GatewayID, &msg.Attributes); region != "" && msg.Message != nil && types.Tracing(types.TraceVerbose) {
+		msg.Message.Trace = msg.Message.Trace.WithEvent("tag", "region", region)
+	}
+	return nil
+}
+
+// HandleDownlink tags downlink messages with the region of the gateway
+func (r *Region) HandleDownlink(ctx middleware.Context, msg *types.DownlinkMessage) error {
+	if region := r.tag(ctx, msg.GatewayID, &msg.Attributes); region != "" && msg.Message != nil && types.Tracing(types.TraceVerbose) {
+		msg.Message.Trace = msg.Message.Trace.WithEvent("tag", "region", region)
+	}
+	return nil
+}
+
+// HandleStatus tags status messages with the region of the gateway
+func (r *Region) HandleStatus(ctx middleware.Context, msg *types.StatusMessage) error {
+	r.tag(ctx, msg.GatewayID, &msg.Attributes)
+	return nil
+}
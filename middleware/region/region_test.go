@@ -0,0 +1,77 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package region
+
+import (
+	"testing"
+
+	"github.com/TheThingsNetwork/api/gateway"
+	"github.com/TheThingsNetwork/api/router"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/middleware"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestRegion(t *testing.T) {
+	Convey("Given a new Region", t, func(c C) {
+		r := NewRegion(func(gatewayID string) string {
+			switch gatewayID {
+			case "eu-gateway", "mapped-gateway":
+				return "EU_868"
+			case "us-gateway":
+				return "US_902_928"
+			}
+			return ""
+		}).WithGateways(map[string]string{"mapped-gateway": "eu-west"}).WithFallback("default")
+
+		Convey("The region should be derived from the frequency plan", func() {
+			So(r.Get("eu-gateway"), ShouldEqual, "eu")
+			So(r.Get("us-gateway"), ShouldEqual, "us")
+		})
+		Convey("The configured mapping should take precedence", func() {
+			So(r.Get("mapped-gateway"), ShouldEqual, "eu-west")
+		})
+		Convey("The fallback should be used for unknown gateways", func() {
+			So(r.Get("other-gateway"), ShouldEqual, "default")
+		})
+
+		Convey("When sending an UplinkMessage", func() {
+			ctx := middleware.NewContext()
+			uplink := &types.UplinkMessage{GatewayID: "eu-gateway", Message: &router.UplinkMessage{}}
+			err := r.HandleUplink(ctx, uplink)
+			Convey("There should be no error", func() {
+				So(err, ShouldBeNil)
+			})
+			Convey("The region should be in the context", func() {
+				So(FromContext(ctx), ShouldEqual, "eu")
+			})
+			Convey("The region should be set as attribute", func() {
+				So(uplink.Attributes[Attribute], ShouldEqual, "eu")
+			})
+			Convey("The tag should be traced", func() {
+				So(uplink.Message.Trace, ShouldNotBeNil)
+				So(uplink.Message.Trace.Metadata["region"], ShouldEqual, "eu")
+			})
+		})
+
+		Convey("When sending a DownlinkMessage with a region attribute", func() {
+			downlink := &types.DownlinkMessage{GatewayID: "eu-gateway", Attributes: map[string]string{Attribute: "eu-west"}}
+			So(r.HandleDownlink(middleware.NewContext(), downlink), ShouldBeNil)
+			Convey("The attribute should not be overwritten", func() {
+				So(downlink.Attributes[Attribute], ShouldEqual, "eu-west")
+			})
+		})
+
+		Convey("When sending a StatusMessage", func() {
+			status := &types.StatusMessage{GatewayID: "us-gateway", Message: &gateway.Status{}}
+			err := r.HandleStatus(middleware.NewContext(), status)
+			Convey("There should be no error", func() {
+				So(err, ShouldBeNil)
+			})
+			Convey("The region should be set as attribute", func() {
+				So(status.Attributes[Attribute], ShouldEqual, "us")
+			})
+		})
+	})
+}
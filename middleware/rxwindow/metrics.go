@@ -0,0 +1,19 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package rxwindow
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var correctedCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "ttn",
+		Subsystem: "bridge",
+		Name:      "downlinks_rx_window_corrected_total",
+		Help:      "Total number of downlink messages that were moved to RX2 because of a missing or invalid frequency or data rate.",
+	}, []string{"reason"},
+)
+
+func init() {
+	prometheus.MustRegister(correctedCounter)
+}
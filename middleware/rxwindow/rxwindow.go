@@ -0,0 +1,139 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package rxwindow
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	pb_lorawan "github.com/TheThingsNetwork/api/protocol/lorawan"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/middleware"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
+	"github.com/TheThingsNetwork/go-utils/log"
+	"github.com/brocaar/lorawan"
+	"github.com/brocaar/lorawan/band"
+)
+
+const correctEvent = "correct rx window"
+
+// FrequencyPlanFunc returns the frequency plan (such as "EU_863_870") of a gateway
+type FrequencyPlanFunc func(gatewayID string) string
+
+// FrequencyPlanAliases maps short names of frequency plans to the names of their regional parameters
+var FrequencyPlanAliases = map[string]string{
+	"EU_868": "EU_863_870",
+	"US_915": "US_902_928",
+	"AU_915": "AU_915_928",
+	"CN_470": "CN_470_510",
+	"CN_779": "CN_779_787",
+	"KR_920": "KR_920_923",
+	"IN_865": "IN_865_867",
+}
+
+var bands = make(map[string]band.Band)
+
+func init() {
+	for _, name := range []band.Name{
+		band.AS_923, band.AU_915_928, band.CN_470_510, band.CN_779_787, band.EU_433,
+		band.EU_863_870, band.IN_865_867, band.KR_920_923, band.US_902_928,
+	} {
+		if b, err := band.GetConfig(name, false, lorawan.DwellTimeNoLimit); err == nil {
+			bands[string(name)] = b
+		}
+	}
+	// TTN uses SF9BW125 in RX2
+	eu := bands[string(band.EU_863_870)]
+	eu.RX2DataRate = 3
+	bands[string(band.EU_863_870)] = eu
+}
+
+// NewRXWindow returns a middleware that checks the RX window of downlink messages against the frequency plan of the
+// gateway, which is looked up with the given function. Downlinks with a missing or invalid frequency or data rate
+// are moved to the RX2 window of the frequency plan.
+func NewRXWindow(frequencyPlan FrequencyPlanFunc) *RXWindow {
+	return &RXWindow{
+		log:           log.Get(),
+		frequencyPlan: frequencyPlan,
+	}
+}
+
+// RXWindow corrects the RX window of downlink messages
+type RXWindow struct {
+	log           log.Interface
+	frequencyPlan FrequencyPlanFunc
+}
+
+func bandFor(frequencyPlan string) (b band.Band, ok bool) {
+	frequencyPlan = strings.ToUpper(frequencyPlan)
+	if alias, ok := FrequencyPlanAliases[frequencyPlan]; ok {
+		frequencyPlan = alias
+	}
+	b, ok = bands[frequencyPlan]
+	return
+}
+
+func validFrequency(b band.Band, frequency uint64) bool {
+	if frequency == uint64(b.RX2Frequency) {
+		return true
+	}
+	for _, channel := range b.DownlinkChannels {
+		if frequency == uint64(channel.Frequency) {
+			return true
+		}
+	}
+	return false
+}
+
+func validDataRate(b band.Band, dataRate string) bool {
+	dr := band.DataRate{Modulation: band.LoRaModulation}
+	if _, err := fmt.Sscanf(dataRate, "SF%dBW%d", &dr.SpreadFactor, &dr.Bandwidth); err != nil {
+		return false
+	}
+	_, err := b.GetDataRate(dr)
+	return err == nil
+}
+
+// HandleDownlink moves LoRa downlink messages with a missing or invalid frequency or data rate to RX2
+func (w *RXWindow) HandleDownlink(ctx middleware.Context, msg *types.DownlinkMessage) error {
+	if msg.Message == nil {
+		return nil
+	}
+	lora := msg.Message.ProtocolConfiguration.GetLoRaWAN()
+	if lora == nil || lora.Modulation != pb_lorawan.Modulation_LORA {
+		return nil
+	}
+	b, ok := bandFor(w.frequencyPlan(msg.GatewayID))
+	if !ok {
+		return nil
+	}
+	gtw := &msg.Message.GatewayConfiguration
+	var reason string
+	switch {
+	case gtw.Frequency == 0:
+		reason = "missing frequency"
+	case !validFrequency(b, gtw.Frequency):
+		reason = "invalid frequency"
+	case lora.DataRate == "":
+		reason = "missing data rate"
+	case !validDataRate(b, lora.DataRate):
+		reason = "invalid data rate"
+	default:
+		return nil
+	}
+	rx2 := b.DataRates[b.RX2DataRate]
+	dataRate := fmt.Sprintf("SF%dBW%d", rx2.SpreadFactor, rx2.Bandwidth)
+	frequency := uint64(b.RX2Frequency)
+	// A downlink that was scheduled in RX1 is only received by the device if it is sent when RX2 opens
+	if gtw.Frequency != 0 && gtw.Frequency != frequency && gtw.Timestamp != 0 {
+		gtw.Timestamp += uint32((b.ReceiveDelay2 - b.ReceiveDelay1) / time.Microsecond)
+	}
+	w.log.WithField("GatewayID", msg.GatewayID).WithField("Reason", reason).WithField("Frequency", gtw.Frequency).WithField("DataRate", lora.DataRate).Debug("Moving downlink to RX2")
+	gtw.Frequency, lora.DataRate = frequency, dataRate
+	correctedCounter.WithLabelValues(reason).Inc()
+	if types.Tracing(types.TraceBasic) {
+		msg.Message.Trace = msg.Message.Trace.WithEvent(correctEvent, "reason", reason, "frequency", frequency, "data_rate", dataRate)
+	}
+	return nil
+}
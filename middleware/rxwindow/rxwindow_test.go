@@ -0,0 +1,103 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package rxwindow
+
+import (
+	"testing"
+
+	"github.com/TheThingsNetwork/api/gateway"
+	"github.com/TheThingsNetwork/api/protocol"
+	"github.com/TheThingsNetwork/api/protocol/lorawan"
+	"github.com/TheThingsNetwork/api/router"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/middleware"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func downlink(gatewayID string, frequency uint64, dataRate string, timestamp uint32) *types.DownlinkMessage {
+	return &types.DownlinkMessage{
+		GatewayID: gatewayID,
+		Message: &router.DownlinkMessage{
+			Payload: make([]byte, 20),
+			ProtocolConfiguration: protocol.TxConfiguration{Protocol: &protocol.TxConfiguration_LoRaWAN{LoRaWAN: &lorawan.TxConfiguration{
+				Modulation: lorawan.Modulation_LORA,
+				DataRate:   dataRate,
+				CodingRate: "4/5",
+			}}},
+			GatewayConfiguration: gateway.TxConfiguration{Frequency: frequency, Timestamp: timestamp},
+		},
+	}
+}
+
+func TestRXWindow(t *testing.T) {
+	Convey("Given a new RXWindow", t, func(c C) {
+		w := NewRXWindow(func(gatewayID string) string {
+			switch gatewayID {
+			case "us-gateway":
+				return "US_902_928"
+			case "unknown-gateway":
+				return ""
+			}
+			return "EU_868"
+		})
+
+		check := func(msg *types.DownlinkMessage) *types.DownlinkMessage {
+			So(w.HandleDownlink(middleware.NewContext(), msg), ShouldBeNil)
+			return msg
+		}
+
+		Convey("Valid RX1 downlinks should not be changed", func() {
+			So(check(downlink("dev", 868100000, "SF7BW125", 1000000)), ShouldResemble, downlink("dev", 868100000, "SF7BW125", 1000000))
+			So(check(downlink("us-gateway", 923900000, "SF10BW500", 1000000)), ShouldResemble, downlink("us-gateway", 923900000, "SF10BW500", 1000000))
+		})
+
+		Convey("Valid RX2 downlinks should not be changed", func() {
+			So(check(downlink("dev", 869525000, "SF9BW125", 2000000)), ShouldResemble, downlink("dev", 869525000, "SF9BW125", 2000000))
+		})
+
+		Convey("Downlinks for gateways without a known frequency plan should not be changed", func() {
+			So(check(downlink("unknown-gateway", 0, "", 0)), ShouldResemble, downlink("unknown-gateway", 0, "", 0))
+		})
+
+		Convey("Downlinks without frequency and data rate should be sent in RX2", func() {
+			msg := check(downlink("dev", 0, "", 0))
+			So(msg.Message.GatewayConfiguration.Frequency, ShouldEqual, 869525000)
+			So(msg.Message.ProtocolConfiguration.GetLoRaWAN().DataRate, ShouldEqual, "SF9BW125")
+			So(msg.Message.GatewayConfiguration.Timestamp, ShouldEqual, 0)
+		})
+
+		Convey("RX2 downlinks without data rate should get the RX2 data rate", func() {
+			msg := check(downlink("dev", 869525000, "", 2000000))
+			So(msg.Message.ProtocolConfiguration.GetLoRaWAN().DataRate, ShouldEqual, "SF9BW125")
+			So(msg.Message.GatewayConfiguration.Timestamp, ShouldEqual, 2000000)
+		})
+
+		Convey("RX1 downlinks with an invalid frequency should be moved to RX2", func() {
+			msg := check(downlink("dev", 915000000, "SF7BW125", 1000000))
+			So(msg.Message.GatewayConfiguration.Frequency, ShouldEqual, 869525000)
+			So(msg.Message.ProtocolConfiguration.GetLoRaWAN().DataRate, ShouldEqual, "SF9BW125")
+			So(msg.Message.GatewayConfiguration.Timestamp, ShouldEqual, 2000000)
+		})
+
+		Convey("RX1 downlinks with an invalid data rate should be moved to RX2", func() {
+			msg := check(downlink("us-gateway", 923900000, "SF7BW250", 1000000))
+			So(msg.Message.GatewayConfiguration.Frequency, ShouldEqual, 923300000)
+			So(msg.Message.ProtocolConfiguration.GetLoRaWAN().DataRate, ShouldEqual, "SF12BW500")
+			So(msg.Message.GatewayConfiguration.Timestamp, ShouldEqual, 2000000)
+		})
+
+		Convey("Corrections should be traced", func() {
+			msg := check(downlink("dev", 0, "", 0))
+			So(msg.Message.Trace, ShouldNotBeNil)
+			So(msg.Message.Trace.Event, ShouldEqual, correctEvent)
+			So(msg.Message.Trace.Metadata["reason"], ShouldEqual, "missing frequency")
+		})
+
+		Convey("FSK downlinks should not be changed", func() {
+			msg := downlink("dev", 0, "", 0)
+			msg.Message.ProtocolConfiguration.GetLoRaWAN().Modulation = lorawan.Modulation_FSK
+			So(check(msg).Message.GatewayConfiguration.Frequency, ShouldEqual, 0)
+		})
+	})
+}
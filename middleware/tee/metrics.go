@@ -0,0 +1,29 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package tee
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var teed = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Namespace: "ttn",
+		Subsystem: "bridge",
+		Name:      "tee_uplinks_total",
+		Help:      "Total number of uplink messages that were copied to the debug sink.",
+	},
+)
+
+var dropped = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Namespace: "ttn",
+		Subsystem: "bridge",
+		Name:      "tee_dropped_uplinks_total",
+		Help:      "Total number of sampled uplink messages that were dropped because the debug sink was too slow.",
+	},
+)
+
+func init() {
+	prometheus.MustRegister(teed)
+	prometheus.MustRegister(dropped)
+}
@@ -0,0 +1,87 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package tee
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
+	"github.com/TheThingsNetwork/go-utils/log"
+)
+
+// record is the JSON representation of a copied uplink message
+type record struct {
+	Time      time.Time   `json:"time"`
+	GatewayID string      `json:"gateway_id"`
+	Message   interface{} `json:"message"`
+}
+
+func newRecord(msg *types.UplinkMessage) record {
+	return record{Time: time.Now(), GatewayID: msg.GatewayID, Message: msg.Message}
+}
+
+// LogSink logs the uplink messages
+func LogSink(ctx log.Interface) Sink {
+	return logSink{ctx}
+}
+
+type logSink struct {
+	ctx log.Interface
+}
+
+func (s logSink) Write(msg *types.UplinkMessage) error {
+	s.ctx.WithField("GatewayID", msg.GatewayID).WithField("Message", msg.Message).Info("Debug uplink")
+	return nil
+}
+
+// WriterSink writes the uplink messages as JSON lines to w, for example a file
+func WriterSink(w io.Writer) Sink {
+	return &writerSink{enc: json.NewEncoder(w)}
+}
+
+type writerSink struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func (s *writerSink) Write(msg *types.UplinkMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enc.Encode(newRecord(msg))
+}
+
+// HTTPTimeout is the timeout of requests of the HTTP sink
+var HTTPTimeout = 5 * time.Second
+
+// HTTPSink POSTs the uplink messages as JSON to the given URL
+func HTTPSink(url string) Sink {
+	return &httpSink{url: url, client: &http.Client{Timeout: HTTPTimeout}}
+}
+
+type httpSink struct {
+	url    string
+	client *http.Client
+}
+
+func (s *httpSink) Write(msg *types.UplinkMessage) error {
+	body, err := json.Marshal(newRecord(msg))
+	if err != nil {
+		return err
+	}
+	res, err := s.client.Post(s.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode >= 300 {
+		return fmt.Errorf("tee: debug sink returned %s", res.Status)
+	}
+	return nil
+}
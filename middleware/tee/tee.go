@@ -0,0 +1,106 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+// Package tee sends copies of the uplink messages of selected gateways to a debug sink, without affecting the
+// messages that are forwarded.
+package tee
+
+import (
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TheThingsNetwork/gateway-connector-bridge/middleware"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
+	"github.com/TheThingsNetwork/go-utils/log"
+)
+
+// BufferSize is the number of copies that can be waiting for the sink. Copies are dropped when the buffer is full.
+var BufferSize = 100
+
+// Sink receives copies of uplink messages
+type Sink interface {
+	Write(msg *types.UplinkMessage) error
+}
+
+// New returns a middleware that sends copies of uplink messages to the sink. Add gateways with WithGateway.
+func New(sink Sink) *Tee {
+	t := &Tee{
+		log:    log.Get(),
+		sink:   sink,
+		rates:  make(map[string]float64),
+		rand:   rand.New(rand.NewSource(time.Now().UnixNano())),
+		copies: make(chan *types.UplinkMessage, BufferSize),
+		done:   make(chan struct{}),
+	}
+	go t.write()
+	return t
+}
+
+// Tee middleware
+type Tee struct {
+	log  log.Interface
+	sink Sink
+
+	mu    sync.Mutex
+	rates map[string]float64
+	rand  *rand.Rand
+
+	copies    chan *types.UplinkMessage
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// WithGateway sends copies of the given fraction (0 to 1) of the uplink messages of the gateway to the sink
+func (t *Tee) WithGateway(gatewayID string, rate float64) *Tee {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.rates[strings.ToLower(gatewayID)] = rate
+	return t
+}
+
+// Close stops sending copies to the sink
+func (t *Tee) Close() {
+	t.closeOnce.Do(func() {
+		close(t.done)
+	})
+}
+
+func (t *Tee) sampled(gatewayID string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	rate, ok := t.rates[strings.ToLower(gatewayID)]
+	if !ok || rate <= 0 {
+		return false
+	}
+	return rate >= 1 || t.rand.Float64() < rate
+}
+
+func (t *Tee) write() {
+	for {
+		select {
+		case <-t.done:
+			return
+		case msg := <-t.copies:
+			if err := t.sink.Write(msg); err != nil {
+				t.log.WithField("GatewayID", msg.GatewayID).WithError(err).Warn("Could not write uplink to debug sink")
+			}
+		}
+	}
+}
+
+// HandleUplink sends a copy of sampled uplink messages to the sink. The sink is written in the background, so that
+// a slow sink does not delay the uplink.
+func (t *Tee) HandleUplink(_ middleware.Context, msg *types.UplinkMessage) error {
+	if !t.sampled(msg.GatewayID) {
+		return nil
+	}
+	select {
+	case t.copies <- msg.Clone():
+		teed.Inc()
+	default:
+		dropped.Inc()
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package tee
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/TheThingsNetwork/api/router"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/middleware"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type recorder struct {
+	mu   sync.Mutex
+	msgs []*types.UplinkMessage
+}
+
+func (r *recorder) Write(msg *types.UplinkMessage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.msgs = append(r.msgs, msg)
+	return nil
+}
+
+func (r *recorder) len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.msgs)
+}
+
+func TestTee(t *testing.T) {
+	Convey("Given a Tee with a sampled gateway", t, func(c C) {
+		sink := new(recorder)
+		tee := New(sink).WithGateway("Dev", 1)
+		Reset(tee.Close)
+
+		Convey("When sending an uplink of the gateway", func() {
+			msg := &types.UplinkMessage{GatewayID: "dev", Message: &router.UplinkMessage{Payload: []byte{1, 2, 3}}}
+			So(tee.HandleUplink(middleware.NewContext(), msg), ShouldBeNil)
+			time.Sleep(10 * time.Millisecond)
+			Convey("A copy should be written to the sink", func() {
+				So(sink.len(), ShouldEqual, 1)
+				So(sink.msgs[0].Message.Payload, ShouldResemble, []byte{1, 2, 3})
+			})
+			Convey("Changing the original should not change the copy", func() {
+				msg.Message.Payload[0] = 42
+				So(sink.msgs[0].Message.Payload[0], ShouldEqual, 1)
+			})
+		})
+
+		Convey("When sending an uplink of another gateway", func() {
+			tee.HandleUplink(middleware.NewContext(), &types.UplinkMessage{GatewayID: "other", Message: &router.UplinkMessage{}})
+			time.Sleep(10 * time.Millisecond)
+			Convey("Nothing should be written to the sink", func() {
+				So(sink.len(), ShouldEqual, 0)
+			})
+		})
+	})
+
+	Convey("Given a Tee with a sample rate", t, func(c C) {
+		sink := new(recorder)
+		tee := New(sink).WithGateway("dev", 0.5)
+		Reset(tee.Close)
+		var sampled int
+		for i := 0; i < 1000; i++ {
+			if tee.sampled("dev") {
+				sampled++
+			}
+		}
+		Convey("About half of the uplinks should be sampled", func() {
+			So(sampled, ShouldBeBetween, 400, 600)
+		})
+	})
+
+	Convey("Given a WriterSink", t, func(c C) {
+		var buf bytes.Buffer
+		sink := WriterSink(&buf)
+		Convey("It should write JSON lines", func() {
+			So(sink.Write(&types.UplinkMessage{GatewayID: "dev", Message: &router.UplinkMessage{}}), ShouldBeNil)
+			So(buf.String(), ShouldContainSubstring, `"gateway_id":"dev"`)
+			So(buf.String(), ShouldEndWith, "\n")
+		})
+	})
+}
@@ -0,0 +1,19 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package threshold
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var belowThreshold = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "ttn",
+		Subsystem: "bridge",
+		Name:      "below_threshold_uplinks_total",
+		Help:      "Total number of uplink messages with a signal quality below the thresholds of the gateway.",
+	}, []string{"gateway_id"},
+)
+
+func init() {
+	prometheus.MustRegister(belowThreshold)
+}
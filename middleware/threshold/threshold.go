@@ -0,0 +1,66 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package threshold
+
+import (
+	"strings"
+
+	"github.com/TheThingsNetwork/gateway-connector-bridge/middleware"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
+	"github.com/TheThingsNetwork/go-utils/log"
+)
+
+// Attribute is the attribute of uplink messages with a signal quality below the thresholds of the gateway. The value
+// is "rssi", "snr" or "rssi,snr".
+const Attribute = "below_threshold"
+
+// ThresholdsFunc returns the minimum RSSI and SNR of a gateway (such as the thresholds from the gateway information
+// overrides), or nil for thresholds that are not configured
+type ThresholdsFunc func(gatewayID string) (minRSSI, minSNR *float32)
+
+// NewThreshold returns a middleware that tags uplink messages with a signal quality below the thresholds of the
+// gateway. The tag is an attribute of the message, so that it reaches the backends that publish attributes.
+func NewThreshold(thresholds ThresholdsFunc) *Threshold {
+	return &Threshold{
+		log:        log.Get(),
+		thresholds: thresholds,
+	}
+}
+
+// Threshold tags uplink messages with a signal quality below the thresholds of the gateway
+type Threshold struct {
+	log        log.Interface
+	thresholds ThresholdsFunc
+}
+
+// HandleUplink tags uplink messages whose RSSI or SNR is below the thresholds of the gateway
+func (t *Threshold) HandleUplink(_ middleware.Context, msg *types.UplinkMessage) error {
+	if msg.Message == nil {
+		return nil
+	}
+	minRSSI, minSNR := t.thresholds(msg.GatewayID)
+	meta := msg.Message.GatewayMetadata
+	var below []string
+	if minRSSI != nil && meta.RSSI < *minRSSI {
+		below = append(below, "rssi")
+	}
+	if minSNR != nil && meta.SNR < *minSNR {
+		below = append(below, "snr")
+	}
+	if len(below) == 0 {
+		return nil
+	}
+	if msg.Attributes == nil {
+		msg.Attributes = make(map[string]string)
+	}
+	msg.Attributes[Attribute] = strings.Join(below, ",")
+	belowThreshold.WithLabelValues(msg.GatewayID).Inc()
+	if types.Tracing(types.TraceVerbose) {
+		for _, field := range below {
+			msg.Message.Trace = msg.Message.Trace.WithEvent("tag", Attribute, field)
+		}
+	}
+	t.log.WithField("GatewayID", msg.GatewayID).WithField("RSSI", meta.RSSI).WithField("SNR", meta.SNR).Debug("Uplink below signal-quality threshold")
+	return nil
+}
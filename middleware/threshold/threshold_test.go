@@ -0,0 +1,73 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package threshold
+
+import (
+	"testing"
+
+	"github.com/TheThingsNetwork/api/gateway"
+	"github.com/TheThingsNetwork/api/router"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/middleware"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
+	dto "github.com/prometheus/client_model/go"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestThreshold(t *testing.T) {
+	Convey("Given a new Threshold", t, func(c C) {
+		minRSSI, minSNR := float32(-110), float32(-5)
+		th := NewThreshold(func(gatewayID string) (*float32, *float32) {
+			if gatewayID == "dev" {
+				return &minRSSI, &minSNR
+			}
+			return nil, nil
+		})
+		uplink := func(gatewayID string, rssi, snr float32) *types.UplinkMessage {
+			msg := &types.UplinkMessage{GatewayID: gatewayID, Message: &router.UplinkMessage{GatewayMetadata: gateway.RxMetadata{RSSI: rssi, SNR: snr}}}
+			So(th.HandleUplink(middleware.NewContext(), msg), ShouldBeNil)
+			return msg
+		}
+		counterValue := func() float64 {
+			var m dto.Metric
+			belowThreshold.WithLabelValues("dev").Write(&m)
+			return m.GetCounter().GetValue()
+		}
+
+		Convey("When sending an UplinkMessage above the thresholds", func() {
+			msg := uplink("dev", -80, 7)
+			Convey("It should not be tagged", func() {
+				So(msg.Attributes, ShouldNotContainKey, Attribute)
+			})
+		})
+
+		Convey("When sending an UplinkMessage below the RSSI threshold", func() {
+			before := counterValue()
+			msg := uplink("dev", -120, 7)
+			Convey("It should be tagged and counted", func() {
+				So(msg.Attributes[Attribute], ShouldEqual, "rssi")
+				So(counterValue()-before, ShouldEqual, 1)
+			})
+		})
+
+		Convey("When sending an UplinkMessage below both thresholds", func() {
+			msg := uplink("dev", -120, -10)
+			Convey("It should be tagged", func() {
+				So(msg.Attributes[Attribute], ShouldEqual, "rssi,snr")
+			})
+		})
+
+		Convey("When sending an UplinkMessage of a gateway without thresholds", func() {
+			msg := uplink("other", -120, -10)
+			Convey("It should not be tagged", func() {
+				So(msg.Attributes, ShouldNotContainKey, Attribute)
+			})
+		})
+
+		Convey("When sending an UplinkMessage without a message", func() {
+			Convey("There should be no error", func() {
+				So(th.HandleUplink(middleware.NewContext(), &types.UplinkMessage{GatewayID: "dev"}), ShouldBeNil)
+			})
+		})
+	})
+}
@@ -0,0 +1,28 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package timestamp
+
+import "github.com/prometheus/client_golang/prometheus"
+
+var normalizedCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "ttn",
+		Subsystem: "bridge",
+		Name:      "timestamp_normalized_total",
+		Help:      "Total number of messages of which the timestamp was normalized.",
+	}, []string{"message"},
+)
+
+var implausibleCounter = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "ttn",
+		Subsystem: "bridge",
+		Name:      "timestamp_implausible_total",
+		Help:      "Total number of messages with an implausible timestamp.",
+	}, []string{"message"},
+)
+
+func init() {
+	prometheus.MustRegister(normalizedCounter, implausibleCounter)
+}
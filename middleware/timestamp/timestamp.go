@@ -0,0 +1,255 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package timestamp
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TheThingsNetwork/gateway-connector-bridge/middleware"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
+	"github.com/TheThingsNetwork/go-utils/log"
+)
+
+// Epoch of the timestamps of a gateway
+type Epoch string
+
+// Epochs of timestamps
+const (
+	EpochUnix Epoch = "unix" // 1970-01-01 00:00:00 UTC
+	EpochGPS  Epoch = "gps"  // 1980-01-06 00:00:00 UTC, without leap seconds
+)
+
+// gpsOffset is the time between the Unix epoch and the GPS epoch
+const gpsOffset = 315964800 * time.Second
+
+// GPSLeapSeconds is the number of leap seconds that GPS time is ahead of UTC
+var GPSLeapSeconds = 18 * time.Second
+
+// Format of the timestamps of a gateway. Timestamps are normalized to nanoseconds since the Unix epoch in UTC.
+type Format struct {
+	Epoch Epoch         // Epoch of the timestamps, defaults to EpochUnix
+	Unit  time.Duration // Unit of the timestamps, or 0 to detect the unit from the magnitude of Unix timestamps
+	Local bool          // The timestamps are the wall clock time in the time zone of the gateway instead of UTC
+}
+
+// ParseFormat parses a format from its configuration: "epoch/unit" or "epoch/unit/local", where the epoch is "unix"
+// or "gps", and the unit is "s", "ms", "us", "ns" or "auto"
+func ParseFormat(format string) (Format, error) {
+	invalid := func(reason string) (Format, error) {
+		return Format{}, fmt.Errorf("timestamp: invalid format %q: %s", format, reason)
+	}
+	parts := strings.Split(format, "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return invalid("should be epoch/unit or epoch/unit/local")
+	}
+	var f Format
+	switch epoch := Epoch(strings.ToLower(parts[0])); epoch {
+	case EpochUnix, EpochGPS:
+		f.Epoch = epoch
+	default:
+		return invalid(fmt.Sprintf("unknown epoch %q", parts[0]))
+	}
+	switch strings.ToLower(parts[1]) {
+	case "s":
+		f.Unit = time.Second
+	case "ms":
+		f.Unit = time.Millisecond
+	case "us":
+		f.Unit = time.Microsecond
+	case "ns":
+		f.Unit = time.Nanosecond
+	case "auto":
+	default:
+		return invalid(fmt.Sprintf("unknown unit %q", parts[1]))
+	}
+	if len(parts) == 3 {
+		if strings.ToLower(parts[2]) != "local" {
+			return invalid(fmt.Sprintf("unknown option %q", parts[2]))
+		}
+		f.Local = true
+	}
+	if f.Epoch == EpochGPS && f.Unit == 0 {
+		return invalid("the unit of GPS timestamps can not be detected")
+	}
+	return f, nil
+}
+
+// unit returns the unit of a Unix timestamp from its magnitude
+func unit(value int64) time.Duration {
+	if value < 0 {
+		value = -value
+	}
+	switch {
+	case value < 1e11:
+		return time.Second
+	case value < 1e14:
+		return time.Millisecond
+	case value < 1e17:
+		return time.Microsecond
+	default:
+		return time.Nanosecond
+	}
+}
+
+// normalize returns the time of a timestamp in the format. The location is used for local timestamps and may be nil.
+func (f Format) normalize(value int64, location *time.Location) time.Time {
+	u := f.Unit
+	if u == 0 {
+		u = unit(value)
+	}
+	t := time.Unix(0, 0).Add(time.Duration(value) * u).UTC()
+	if f.Epoch == EpochGPS {
+		t = t.Add(gpsOffset - GPSLeapSeconds)
+	}
+	if f.Local && location != nil {
+		t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), location).UTC()
+	}
+	return t
+}
+
+// Defaults for plausible timestamps
+var (
+	DefaultMinTime   = time.Date(2015, time.January, 1, 0, 0, 0, 0, time.UTC)
+	DefaultMaxFuture = time.Hour
+)
+
+// TimezoneFunc returns the time zone of a gateway (such as the time zone from the gateway information), or nil if it
+// is not known
+type TimezoneFunc func(gatewayID string) *time.Location
+
+// NewTimestamp returns a middleware that normalizes the timestamps of uplink and status messages to nanoseconds since
+// the Unix epoch in UTC
+func NewTimestamp() *Timestamp {
+	return &Timestamp{
+		log:       log.Get(),
+		gateways:  make(map[string]Format),
+		minTime:   DefaultMinTime,
+		maxFuture: DefaultMaxFuture,
+	}
+}
+
+// Timestamp normalizes the timestamps of uplink and status messages
+type Timestamp struct {
+	log log.Interface
+
+	mu        sync.RWMutex
+	format    Format
+	gateways  map[string]Format
+	timezone  TimezoneFunc
+	minTime   time.Time
+	maxFuture time.Duration
+}
+
+// WithDefault sets the format of the timestamps of gateways that have no format of their own
+func (t *Timestamp) WithDefault(format Format) *Timestamp {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.format = format
+	return t
+}
+
+// WithGateway sets the format of the timestamps of the gateway
+func (t *Timestamp) WithGateway(gatewayID string, format Format) *Timestamp {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.gateways[strings.ToLower(gatewayID)] = format
+	return t
+}
+
+// WithTimezoneFunc sets the function that looks up the time zone of gateways with local timestamps. Local timestamps
+// of gateways without a time zone are interpreted as UTC.
+func (t *Timestamp) WithTimezoneFunc(timezone TimezoneFunc) *Timestamp {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.timezone = timezone
+	return t
+}
+
+// WithPlausibility sets the range of plausible timestamps: timestamps before minTime or more than maxFuture after the
+// current time are flagged as implausible. Implausible timestamps are counted, logged and traced, but not dropped.
+func (t *Timestamp) WithPlausibility(minTime time.Time, maxFuture time.Duration) *Timestamp {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.minTime, t.maxFuture = minTime, maxFuture
+	return t
+}
+
+// normalize returns the normalized timestamp of the gateway, and why it is implausible, or an empty string if it is
+// plausible
+func (t *Timestamp) normalize(gatewayID string, value int64) (int64, string) {
+	t.mu.RLock()
+	format, ok := t.gateways[strings.ToLower(gatewayID)]
+	if !ok {
+		format = t.format
+	}
+	timezone, minTime, maxFuture := t.timezone, t.minTime, t.maxFuture
+	t.mu.RUnlock()
+	var location *time.Location
+	if format.Local && timezone != nil {
+		location = timezone(gatewayID)
+	}
+	normalized := format.normalize(value, location)
+	switch {
+	case normalized.Before(minTime):
+		return normalized.UnixNano(), fmt.Sprintf("before %s", minTime.Format(time.RFC3339))
+	case maxFuture > 0 && normalized.After(time.Now().Add(maxFuture)):
+		return normalized.UnixNano(), fmt.Sprintf("more than %s in the future", maxFuture)
+	}
+	return normalized.UnixNano(), ""
+}
+
+// observe normalizes the timestamp of a message of the gateway, counts and logs implausible timestamps, and returns
+// the normalized timestamp and why it is implausible
+func (t *Timestamp) observe(message, gatewayID string, value int64) (int64, string) {
+	normalized, reason := t.normalize(gatewayID, value)
+	if normalized != value {
+		normalizedCounter.WithLabelValues(message).Inc()
+	}
+	if reason != "" {
+		implausibleCounter.WithLabelValues(message).Inc()
+		t.log.WithField("GatewayID", gatewayID).WithField("Message", message).WithField("Time", time.Unix(0, normalized).UTC()).
+			WithField("Reason", reason).Debug("Implausible timestamp")
+	}
+	return normalized, reason
+}
+
+const (
+	normalizeEvent   = "normalize time"
+	implausibleEvent = "implausible time"
+)
+
+// HandleUplink normalizes the time in the gateway metadata of uplink messages
+func (t *Timestamp) HandleUplink(_ middleware.Context, msg *types.UplinkMessage) error {
+	metadata := &msg.Message.GatewayMetadata
+	if metadata.Time == 0 {
+		return nil
+	}
+	original := metadata.Time
+	normalized, reason := t.observe("uplink", msg.GatewayID, original)
+	metadata.Time = normalized
+	if normalized != original && types.Tracing(types.TraceVerbose) {
+		msg.Message.Trace = msg.Message.Trace.WithEvent(normalizeEvent, "original", original, "normalized", normalized)
+	}
+	if reason != "" && types.Tracing(types.TraceBasic) {
+		msg.Message.Trace = msg.Message.Trace.WithEvent(implausibleEvent, "time", normalized, "reason", reason)
+	}
+	return nil
+}
+
+// HandleStatus normalizes the time of status messages. Status messages have no trace, so corrections are logged.
+func (t *Timestamp) HandleStatus(_ middleware.Context, msg *types.StatusMessage) error {
+	if msg.Message == nil || msg.Message.Time == 0 {
+		return nil
+	}
+	original := msg.Message.Time
+	msg.Message.Time, _ = t.observe("status", msg.GatewayID, original)
+	if msg.Message.Time != original {
+		t.log.WithField("GatewayID", msg.GatewayID).WithField("Backend", msg.Backend).
+			WithField("Original", original).WithField("Normalized", msg.Message.Time).Debug("Normalized status time")
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package timestamp
+
+import (
+	"testing"
+	"time"
+
+	pb_gateway "github.com/TheThingsNetwork/api/gateway"
+	pb_router "github.com/TheThingsNetwork/api/router"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/middleware"
+	"github.com/TheThingsNetwork/gateway-connector-bridge/types"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseFormat(t *testing.T) {
+	Convey("Given format configurations", t, func(c C) {
+		Convey("An epoch with a unit should be parsed", func() {
+			format, err := ParseFormat("gps/ms")
+			So(err, ShouldBeNil)
+			So(format, ShouldResemble, Format{Epoch: EpochGPS, Unit: time.Millisecond})
+		})
+		Convey("Local timestamps with a detected unit should be parsed", func() {
+			format, err := ParseFormat("Unix/auto/local")
+			So(err, ShouldBeNil)
+			So(format, ShouldResemble, Format{Epoch: EpochUnix, Local: true})
+		})
+		Convey("Invalid formats should return an error", func() {
+			for _, format := range []string{"unix", "mars/s", "unix/h", "unix/s/utc", "gps/auto", "unix/s/local/x"} {
+				_, err := ParseFormat(format)
+				So(err, ShouldNotBeNil)
+			}
+		})
+	})
+}
+
+func TestTimestamp(t *testing.T) {
+	Convey("Given a new Timestamp", t, func(c C) {
+		amsterdam, _ := time.LoadLocation("Europe/Amsterdam")
+		now := time.Date(2017, time.June, 1, 12, 0, 0, 0, time.UTC)
+
+		s := NewTimestamp().
+			WithGateway("gps", Format{Epoch: EpochGPS, Unit: time.Second}).
+			WithGateway("local", Format{Epoch: EpochUnix, Unit: time.Second, Local: true}).
+			WithTimezoneFunc(func(gatewayID string) *time.Location {
+				if gatewayID == "local" {
+					return amsterdam
+				}
+				return nil
+			})
+
+		uplink := func(gatewayID string, value int64) *types.UplinkMessage {
+			msg := &types.UplinkMessage{
+				GatewayID: gatewayID,
+				Message:   &pb_router.UplinkMessage{GatewayMetadata: pb_gateway.RxMetadata{Time: value}},
+			}
+			So(s.HandleUplink(middleware.NewContext(), msg), ShouldBeNil)
+			return msg
+		}
+
+		Convey("The unit of Unix timestamps should be detected", func() {
+			for _, value := range []int64{now.Unix(), now.UnixNano() / 1e6, now.UnixNano() / 1e3, now.UnixNano()} {
+				So(uplink("dev", value).Message.GatewayMetadata.Time, ShouldEqual, now.UnixNano())
+			}
+		})
+
+		Convey("GPS timestamps should be converted to the Unix epoch", func() {
+			gps := now.Unix() - 315964800 + 18
+			So(uplink("GPS", gps).Message.GatewayMetadata.Time, ShouldEqual, now.UnixNano())
+		})
+
+		Convey("Local timestamps should be converted to UTC with the time zone of the gateway", func() {
+			wallClock := time.Date(2017, time.June, 1, 14, 0, 0, 0, time.UTC)
+			So(uplink("local", wallClock.Unix()).Message.GatewayMetadata.Time, ShouldEqual, now.UnixNano())
+		})
+
+		Convey("Uplinks without time should not be changed", func() {
+			So(uplink("dev", 0).Message.GatewayMetadata.Time, ShouldEqual, 0)
+			So(s.HandleUplink(middleware.NewContext(), &types.UplinkMessage{Message: &pb_router.UplinkMessage{}}), ShouldBeNil)
+		})
+
+		Convey("Implausible timestamps should be kept", func() {
+			past := time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+			So(uplink("dev", past.Unix()).Message.GatewayMetadata.Time, ShouldEqual, past.UnixNano())
+			future := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+			So(uplink("dev", future.Unix()).Message.GatewayMetadata.Time, ShouldEqual, future.UnixNano())
+		})
+
+		Convey("The plausibility of timestamps should be checked", func() {
+			_, reason := s.normalize("dev", time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC).Unix())
+			So(reason, ShouldNotBeEmpty)
+			_, reason = s.normalize("dev", time.Now().Add(24*time.Hour).Unix())
+			So(reason, ShouldNotBeEmpty)
+			_, reason = s.normalize("dev", now.Unix())
+			So(reason, ShouldBeEmpty)
+			s.WithPlausibility(time.Time{}, 0)
+			_, reason = s.normalize("dev", time.Now().Add(24*time.Hour).Unix())
+			So(reason, ShouldBeEmpty)
+		})
+
+		Convey("The time of status messages should be normalized", func() {
+			status := &types.StatusMessage{GatewayID: "dev", Message: &pb_gateway.Status{Time: now.UnixNano() / 1e6}}
+			So(s.HandleStatus(middleware.NewContext(), status), ShouldBeNil)
+			So(status.Message.Time, ShouldEqual, now.UnixNano())
+		})
+
+		Convey("The default format should be used for gateways without a format", func() {
+			s.WithDefault(Format{Epoch: EpochGPS, Unit: time.Millisecond})
+			gps := (now.Unix() - 315964800 + 18) * 1000
+			So(uplink("dev", gps).Message.GatewayMetadata.Time, ShouldEqual, now.UnixNano())
+		})
+	})
+}
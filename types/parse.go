@@ -0,0 +1,104 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package types
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/TheThingsNetwork/api/gateway"
+	"github.com/TheThingsNetwork/api/router"
+	"github.com/gogo/protobuf/proto"
+)
+
+// MaxMessageSize is the maximum size of a protocol buffer that is received from a connector
+var MaxMessageSize = 64 * 1024
+
+// MaxGatewayIDLength is the maximum length of the gateway ID in connect and disconnect messages
+var MaxGatewayIDLength = 128
+
+// Errors returned by the parsers
+var (
+	ErrMessageTooLarge  = errors.New("types: message too large")
+	ErrMalformedMessage = errors.New("types: malformed message")
+	ErrInvalidGatewayID = errors.New("types: invalid gateway ID")
+)
+
+// unmarshal unmarshals the protocol buffer into msg, and returns ErrMalformedMessage instead of panicking on
+// invalid data
+func unmarshal(data []byte, msg proto.Message) (err error) {
+	if len(data) > MaxMessageSize {
+		return fmt.Errorf("%w: %d bytes", ErrMessageTooLarge, len(data))
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", ErrMalformedMessage, r)
+		}
+	}()
+	if err := proto.Unmarshal(data, msg); err != nil {
+		return fmt.Errorf("%w: %w", ErrMalformedMessage, err)
+	}
+	return nil
+}
+
+func validateGatewayID(gatewayID string) error {
+	if gatewayID == "" {
+		return fmt.Errorf("%w: empty", ErrInvalidGatewayID)
+	}
+	if len(gatewayID) > MaxGatewayIDLength {
+		return fmt.Errorf("%w: longer than %d characters", ErrInvalidGatewayID, MaxGatewayIDLength)
+	}
+	return nil
+}
+
+// ParseConnect parses a connect message received from a connector
+func ParseConnect(data []byte) (*ConnectMessage, error) {
+	msg := new(ConnectMessage)
+	if err := unmarshal(data, msg); err != nil {
+		return nil, err
+	}
+	if err := validateGatewayID(msg.GatewayID); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// ParseDisconnect parses a disconnect message received from a connector
+func ParseDisconnect(data []byte) (*DisconnectMessage, error) {
+	msg := new(DisconnectMessage)
+	if err := unmarshal(data, msg); err != nil {
+		return nil, err
+	}
+	if err := validateGatewayID(msg.GatewayID); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// ParseUplink parses an uplink message received from a connector
+func ParseUplink(data []byte) (*router.UplinkMessage, error) {
+	msg := new(router.UplinkMessage)
+	if err := unmarshal(data, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// ParseDownlink parses a downlink message received from a server up the chain
+func ParseDownlink(data []byte) (*router.DownlinkMessage, error) {
+	msg := new(router.DownlinkMessage)
+	if err := unmarshal(data, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// ParseStatus parses a gateway status message received from a connector
+func ParseStatus(data []byte) (*gateway.Status, error) {
+	msg := new(gateway.Status)
+	if err := unmarshal(data, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
@@ -0,0 +1,85 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package types
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/TheThingsNetwork/api/gateway"
+	"github.com/TheThingsNetwork/api/router"
+	"github.com/gogo/protobuf/proto"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestParse(t *testing.T) {
+	Convey("Given valid messages", t, func(c C) {
+		connect, _ := proto.Marshal(&ConnectMessage{GatewayID: "dev", Key: "key"})
+		uplink, _ := proto.Marshal(&router.UplinkMessage{Payload: []byte{1, 2, 3}})
+		status, _ := proto.Marshal(&gateway.Status{Platform: "Kerlink"})
+		downlink, _ := proto.Marshal(&router.DownlinkMessage{Payload: []byte{4, 5, 6}})
+
+		Convey("They should be parsed", func() {
+			msg, err := ParseConnect(connect)
+			So(err, ShouldBeNil)
+			So(msg.GatewayID, ShouldEqual, "dev")
+			up, err := ParseUplink(uplink)
+			So(err, ShouldBeNil)
+			So(up.Payload, ShouldResemble, []byte{1, 2, 3})
+			st, err := ParseStatus(status)
+			So(err, ShouldBeNil)
+			So(st.Platform, ShouldEqual, "Kerlink")
+			down, err := ParseDownlink(downlink)
+			So(err, ShouldBeNil)
+			So(down.Payload, ShouldResemble, []byte{4, 5, 6})
+		})
+	})
+
+	Convey("Given invalid messages", t, func(c C) {
+		Convey("Truncated messages should be malformed", func() {
+			connect, _ := proto.Marshal(&ConnectMessage{GatewayID: "dev"})
+			_, err := ParseConnect(connect[:len(connect)-1])
+			So(errors.Is(err, ErrMalformedMessage), ShouldBeTrue)
+		})
+		Convey("Connect messages without gateway ID should be invalid", func() {
+			_, err := ParseDisconnect(nil)
+			So(errors.Is(err, ErrInvalidGatewayID), ShouldBeTrue)
+			long, _ := proto.Marshal(&ConnectMessage{GatewayID: strings.Repeat("a", MaxGatewayIDLength+1)})
+			_, err = ParseConnect(long)
+			So(errors.Is(err, ErrInvalidGatewayID), ShouldBeTrue)
+		})
+		Convey("Large messages should be rejected", func() {
+			_, err := ParseUplink(make([]byte, MaxMessageSize+1))
+			So(errors.Is(err, ErrMessageTooLarge), ShouldBeTrue)
+		})
+	})
+}
+
+func FuzzParse(f *testing.F) {
+	connect, _ := proto.Marshal(&ConnectMessage{GatewayID: "dev", Key: "key", Network: "ttn"})
+	uplink, _ := proto.Marshal(&router.UplinkMessage{Payload: []byte{1, 2, 3}})
+	status, _ := proto.Marshal(&gateway.Status{Platform: "Kerlink", Location: &gateway.LocationMetadata{Latitude: 1}})
+	f.Add(connect)
+	f.Add(uplink)
+	f.Add(status)
+	f.Add([]byte{0xff, 0xff, 0xff})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if msg, err := ParseConnect(data); (msg == nil) == (err == nil) {
+			t.Fatalf("ParseConnect returned %v, %v", msg, err)
+		}
+		if msg, err := ParseDisconnect(data); (msg == nil) == (err == nil) {
+			t.Fatalf("ParseDisconnect returned %v, %v", msg, err)
+		}
+		if msg, err := ParseUplink(data); (msg == nil) == (err == nil) {
+			t.Fatalf("ParseUplink returned %v, %v", msg, err)
+		}
+		if msg, err := ParseStatus(data); (msg == nil) == (err == nil) {
+			t.Fatalf("ParseStatus returned %v, %v", msg, err)
+		}
+		if msg, err := ParseDownlink(data); (msg == nil) == (err == nil) {
+			t.Fatalf("ParseDownlink returned %v, %v", msg, err)
+		}
+	})
+}
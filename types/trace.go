@@ -0,0 +1,66 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package types
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/TheThingsNetwork/api/trace"
+)
+
+// TraceLevel is the verbosity of the trace events that are recorded in messages
+type TraceLevel int32
+
+// Trace levels. At TraceBasic, only events of backends (receive, forward) and drops are recorded. At TraceVerbose,
+// events of middleware that changes messages (such as injection) are recorded as well.
+const (
+	TraceOff TraceLevel = iota
+	TraceBasic
+	TraceVerbose
+)
+
+func (l TraceLevel) String() string {
+	switch l {
+	case TraceOff:
+		return "off"
+	case TraceBasic:
+		return "basic"
+	case TraceVerbose:
+		return "verbose"
+	}
+	return fmt.Sprintf("TraceLevel(%d)", int32(l))
+}
+
+// ParseTraceLevel parses "off", "basic" or "verbose"
+func ParseTraceLevel(level string) (TraceLevel, error) {
+	for _, l := range []TraceLevel{TraceOff, TraceBasic, TraceVerbose} {
+		if l.String() == level {
+			return l, nil
+		}
+	}
+	return TraceOff, fmt.Errorf("types: invalid trace level %q", level)
+}
+
+var traceLevel = int32(TraceVerbose)
+
+// SetTraceLevel sets the trace level of the bridge
+func SetTraceLevel(level TraceLevel) {
+	atomic.StoreInt32(&traceLevel, int32(level))
+}
+
+// Tracing returns whether events of the given level should be recorded. Callers should check this before building
+// the event, so that no allocations are made when tracing is disabled.
+func Tracing(level TraceLevel) bool {
+	return level > TraceOff && atomic.LoadInt32(&traceLevel) >= int32(level)
+}
+
+// TraceID returns the ID of the first event of the trace, which identifies the message that the trace belongs to. It
+// returns an empty string if there is no trace.
+func TraceID(t *trace.Trace) string {
+	if ids := t.GetIDs(); len(ids) > 0 {
+		return ids[0]
+	}
+	return ""
+}
@@ -0,0 +1,41 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package types
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTraceLevel(t *testing.T) {
+	Convey("Given the trace levels", t, func(c C) {
+		Reset(func() { SetTraceLevel(TraceVerbose) })
+
+		Convey("By default, all events should be recorded", func() {
+			So(Tracing(TraceBasic), ShouldBeTrue)
+			So(Tracing(TraceVerbose), ShouldBeTrue)
+		})
+
+		Convey("At basic level, verbose events should not be recorded", func() {
+			SetTraceLevel(TraceBasic)
+			So(Tracing(TraceBasic), ShouldBeTrue)
+			So(Tracing(TraceVerbose), ShouldBeFalse)
+		})
+
+		Convey("When tracing is off, no events should be recorded", func() {
+			SetTraceLevel(TraceOff)
+			So(Tracing(TraceBasic), ShouldBeFalse)
+			So(Tracing(TraceOff), ShouldBeFalse)
+		})
+
+		Convey("Trace levels should be parsed", func() {
+			level, err := ParseTraceLevel("basic")
+			So(err, ShouldBeNil)
+			So(level, ShouldEqual, TraceBasic)
+			_, err = ParseTraceLevel("debug")
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/TheThingsNetwork/api/gateway"
 	"github.com/TheThingsNetwork/api/router"
+	"github.com/gogo/protobuf/proto"
 )
 
 // UplinkMessage is used internally
@@ -15,12 +16,71 @@ type UplinkMessage struct {
 	GatewayID   string
 	GatewayAddr net.Addr
 	Message     *router.UplinkMessage
+
+	// Attributes contains metadata that has no field in the uplink message, such as operator-defined tags.
+	// Attributes are available to middleware and to backends that publish them, but are not sent to the TTN router.
+	Attributes map[string]string `json:",omitempty"`
+}
+
+// Clone returns a deep copy of the uplink message, which can be modified without affecting the original
+func (msg *UplinkMessage) Clone() *UplinkMessage {
+	clone := *msg
+	if msg.Message != nil {
+		clone.Message = proto.Clone(msg.Message).(*router.UplinkMessage)
+	}
+	if msg.Attributes != nil {
+		clone.Attributes = make(map[string]string, len(msg.Attributes))
+		for key, value := range msg.Attributes {
+			clone.Attributes[key] = value
+		}
+	}
+	return &clone
 }
 
 // DownlinkMessage is used internally
 type DownlinkMessage struct {
 	GatewayID string
 	Message   *router.DownlinkMessage
+
+	// Attributes contains metadata that has no field in the downlink message, such as operator-defined tags.
+	// Attributes are available to middleware and to backends that publish them (such as AMQP message headers), but
+	// are not part of the downlink message that the gateway decodes.
+	Attributes map[string]string `json:",omitempty"`
+}
+
+// ID returns the ID that identifies the downlink message in its acknowledgement, which is the ID of its trace. It
+// returns an empty string if the downlink message has no trace.
+func (msg *DownlinkMessage) ID() string {
+	if msg.Message == nil {
+		return ""
+	}
+	return TraceID(msg.Message.Trace)
+}
+
+// DownlinkAckMessage is used internally. Southbound backends that receive confirmations of downlink messages from
+// gateways emit it, and the Exchange routes it to the backends that publish it.
+type DownlinkAckMessage struct {
+	GatewayID string
+
+	// DownlinkID is the ID of the acknowledged downlink message (see DownlinkMessage.ID). It is empty if the
+	// downlink message has no ID, or if the acknowledgement could not be matched to a downlink message.
+	DownlinkID string `json:",omitempty"`
+
+	// Error is empty if the gateway accepted the downlink message for transmission, and otherwise contains the
+	// reason why the gateway rejected it, such as "TOO_LATE" or "COLLISION_PACKET".
+	Error string `json:",omitempty"`
+
+	// Attributes contains metadata of the acknowledgement. Attributes are available to backends that publish them.
+	Attributes map[string]string `json:",omitempty"`
+}
+
+// ConnectResponseMessage is used internally. It contains the gateway information that was resolved for a connect
+// message, which southbound backends that support it send back to the gateway, so that it can verify its
+// registration.
+type ConnectResponseMessage struct {
+	GatewayID     string                    `json:"gateway_id"`
+	FrequencyPlan string                    `json:"frequency_plan,omitempty"`
+	Location      *gateway.LocationMetadata `json:"location,omitempty"`
 }
 
 // StatusMessage is used internally
@@ -29,4 +89,8 @@ type StatusMessage struct {
 	GatewayID   string
 	GatewayAddr net.Addr
 	Message     *gateway.Status
+
+	// Attributes contains metadata that has no field in the gateway status, such as flags from the account server.
+	// Attributes are available to middleware and to backends that publish them, but are not sent to the TTN router.
+	Attributes map[string]string `json:",omitempty"`
 }
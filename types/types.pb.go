@@ -34,6 +34,7 @@ const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
 type ConnectMessage struct {
 	GatewayID string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
 	Key       string `protobuf:"bytes,3,opt,name=key,proto3" json:"key,omitempty"`
+	Network   string `protobuf:"bytes,4,opt,name=network,proto3" json:"network,omitempty"`
 }
 
 func (m *ConnectMessage) Reset()                    { *m = ConnectMessage{} }
@@ -55,9 +56,17 @@ func (m *ConnectMessage) GetKey() string {
 	return ""
 }
 
+func (m *ConnectMessage) GetNetwork() string {
+	if m != nil {
+		return m.Network
+	}
+	return ""
+}
+
 type DisconnectMessage struct {
 	GatewayID string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
 	Key       string `protobuf:"bytes,3,opt,name=key,proto3" json:"key,omitempty"`
+	Network   string `protobuf:"bytes,4,opt,name=network,proto3" json:"network,omitempty"`
 }
 
 func (m *DisconnectMessage) Reset()                    { *m = DisconnectMessage{} }
@@ -79,6 +88,13 @@ func (m *DisconnectMessage) GetKey() string {
 	return ""
 }
 
+func (m *DisconnectMessage) GetNetwork() string {
+	if m != nil {
+		return m.Network
+	}
+	return ""
+}
+
 func init() {
 	proto.RegisterType((*ConnectMessage)(nil), "types.ConnectMessage")
 	proto.RegisterType((*DisconnectMessage)(nil), "types.DisconnectMessage")
@@ -110,6 +126,12 @@ func (m *ConnectMessage) MarshalTo(dAtA []byte) (int, error) {
 		i = encodeVarintTypes(dAtA, i, uint64(len(m.Key)))
 		i += copy(dAtA[i:], m.Key)
 	}
+	if len(m.Network) > 0 {
+		dAtA[i] = 0x22
+		i++
+		i = encodeVarintTypes(dAtA, i, uint64(len(m.Network)))
+		i += copy(dAtA[i:], m.Network)
+	}
 	return i, nil
 }
 
@@ -140,6 +162,12 @@ func (m *DisconnectMessage) MarshalTo(dAtA []byte) (int, error) {
 		i = encodeVarintTypes(dAtA, i, uint64(len(m.Key)))
 		i += copy(dAtA[i:], m.Key)
 	}
+	if len(m.Network) > 0 {
+		dAtA[i] = 0x22
+		i++
+		i = encodeVarintTypes(dAtA, i, uint64(len(m.Network)))
+		i += copy(dAtA[i:], m.Network)
+	}
 	return i, nil
 }
 
@@ -181,6 +209,10 @@ func (m *ConnectMessage) Size() (n int) {
 	if l > 0 {
 		n += 1 + l + sovTypes(uint64(l))
 	}
+	l = len(m.Network)
+	if l > 0 {
+		n += 1 + l + sovTypes(uint64(l))
+	}
 	return n
 }
 
@@ -195,6 +227,10 @@ func (m *DisconnectMessage) Size() (n int) {
 	if l > 0 {
 		n += 1 + l + sovTypes(uint64(l))
 	}
+	l = len(m.Network)
+	if l > 0 {
+		n += 1 + l + sovTypes(uint64(l))
+	}
 	return n
 }
 
@@ -298,6 +334,35 @@ func (m *ConnectMessage) Unmarshal(dAtA []byte) error {
 			}
 			m.Key = string(dAtA[iNdEx:postIndex])
 			iNdEx = postIndex
+		case 4:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Network", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTypes
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthTypes
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Network = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipTypes(dAtA[iNdEx:])
@@ -406,6 +471,35 @@ func (m *DisconnectMessage) Unmarshal(dAtA []byte) error {
 			}
 			m.Key = string(dAtA[iNdEx:postIndex])
 			iNdEx = postIndex
+		case 4:
+			if wireType != 2 {
+				return fmt.Errorf("proto: wrong wireType = %d for field Network", wireType)
+			}
+			var stringLen uint64
+			for shift := uint(0); ; shift += 7 {
+				if shift >= 64 {
+					return ErrIntOverflowTypes
+				}
+				if iNdEx >= l {
+					return io.ErrUnexpectedEOF
+				}
+				b := dAtA[iNdEx]
+				iNdEx++
+				stringLen |= (uint64(b) & 0x7F) << shift
+				if b < 0x80 {
+					break
+				}
+			}
+			intStringLen := int(stringLen)
+			if intStringLen < 0 {
+				return ErrInvalidLengthTypes
+			}
+			postIndex := iNdEx + intStringLen
+			if postIndex > l {
+				return io.ErrUnexpectedEOF
+			}
+			m.Network = string(dAtA[iNdEx:postIndex])
+			iNdEx = postIndex
 		default:
 			iNdEx = preIndex
 			skippy, err := skipTypes(dAtA[iNdEx:])
@@ -537,19 +631,19 @@ func init() {
 }
 
 var fileDescriptorTypes = []byte{
-	// 212 bytes of a gzipped FileDescriptorProto
+	// 222 bytes of a gzipped FileDescriptorProto
 	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0x72, 0x4b, 0xcf, 0x2c, 0xc9,
 	0x28, 0x4d, 0xd2, 0x4b, 0xce, 0xcf, 0xd5, 0x0f, 0xc9, 0x48, 0x0d, 0xc9, 0xc8, 0xcc, 0x4b, 0x2f,
 	0xf6, 0x4b, 0x2d, 0x29, 0xcf, 0x2f, 0xca, 0xd6, 0x4f, 0x4f, 0x2c, 0x49, 0x2d, 0x4f, 0xac, 0xd4,
 	0x4d, 0xce, 0xcf, 0xcb, 0x4b, 0x4d, 0x2e, 0xc9, 0x2f, 0xd2, 0x4d, 0x2a, 0xca, 0x4c, 0x49, 0x4f,
 	0xd5, 0x2f, 0xa9, 0x2c, 0x48, 0x2d, 0x86, 0x90, 0x7a, 0x05, 0x45, 0xf9, 0x25, 0xf9, 0x42, 0xac,
 	0x60, 0x8e, 0x94, 0x2e, 0x92, 0x71, 0xe9, 0xf9, 0xe9, 0xf9, 0xfa, 0x60, 0xd9, 0xa4, 0xd2, 0x34,
-	0x30, 0x0f, 0xcc, 0x01, 0xb3, 0x20, 0xba, 0x94, 0x1c, 0xb9, 0xf8, 0x9c, 0x21, 0x66, 0xfb, 0xa6,
+	0x30, 0x0f, 0xcc, 0x01, 0xb3, 0x20, 0xba, 0x94, 0xa2, 0xb9, 0xf8, 0x9c, 0x21, 0x66, 0xfb, 0xa6,
 	0x16, 0x17, 0x27, 0xa6, 0xa7, 0x0a, 0xc9, 0x72, 0x31, 0x65, 0xa6, 0x48, 0x30, 0x2a, 0x30, 0x6a,
 	0x70, 0x3a, 0xf1, 0x3e, 0xba, 0x27, 0xcf, 0xe9, 0x0e, 0x71, 0x83, 0xa7, 0x4b, 0x10, 0x53, 0x66,
-	0x8a, 0x90, 0x00, 0x17, 0x73, 0x76, 0x6a, 0xa5, 0x04, 0x33, 0x48, 0x3e, 0x08, 0xc4, 0x54, 0x72,
-	0xe1, 0x12, 0x74, 0xc9, 0x2c, 0x4e, 0xa6, 0xcc, 0x14, 0x27, 0x9f, 0x13, 0x8f, 0xe4, 0x18, 0x2f,
-	0x3c, 0x92, 0x63, 0x7c, 0xf0, 0x48, 0x8e, 0x71, 0xc6, 0x63, 0x39, 0x86, 0x28, 0x2b, 0xf2, 0x03,
-	0x26, 0x89, 0x0d, 0xec, 0x3b, 0x63, 0x40, 0x00, 0x00, 0x00, 0xff, 0xff, 0xa4, 0x6a, 0x11, 0x6d,
-	0x5d, 0x01, 0x00, 0x00,
+	0x8a, 0x90, 0x00, 0x17, 0x73, 0x76, 0x6a, 0xa5, 0x04, 0x33, 0x48, 0x3e, 0x08, 0xc4, 0x14, 0x92,
+	0xe0, 0x62, 0xcf, 0x83, 0x38, 0x57, 0x82, 0x05, 0x2c, 0x0a, 0xe3, 0x2a, 0xc5, 0x71, 0x09, 0xba,
+	0x64, 0x16, 0x27, 0xd3, 0xca, 0x7c, 0x27, 0x9f, 0x13, 0x8f, 0xe4, 0x18, 0x2f, 0x3c, 0x92, 0x63,
+	0x7c, 0xf0, 0x48, 0x8e, 0x71, 0xc6, 0x63, 0x39, 0x86, 0x28, 0x2b, 0xf2, 0x03, 0x33, 0x89, 0x0d,
+	0x1c, 0x22, 0xc6, 0x80, 0x01, 0x00, 0x85, 0x37, 0xdc, 0x44, 0x91, 0x01, 0x00, 0x00,
 }
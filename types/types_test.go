@@ -0,0 +1,46 @@
+// Copyright © 2017 The Things Network
+// Use of this source code is governed by the MIT license that can be found in the LICENSE file.
+
+package types
+
+import (
+	"testing"
+
+	"github.com/TheThingsNetwork/api/router"
+	"github.com/gogo/protobuf/proto"
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestConnectMessage(t *testing.T) {
+	Convey("Given a ConnectMessage with a network", t, func(c C) {
+		msg := &ConnectMessage{GatewayID: "dev", Key: "key", Network: "network"}
+		Convey("It should survive a marshal/unmarshal roundtrip", func() {
+			data, err := proto.Marshal(msg)
+			So(err, ShouldBeNil)
+			var res ConnectMessage
+			So(proto.Unmarshal(data, &res), ShouldBeNil)
+			So(res, ShouldResemble, *msg)
+		})
+	})
+}
+
+func TestUplinkMessageClone(t *testing.T) {
+	Convey("Given an UplinkMessage", t, func(c C) {
+		msg := &UplinkMessage{GatewayID: "dev", Message: &router.UplinkMessage{Payload: []byte{1, 2, 3}}}
+		Convey("Its clone should not share the message", func() {
+			clone := msg.Clone()
+			So(clone.GatewayID, ShouldEqual, "dev")
+			clone.Message.Payload[0] = 42
+			So(msg.Message.Payload[0], ShouldEqual, 1)
+		})
+		Convey("Its clone should not share the attributes", func() {
+			msg.Attributes = map[string]string{"site": "rooftop"}
+			clone := msg.Clone()
+			clone.Attributes["site"] = "basement"
+			So(msg.Attributes["site"], ShouldEqual, "rooftop")
+		})
+		Convey("A message without protocol message should be cloned", func() {
+			So((&UplinkMessage{GatewayID: "dev"}).Clone().Message, ShouldBeNil)
+		})
+	})
+}